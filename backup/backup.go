@@ -18,25 +18,38 @@ import (
  */
 func initializeFlags(cmd *cobra.Command) {
 	backupDir = cmd.Flags().String("backup-dir", "", "The absolute path of the directory to which all backup files will be written")
-	compressionLevel = cmd.Flags().Int("compression-level", 0, "Level of compression to use during data backup. Valid values are between 1 and 9.")
+	compressionLevel = cmd.Flags().Int("compression-level", 0, "Level of compression to use during data backup. Valid values are between 1 and 9 for gzip, 1 and 12 for lz4, and 1 and 19 for zstd.")
+	compressionType = cmd.Flags().String("compression-type", "gzip", "Type of compression to use during data backup. Valid values are gzip, lz4, zstd, and none.")
 	dataOnly = cmd.Flags().Bool("data-only", false, "Only back up data, do not back up metadata")
 	dbname = cmd.Flags().String("dbname", "", "The database to be backed up")
 	debug = cmd.Flags().Bool("debug", false, "Print verbose and debug log messages")
+	encryptionKeyFile = cmd.Flags().String("encryption-key-file", "", "The absolute path of a file containing the key or passphrase with which to encrypt backup files, after a first line of format=hex or format=passphrase.  The file must exist at the same path on every host.")
+	excludeRoles = cmd.Flags().StringSlice("exclude-role", []string{}, "Back up all roles except the specified role(s), along with the role memberships of the other roles. Requires --globals-only. --exclude-role can be specified multiple times.")
 	excludeSchemas = cmd.Flags().StringSlice("exclude-schema", []string{}, "Back up all metadata except objects in the specified schema(s). --exclude-schema can be specified multiple times.")
 	excludeTables = cmd.Flags().StringSlice("exclude-table", []string{}, "Back up all metadata except the specified table(s). --exclude-table can be specified multiple times.")
 	excludeTableFile = cmd.Flags().String("exclude-table-file", "", "A file containing a list of fully-qualified tables to be excluded from the backup")
+	format = cmd.Flags().String("format", "directory", "The format of the backup: \"directory\" to write data files on each segment for gprestore, or \"plain\" to write a single SQL script that can be restored with psql.  A plain backup cannot be the base of an incremental backup")
+	fromTimestamp = cmd.Flags().String("from-timestamp", "", "A timestamp to use as the base for an incremental backup")
+	globalsOnly = cmd.Flags().Bool("globals-only", false, "Only back up global metadata, such as roles, role memberships, resource queues and groups, tablespaces, and database configuration, without gathering or locking tables")
 	cmd.Flags().Bool("help", false, "Help for gpbackup")
+	includeRoles = cmd.Flags().StringSlice("include-role", []string{}, "Back up only the specified role(s), along with the role memberships between them. Requires --globals-only. --include-role can be specified multiple times.")
 	includeSchemas = cmd.Flags().StringSlice("include-schema", []string{}, "Back up only the specified schema(s). --include-schema can be specified multiple times.")
 	includeTables = cmd.Flags().StringSlice("include-table", []string{}, "Back up only the specified table(s). --include-table can be specified multiple times.")
 	includeTableFile = cmd.Flags().String("include-table-file", "", "A file containing a list of fully-qualified tables to be included in the backup")
+	incremental = cmd.Flags().Bool("incremental", false, "Only back up data for append-optimized tables that have been modified since the last backup")
 	numJobs = cmd.Flags().Int("jobs", 1, "The number of parallel connections to use when backing up data")
 	leafPartitionData = cmd.Flags().Bool("leaf-partition-data", false, "For partition tables, create one data file per leaf partition instead of one data file for the whole table")
+	lockRetries = cmd.Flags().Int("lock-retries", 0, "The number of times to retry acquiring table locks that time out.  Requires --lock-wait-timeout.")
+	lockWaitTimeout = cmd.Flags().Int("lock-wait-timeout", 0, "The number of seconds to wait to acquire table locks before timing out.  The default of 0 waits indefinitely.")
+	maskingPolicyFile = cmd.Flags().String("masking-policy-file", "", "A YAML file mapping columns of fully-qualified tables to masking functions (hash, nullify, fixed, or expression), which are applied to the data as it is backed up.  A masked backup cannot be the base of an incremental backup")
 	metadataOnly = cmd.Flags().Bool("metadata-only", false, "Only back up metadata, do not back up data")
 	noCompression = cmd.Flags().Bool("no-compression", false, "Disable compression of data files")
 	pluginConfigFile = cmd.Flags().String("plugin-config", "", "The configuration file to use for a plugin")
 	cmd.Flags().Bool("version", false, "Print version number and exit")
 	quiet = cmd.Flags().Bool("quiet", false, "Suppress non-warning, non-error log messages")
+	resume = cmd.Flags().String("resume", "", "The timestamp of an interrupted backup to finish.  The other flags must be the same as those the backup was started with.")
 	singleDataFile = cmd.Flags().Bool("single-data-file", false, "Back up all data to a single file instead of one per table")
+	tableFilterFile = cmd.Flags().String("table-filter-file", "", "A YAML file mapping fully-qualified tables to SQL predicates, so that only the rows of each table matching its predicate are backed up.  A backup with filtered rows cannot be the base of an incremental backup")
 	verbose = cmd.Flags().Bool("verbose", false, "Print verbose log messages")
 	withStats = cmd.Flags().Bool("with-stats", false, "Back up query plan statistics")
 
@@ -55,15 +68,20 @@ func DoInit(cmd *cobra.Command) {
 func DoFlagValidation(cmd *cobra.Command) {
 	ValidateFlagCombinations(cmd.Flags())
 	ValidateFlagValues()
+	journalFlags = utils.GetJournalFlags(cmd.Flags())
 }
 
 // This function handles setup that must be done after parsing flags.
 func DoSetup() {
 	SetLoggerVerbosity()
 	timestamp := utils.CurrentTimestamp()
-	utils.CreateBackupLockFile(timestamp)
-
-	gplog.Info("Starting backup of database %s", *dbname)
+	if *resume != "" {
+		timestamp = *resume
+		gplog.Info("Resuming backup %s of database %s", timestamp, *dbname)
+	} else {
+		utils.CreateBackupLockFile(timestamp)
+		gplog.Info("Starting backup of database %s", *dbname)
+	}
 	InitializeConnectionPool()
 
 	InitializeFilterLists()
@@ -72,9 +90,21 @@ func DoSetup() {
 
 	segConfig := cluster.MustGetSegmentConfiguration(connectionPool)
 	globalCluster = cluster.NewCluster(segConfig)
+	backupReport.SegmentCount = len(globalCluster.ContentIDs) - 1
 	segPrefix := utils.GetSegPrefix(connectionPool)
-	globalFPInfo = utils.NewFilePathInfo(globalCluster, *backupDir, timestamp, segPrefix)
+	fpInfo := utils.NewFilePathInfo(globalCluster, *backupDir, timestamp, segPrefix)
+	if *resume != "" {
+		InitializeResume(fpInfo)
+	}
+	globalFPInfo = fpInfo
 	CreateBackupDirectoriesOnAllHosts()
+	if !backupReport.MetadataOnly {
+		utils.VerifyCompressionProgramOnAllHosts(globalCluster)
+	}
+	if *encryptionKeyFile != "" && !backupReport.MetadataOnly {
+		utils.VerifyHelperVersionOnSegments(version, globalCluster)
+		utils.VerifyEncryptionKeyOnAllHosts(globalCluster)
+	}
 	globalTOC = &utils.TOC{}
 	globalTOC.InitializeEntryMap()
 
@@ -92,14 +122,39 @@ func DoBackup() {
 
 	objectCounts = make(map[string]int, 0)
 
-	metadataTables, dataTables, tableDefs := RetrieveAndProcessTables()
-	CheckTablesContainData(dataTables, tableDefs)
+	// A backup of global metadata does not need to gather or lock any tables
+	var metadataTables, dataTables []Relation
+	var tableDefs map[uint32]TableDefinition
+	if !*globalsOnly {
+		metadataTables, dataTables, tableDefs = RetrieveAndProcessTables()
+		CheckTablesContainData(dataTables, tableDefs)
+	}
+	/*
+	 * Any backup with one data file per leaf partition can serve as the base
+	 * for a later incremental backup, so we always record the state of its
+	 * append-optimized tables.  A backup whose rows were filtered or whose
+	 * columns were masked does not contain the data in those tables as it is,
+	 * and a plain backup has no data files, so these can never be a base.
+	 */
+	if *leafPartitionData && !backupReport.MetadataOnly && !backupReport.RowFiltered && backupReport.MaskingPolicyFingerprint == "" && *format != "plain" {
+		gplog.Verbose("Gathering append-optimized table information for incremental backups")
+		globalTOC.IncrementalMetadata.AO = GetAOIncrementalMetadata(connectionPool)
+	}
+	var previousTOC *utils.TOC
+	var unchangedTables []Relation
+	if *incremental && !backupReport.MetadataOnly {
+		previousTOC = GetIncrementalBaseTOC()
+		dataTables, unchangedTables = FilterTablesForIncremental(previousTOC, globalTOC, dataTables)
+		gplog.Info("Found %d unchanged append-optimized table(s) whose data will not be backed up", len(unchangedTables))
+	}
 	metadataFilename := globalFPInfo.GetMetadataFilePath()
 	gplog.Info("Metadata will be written to %s", metadataFilename)
 	metadataFile := utils.NewFileWithByteCountFromFile(metadataFilename)
 
 	BackupSessionGUCs(metadataFile)
-	if !*dataOnly {
+	if *globalsOnly {
+		backupGlobal(metadataFile)
+	} else if !*dataOnly {
 		if len(*includeTables) > 0 {
 			backupTablePredata(metadataFile, metadataTables, tableDefs)
 		} else {
@@ -114,19 +169,28 @@ func DoBackup() {
 	 * perform a metadata only backup if the database contains no tables
 	 * or only external tables
 	 */
-	if !backupReport.MetadataOnly {
+	if !backupReport.MetadataOnly && *format != "plain" {
 		backupData(dataTables, tableDefs)
+		if *incremental {
+			AddIncrementalDataEntriesToTOC(previousTOC, unchangedTables)
+		}
 	}
 
 	if *withStats {
 		backupStatistics(metadataTables)
 	}
 
+	metadataFile.Close()
+	if *format == "plain" {
+		WritePlainScript(metadataFilename, dataTables, tableDefs)
+	}
 	globalTOC.WriteToFileAndMakeReadOnly(globalFPInfo.GetTOCFilePath())
 	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
 		connectionPool.MustCommit(connNum)
 	}
-	metadataFile.Close()
+	if !wasTerminated {
+		backupReport.Checksums = GetMetadataFileChecksums()
+	}
 	if *pluginConfigFile != "" {
 		pluginConfig.BackupFile(metadataFilename)
 		pluginConfig.BackupFile(globalFPInfo.GetTOCFilePath())
@@ -249,28 +313,58 @@ func backupTablePredata(metadataFile *utils.FileWithByteCount, tables []Relation
 }
 
 func backupData(tables []Relation, tableDefs map[uint32]TableDefinition) {
+	if len(tables) == 0 {
+		// This can only happen with an incremental backup if no tables have changed
+		gplog.Info("No tables have changed since the previous backup; skipping data backup")
+		return
+	}
+	if maskingPolicy != nil {
+		ValidateMaskingPolicy(tables, tableDefs)
+	}
+	// gpbackup_helper writes the data files whether or not there is a single data file
+	utils.VerifyHelperVersionOnSegments(version, globalCluster)
 	if *singleDataFile {
 		gplog.Verbose("Initializing pipes and gpbackup_helper on segments for single data file backup")
-		utils.VerifyHelperVersionOnSegments(version, globalCluster)
 		oidList := make([]string, len(tables))
 		for i, table := range tables {
 			oidList[i] = fmt.Sprintf("%d", table.Oid)
 		}
 		utils.WriteOidListToSegments(oidList, globalCluster, globalFPInfo)
-		firstOid := tables[0].Oid
-		utils.CreateFirstSegmentPipeOnAllHosts(firstOid, globalCluster, globalFPInfo)
-		compressStr := fmt.Sprintf(" --compression-level %d", *compressionLevel)
-		if !*noCompression && *compressionLevel == 0 {
-			compressStr = " --compression-level 1"
+		firstOids := make([]uint32, 0)
+		for _, streamTables := range GetTablesByStream(tables) {
+			if len(streamTables) > 0 {
+				firstOids = append(firstOids, streamTables[0].Oid)
+			}
+		}
+		utils.CreateFirstSegmentPipesOnAllHosts(firstOids, globalCluster, globalFPInfo)
+		helperFlagsStr := fmt.Sprintf(" --data-streams %d", connectionPool.NumConns)
+		if usingCompression, compression := utils.GetCompressionParameters(); usingCompression {
+			helperFlagsStr += fmt.Sprintf(" --compression-type %s --compression-level %d", compression.Name, compression.Level)
+		} else {
+			helperFlagsStr += " --compression-level 0"
+		}
+		utils.StartAgent(globalCluster, globalFPInfo, "--backup-agent", *pluginConfigFile, helperFlagsStr)
+	}
+	tablesToBackUp := tables
+	resumedRowsCopied := make(map[uint32]int64, 0)
+	if *resume != "" {
+		tablesToBackUp, resumedRowsCopied = GetTablesToResume(tables, tableDefs)
+		if len(resumedRowsCopied) > 0 {
+			backupReport.TransactionConsistency = "No, some tables were backed up before the backup was resumed"
 		}
-		utils.StartAgent(globalCluster, globalFPInfo, "--backup-agent", *pluginConfigFile, compressStr)
+	} else if !*singleDataFile {
+		InitializeJournal(tables)
 	}
 	gplog.Info("Writing data to file")
-	rowsCopiedMaps := BackupDataForAllTables(tables, tableDefs)
+	rowsCopiedMaps := BackupDataForAllTables(tablesToBackUp, tableDefs)
+	rowsCopiedMaps = append(rowsCopiedMaps, resumedRowsCopied)
 	AddTableDataEntriesToTOC(tables, tableDefs, rowsCopiedMaps)
 	if *singleDataFile && *pluginConfigFile != "" {
 		pluginConfig.BackupSegmentTOCs(globalCluster, globalFPInfo)
 	}
+	if !*singleDataFile && !wasTerminated {
+		AddDataFileInfoToTOC()
+	}
 	if wasTerminated {
 		gplog.Info("Data backup incomplete")
 	} else {
@@ -352,6 +446,14 @@ func DoTeardown() {
 		backupReport.ConstructBackupParamsString()
 		backupReport.WriteConfigFile(configFilename)
 		backupReport.WriteBackupReportFile(reportFilename, globalFPInfo.Timestamp, objectCounts, errMsg)
+		WriteHistoryEntry(errMsg)
+		if globalJournal != nil {
+			_ = globalJournal.Close()
+			// The journal is kept after a failure so that the backup can be resumed
+			if errMsg == "" {
+				_ = os.Remove(globalFPInfo.GetJournalFilePath())
+			}
+		}
 		utils.EmailReport(globalCluster, globalFPInfo.Timestamp, reportFilename, "gpbackup")
 		if pluginConfig != nil {
 			pluginConfig.BackupFile(configFilename, true)
@@ -369,6 +471,20 @@ func DoTeardown() {
 	os.Exit(errorCode)
 }
 
+/*
+ * Subcommands such as "history" and "delete" do not take a backup, so their
+ * teardown only needs to report any error and close the connection, if any.
+ */
+func DoSubcommandTeardown() {
+	if err := recover(); err != nil {
+		fmt.Println(err)
+	}
+	if connectionPool != nil {
+		connectionPool.Close()
+	}
+	os.Exit(gplog.GetErrorCode())
+}
+
 func DoCleanup() {
 	defer func() {
 		if err := recover(); err != nil {
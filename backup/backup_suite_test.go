@@ -40,6 +40,8 @@ var _ = BeforeSuite(func() {
 	connectionPool, mock, stdout, stderr, logfile = testutils.SetupTestEnvironment()
 	backup.SetIncludeSchemas([]string{})
 	backup.SetExcludeSchemas([]string{})
+	backup.SetIncludeRoles([]string{})
+	backup.SetExcludeRoles([]string{})
 	backup.SetIncludeTables([]string{})
 	backup.SetExcludeTables([]string{})
 })
@@ -6,11 +6,13 @@ package backup
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 	"gopkg.in/cheggaaa/pb.v1"
 	"sync"
 )
@@ -31,6 +33,7 @@ func ConstructTableAttributesList(columnDefs []ColumnDefinition) string {
 }
 
 func AddTableDataEntriesToTOC(tables []Relation, tableDefs map[uint32]TableDefinition, rowsCopiedMaps []map[uint32]int64) {
+	streams := getDataStreams(tables)
 	for _, table := range tables {
 		if !tableDefs[table.Oid].IsExternal {
 			var rowsCopied int64
@@ -42,10 +45,78 @@ func AddTableDataEntriesToTOC(tables []Relation, tableDefs map[uint32]TableDefin
 			}
 			attributes := ConstructTableAttributesList(tableDefs[table.Oid].ColumnDefs)
 			globalTOC.AddMasterDataEntry(table.Schema, table.Name, table.Oid, attributes, rowsCopied)
+			globalTOC.DataEntries[len(globalTOC.DataEntries)-1].Stream = streams[table.Oid]
+			globalTOC.DataEntries[len(globalTOC.DataEntries)-1].Filter, _ = getTableFilter(table)
 		}
 	}
 }
 
+/*
+ * In single-data-file mode, each connection backs up the tables in its own
+ * data stream, so that each segment writes one data file per connection.
+ * Otherwise, all tables are in a single stream shared by all connections.
+ */
+func getNumDataStreams() int {
+	if *singleDataFile {
+		return connectionPool.NumConns
+	}
+	return 1
+}
+
+func getDataStreams(tables []Relation) map[uint32]int {
+	oids := make([]uint32, len(tables))
+	for i, table := range tables {
+		oids[i] = table.Oid
+	}
+	return utils.AssignDataStreams(oids, getNumDataStreams())
+}
+
+// Returns the tables in each stream in oid order, which gpbackup_helper expects
+func GetTablesByStream(tables []Relation) [][]Relation {
+	streams := getDataStreams(tables)
+	streamTables := make([][]Relation, getNumDataStreams())
+	for _, table := range tables {
+		stream := streams[table.Oid]
+		streamTables[stream] = append(streamTables[stream], table)
+	}
+	for _, stream := range streamTables {
+		sort.Slice(stream, func(i int, j int) bool {
+			return stream[i].Oid < stream[j].Oid
+		})
+	}
+	return streamTables
+}
+
+/*
+ * gpbackup_helper records the checksum and size of each table's data file on
+ * each segment as it writes the file, and the checksum files of all segments
+ * are read once all of the tables have been backed up.  In single-data-file
+ * mode, gpbackup_helper records a checksum for each table's portion of the
+ * data file in the segment TOC instead.  Entries carried over from an
+ * incremental base backup keep the checksums and sizes recorded by that
+ * backup, as their data files are not in this backup's directory.
+ */
+func AddDataFileInfoToTOC() {
+	infos := utils.GetDataFileInfoOnAllHosts(globalCluster, globalFPInfo)
+	for i, entry := range globalTOC.DataEntries {
+		if entry.Timestamp != "" {
+			continue
+		}
+		checksums := make(map[int]string, len(infos))
+		sizes := make(map[int]int64, len(infos))
+		for contentID, segInfos := range infos {
+			info, ok := segInfos[entry.Oid]
+			if !ok {
+				gplog.Fatal(errors.Errorf("No checksum was recorded for the data file of table %s for segment %d", utils.MakeFQN(entry.Schema, entry.Name), contentID), "")
+			}
+			checksums[contentID] = info.Checksum
+			sizes[contentID] = info.Size
+		}
+		globalTOC.DataEntries[i].Checksums = checksums
+		globalTOC.DataEntries[i].Sizes = sizes
+	}
+}
+
 type BackupProgressCounters struct {
 	NumRegTables   int64
 	TotalRegTables int64
@@ -53,8 +124,107 @@ type BackupProgressCounters struct {
 	ProgressBar    utils.ProgressBar
 }
 
-func CopyTableOut(connectionPool *dbconn.DBConn, table Relation, backupFile string, connNum int) int64 {
-	usingCompression, compressionProgram := utils.GetCompressionParameters()
+/*
+ * The leaf partitions of a partition table are needed to apply its filter or
+ * masking policy to each leaf partition with --leaf-partition-data, and to
+ * leave out its external partitions without --leaf-partition-data.
+ */
+func InitializePartitionLeaves() {
+	if len(tableFilters) == 0 && len(maskingPolicy) == 0 {
+		return
+	}
+	leaves := GetPartitionLeaves(connectionPool)
+	ValidateLeafPartitionFilters(leaves)
+	partitionRoots, nonExternalLeaves = getPartitionLeafMaps(leaves)
+}
+
+/*
+ * Returns a map of each leaf partition to its root table, and a map of each
+ * root table with external partitions to its other leaf partitions.
+ */
+func getPartitionLeafMaps(leaves []PartitionLeaf) (map[uint32]string, map[string][]string) {
+	roots := make(map[uint32]string, len(leaves))
+	hasExternalLeaf := make(map[string]bool, 0)
+	allLeaves := make(map[string][]string, 0)
+	for _, leaf := range leaves {
+		roots[leaf.Oid] = leaf.RootName
+		if leaf.IsExternal {
+			hasExternalLeaf[leaf.RootName] = true
+		} else {
+			allLeaves[leaf.RootName] = append(allLeaves[leaf.RootName], utils.MakeFQN(leaf.Schema, leaf.Name))
+		}
+	}
+	otherLeaves := make(map[string][]string, len(hasExternalLeaf))
+	for root := range hasExternalLeaf {
+		otherLeaves[root] = allLeaves[root]
+	}
+	return roots, otherLeaves
+}
+
+/*
+ * With --leaf-partition-data, the data of a partition table is backed up from
+ * its leaf partitions, so the filter of the root table applies to each leaf.
+ */
+func getTableFilter(table Relation) (string, bool) {
+	if filter, ok := tableFilters[table.ToString()]; ok {
+		return filter, true
+	}
+	if root, ok := partitionRoots[table.Oid]; ok && *leafPartitionData {
+		filter, ok := tableFilters[root]
+		return filter, ok
+	}
+	return "", false
+}
+
+/*
+ * Tables whose rows are filtered or whose columns are masked are copied out
+ * using a query instead of directly.  The query returns the same columns in
+ * the same order as copying the whole table, so the data is restored the
+ * same way.  A query cannot ignore external partitions as COPY does, so a
+ * partition table with external partitions is read from its other leaf
+ * partitions instead.
+ */
+func GetCopySelectQuery(table Relation, columnDefs []ColumnDefinition) string {
+	filter, isFiltered := getTableFilter(table)
+	columnRules, isMasked := getMaskingRules(table)
+	if !isFiltered && !isMasked {
+		return ""
+	}
+	leaves, hasExternalLeaves := nonExternalLeaves[table.ToString()]
+	hasExternalLeaves = hasExternalLeaves && !*leafPartitionData
+	selectList := "*"
+	if isMasked || hasExternalLeaves {
+		columns := make([]string, len(columnDefs))
+		for i, columnDef := range columnDefs {
+			columns[i] = columnDef.Name
+			if rule, ok := columnRules[columnDef.Name]; ok {
+				columns[i] = fmt.Sprintf("%s AS %s", GetMaskedColumnExpression(columnDef, rule), columnDef.Name)
+			}
+		}
+		selectList = strings.Join(columns, ", ")
+	}
+	whereClause := ""
+	if isFiltered {
+		whereClause = fmt.Sprintf(" WHERE %s", filter)
+	}
+	if !hasExternalLeaves {
+		return fmt.Sprintf("SELECT %s FROM %s%s", selectList, table.ToString(), whereClause)
+	}
+	if len(leaves) == 0 {
+		return fmt.Sprintf("SELECT %s FROM %s WHERE false", selectList, table.ToString())
+	}
+	queries := make([]string, len(leaves))
+	for i, leaf := range leaves {
+		queries[i] = fmt.Sprintf("SELECT %s FROM %s%s", selectList, leaf, whereClause)
+	}
+	return strings.Join(queries, " UNION ALL ")
+}
+
+/*
+ * When each table has its own data file, gpbackup_helper writes the file so
+ * that its checksum is computed as it is written.
+ */
+func CopyTableOut(connectionPool *dbconn.DBConn, table Relation, columnDefs []ColumnDefinition, backupFile string, connNum int) int64 {
 	copyCommand := ""
 	if *singleDataFile {
 		/*
@@ -65,12 +235,13 @@ func CopyTableOut(connectionPool *dbconn.DBConn, table Relation, backupFile stri
 		 */
 		checkPipeExistsCommand := fmt.Sprintf("(test -p \"%s\" || (echo \"Pipe not found\">&2; exit 1))", backupFile)
 		copyCommand = fmt.Sprintf("PROGRAM '%s && cat - > %s'", checkPipeExistsCommand, backupFile)
-	} else if usingCompression {
-		copyCommand = fmt.Sprintf("PROGRAM '%s > %s'", compressionProgram.CompressCommand, backupFile)
 	} else {
-		copyCommand = fmt.Sprintf("'%s'", backupFile)
+		copyCommand = fmt.Sprintf("PROGRAM '%s'", utils.GetWriteTableDataCommand(backupFile, globalFPInfo.GetSegmentChecksumFilePathForCopyCommand(), table.Oid))
 	}
 	query := fmt.Sprintf("COPY %s TO %s WITH CSV DELIMITER '%s' ON SEGMENT IGNORE EXTERNAL PARTITIONS;", table.ToString(), copyCommand, tableDelim)
+	if selectQuery := GetCopySelectQuery(table, columnDefs); selectQuery != "" {
+		query = fmt.Sprintf("COPY (%s) TO %s WITH CSV DELIMITER '%s' ON SEGMENT;", selectQuery, copyCommand, tableDelim)
+	}
 	result, err := connectionPool.Exec(query, connNum)
 	if err != nil {
 		errStr := ""
@@ -103,8 +274,11 @@ func BackupSingleTableData(tableDef TableDefinition, table Relation, rowsCopiedM
 		} else {
 			backupFile = globalFPInfo.GetTableBackupFilePathForCopyCommand(table.Oid, false)
 		}
-		rowsCopied := CopyTableOut(connectionPool, table, backupFile, whichConn)
+		rowsCopied := CopyTableOut(connectionPool, table, tableDef.ColumnDefs, backupFile, whichConn)
 		rowsCopiedMap[table.Oid] = rowsCopied
+		if globalJournal != nil && !wasTerminated {
+			AddTableToJournal(table, tableDef, rowsCopied, backupFile)
+		}
 		counters.ProgressBar.Increment()
 	} else {
 		gplog.Verbose("Skipping data backup of table %s because it is an external table.", table.ToString())
@@ -127,14 +301,22 @@ func BackupDataForAllTables(tables []Relation, tableDefs map[uint32]TableDefinit
 	 * TerminateHangingCopySessions to kill any COPY statements
 	 * in progress if they don't finish on their own.
 	 */
-	tasks := make(chan Relation, len(tables))
+	streamTables := GetTablesByStream(tables)
+	tasks := make([]chan Relation, len(streamTables))
+	for i, stream := range streamTables {
+		tasks[i] = make(chan Relation, len(stream))
+		for _, table := range stream {
+			tasks[i] <- table
+		}
+		close(tasks[i])
+	}
 	var workerPool sync.WaitGroup
 	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
 		rowsCopiedMaps[connNum] = make(map[uint32]int64, 0)
 		workerPool.Add(1)
 		go func(whichConn int) {
 			defer workerPool.Done()
-			for table := range tasks {
+			for table := range tasks[whichConn%len(tasks)] {
 				if wasTerminated {
 					counters.ProgressBar.(*pb.ProgressBar).NotPrint = true
 					break
@@ -143,10 +325,6 @@ func BackupDataForAllTables(tables []Relation, tableDefs map[uint32]TableDefinit
 			}
 		}(connNum)
 	}
-	for _, table := range tables {
-		tasks <- table
-	}
-	close(tasks)
 	workerPool.Wait()
 	counters.ProgressBar.Finish()
 
@@ -1,9 +1,14 @@
 package backup_test
 
 import (
+	"io/ioutil"
+	"os"
 	"regexp"
 
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/testutils"
 	"github.com/greenplum-db/gpbackup/utils"
 
 	"fmt"
@@ -37,6 +42,7 @@ var _ bool = Describe("backup/data tests", func() {
 		BeforeEach(func() {
 			toc = &utils.TOC{}
 			backup.SetTOC(toc)
+			backup.SetSingleDataFile(false)
 			rowsCopiedMaps = make([]map[uint32]int64, connectionPool.NumConns)
 		})
 		It("adds an entry for a regular table to the TOC", func() {
@@ -47,6 +53,16 @@ var _ bool = Describe("backup/data tests", func() {
 			expectedDataEntries := []utils.MasterDataEntry{{Schema: "public", Name: "table", Oid: 1, AttributeString: "(a)"}}
 			Expect(toc.DataEntries).To(Equal(expectedDataEntries))
 		})
+		It("records the filter of a table whose rows were filtered", func() {
+			backup.SetTableFilters(map[string]string{"public.table": "a > 10"})
+			defer backup.SetTableFilters(nil)
+			columnDefs := []backup.ColumnDefinition{{Oid: 1, Name: "a"}}
+			tableDefs := map[uint32]backup.TableDefinition{1: {ColumnDefs: columnDefs}}
+			tables := []backup.Relation{{Oid: 1, Schema: "public", Name: "table"}}
+			backup.AddTableDataEntriesToTOC(tables, tableDefs, rowsCopiedMaps)
+			expectedDataEntries := []utils.MasterDataEntry{{Schema: "public", Name: "table", Oid: 1, AttributeString: "(a)", Filter: "a > 10"}}
+			Expect(toc.DataEntries).To(Equal(expectedDataEntries))
+		})
 		It("does not add an entry for an external table to the TOC", func() {
 			columnDefs := []backup.ColumnDefinition{{Oid: 1, Name: "a"}}
 			tableDefs := map[uint32]backup.TableDefinition{1: {ColumnDefs: columnDefs, IsExternal: true}}
@@ -54,27 +70,127 @@ var _ bool = Describe("backup/data tests", func() {
 			backup.AddTableDataEntriesToTOC(tables, tableDefs, rowsCopiedMaps)
 			Expect(toc.DataEntries).To(BeNil())
 		})
+		It("records the data stream of each table when backing up to a single data file with multiple connections", func() {
+			backup.SetSingleDataFile(true)
+			connectionPool, mock = testutils.CreateAndConnectMockDB(2)
+			defer backup.SetSingleDataFile(false)
+			tableDefs := map[uint32]backup.TableDefinition{1: {}, 2: {}, 3: {}}
+			tables := []backup.Relation{{Oid: 1, Schema: "public", Name: "foo"}, {Oid: 2, Schema: "public", Name: "bar"}, {Oid: 3, Schema: "public", Name: "baz"}}
+			backup.AddTableDataEntriesToTOC(tables, tableDefs, make([]map[uint32]int64, 2))
+			Expect(toc.DataEntries).To(HaveLen(3))
+			Expect(toc.DataEntries[0].Stream).To(Equal(0))
+			Expect(toc.DataEntries[1].Stream).To(Equal(1))
+			Expect(toc.DataEntries[2].Stream).To(Equal(0))
+		})
+	})
+	Describe("GetTablesByStream", func() {
+		tables := []backup.Relation{{Oid: 3, Name: "baz"}, {Oid: 1, Name: "foo"}, {Oid: 2, Name: "bar"}}
+		BeforeEach(func() {
+			connectionPool, mock = testutils.CreateAndConnectMockDB(2)
+		})
+		AfterEach(func() {
+			backup.SetSingleDataFile(false)
+		})
+		It("puts all tables in one stream when each table has its own data file", func() {
+			backup.SetSingleDataFile(false)
+			Expect(backup.GetTablesByStream(tables)).To(Equal([][]backup.Relation{{{Oid: 1, Name: "foo"}, {Oid: 2, Name: "bar"}, {Oid: 3, Name: "baz"}}}))
+		})
+		It("puts the tables in one stream per connection in oid order in single-data-file mode", func() {
+			backup.SetSingleDataFile(true)
+			Expect(backup.GetTablesByStream(tables)).To(Equal([][]backup.Relation{{{Oid: 1, Name: "foo"}, {Oid: 3, Name: "baz"}}, {{Oid: 2, Name: "bar"}}}))
+		})
+	})
+	Describe("AddDataFileInfoToTOC", func() {
+		var testExecutor *testhelper.TestExecutor
+		BeforeEach(func() {
+			testExecutor = &testhelper.TestExecutor{}
+			testCluster := testutils.SetDefaultSegmentConfiguration()
+			testCluster.Executor = testExecutor
+			backup.SetCluster(testCluster)
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{Stdouts: map[int]string{
+				0: "3456 1234 1234\n",
+				1: "3456 9999 9999\n3456 5678 5678\n",
+			}}
+		})
+		AfterEach(func() {
+			testutils.SetupTestCluster()
+		})
+		It("adds the checksum and size of each segment's data file recorded by gpbackup_helper to the table's data entry", func() {
+			toc := &utils.TOC{}
+			toc.AddMasterDataEntry("public", "foo", 3456, "(i)", 1)
+			backup.SetTOC(toc)
+
+			backup.AddDataFileInfoToTOC()
+
+			Expect(testExecutor.NumExecutions).To(Equal(1))
+			Expect(toc.DataEntries[0].Checksums).To(Equal(map[int]string{0: "1234", 1: "5678"}))
+			Expect(toc.DataEntries[0].Sizes).To(Equal(map[int]int64{0: 1234, 1: 5678}))
+		})
+		It("keeps the checksums and sizes of data entries from an incremental base backup", func() {
+			toc := &utils.TOC{}
+			baseEntry := utils.MasterDataEntry{Schema: "public", Name: "foo", Oid: 3456, Checksums: map[int]string{0: "cccc", 1: "dddd"}, Sizes: map[int]int64{0: 12, 1: 34}}
+			toc.AddIncrementalDataEntry(baseEntry, "20161231010101")
+			backup.SetTOC(toc)
+
+			backup.AddDataFileInfoToTOC()
+
+			Expect(toc.DataEntries[0].Checksums).To(Equal(map[int]string{0: "cccc", 1: "dddd"}))
+			Expect(toc.DataEntries[0].Sizes).To(Equal(map[int]int64{0: 12, 1: 34}))
+		})
+		It("panics if no checksum was recorded for a segment's data file", func() {
+			testExecutor.ClusterOutput.Stdouts[1] = ""
+			toc := &utils.TOC{}
+			toc.AddMasterDataEntry("public", "foo", 3456, "(i)", 1)
+			backup.SetTOC(toc)
+
+			defer testhelper.ShouldPanicWithMessage("No checksum was recorded for the data file of table public.foo for segment 1")
+			backup.AddDataFileInfoToTOC()
+		})
 	})
 	Describe("CopyTableOut", func() {
 		It("will back up a table to its own file with compression", func() {
 			backup.SetSingleDataFile(false)
-			utils.SetCompressionParameters(true, utils.Compression{Name: "gzip", CompressCommand: "gzip -c -8", DecompressCommand: "gzip -d -c", Extension: ".gz"})
+			utils.SetCompressionParameters(true, utils.Compression{Name: "gzip", Level: 8, CompressCommand: "gzip -c -8", DecompressCommand: "gzip -d -c", Extension: ".gz"})
 			testTable := backup.Relation{SchemaOid: 2345, Oid: 3456, Schema: "public", Name: "foo", DependsUpon: nil, Inherits: nil}
-			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM 'gzip -c -8 > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM 'gpbackup_helper --write-table-data --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz --checksum-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums --oid 3456 --content <SEGID> --compression-type gzip --compression-level 8' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
 
-			backup.CopyTableOut(connectionPool, testTable, filename, defaultConnNum)
+			backup.CopyTableOut(connectionPool, testTable, []backup.ColumnDefinition{}, filename, defaultConnNum)
 		})
 		It("will back up a table to its own file without compression", func() {
 			backup.SetSingleDataFile(false)
 			utils.SetCompressionParameters(false, utils.Compression{})
 			testTable := backup.Relation{SchemaOid: 2345, Oid: 3456, Schema: "public", Name: "foo", DependsUpon: nil, Inherits: nil}
-			execStr := regexp.QuoteMeta("COPY public.foo TO '<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM 'gpbackup_helper --write-table-data --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456 --checksum-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums --oid 3456 --content <SEGID>' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
 
-			backup.CopyTableOut(connectionPool, testTable, filename, defaultConnNum)
+			backup.CopyTableOut(connectionPool, testTable, []backup.ColumnDefinition{}, filename, defaultConnNum)
+		})
+		It("will back up a table to its own file with compression and encryption", func() {
+			backup.SetSingleDataFile(false)
+			utils.SetCompressionParameters(true, utils.Compression{Name: "gzip", Level: 8, CompressCommand: "gzip -c -8", DecompressCommand: "gzip -d -c", Extension: ".gz"})
+			utils.SetEncryptionParameters("/tmp/key", []byte("0123456789abcdef0123456789abcdef"))
+			defer utils.SetEncryptionParameters("", nil)
+			testTable := backup.Relation{SchemaOid: 2345, Oid: 3456, Schema: "public", Name: "foo", DependsUpon: nil, Inherits: nil}
+			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM 'gpbackup_helper --write-table-data --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz --checksum-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums --oid 3456 --content <SEGID> --compression-type gzip --compression-level 8 --encryption-key-file /tmp/key' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
+
+			backup.CopyTableOut(connectionPool, testTable, []backup.ColumnDefinition{}, filename, defaultConnNum)
+		})
+		It("will back up a table to its own file with encryption and without compression", func() {
+			backup.SetSingleDataFile(false)
+			utils.SetCompressionParameters(false, utils.Compression{})
+			utils.SetEncryptionParameters("/tmp/key", []byte("0123456789abcdef0123456789abcdef"))
+			defer utils.SetEncryptionParameters("", nil)
+			testTable := backup.Relation{SchemaOid: 2345, Oid: 3456, Schema: "public", Name: "foo", DependsUpon: nil, Inherits: nil}
+			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM 'gpbackup_helper --write-table-data --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456 --checksum-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums --oid 3456 --content <SEGID> --encryption-key-file /tmp/key' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
+
+			backup.CopyTableOut(connectionPool, testTable, []backup.ColumnDefinition{}, filename, defaultConnNum)
 		})
 		It("will back up a table to a single file", func() {
 			backup.SetSingleDataFile(true)
@@ -84,7 +200,104 @@ var _ bool = Describe("backup/data tests", func() {
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
 
-			backup.CopyTableOut(connectionPool, testTable, filename, defaultConnNum)
+			backup.CopyTableOut(connectionPool, testTable, []backup.ColumnDefinition{}, filename, defaultConnNum)
+		})
+	})
+	Describe("CopyTableOut with a table filter", func() {
+		AfterEach(func() {
+			backup.SetTableFilters(nil)
+		})
+		It("backs up only the rows of a table that match its filter", func() {
+			backup.SetSingleDataFile(false)
+			utils.SetCompressionParameters(false, utils.Compression{})
+			backup.SetTableFilters(map[string]string{"public.foo": "event_time > now() - interval '90 days'"})
+			testTable := backup.Relation{SchemaOid: 2345, Oid: 3456, Schema: "public", Name: "foo"}
+			execStr := regexp.QuoteMeta("COPY (SELECT * FROM public.foo WHERE event_time > now() - interval '90 days') TO PROGRAM 'gpbackup_helper --write-table-data --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456 --checksum-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums --oid 3456 --content <SEGID>' WITH CSV DELIMITER ',' ON SEGMENT;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
+
+			backup.CopyTableOut(connectionPool, testTable, []backup.ColumnDefinition{}, filename, defaultConnNum)
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("backs up the whole table if a different table is filtered", func() {
+			backup.SetSingleDataFile(false)
+			utils.SetCompressionParameters(false, utils.Compression{})
+			backup.SetTableFilters(map[string]string{"public.bar": "i > 10"})
+			testTable := backup.Relation{SchemaOid: 2345, Oid: 3456, Schema: "public", Name: "foo"}
+			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM 'gpbackup_helper --write-table-data --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456 --checksum-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums --oid 3456 --content <SEGID>' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
+
+			backup.CopyTableOut(connectionPool, testTable, []backup.ColumnDefinition{}, filename, defaultConnNum)
+		})
+	})
+	Describe("GetCopySelectQuery with partition tables", func() {
+		columnDefs := []backup.ColumnDefinition{{Name: "i"}, {Name: "j"}}
+		root := backup.Relation{Oid: 1, Schema: "public", Name: "part"}
+		leaf := backup.Relation{Oid: 2, Schema: "public", Name: "part_1_prt_1"}
+		leaves := []backup.PartitionLeaf{
+			{Oid: 2, Schema: "public", Name: "part_1_prt_1", RootName: "public.part"},
+			{Oid: 3, Schema: "public", Name: "part_1_prt_2", RootName: "public.part"},
+			{Oid: 4, Schema: "public", Name: "part_1_prt_3", RootName: "public.part", IsExternal: true},
+		}
+		BeforeEach(func() {
+			backup.SetTableFilters(map[string]string{"public.part": "i > 10"})
+		})
+		AfterEach(func() {
+			backup.SetTableFilters(nil)
+			backup.SetPartitionLeaves(nil)
+			backup.SetLeafPartitionData(false)
+		})
+		It("applies the filter of the root table to a leaf partition with --leaf-partition-data", func() {
+			backup.SetLeafPartitionData(true)
+			backup.SetPartitionLeaves(leaves)
+			Expect(backup.GetCopySelectQuery(leaf, columnDefs)).To(Equal("SELECT * FROM public.part_1_prt_1 WHERE i > 10"))
+		})
+		It("does not apply the filter of the root table to a leaf partition without --leaf-partition-data", func() {
+			backup.SetPartitionLeaves(leaves)
+			Expect(backup.GetCopySelectQuery(leaf, columnDefs)).To(Equal(""))
+		})
+		It("reads a partition table with external partitions from its other leaf partitions", func() {
+			backup.SetPartitionLeaves(leaves)
+			Expect(backup.GetCopySelectQuery(root, columnDefs)).To(Equal("SELECT i, j FROM public.part_1_prt_1 WHERE i > 10 UNION ALL SELECT i, j FROM public.part_1_prt_2 WHERE i > 10"))
+		})
+		It("reads no rows from a partition table whose leaf partitions are all external", func() {
+			backup.SetPartitionLeaves([]backup.PartitionLeaf{leaves[2]})
+			Expect(backup.GetCopySelectQuery(root, columnDefs)).To(Equal("SELECT i, j FROM public.part WHERE false"))
+		})
+		It("reads a partition table without external partitions directly", func() {
+			backup.SetPartitionLeaves(leaves[:2])
+			Expect(backup.GetCopySelectQuery(root, columnDefs)).To(Equal("SELECT * FROM public.part WHERE i > 10"))
+		})
+	})
+	Describe("ReadTableFilterFile", func() {
+		var filename string
+		BeforeEach(func() {
+			file, _ := ioutil.TempFile("", "gpbackup_table_filter")
+			_ = file.Close()
+			filename = file.Name()
+		})
+		AfterEach(func() {
+			_ = os.Remove(filename)
+		})
+		It("reads the filter for each table", func() {
+			_ = ioutil.WriteFile(filename, []byte(`public.events: event_time > now() - interval '90 days'
+'public."Foo"': "i = 'x'"
+`), 0644)
+			Expect(backup.ReadTableFilterFile(filename)).To(Equal(map[string]string{
+				"public.events": "event_time > now() - interval '90 days'",
+				`public."Foo"`:  "i = 'x'",
+			}))
+		})
+		It("panics if a table has an empty filter", func() {
+			_ = ioutil.WriteFile(filename, []byte("public.events: \"\"\n"), 0644)
+			defer testhelper.ShouldPanicWithMessage("The filter for table public.events in table filter file")
+			backup.ReadTableFilterFile(filename)
+		})
+		It("panics if the file is not a map of tables to filters", func() {
+			_ = ioutil.WriteFile(filename, []byte("- public.events\n"), 0644)
+			defer testhelper.ShouldPanicWithMessage("Unable to parse table filter file")
+			backup.ReadTableFilterFile(filename)
 		})
 	})
 	Describe("BackupSingleTableData", func() {
@@ -0,0 +1,150 @@
+package backup
+
+/*
+ * This file contains functions related to the "gpbackup delete" subcommand,
+ * which deletes backups by timestamp or according to a retention policy.
+ */
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewDeleteCommand() *cobra.Command {
+	deleteCmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete a backup, or all backups not retained by a retention policy",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			defer DoSubcommandTeardown()
+			ValidateDeleteFlags(cmd.Flags())
+			DoDelete()
+		}}
+	deleteDBName = deleteCmd.Flags().String("dbname", "", "Only apply the retention policy to backups of the specified database")
+	deleteDryRun = deleteCmd.Flags().Bool("dry-run", false, "List the backups that would be deleted without deleting them")
+	deleteKeepDays = deleteCmd.Flags().Int("keep-days", 0, "Retain all backups taken within the specified number of days")
+	deleteKeepLast = deleteCmd.Flags().Int("keep-last", 0, "Retain the specified number of most recent successful full backups of each database, and all backups taken after them")
+	deletePluginConfig = deleteCmd.Flags().String("plugin-config", "", "The configuration file to use for deleting backups taken with a plugin")
+	deleteTimestamp = deleteCmd.Flags().String("timestamp", "", "The timestamp of the backup to delete, in the format YYYYMMDDHHMMSS")
+	return deleteCmd
+}
+
+func ValidateDeleteFlags(flags *pflag.FlagSet) {
+	utils.CheckExclusiveFlags(flags, "timestamp", "keep-last")
+	utils.CheckExclusiveFlags(flags, "timestamp", "keep-days")
+	utils.CheckExclusiveFlags(flags, "timestamp", "dbname")
+	if *deleteTimestamp == "" && *deleteKeepLast == 0 && *deleteKeepDays == 0 {
+		gplog.Fatal(errors.Errorf("One of --timestamp, --keep-last, or --keep-days must be specified"), "")
+	}
+	if *deleteTimestamp != "" && !utils.IsValidTimestamp(*deleteTimestamp) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", *deleteTimestamp), "")
+	}
+	if *deleteKeepLast < 0 || *deleteKeepDays < 0 {
+		gplog.Fatal(errors.Errorf("--keep-last and --keep-days must be positive integers"), "")
+	}
+}
+
+func DoDelete() {
+	connectionPool = dbconn.NewDBConnFromEnvironment("postgres")
+	connectionPool.MustConnect(1)
+	utils.SetDatabaseVersion(connectionPool)
+	globalCluster = cluster.NewCluster(cluster.MustGetSegmentConfiguration(connectionPool))
+	segPrefix := utils.GetSegPrefix(connectionPool)
+
+	historyFilename := utils.GetHistoryFilePath(globalCluster.GetDirForContent(-1))
+	history := utils.ReadHistoryFile(historyFilename)
+	policy := utils.RetentionPolicy{DatabaseName: *deleteDBName, KeepLast: *deleteKeepLast, KeepDays: *deleteKeepDays}
+	entries := GetBackupsToDelete(history, *deleteTimestamp, policy)
+	if len(entries) == 0 {
+		gplog.Info("No backups to delete")
+		return
+	}
+	if *deleteDryRun {
+		gplog.Info("The following %d backup(s) would be deleted:", len(entries))
+		PrintHistoryEntries(os.Stdout, entries)
+		return
+	}
+
+	InitializePluginForDelete(entries)
+	for _, entry := range entries {
+		DeleteBackup(entry, segPrefix, historyFilename)
+	}
+	gplog.Info("Deleted %d backup(s)", len(entries))
+}
+
+func GetBackupsToDelete(history *utils.History, timestamp string, policy utils.RetentionPolicy) []utils.HistoryEntry {
+	if timestamp == "" {
+		return history.GetExpiredEntries(policy)
+	}
+	entry := history.FindEntry(timestamp)
+	if entry == nil {
+		gplog.Fatal(errors.Errorf("Backup %s was not found in the backup history file", timestamp), "")
+	}
+	dependents := history.GetDependentEntries(timestamp)
+	if len(dependents) > 0 {
+		dependentTimestamps := make([]string, 0)
+		for _, dependent := range dependents {
+			dependentTimestamps = append(dependentTimestamps, dependent.Timestamp)
+		}
+		gplog.Fatal(errors.Errorf("Cannot delete backup %s, as the following incremental backup(s) depend on it: %s",
+			timestamp, strings.Join(dependentTimestamps, ", ")), "")
+	}
+	return []utils.HistoryEntry{*entry}
+}
+
+/*
+ * We check that every plugin backup can be deleted before deleting anything,
+ * so that a missing or mismatched plugin configuration cannot leave the
+ * retention policy partially applied.
+ */
+func InitializePluginForDelete(entries []utils.HistoryEntry) {
+	for _, entry := range entries {
+		if entry.Plugin == "" {
+			continue
+		}
+		if *deletePluginConfig == "" {
+			gplog.Fatal(errors.Errorf("Backup %s was taken with plugin %s.  Specify --plugin-config to delete it.", entry.Timestamp, entry.Plugin), "")
+		}
+		if pluginConfig == nil {
+			pluginConfig = utils.ReadPluginConfig(*deletePluginConfig)
+			pluginConfig.CopyPluginConfigToAllHosts(globalCluster, *deletePluginConfig)
+		}
+		if pluginConfig.ExecutablePath != entry.Plugin {
+			gplog.Fatal(errors.Errorf("Backup %s was taken with plugin %s, but the plugin configuration specifies %s", entry.Timestamp, entry.Plugin, pluginConfig.ExecutablePath), "")
+		}
+	}
+}
+
+func DeleteBackup(entry utils.HistoryEntry, segPrefix string, historyFilename string) {
+	gplog.Info("Deleting backup %s of database %s", entry.Timestamp, entry.DatabaseName)
+	fpInfo := utils.NewFilePathInfo(globalCluster, entry.BackupDir, entry.Timestamp, segPrefix)
+	if entry.Plugin != "" {
+		pluginConfig.DeleteBackup(entry.Timestamp)
+	}
+	DeleteBackupDirectoriesOnAllHosts(fpInfo)
+	utils.RemoveHistoryEntry(historyFilename, entry.Timestamp)
+}
+
+/*
+ * The date directory containing the backup directory is removed as well once
+ * it is empty, so that deleted backups do not leave empty directories behind.
+ */
+func DeleteBackupDirectoriesOnAllHosts(fpInfo utils.FilePathInfo) {
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Deleting backup directories", func(contentID int) string {
+		backupDir := fpInfo.GetDirForContent(contentID)
+		return fmt.Sprintf("rm -rf %s && (rmdir %s 2>/dev/null || true)", utils.ShellQuote(backupDir), utils.ShellQuote(path.Dir(backupDir)))
+	}, cluster.ON_SEGMENTS_AND_MASTER)
+	globalCluster.CheckClusterError(remoteOutput, "Unable to delete backup directories", func(contentID int) string {
+		return fmt.Sprintf("Unable to delete backup directory %s", fpInfo.GetDirForContent(contentID))
+	})
+}
@@ -0,0 +1,38 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/delete tests", func() {
+	Describe("GetBackupsToDelete", func() {
+		full := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb"}, Timestamp: "20170101010101", Status: utils.HISTORY_STATUS_SUCCESS}
+		incremental := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", Incremental: true, FromTimestamp: "20170101010101"}, Timestamp: "20170102010101", Status: utils.HISTORY_STATUS_SUCCESS}
+		var history *utils.History
+		BeforeEach(func() {
+			history = &utils.History{}
+			history.AddEntry(full)
+			history.AddEntry(incremental)
+		})
+		It("returns the backup with the given timestamp", func() {
+			Expect(backup.GetBackupsToDelete(history, "20170102010101", utils.RetentionPolicy{})).To(Equal([]utils.HistoryEntry{incremental}))
+		})
+		It("panics if the backup is not in the history file", func() {
+			defer testhelper.ShouldPanicWithMessage("Backup 20170103010101 was not found in the backup history file")
+			backup.GetBackupsToDelete(history, "20170103010101", utils.RetentionPolicy{})
+		})
+		It("panics if an incremental backup depends on the backup", func() {
+			defer testhelper.ShouldPanicWithMessage("Cannot delete backup 20170101010101, as the following incremental backup(s) depend on it: 20170102010101")
+			backup.GetBackupsToDelete(history, "20170101010101", utils.RetentionPolicy{})
+		})
+		It("returns the backups expired by the retention policy", func() {
+			history.AddEntry(utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb"}, Timestamp: "20170103010101", Status: utils.HISTORY_STATUS_SUCCESS})
+			Expect(backup.GetBackupsToDelete(history, "", utils.RetentionPolicy{KeepLast: 1})).To(Equal([]utils.HistoryEntry{incremental, full}))
+		})
+	})
+})
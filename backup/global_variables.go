@@ -17,15 +17,24 @@ import (
  * Non-flag variables
  */
 var (
-	backupReport   *utils.Report
-	connectionPool *dbconn.DBConn
-	globalCluster  *cluster.Cluster
-	globalFPInfo   utils.FilePathInfo
-	globalTOC      *utils.TOC
-	objectCounts   map[string]int
-	pluginConfig   *utils.PluginConfig
-	version        string
-	wasTerminated  bool
+	backupReport             *utils.Report
+	connectionPool           *dbconn.DBConn
+	globalCluster            *cluster.Cluster
+	globalFPInfo             utils.FilePathInfo
+	globalJournal            *utils.Journal
+	globalTOC                *utils.TOC
+	journalFlags             map[string]string
+	maskingPolicy            MaskingPolicy
+	maskingPolicyFingerprint string
+	maskingSecret            string
+	nonExternalLeaves        map[string][]string
+	objectCounts             map[string]int
+	partitionRoots           map[uint32]string
+	pluginConfig             *utils.PluginConfig
+	snapshotID               string
+	tableFilters             map[string]string
+	version                  string
+	wasTerminated            bool
 
 	/*
 	 * Used for synchronizing DoCleanup.  In DoInit() we increment the group
@@ -41,26 +50,66 @@ var (
 var (
 	backupDir         *string
 	compressionLevel  *int
+	compressionType   *string
 	dataOnly          *bool
 	dbname            *string
 	debug             *bool
+	encryptionKeyFile *string
+	excludeRoles      *[]string
 	excludeSchemas    *[]string
 	excludeTableFile  *string
 	excludeTables     *[]string
+	format            *string
+	fromTimestamp     *string
+	globalsOnly       *bool
+	incremental       *bool
+	includeRoles      *[]string
 	includeSchemas    *[]string
 	includeTableFile  *string
 	includeTables     *[]string
 	numJobs           *int
 	leafPartitionData *bool
+	lockRetries       *int
+	lockWaitTimeout   *int
+	maskingPolicyFile *string
 	metadataOnly      *bool
 	noCompression     *bool
 	pluginConfigFile  *string
 	quiet             *bool
+	resume            *string
 	singleDataFile    *bool
+	tableFilterFile   *string
 	verbose           *bool
 	withStats         *bool
 )
 
+/*
+ * Flags for the history subcommand
+ */
+var (
+	historyAfter     *string
+	historyBefore    *string
+	historyDBName    *string
+	historyFile      *string
+	historyLimit     *int
+	historyStatus    *string
+	historyType      *string
+	historyVerbose   *bool
+	historyWithStats *bool
+)
+
+/*
+ * Flags for the delete subcommand
+ */
+var (
+	deleteDBName       *string
+	deleteDryRun       *bool
+	deleteKeepDays     *int
+	deleteKeepLast     *int
+	deletePluginConfig *string
+	deleteTimestamp    *string
+)
+
 /*
  * Setter functions
  */
@@ -73,6 +122,10 @@ func SetCluster(cluster *cluster.Cluster) {
 	globalCluster = cluster
 }
 
+func SetExcludeRoles(roles []string) {
+	excludeRoles = &roles
+}
+
 func SetExcludeSchemas(schemas []string) {
 	excludeSchemas = &schemas
 }
@@ -85,6 +138,18 @@ func SetFPInfo(fpInfo utils.FilePathInfo) {
 	globalFPInfo = fpInfo
 }
 
+func SetFromTimestamp(timestamp string) {
+	fromTimestamp = &timestamp
+}
+
+func SetIncremental(which bool) {
+	incremental = &which
+}
+
+func SetIncludeRoles(roles []string) {
+	includeRoles = &roles
+}
+
 func SetIncludeSchemas(schemas []string) {
 	includeSchemas = &schemas
 }
@@ -93,6 +158,10 @@ func SetIncludeTables(tables []string) {
 	includeTables = &tables
 }
 
+func SetJournal(journal *utils.Journal) {
+	globalJournal = journal
+}
+
 func SetLeafPartitionData(which bool) {
 	leafPartitionData = &which
 }
@@ -109,6 +178,22 @@ func SetSingleDataFile(which bool) {
 	singleDataFile = &which
 }
 
+func SetMaskingPolicy(policy MaskingPolicy) {
+	maskingPolicy = policy
+}
+
+func SetMaskingSecret(secret string) {
+	maskingSecret = secret
+}
+
+func SetPartitionLeaves(leaves []PartitionLeaf) {
+	partitionRoots, nonExternalLeaves = getPartitionLeafMaps(leaves)
+}
+
+func SetTableFilters(filters map[string]string) {
+	tableFilters = filters
+}
+
 func SetTOC(toc *utils.TOC) {
 	globalTOC = toc
 }
@@ -0,0 +1,126 @@
+package backup
+
+/*
+ * This file contains functions related to recording backups in the backup
+ * history file and to the "gpbackup history" subcommand that lists them.
+ */
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func NewHistoryCommand() *cobra.Command {
+	historyCmd := &cobra.Command{
+		Use:   "history",
+		Short: "List the backups recorded in the backup history file",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			defer DoSubcommandTeardown()
+			DoHistory()
+		}}
+	historyAfter = historyCmd.Flags().String("after", "", "Only list backups taken after the specified timestamp, in the format YYYYMMDDHHMMSS")
+	historyBefore = historyCmd.Flags().String("before", "", "Only list backups taken before the specified timestamp, in the format YYYYMMDDHHMMSS")
+	historyDBName = historyCmd.Flags().String("dbname", "", "Only list backups of the specified database")
+	historyFile = historyCmd.Flags().String("history-file", "", "The history file to read, instead of the one in $MASTER_DATA_DIRECTORY")
+	historyLimit = historyCmd.Flags().Int("limit", 0, "List at most this many backups, starting with the most recent")
+	historyStatus = historyCmd.Flags().String("status", "", "Only list backups with the specified status, either success or failure")
+	historyType = historyCmd.Flags().String("type", "", "Only list backups of the specified type: full, incremental, plain, masked, row-filtered, data-only, or metadata-only")
+	historyVerbose = historyCmd.Flags().Bool("verbose", false, "Print all recorded information for each backup in YAML format")
+	historyWithStats = historyCmd.Flags().Bool("with-stats", false, "Only list backups that include query plan statistics")
+	return historyCmd
+}
+
+func DoHistory() {
+	filter := utils.HistoryFilter{
+		DatabaseName:   *historyDBName,
+		Status:         *historyStatus,
+		BackupType:     *historyType,
+		WithStatistics: *historyWithStats,
+		Before:         *historyBefore,
+		After:          *historyAfter,
+		Limit:          *historyLimit,
+	}
+	utils.ValidateHistoryFilter(filter)
+	history := utils.ReadHistoryFile(GetHistoryFilePathForCommand())
+	entries := history.FilterEntries(filter)
+	if *historyVerbose {
+		PrintHistoryEntriesVerbose(os.Stdout, entries)
+	} else {
+		PrintHistoryEntries(os.Stdout, entries)
+	}
+}
+
+func GetHistoryFilePathForCommand() string {
+	if *historyFile != "" {
+		return *historyFile
+	}
+	masterDataDir := operating.System.Getenv("MASTER_DATA_DIRECTORY")
+	if masterDataDir == "" {
+		gplog.Fatal(errors.Errorf("MASTER_DATA_DIRECTORY is not set.  Set it or pass --history-file to specify the history file."), "")
+	}
+	return utils.GetHistoryFilePath(masterDataDir)
+}
+
+func PrintHistoryEntries(output io.Writer, entries []utils.HistoryEntry) {
+	writer := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "TIMESTAMP\tDATABASE\tSTATUS\tTYPE\tSTATISTICS\tDURATION\tPLUGIN\tBACKUP DIR")
+	for _, entry := range entries {
+		statsStr := "No"
+		if entry.WithStatistics {
+			statsStr = "Yes"
+		}
+		pluginStr := "None"
+		if entry.Plugin != "" {
+			pluginStr = entry.Plugin
+		}
+		backupDirStr := "Default"
+		if entry.BackupDir != "" {
+			backupDirStr = entry.BackupDir
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Timestamp, entry.DatabaseName, entry.Status,
+			entry.GetBackupType(), statsStr, entry.GetDuration(), pluginStr, backupDirStr)
+	}
+	_ = writer.Flush()
+}
+
+func PrintHistoryEntriesVerbose(output io.Writer, entries []utils.HistoryEntry) {
+	contents, err := yaml.Marshal(utils.History{Entries: entries})
+	gplog.FatalOnError(err)
+	_, err = output.Write(contents)
+	gplog.FatalOnError(err)
+}
+
+func WriteHistoryEntry(errMsg string) {
+	status := utils.HISTORY_STATUS_SUCCESS
+	if errMsg != "" {
+		status = utils.HISTORY_STATUS_FAILURE
+	}
+	entry := utils.HistoryEntry{
+		BackupConfig:   backupReport.BackupConfig,
+		Timestamp:      globalFPInfo.Timestamp,
+		EndTime:        utils.CurrentTimestamp(),
+		Status:         status,
+		ErrorMessage:   errMsg,
+		BackupDir:      *backupDir,
+		DatabaseSize:   backupReport.DatabaseSize,
+		IncludeSchemas: *includeSchemas,
+		ExcludeSchemas: *excludeSchemas,
+		IncludeTables:  *includeTables,
+		ExcludeTables:  *excludeTables,
+		TableFilters:   backupReport.TableFilters,
+		ObjectCounts:   objectCounts,
+	}
+	historyFilename := utils.GetHistoryFilePath(globalFPInfo.SegDirMap[-1])
+	gplog.Verbose("Recording backup in history file %s", historyFilename)
+	utils.AddHistoryEntry(historyFilename, entry)
+}
@@ -0,0 +1,30 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("backup/history tests", func() {
+	Describe("PrintHistoryEntries", func() {
+		It("prints a table of history entries", func() {
+			entries := []utils.HistoryEntry{
+				{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", Incremental: true, Plugin: "/tmp/plugin"}, Timestamp: "20170102010101", EndTime: "20170102010201", Status: utils.HISTORY_STATUS_SUCCESS, BackupDir: "/backups"},
+				{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", WithStatistics: true}, Timestamp: "20170101010101", Status: utils.HISTORY_STATUS_FAILURE},
+			}
+			backup.PrintHistoryEntries(buffer, entries)
+			Expect(buffer).To(Say(`TIMESTAMP\s+DATABASE\s+STATUS\s+TYPE\s+STATISTICS\s+DURATION\s+PLUGIN\s+BACKUP DIR`))
+			Expect(buffer).To(Say(`20170102010101\s+testdb\s+Success\s+incremental\s+No\s+0:01:00\s+/tmp/plugin\s+/backups`))
+			Expect(buffer).To(Say(`20170101010101\s+testdb\s+Failure\s+full\s+Yes\s+None\s+Default`))
+		})
+		It("prints only the header if there are no entries", func() {
+			backup.PrintHistoryEntries(buffer, []utils.HistoryEntry{})
+			Expect(buffer).To(Say(`TIMESTAMP\s+DATABASE`))
+			Expect(buffer).ToNot(Say(`testdb`))
+		})
+	})
+})
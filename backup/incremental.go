@@ -0,0 +1,156 @@
+package backup
+
+/*
+ * This file contains structs and functions related to incremental backups,
+ * in which the data for append-optimized tables that have not changed since
+ * a previous backup is not backed up again.
+ */
+
+import (
+	"path"
+	"sort"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * A previous backup can only serve as the base for an incremental backup if
+ * its data files can be restored alongside those of the new backup, so any
+ * options that affect how data files are written must match.  A backup whose
+ * rows were filtered is missing data that the incremental backup would skip,
+ * and a masked backup would restore masked data alongside unmasked data.  A
+ * plain backup has no data files for the incremental backup to refer to.
+ */
+func IsValidIncrementalBase(previousConfig *utils.BackupConfig, currentConfig *utils.BackupConfig) bool {
+	return previousConfig.DatabaseName == currentConfig.DatabaseName &&
+		!previousConfig.MetadataOnly &&
+		previousConfig.Format != "plain" &&
+		!previousConfig.RowFiltered &&
+		previousConfig.MaskingPolicyFingerprint == currentConfig.MaskingPolicyFingerprint &&
+		previousConfig.LeafPartitionData == currentConfig.LeafPartitionData &&
+		previousConfig.SingleDataFile == currentConfig.SingleDataFile &&
+		previousConfig.Compressed == currentConfig.Compressed &&
+		getCompressionType(previousConfig) == getCompressionType(currentConfig) &&
+		hasMatchingEncryptionKey(previousConfig, currentConfig) &&
+		previousConfig.Plugin == currentConfig.Plugin
+}
+
+func hasMatchingEncryptionKey(previousConfig *utils.BackupConfig, currentConfig *utils.BackupConfig) bool {
+	if previousConfig.Encrypted != currentConfig.Encrypted {
+		return false
+	}
+	if !currentConfig.Encrypted || previousConfig.EncryptionSalt == currentConfig.EncryptionSalt {
+		return previousConfig.EncryptionKeyFingerprint == currentConfig.EncryptionKeyFingerprint
+	}
+	return utils.IsEncryptionKeyForBackup(previousConfig.EncryptionSalt, previousConfig.EncryptionKeyFingerprint)
+}
+
+// Backups taken before the compression type was recorded always used gzip
+func getCompressionType(config *utils.BackupConfig) string {
+	if config.Compressed && config.CompressionType == "" {
+		return "gzip"
+	}
+	return config.CompressionType
+}
+
+/*
+ * A backup writes its config file during teardown even if it fails, but only
+ * writes its TOC once all data has been backed up, so we only consider backups
+ * with a TOC file to be complete.
+ */
+func GetLatestMatchingBackupTimestamp() string {
+	backupsDir := globalFPInfo.GetBackupsDirForContent(-1)
+	configFiles, err := operating.System.Glob(path.Join(backupsDir, "*", "*", "gpbackup_*_config.yaml"))
+	gplog.FatalOnError(err)
+	sort.Sort(sort.Reverse(sort.StringSlice(configFiles)))
+	for _, configFile := range configFiles {
+		timestamp := path.Base(path.Dir(configFile))
+		if !utils.IsValidTimestamp(timestamp) || timestamp >= globalFPInfo.Timestamp {
+			continue
+		}
+		fpInfo := globalFPInfo
+		fpInfo.Timestamp = timestamp
+		if !iohelper.FileExistsAndIsReadable(fpInfo.GetTOCFilePath()) {
+			continue
+		}
+		if IsValidIncrementalBase(utils.ReadConfigFile(configFile), &backupReport.BackupConfig) {
+			return timestamp
+		}
+	}
+	return ""
+}
+
+func GetIncrementalBaseTOC() *utils.TOC {
+	baseTimestamp := *fromTimestamp
+	if baseTimestamp == "" {
+		baseTimestamp = GetLatestMatchingBackupTimestamp()
+		if baseTimestamp == "" {
+			gplog.Fatal(errors.Errorf("There was no matching previous backup found with the flags provided.  Please take a full backup."), "")
+		}
+	}
+	fpInfo := globalFPInfo
+	fpInfo.Timestamp = baseTimestamp
+	for _, filename := range []string{fpInfo.GetConfigFilePath(), fpInfo.GetTOCFilePath()} {
+		if !iohelper.FileExistsAndIsReadable(filename) {
+			gplog.Fatal(errors.Errorf("Cannot access %s for backup %s", filename, baseTimestamp), "")
+		}
+	}
+	baseConfig := utils.ReadConfigFile(fpInfo.GetConfigFilePath())
+	if baseConfig.Format == "plain" {
+		gplog.Fatal(errors.Errorf("Backup %s cannot be used as the base for an incremental backup because it was taken with --format=plain", baseTimestamp), "")
+	}
+	if baseConfig.RowFiltered {
+		gplog.Fatal(errors.Errorf("Backup %s cannot be used as the base for an incremental backup because its rows were filtered with --table-filter-file", baseTimestamp), "")
+	}
+	if baseConfig.MaskingPolicyFingerprint != "" {
+		gplog.Fatal(errors.Errorf("Backup %s cannot be used as the base for an incremental backup because its data was masked with --masking-policy-file", baseTimestamp), "")
+	}
+	if !IsValidIncrementalBase(baseConfig, &backupReport.BackupConfig) {
+		gplog.Fatal(errors.Errorf("Backup %s cannot be used as the base for an incremental backup with the flags provided", baseTimestamp), "")
+	}
+	if baseConfig.Encrypted {
+		InitializeEncryptionKey(baseConfig.EncryptionSalt)
+	}
+	gplog.Info("Basing incremental backup on backup with timestamp %s", baseTimestamp)
+	backupReport.FromTimestamp = baseTimestamp
+	return utils.NewTOC(fpInfo.GetTOCFilePath())
+}
+
+/*
+ * Splits the tables into those whose data must be backed up and those whose
+ * data can be taken from the previous backup.  Only append-optimized tables
+ * can be skipped, and only if neither their modcount nor the time of the last
+ * DDL operation on them has changed and the previous backup contains their data.
+ */
+func FilterTablesForIncremental(previousTOC *utils.TOC, currentTOC *utils.TOC, tables []Relation) ([]Relation, []Relation) {
+	previousDataEntries := make(map[string]bool, len(previousTOC.DataEntries))
+	for _, entry := range previousTOC.DataEntries {
+		previousDataEntries[utils.MakeFQN(entry.Schema, entry.Name)] = true
+	}
+	changedTables := make([]Relation, 0)
+	unchangedTables := make([]Relation, 0)
+	for _, table := range tables {
+		currentAOEntry, isAOTable := currentTOC.IncrementalMetadata.AO[table.ToString()]
+		previousAOEntry, wasAOTable := previousTOC.IncrementalMetadata.AO[table.ToString()]
+		if isAOTable && wasAOTable && previousDataEntries[table.ToString()] && currentAOEntry == previousAOEntry {
+			unchangedTables = append(unchangedTables, table)
+		} else {
+			changedTables = append(changedTables, table)
+		}
+	}
+	return changedTables, unchangedTables
+}
+
+func AddIncrementalDataEntriesToTOC(previousTOC *utils.TOC, tables []Relation) {
+	previousDataEntries := make(map[string]utils.MasterDataEntry, len(previousTOC.DataEntries))
+	for _, entry := range previousTOC.DataEntries {
+		previousDataEntries[utils.MakeFQN(entry.Schema, entry.Name)] = entry
+	}
+	for _, table := range tables {
+		globalTOC.AddIncrementalDataEntry(previousDataEntries[table.ToString()], backupReport.FromTimestamp)
+	}
+}
@@ -0,0 +1,247 @@
+package backup_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/incremental tests", func() {
+	Describe("IsValidIncrementalBase", func() {
+		var currentConfig utils.BackupConfig
+		BeforeEach(func() {
+			currentConfig = utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, Incremental: true}
+		})
+		It("accepts a backup with matching options", func() {
+			previousConfig := utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true}
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeTrue())
+		})
+		It("accepts a backup that is itself incremental", func() {
+			previousConfig := utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, Incremental: true}
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeTrue())
+		})
+		It("rejects a backup of a different database", func() {
+			previousConfig := utils.BackupConfig{DatabaseName: "otherdb", Compressed: true, LeafPartitionData: true}
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeFalse())
+		})
+		It("rejects a metadata-only backup", func() {
+			previousConfig := utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, MetadataOnly: true}
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeFalse())
+		})
+		It("rejects a backup without one data file per leaf partition", func() {
+			previousConfig := utils.BackupConfig{DatabaseName: "testdb", Compressed: true}
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeFalse())
+		})
+		It("rejects a backup whose rows were filtered", func() {
+			previousConfig := utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, RowFiltered: true}
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeFalse())
+		})
+		It("rejects a plain backup", func() {
+			previousConfig := utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, Format: "plain"}
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeFalse())
+		})
+		It("rejects a masked backup", func() {
+			previousConfig := utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, MaskingPolicyFingerprint: "0123456789abcdef"}
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeFalse())
+		})
+		It("rejects a backup with a different compression setting", func() {
+			previousConfig := utils.BackupConfig{DatabaseName: "testdb", LeafPartitionData: true}
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeFalse())
+		})
+		It("rejects a backup with a different compression type", func() {
+			previousConfig := utils.BackupConfig{DatabaseName: "testdb", Compressed: true, CompressionType: "zstd", LeafPartitionData: true}
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeFalse())
+		})
+		It("accepts a gzip backup taken before the compression type was recorded", func() {
+			currentConfig.CompressionType = "gzip"
+			previousConfig := utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true}
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeTrue())
+		})
+		It("rejects a backup with a different data file format", func() {
+			previousConfig := utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, SingleDataFile: true}
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeFalse())
+		})
+		It("rejects a backup using a different plugin", func() {
+			previousConfig := utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, Plugin: "/tmp/plugin"}
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeFalse())
+		})
+		It("rejects a backup encrypted with a different key", func() {
+			previousConfig := utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, Encrypted: true, EncryptionKeyFingerprint: "0123456789abcdef"}
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeFalse())
+		})
+		It("accepts a backup encrypted with the same passphrase and a different salt", func() {
+			keyFile := "/tmp/gpbackup_incremental_key"
+			_ = ioutil.WriteFile(keyFile, []byte("format=passphrase\nmy passphrase\n"), 0600)
+			defer os.Remove(keyFile)
+			previousSalt := utils.GenerateEncryptionSalt()
+			previousKey, _ := utils.ReadEncryptionKeyFile(keyFile, previousSalt)
+			previousConfig := utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, Encrypted: true, EncryptionSalt: previousSalt, EncryptionKeyFingerprint: utils.GetEncryptionKeyFingerprint(previousKey)}
+
+			currentSalt := utils.GenerateEncryptionSalt()
+			utils.InitializeEncryptionKey(keyFile, currentSalt)
+			defer utils.InitializeEncryptionKey("", "")
+			_, currentKey := utils.GetEncryptionParameters()
+			currentConfig.Encrypted = true
+			currentConfig.EncryptionSalt = currentSalt
+			currentConfig.EncryptionKeyFingerprint = utils.GetEncryptionKeyFingerprint(currentKey)
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeTrue())
+
+			_ = ioutil.WriteFile(keyFile, []byte("format=passphrase\nanother passphrase\n"), 0600)
+			Expect(backup.IsValidIncrementalBase(&previousConfig, &currentConfig)).To(BeFalse())
+		})
+	})
+	Describe("GetLatestMatchingBackupTimestamp", func() {
+		var backupsDir string
+		writeBackup := func(timestamp string, config utils.BackupConfig, withTOC bool) {
+			fpInfo := utils.FilePathInfo{SegDirMap: map[int]string{-1: path.Dir(backupsDir)}, Timestamp: timestamp}
+			Expect(os.MkdirAll(fpInfo.GetDirForContent(-1), 0755)).To(Succeed())
+			contents := fmt.Sprintf("databasename: %s\ncompressed: %v\nleafpartitiondata: %v\nrowfiltered: %v\nmaskingpolicyfingerprint: %q\nformat: %q\n", config.DatabaseName, config.Compressed, config.LeafPartitionData, config.RowFiltered, config.MaskingPolicyFingerprint, config.Format)
+			Expect(ioutil.WriteFile(fpInfo.GetConfigFilePath(), []byte(contents), 0644)).To(Succeed())
+			if withTOC {
+				Expect(ioutil.WriteFile(fpInfo.GetTOCFilePath(), []byte("dataentries: []\n"), 0644)).To(Succeed())
+			}
+		}
+		BeforeEach(func() {
+			tempDir, err := ioutil.TempDir("", "incremental_test")
+			Expect(err).ToNot(HaveOccurred())
+			backupsDir = path.Join(tempDir, "backups")
+			fpInfo := utils.NewFilePathInfo(&cluster.Cluster{Segments: map[int]cluster.SegConfig{-1: {DataDir: tempDir}}}, "", "20170103010101", "gpseg")
+			backup.SetFPInfo(fpInfo)
+			backup.SetReport(&utils.Report{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, Incremental: true}})
+		})
+		AfterEach(func() {
+			_ = os.RemoveAll(path.Dir(backupsDir))
+			testutils.SetupTestCluster()
+		})
+		It("returns the most recent matching backup", func() {
+			writeBackup("20170101010101", utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true}, true)
+			writeBackup("20170102010101", utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true}, true)
+			Expect(backup.GetLatestMatchingBackupTimestamp()).To(Equal("20170102010101"))
+		})
+		It("skips backups that do not match", func() {
+			writeBackup("20170101010101", utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true}, true)
+			writeBackup("20170102010101", utils.BackupConfig{DatabaseName: "otherdb", Compressed: true, LeafPartitionData: true}, true)
+			Expect(backup.GetLatestMatchingBackupTimestamp()).To(Equal("20170101010101"))
+		})
+		It("skips backups without a TOC file", func() {
+			writeBackup("20170101010101", utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true}, true)
+			writeBackup("20170102010101", utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true}, false)
+			Expect(backup.GetLatestMatchingBackupTimestamp()).To(Equal("20170101010101"))
+		})
+		It("skips backups taken after the current backup", func() {
+			writeBackup("20170101010101", utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true}, true)
+			writeBackup("20170104010101", utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true}, true)
+			Expect(backup.GetLatestMatchingBackupTimestamp()).To(Equal("20170101010101"))
+		})
+		It("returns an empty string if there is no matching backup", func() {
+			writeBackup("20170101010101", utils.BackupConfig{DatabaseName: "otherdb", Compressed: true, LeafPartitionData: true}, true)
+			Expect(backup.GetLatestMatchingBackupTimestamp()).To(Equal(""))
+		})
+		It("skips backups whose rows were filtered", func() {
+			writeBackup("20170101010101", utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true}, true)
+			writeBackup("20170102010101", utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, RowFiltered: true}, true)
+			Expect(backup.GetLatestMatchingBackupTimestamp()).To(Equal("20170101010101"))
+		})
+		It("rejects a row-filtered backup specified with --from-timestamp", func() {
+			writeBackup("20170102010101", utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, RowFiltered: true}, true)
+			backup.SetFromTimestamp("20170102010101")
+			defer backup.SetFromTimestamp("")
+			defer testhelper.ShouldPanicWithMessage("Backup 20170102010101 cannot be used as the base for an incremental backup because its rows were filtered with --table-filter-file")
+			backup.GetIncrementalBaseTOC()
+		})
+		It("rejects a plain backup specified with --from-timestamp", func() {
+			writeBackup("20170102010101", utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, Format: "plain"}, true)
+			backup.SetFromTimestamp("20170102010101")
+			defer backup.SetFromTimestamp("")
+			defer testhelper.ShouldPanicWithMessage("Backup 20170102010101 cannot be used as the base for an incremental backup because it was taken with --format=plain")
+			backup.GetIncrementalBaseTOC()
+		})
+		It("rejects a masked backup specified with --from-timestamp", func() {
+			writeBackup("20170102010101", utils.BackupConfig{DatabaseName: "testdb", Compressed: true, LeafPartitionData: true, MaskingPolicyFingerprint: "0123456789abcdef"}, true)
+			backup.SetFromTimestamp("20170102010101")
+			defer backup.SetFromTimestamp("")
+			defer testhelper.ShouldPanicWithMessage("Backup 20170102010101 cannot be used as the base for an incremental backup because its data was masked with --masking-policy-file")
+			backup.GetIncrementalBaseTOC()
+		})
+	})
+	Describe("FilterTablesForIncremental", func() {
+		heapTable := backup.Relation{Oid: 1, Schema: "public", Name: "heap"}
+		aoTable := backup.Relation{Oid: 2, Schema: "public", Name: "ao"}
+		var previousTOC, currentTOC *utils.TOC
+		BeforeEach(func() {
+			previousTOC = &utils.TOC{
+				DataEntries: []utils.MasterDataEntry{
+					{Schema: "public", Name: "heap", Oid: 1},
+					{Schema: "public", Name: "ao", Oid: 2},
+				},
+				IncrementalMetadata: utils.IncrementalEntries{AO: map[string]utils.AOEntry{
+					"public.ao": {Modcount: 5, LastDDLTimestamp: "2017-01-01 01:01:01"},
+				}},
+			}
+			currentTOC = &utils.TOC{
+				IncrementalMetadata: utils.IncrementalEntries{AO: map[string]utils.AOEntry{
+					"public.ao": {Modcount: 5, LastDDLTimestamp: "2017-01-01 01:01:01"},
+				}},
+			}
+		})
+		It("always backs up heap tables", func() {
+			changed, unchanged := backup.FilterTablesForIncremental(previousTOC, currentTOC, []backup.Relation{heapTable})
+			Expect(changed).To(Equal([]backup.Relation{heapTable}))
+			Expect(unchanged).To(BeEmpty())
+		})
+		It("skips an append-optimized table that has not changed", func() {
+			changed, unchanged := backup.FilterTablesForIncremental(previousTOC, currentTOC, []backup.Relation{heapTable, aoTable})
+			Expect(changed).To(Equal([]backup.Relation{heapTable}))
+			Expect(unchanged).To(Equal([]backup.Relation{aoTable}))
+		})
+		It("backs up an append-optimized table whose modcount has changed", func() {
+			currentTOC.IncrementalMetadata.AO["public.ao"] = utils.AOEntry{Modcount: 6, LastDDLTimestamp: "2017-01-01 01:01:01"}
+			changed, unchanged := backup.FilterTablesForIncremental(previousTOC, currentTOC, []backup.Relation{aoTable})
+			Expect(changed).To(Equal([]backup.Relation{aoTable}))
+			Expect(unchanged).To(BeEmpty())
+		})
+		It("backs up an append-optimized table that has had a DDL operation", func() {
+			currentTOC.IncrementalMetadata.AO["public.ao"] = utils.AOEntry{Modcount: 5, LastDDLTimestamp: "2017-01-02 01:01:01"}
+			changed, unchanged := backup.FilterTablesForIncremental(previousTOC, currentTOC, []backup.Relation{aoTable})
+			Expect(changed).To(Equal([]backup.Relation{aoTable}))
+			Expect(unchanged).To(BeEmpty())
+		})
+		It("backs up an append-optimized table whose data is not in the previous backup", func() {
+			previousTOC.DataEntries = []utils.MasterDataEntry{{Schema: "public", Name: "heap", Oid: 1}}
+			changed, unchanged := backup.FilterTablesForIncremental(previousTOC, currentTOC, []backup.Relation{aoTable})
+			Expect(changed).To(Equal([]backup.Relation{aoTable}))
+			Expect(unchanged).To(BeEmpty())
+		})
+	})
+	Describe("AddIncrementalDataEntriesToTOC", func() {
+		It("adds entries referring to the backups containing the data", func() {
+			previousTOC := &utils.TOC{
+				DataEntries: []utils.MasterDataEntry{
+					{Schema: "public", Name: "ao1", Oid: 1, AttributeString: "(i)", RowsCopied: 10},
+					{Schema: "public", Name: "ao2", Oid: 2, AttributeString: "(j)", RowsCopied: 20, Timestamp: "20161231010101"},
+				},
+			}
+			tables := []backup.Relation{{Oid: 1, Schema: "public", Name: "ao1"}, {Oid: 2, Schema: "public", Name: "ao2"}}
+			toc := &utils.TOC{}
+			backup.SetTOC(toc)
+			backup.SetReport(&utils.Report{BackupConfig: utils.BackupConfig{FromTimestamp: "20170101010101"}})
+
+			backup.AddIncrementalDataEntriesToTOC(previousTOC, tables)
+
+			Expect(toc.DataEntries).To(Equal([]utils.MasterDataEntry{
+				{Schema: "public", Name: "ao1", Oid: 1, AttributeString: "(i)", RowsCopied: 10, Timestamp: "20170101010101"},
+				{Schema: "public", Name: "ao2", Oid: 2, AttributeString: "(j)", RowsCopied: 20, Timestamp: "20161231010101"},
+			}))
+		})
+	})
+})
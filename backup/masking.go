@@ -0,0 +1,217 @@
+package backup
+
+/*
+ * This file contains structs and functions related to masking column data
+ * during a backup with --masking-policy-file.
+ */
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	MASK_HASH       = "hash"
+	MASK_NULLIFY    = "nullify"
+	MASK_FIXED      = "fixed"
+	MASK_EXPRESSION = "expression"
+)
+
+/*
+ * The value of a rule is the replacement value for the "fixed" function and
+ * the SQL expression for the "expression" function, and is unused otherwise.
+ */
+type MaskingRule struct {
+	Function string
+	Value    string
+}
+
+/*
+ * The masking policy file is a YAML map from each table to a map from each of
+ * its masked columns to a masking rule, such as
+ *   public.customers:
+ *     email:
+ *       function: hash
+ *     country:
+ *       function: fixed
+ *       value: unknown
+ *     salary:
+ *       function: expression
+ *       value: round(salary, -4)
+ */
+type MaskingPolicy map[string]map[string]MaskingRule
+
+func ReadMaskingPolicyFile(filename string) (MaskingPolicy, string) {
+	contents, err := operating.System.ReadFile(filename)
+	gplog.FatalOnError(err)
+	policy := make(MaskingPolicy, 0)
+	err = yaml.UnmarshalStrict(contents, &policy)
+	if err != nil {
+		gplog.Fatal(err, "Unable to parse masking policy file %s", filename)
+	}
+	for table, columns := range policy {
+		for column, rule := range columns {
+			validateMaskingRule(table, column, rule)
+		}
+	}
+	return policy, GetMaskingPolicyFingerprint(contents)
+}
+
+func validateMaskingRule(table string, column string, rule MaskingRule) {
+	switch rule.Function {
+	case MASK_HASH, MASK_NULLIFY:
+		if rule.Value != "" {
+			gplog.Fatal(errors.Errorf("The %s masking function for column %s of table %s does not take a value", rule.Function, column, table), "")
+		}
+	case MASK_FIXED:
+	case MASK_EXPRESSION:
+		if strings.TrimSpace(rule.Value) == "" {
+			gplog.Fatal(errors.Errorf("The expression masking function for column %s of table %s requires an expression as its value", column, table), "")
+		}
+	default:
+		gplog.Fatal(errors.Errorf("Column %s of table %s has unknown masking function \"%s\".  The masking function must be one of %s, %s, %s, or %s.", column, table, rule.Function, MASK_HASH, MASK_NULLIFY, MASK_FIXED, MASK_EXPRESSION), "")
+	}
+}
+
+/*
+ * Hashed values are salted with a secret generated for each backup and not
+ * stored anywhere, so that a hashed value cannot be recovered by hashing
+ * candidate values.  Hashed values are only consistent within one backup.
+ */
+func GenerateMaskingSecret() string {
+	secret := make([]byte, 16)
+	_, err := rand.Read(secret)
+	gplog.FatalOnError(err)
+	return hex.EncodeToString(secret)
+}
+
+// The fingerprint is stored in the backup config file to identify the policy without storing it.
+func GetMaskingPolicyFingerprint(contents []byte) string {
+	checksum := sha256.Sum256(contents)
+	return hex.EncodeToString(checksum[:16])
+}
+
+/*
+ * With --leaf-partition-data, the data of a partition table is backed up from
+ * its leaf partitions, so the policy of the root table applies to each leaf.
+ */
+func getMaskingRules(table Relation) (map[string]MaskingRule, bool) {
+	if columnRules, ok := maskingPolicy[table.ToString()]; ok {
+		return columnRules, true
+	}
+	if root, ok := partitionRoots[table.Oid]; ok && *leafPartitionData {
+		columnRules, ok := maskingPolicy[root]
+		return columnRules, ok
+	}
+	return nil, false
+}
+
+/*
+ * This is checked once the columns of each table are known, so that a column
+ * misspelled in the policy cannot leave the data in that column unmasked, and
+ * a masked value that is too long for its column is reported before any data
+ * is backed up where possible.
+ */
+func ValidateMaskingPolicy(tables []Relation, tableDefs map[uint32]TableDefinition) {
+	for _, table := range tables {
+		columnRules, ok := getMaskingRules(table)
+		if !ok || tableDefs[table.Oid].IsExternal {
+			continue
+		}
+		columnDefs := make(map[string]ColumnDefinition, len(tableDefs[table.Oid].ColumnDefs))
+		for _, columnDef := range tableDefs[table.Oid].ColumnDefs {
+			columnDefs[columnDef.Name] = columnDef
+		}
+		columns := make([]string, 0, len(columnRules))
+		for column := range columnRules {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		for _, column := range columns {
+			columnDef, ok := columnDefs[column]
+			if !ok {
+				gplog.Fatal(errors.Errorf("Column %s of table %s in the masking policy does not exist", column, table.ToString()), "")
+			}
+			_, maxLength := getCharacterLengthLimit(columnDef.Type)
+			switch columnRules[column].Function {
+			case MASK_NULLIFY:
+				if columnDef.NotNull {
+					gplog.Fatal(errors.Errorf("Column %s of table %s cannot be nullified because it is NOT NULL", column, table.ToString()), "")
+				}
+			case MASK_HASH:
+				if !isCharacterType(columnDef.Type) {
+					gplog.Fatal(errors.Errorf("Column %s of table %s cannot be hashed because it has type %s.  Only character columns can be hashed; use an expression to mask other columns.", column, table.ToString(), columnDef.Type), "")
+				}
+				if maxLength > 0 && maxLength < hashLength {
+					gplog.Fatal(errors.Errorf("Column %s of table %s cannot be hashed because it has type %s.  Hashed values are %d characters long.", column, table.ToString(), columnDef.Type, hashLength), "")
+				}
+			case MASK_FIXED:
+				if maxLength > 0 && len([]rune(columnRules[column].Value)) > maxLength {
+					gplog.Fatal(errors.Errorf("The fixed value for column %s of table %s is too long for type %s", column, table.ToString(), columnDef.Type), "")
+				}
+			}
+		}
+	}
+}
+
+func isCharacterType(columnType string) bool {
+	isArray := strings.HasSuffix(columnType, "]")
+	return !isArray && (columnType == "text" || strings.HasPrefix(columnType, "character"))
+}
+
+const hashLength = 32
+
+var characterLengthRegex = regexp.MustCompile(`^(character varying|character)\((\d+)\)$`)
+
+/*
+ * Returns the type without its length and the maximum length of a column of a
+ * length-limited character type, or an empty string and 0 for other types.
+ */
+func getCharacterLengthLimit(columnType string) (string, int) {
+	matches := characterLengthRegex.FindStringSubmatch(columnType)
+	if matches == nil {
+		return "", 0
+	}
+	maxLength, _ := strconv.Atoi(matches[2])
+	return matches[1], maxLength
+}
+
+/*
+ * Each masked value is cast to the type of its column, so that the masked
+ * data can be restored into the table the backup creates.  A cast to a
+ * length-limited character type silently truncates a value that is too long,
+ * so such values are instead converted with the function used when a value is
+ * assigned to a column, which fails the backup if the value is too long.
+ */
+func GetMaskedColumnExpression(columnDef ColumnDefinition, rule MaskingRule) string {
+	value := ""
+	switch rule.Function {
+	case MASK_HASH:
+		value = fmt.Sprintf("md5('%s' || %s::text)", maskingSecret, columnDef.Name)
+	case MASK_NULLIFY:
+		return fmt.Sprintf("NULL::%s", columnDef.Type)
+	case MASK_FIXED:
+		value = fmt.Sprintf("'%s'", strings.Replace(rule.Value, "'", "''", -1))
+	default:
+		value = fmt.Sprintf("(%s)", rule.Value)
+	}
+	baseType, maxLength := getCharacterLengthLimit(columnDef.Type)
+	switch baseType {
+	case "character varying":
+		return fmt.Sprintf("pg_catalog.varchar(%s::character varying, %d, false)", value, maxLength+4)
+	case "character":
+		return fmt.Sprintf("pg_catalog.bpchar(%s::bpchar, %d, false)", value, maxLength+4)
+	}
+	return fmt.Sprintf("%s::%s", value, columnDef.Type)
+}
@@ -0,0 +1,150 @@
+package backup_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/backup"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/masking tests", func() {
+	Describe("ReadMaskingPolicyFile", func() {
+		var filename string
+		BeforeEach(func() {
+			file, _ := ioutil.TempFile("", "gpbackup_masking_policy")
+			_ = file.Close()
+			filename = file.Name()
+		})
+		AfterEach(func() {
+			_ = os.Remove(filename)
+		})
+		It("reads the masking rule for each column", func() {
+			contents := []byte(`public.customers:
+  email:
+    function: hash
+  country:
+    function: fixed
+    value: unknown
+  salary:
+    function: expression
+    value: round(salary, -4)
+`)
+			_ = ioutil.WriteFile(filename, contents, 0644)
+			policy, fingerprint := backup.ReadMaskingPolicyFile(filename)
+			Expect(policy).To(Equal(backup.MaskingPolicy{"public.customers": {
+				"email":   {Function: "hash"},
+				"country": {Function: "fixed", Value: "unknown"},
+				"salary":  {Function: "expression", Value: "round(salary, -4)"},
+			}}))
+			Expect(fingerprint).To(Equal(backup.GetMaskingPolicyFingerprint(contents)))
+			Expect(fingerprint).To(HaveLen(32))
+		})
+		It("panics if a masking function is unknown", func() {
+			_ = ioutil.WriteFile(filename, []byte("public.customers:\n  email:\n    function: scramble\n"), 0644)
+			defer testhelper.ShouldPanicWithMessage(`Column email of table public.customers has unknown masking function "scramble".  The masking function must be one of hash, nullify, fixed, or expression.`)
+			backup.ReadMaskingPolicyFile(filename)
+		})
+		It("panics if an expression is missing", func() {
+			_ = ioutil.WriteFile(filename, []byte("public.customers:\n  salary:\n    function: expression\n"), 0644)
+			defer testhelper.ShouldPanicWithMessage("The expression masking function for column salary of table public.customers requires an expression as its value")
+			backup.ReadMaskingPolicyFile(filename)
+		})
+		It("panics if a rule has an unknown field", func() {
+			_ = ioutil.WriteFile(filename, []byte("public.customers:\n  email:\n    funtion: hash\n"), 0644)
+			defer testhelper.ShouldPanicWithMessage("Unable to parse masking policy file")
+			backup.ReadMaskingPolicyFile(filename)
+		})
+	})
+	Describe("ValidateMaskingPolicy", func() {
+		customers := backup.Relation{Oid: 1, Schema: "public", Name: "customers"}
+		tableDefs := map[uint32]backup.TableDefinition{1: {ColumnDefs: []backup.ColumnDefinition{
+			{Name: "id", Type: "integer", NotNull: true},
+			{Name: "email", Type: "character varying(100)"},
+		}}}
+		AfterEach(func() {
+			backup.SetMaskingPolicy(nil)
+		})
+		It("passes if each masked column can be masked", func() {
+			backup.SetMaskingPolicy(backup.MaskingPolicy{"public.customers": {"email": {Function: "hash"}, "id": {Function: "expression", Value: "id % 100"}}})
+			backup.ValidateMaskingPolicy([]backup.Relation{customers}, tableDefs)
+		})
+		It("panics if a masked column does not exist", func() {
+			backup.SetMaskingPolicy(backup.MaskingPolicy{"public.customers": {"emial": {Function: "hash"}}})
+			defer testhelper.ShouldPanicWithMessage("Column emial of table public.customers in the masking policy does not exist")
+			backup.ValidateMaskingPolicy([]backup.Relation{customers}, tableDefs)
+		})
+		It("panics if a NOT NULL column is nullified", func() {
+			backup.SetMaskingPolicy(backup.MaskingPolicy{"public.customers": {"id": {Function: "nullify"}}})
+			defer testhelper.ShouldPanicWithMessage("Column id of table public.customers cannot be nullified because it is NOT NULL")
+			backup.ValidateMaskingPolicy([]backup.Relation{customers}, tableDefs)
+		})
+		It("panics if a non-character column is hashed", func() {
+			backup.SetMaskingPolicy(backup.MaskingPolicy{"public.customers": {"id": {Function: "hash"}}})
+			defer testhelper.ShouldPanicWithMessage("Column id of table public.customers cannot be hashed because it has type integer.")
+			backup.ValidateMaskingPolicy([]backup.Relation{customers}, tableDefs)
+		})
+		It("panics if a hashed value is too long for its column", func() {
+			shortTableDefs := map[uint32]backup.TableDefinition{1: {ColumnDefs: []backup.ColumnDefinition{{Name: "email", Type: "character varying(20)"}}}}
+			backup.SetMaskingPolicy(backup.MaskingPolicy{"public.customers": {"email": {Function: "hash"}}})
+			defer testhelper.ShouldPanicWithMessage("Column email of table public.customers cannot be hashed because it has type character varying(20).  Hashed values are 32 characters long.")
+			backup.ValidateMaskingPolicy([]backup.Relation{customers}, shortTableDefs)
+		})
+		It("panics if a fixed value is too long for its column", func() {
+			shortTableDefs := map[uint32]backup.TableDefinition{1: {ColumnDefs: []backup.ColumnDefinition{{Name: "email", Type: "character(5)"}}}}
+			backup.SetMaskingPolicy(backup.MaskingPolicy{"public.customers": {"email": {Function: "fixed", Value: "nobody"}}})
+			defer testhelper.ShouldPanicWithMessage("The fixed value for column email of table public.customers is too long for type character(5)")
+			backup.ValidateMaskingPolicy([]backup.Relation{customers}, shortTableDefs)
+		})
+		It("validates a leaf partition against the policy of its root table with --leaf-partition-data", func() {
+			backup.SetLeafPartitionData(true)
+			backup.SetPartitionLeaves([]backup.PartitionLeaf{{Oid: 2, Schema: "public", Name: "customers_1_prt_1", RootName: "public.customers"}})
+			defer backup.SetLeafPartitionData(false)
+			defer backup.SetPartitionLeaves(nil)
+			leaf := backup.Relation{Oid: 2, Schema: "public", Name: "customers_1_prt_1"}
+			leafTableDefs := map[uint32]backup.TableDefinition{2: tableDefs[1]}
+			backup.SetMaskingPolicy(backup.MaskingPolicy{"public.customers": {"emial": {Function: "hash"}}})
+			defer testhelper.ShouldPanicWithMessage("Column emial of table public.customers_1_prt_1 in the masking policy does not exist")
+			backup.ValidateMaskingPolicy([]backup.Relation{leaf}, leafTableDefs)
+		})
+	})
+	DescribeTable("GetMaskedColumnExpression", func(columnType string, rule backup.MaskingRule, expected string) {
+		backup.SetMaskingSecret("0123456789abcdef")
+		defer backup.SetMaskingSecret("")
+		columnDef := backup.ColumnDefinition{Name: "email", Type: columnType}
+		Expect(backup.GetMaskedColumnExpression(columnDef, rule)).To(Equal(expected))
+	},
+		Entry("hashes a column with the secret of the backup", "text", backup.MaskingRule{Function: "hash"}, "md5('0123456789abcdef' || email::text)::text"),
+		Entry("nullifies a column", "character varying(100)", backup.MaskingRule{Function: "nullify"}, "NULL::character varying(100)"),
+		Entry("replaces a column with a fixed value", "text", backup.MaskingRule{Function: "fixed", Value: "nobody's"}, "'nobody''s'::text"),
+		Entry("replaces a column with an expression", "integer", backup.MaskingRule{Function: "expression", Value: "email % 100"}, "(email % 100)::integer"),
+		Entry("checks the length of a value for a character varying column", "character varying(100)", backup.MaskingRule{Function: "expression", Value: "left(email, 2)"}, "pg_catalog.varchar((left(email, 2))::character varying, 104, false)"),
+		Entry("checks the length of a value for a character column", "character(40)", backup.MaskingRule{Function: "hash"}, "pg_catalog.bpchar(md5('0123456789abcdef' || email::text)::bpchar, 44, false)"),
+	)
+	Describe("GetCopySelectQuery", func() {
+		foo := backup.Relation{Oid: 1, Schema: "public", Name: "foo"}
+		columnDefs := []backup.ColumnDefinition{{Name: "i", Type: "integer"}, {Name: "email", Type: "text"}}
+		AfterEach(func() {
+			backup.SetMaskingPolicy(nil)
+			backup.SetTableFilters(nil)
+		})
+		It("returns no query for a table that is neither filtered nor masked", func() {
+			Expect(backup.GetCopySelectQuery(foo, columnDefs)).To(Equal(""))
+		})
+		It("selects the masked columns in column order", func() {
+			backup.SetMaskingPolicy(backup.MaskingPolicy{"public.foo": {"email": {Function: "hash"}}})
+			backup.SetMaskingSecret("0123456789abcdef")
+			defer backup.SetMaskingSecret("")
+			Expect(backup.GetCopySelectQuery(foo, columnDefs)).To(Equal("SELECT i, md5('0123456789abcdef' || email::text)::text AS email FROM public.foo"))
+		})
+		It("filters and masks the same table", func() {
+			backup.SetMaskingPolicy(backup.MaskingPolicy{"public.foo": {"email": {Function: "nullify"}}})
+			backup.SetTableFilters(map[string]string{"public.foo": "i > 10"})
+			Expect(backup.GetCopySelectQuery(foo, columnDefs)).To(Equal("SELECT i, NULL::text AS email FROM public.foo WHERE i > 10"))
+		})
+	})
+})
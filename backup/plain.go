@@ -0,0 +1,109 @@
+package backup
+
+/*
+ * This file contains functions related to writing a backup as a single SQL
+ * script with --format=plain, which can be restored with psql instead of
+ * gprestore.
+ */
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * These are the settings gprestore uses for its connections, apart from those
+ * specific to gprestore, so that the statements behave the same in psql.
+ */
+const PLAIN_SCRIPT_SETTINGS = `SET search_path TO pg_catalog;
+SET gp_default_storage_options = '';
+SET statement_timeout = 0;
+SET check_function_bodies = false;
+SET client_min_messages = error;
+SET standard_conforming_strings = on;
+SET default_with_oids = off;
+`
+
+/*
+ * The script is assembled from the metadata file once it has been written,
+ * with the data for each table between the predata and postdata statements.
+ * The data is copied to a file on the master in the backup transaction, so
+ * it is consistent with the metadata, and then appended to the script.
+ */
+func WritePlainScript(metadataFilename string, tables []Relation, tableDefs map[uint32]TableDefinition) {
+	scriptFilename := globalFPInfo.GetPlainScriptFilePath()
+	gplog.Info("Writing plain SQL script to %s", scriptFilename)
+	metadataFile, err := os.Open(metadataFilename)
+	gplog.FatalOnError(err)
+	defer metadataFile.Close()
+	scriptFile := utils.NewFileWithByteCountFromFile(scriptFilename)
+	defer scriptFile.Close()
+
+	scriptFile.MustPrintf("--\n-- Greenplum Database backup %s of database %s, written by gpbackup %s\n--\n\n", globalFPInfo.Timestamp, backupReport.DatabaseName, version)
+	scriptFile.MustPrintf(PLAIN_SCRIPT_SETTINGS)
+	writePlainStatements(scriptFile, globalTOC.GetSQLStatementForObjectTypes("global", metadataFile, []string{"SESSION GUCS"}, []string{}, []string{}, []string{}, []string{}, []string{}))
+	writePlainStatements(scriptFile, globalTOC.GetAllSQLStatements("predata", metadataFile))
+	if !backupReport.MetadataOnly {
+		if maskingPolicy != nil {
+			ValidateMaskingPolicy(tables, tableDefs)
+		}
+		rowsCopied := writePlainTableData(scriptFile, tables, tableDefs)
+		AddTableDataEntriesToTOC(tables, tableDefs, []map[uint32]int64{rowsCopied})
+	}
+	writePlainStatements(scriptFile, globalTOC.GetAllSQLStatements("postdata", metadataFile))
+	scriptFile.MustPrintf("\n")
+}
+
+func writePlainStatements(scriptFile *utils.FileWithByteCount, statements []utils.StatementWithType) {
+	for _, statement := range statements {
+		scriptFile.MustPrintf("%s", statement.Statement)
+	}
+}
+
+func writePlainTableData(scriptFile *utils.FileWithByteCount, tables []Relation, tableDefs map[uint32]TableDefinition) map[uint32]int64 {
+	dataFilename := path.Join(globalFPInfo.GetDirForContent(-1), fmt.Sprintf("gpbackup_%s_plain_data", globalFPInfo.Timestamp))
+	defer os.Remove(dataFilename)
+	rowsCopied := make(map[uint32]int64, 0)
+	progressBar := utils.NewProgressBar(len(tables), "Tables backed up: ", utils.PB_INFO)
+	progressBar.Start()
+	for _, table := range tables {
+		if wasTerminated {
+			break
+		}
+		if tableDefs[table.Oid].IsExternal {
+			gplog.Verbose("Skipping data backup of table %s because it is an external table.", table.ToString())
+			progressBar.Increment()
+			continue
+		}
+		gplog.Verbose("Writing data for table %s to plain SQL script", table.ToString())
+		rowsCopied[table.Oid] = CopyTableOutToMaster(table, tableDefs[table.Oid].ColumnDefs, dataFilename)
+		attributes := ConstructTableAttributesList(tableDefs[table.Oid].ColumnDefs)
+		scriptFile.MustPrintf("\n\nCOPY %s %s FROM stdin;\n", table.ToString(), attributes)
+		dataFile, err := os.Open(dataFilename)
+		gplog.FatalOnError(err)
+		scriptFile.MustCopyFrom(dataFile)
+		_ = dataFile.Close()
+		scriptFile.MustPrintf("\\.\n")
+		progressBar.Increment()
+	}
+	progressBar.Finish()
+	return rowsCopied
+}
+
+// The data is gathered from the segments and written in text format by the master.
+func CopyTableOutToMaster(table Relation, columnDefs []ColumnDefinition, dataFilename string) int64 {
+	query := fmt.Sprintf("COPY %s TO '%s' IGNORE EXTERNAL PARTITIONS;", table.ToString(), dataFilename)
+	if selectQuery := GetCopySelectQuery(table, columnDefs); selectQuery != "" {
+		query = fmt.Sprintf("COPY (%s) TO '%s';", selectQuery, dataFilename)
+	}
+	result, err := connectionPool.Exec(query)
+	if err != nil {
+		gplog.Fatal(err, "Unable to back up data for table %s", table.ToString())
+	}
+	numRows, _ := result.RowsAffected()
+	return numRows
+}
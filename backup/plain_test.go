@@ -0,0 +1,111 @@
+package backup_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var _ = Describe("backup/plain tests", func() {
+	var (
+		backupDir string
+		fpInfo    utils.FilePathInfo
+		toc       *utils.TOC
+	)
+	foo := backup.Relation{Oid: 1, Schema: "public", Name: "foo"}
+	bar := backup.Relation{Oid: 2, Schema: "public", Name: "bar"}
+	tableDefs := map[uint32]backup.TableDefinition{
+		1: {ColumnDefs: []backup.ColumnDefinition{{Name: "i", Type: "integer"}}},
+		2: {IsExternal: true},
+	}
+	BeforeEach(func() {
+		backupDir, _ = ioutil.TempDir("", "gpbackup_plain")
+		fpInfo = utils.FilePathInfo{UserSpecifiedBackupDir: backupDir, UserSpecifiedSegPrefix: "gpseg", Timestamp: "20170101010101"}
+		_ = os.MkdirAll(fpInfo.GetDirForContent(-1), 0755)
+		backup.SetFPInfo(fpInfo)
+		backup.SetVersion("1.0.0")
+		backup.SetSingleDataFile(false)
+		backup.SetReport(&utils.Report{BackupConfig: utils.BackupConfig{DatabaseName: "testdb"}})
+		toc = &utils.TOC{}
+		toc.InitializeEntryMap()
+		backup.SetTOC(toc)
+
+		metadataFile := utils.NewFileWithByteCountFromFile(fpInfo.GetMetadataFilePath())
+		statements := []struct{ section, objectType, statement string }{
+			{"global", "SESSION GUCS", "\nSET client_encoding = 'UTF8';\n"},
+			{"global", "DATABASE", "\n\nCREATE DATABASE testdb TEMPLATE template0;\n"},
+			{"predata", "TABLE", "\n\nCREATE TABLE public.foo (\n\ti integer\n) DISTRIBUTED RANDOMLY;\n"},
+			{"postdata", "INDEX", "\n\nCREATE INDEX foo_idx ON public.foo USING btree (i);\n"},
+		}
+		for _, s := range statements {
+			start := metadataFile.ByteCount
+			metadataFile.MustPrintf(s.statement)
+			toc.AddMetadataEntry("", "", s.objectType, "", start, metadataFile, s.section)
+		}
+		metadataFile.Close()
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(backupDir)
+		testutils.SetupTestCluster()
+		backup.SetReport(&utils.Report{})
+	})
+	It("writes the metadata and data in a single script", func() {
+		dataFilename := path.Join(fpInfo.GetDirForContent(-1), "gpbackup_20170101010101_plain_data")
+		_ = ioutil.WriteFile(dataFilename, []byte("1\n2\n"), 0644)
+		mock.ExpectExec(regexp.QuoteMeta("COPY public.foo TO '" + dataFilename + "' IGNORE EXTERNAL PARTITIONS;")).WillReturnResult(sqlmock.NewResult(0, 2))
+
+		backup.WritePlainScript(fpInfo.GetMetadataFilePath(), []backup.Relation{foo, bar}, tableDefs)
+
+		contents, err := ioutil.ReadFile(fpInfo.GetPlainScriptFilePath())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(Equal(`--
+-- Greenplum Database backup 20170101010101 of database testdb, written by gpbackup 1.0.0
+--
+
+` + backup.PLAIN_SCRIPT_SETTINGS + `
+SET client_encoding = 'UTF8';
+
+
+CREATE TABLE public.foo (
+	i integer
+) DISTRIBUTED RANDOMLY;
+
+
+COPY public.foo (i) FROM stdin;
+1
+2
+\.
+
+
+CREATE INDEX foo_idx ON public.foo USING btree (i);
+
+`))
+		Expect(toc.DataEntries).To(Equal([]utils.MasterDataEntry{{Schema: "public", Name: "foo", Oid: 1, AttributeString: "(i)", RowsCopied: 2}}))
+		Expect(dataFilename).ToNot(BeAnExistingFile())
+	})
+	It("writes only the metadata for a metadata-only backup", func() {
+		backup.SetReport(&utils.Report{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", MetadataOnly: true}})
+
+		backup.WritePlainScript(fpInfo.GetMetadataFilePath(), []backup.Relation{foo}, tableDefs)
+
+		contents, _ := ioutil.ReadFile(fpInfo.GetPlainScriptFilePath())
+		Expect(string(contents)).ToNot(ContainSubstring("COPY"))
+		Expect(string(contents)).ToNot(ContainSubstring("CREATE DATABASE"))
+		Expect(string(contents)).To(ContainSubstring("CREATE INDEX foo_idx"))
+	})
+	It("copies a masked table using a query", func() {
+		backup.SetMaskingPolicy(backup.MaskingPolicy{"public.foo": {"i": {Function: "nullify"}}})
+		defer backup.SetMaskingPolicy(nil)
+		mock.ExpectExec(regexp.QuoteMeta("COPY (SELECT NULL::integer AS i FROM public.foo) TO '/tmp/data';")).WillReturnResult(sqlmock.NewResult(0, 2))
+		Expect(backup.CopyTableOutToMaster(foo, tableDefs[1].ColumnDefs, "/tmp/data")).To(Equal(int64(2)))
+	})
+})
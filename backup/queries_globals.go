@@ -215,7 +215,7 @@ SELECT
 	rolcreaterexthdfs,
 	rolcreatewexthdfs
 FROM
-	pg_authid`, resgroupQuery)
+	pg_authid%s`, resgroupQuery, RoleFilterClause("rolname"))
 
 	roles := make([]Role, 0)
 	err := connection.Select(&roles, query)
@@ -296,15 +296,19 @@ type RoleMember struct {
 	IsAdmin bool
 }
 
+/*
+ * With a role filter, a role membership is only backed up if both the role and
+ * its member are backed up, so that the membership can be restored.
+ */
 func GetRoleMembers(connection *dbconn.DBConn) []RoleMember {
-	query := `
+	query := fmt.Sprintf(`
 SELECT
 	quote_ident(pg_get_userbyid(roleid)) AS role,
 	quote_ident(pg_get_userbyid(member)) AS member,
 	quote_ident(pg_get_userbyid(grantor)) AS grantor,
 	admin_option as isadmin
-FROM pg_auth_members
-ORDER BY roleid, member;`
+FROM pg_auth_members%s
+ORDER BY roleid, member;`, RoleFilterClause("pg_get_userbyid(roleid)", "pg_get_userbyid(member)"))
 
 	results := make([]RoleMember, 0)
 	err := connection.Select(&results, query)
@@ -0,0 +1,118 @@
+package backup
+
+/*
+ * This file contains structs and functions related to executing specific
+ * queries to gather the information needed to determine which tables have
+ * changed since a previous backup.
+ */
+
+import (
+	"fmt"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+func GetAOIncrementalMetadata(connection *dbconn.DBConn) map[string]utils.AOEntry {
+	modCounts := getAllModCounts(connection)
+	lastDDLTimestamps := getLastDDLTimestamps(connection)
+	aoTableEntries := make(map[string]utils.AOEntry, len(modCounts))
+	for aoTableFQN, modCount := range modCounts {
+		aoTableEntries[aoTableFQN] = utils.AOEntry{
+			Modcount:         modCount,
+			LastDDLTimestamp: lastDDLTimestamps[aoTableFQN],
+		}
+	}
+	return aoTableEntries
+}
+
+func getAllModCounts(connection *dbconn.DBConn) map[string]int64 {
+	segTableFQNs := getAOSegTableFQNs(connection)
+	modCounts := make(map[string]int64, len(segTableFQNs))
+	for aoTableFQN, segTableFQN := range segTableFQNs {
+		modCounts[aoTableFQN] = getModCount(connection, segTableFQN)
+	}
+	return modCounts
+}
+
+func getAOSegTableFQNs(connection *dbconn.DBConn) map[string]string {
+	query := fmt.Sprintf(`
+SELECT
+	quote_ident(n.nspname) || '.' || quote_ident(c.relname) AS aotablefqn,
+	'pg_aoseg.' || quote_ident(s.relname) AS aosegtablefqn
+FROM pg_class c
+JOIN pg_namespace n ON c.relnamespace = n.oid
+JOIN pg_appendonly a ON c.oid = a.relid
+JOIN pg_class s ON a.segrelid = s.oid
+WHERE %s
+AND c.relstorage IN ('a', 'c');`, tableAndSchemaFilterClause())
+
+	results := make([]struct {
+		AOTableFQN    string
+		AOSegTableFQN string
+	}, 0)
+	err := connection.Select(&results, query)
+	gplog.FatalOnError(err)
+	segTableFQNs := make(map[string]string, len(results))
+	for _, result := range results {
+		segTableFQNs[result.AOTableFQN] = result.AOSegTableFQN
+	}
+	return segTableFQNs
+}
+
+/*
+ * The modcount of an append-optimized table is incremented on every segment
+ * each time the table's data is modified.  Before GPDB 6 the master also keeps
+ * track of the modcount, but starting in GPDB 6 only the segments do, so we
+ * must query the segments directly.
+ */
+func getModCount(connection *dbconn.DBConn, aoSegTableFQN string) int64 {
+	query := ""
+	if connection.Version.Before("6") {
+		query = fmt.Sprintf(`SELECT COALESCE(sum(modcount), 0) AS modcount FROM %s;`, aoSegTableFQN)
+	} else {
+		query = fmt.Sprintf(`SELECT COALESCE(sum(modcount), 0) AS modcount FROM gp_dist_random('%s');`, aoSegTableFQN)
+	}
+	var results []struct {
+		Modcount int64
+	}
+	err := connection.Select(&results, query)
+	gplog.FatalOnError(err)
+	if len(results) == 0 {
+		return 0
+	}
+	return results[0].Modcount
+}
+
+/*
+ * Any DDL operation that can change a table's data without changing its
+ * modcount (e.g. TRUNCATE, or ALTER TABLE rewriting the table) is recorded in
+ * pg_stat_last_operation, so we compare the time of the last such operation
+ * as well as the modcount.
+ */
+func getLastDDLTimestamps(connection *dbconn.DBConn) map[string]string {
+	query := fmt.Sprintf(`
+SELECT
+	quote_ident(n.nspname) || '.' || quote_ident(c.relname) AS aotablefqn,
+	max(o.statime)::text AS lastddltimestamp
+FROM pg_class c
+JOIN pg_namespace n ON c.relnamespace = n.oid
+JOIN pg_stat_last_operation o ON c.oid = o.objid
+WHERE %s
+AND c.relstorage IN ('a', 'c')
+AND o.staactionname IN ('CREATE', 'ALTER', 'TRUNCATE')
+GROUP BY n.nspname, c.relname;`, tableAndSchemaFilterClause())
+
+	results := make([]struct {
+		AOTableFQN       string
+		LastDDLTimestamp string
+	}, 0)
+	err := connection.Select(&results, query)
+	gplog.FatalOnError(err)
+	lastDDLTimestamps := make(map[string]string, len(results))
+	for _, result := range results {
+		lastDDLTimestamps[result.AOTableFQN] = result.LastDDLTimestamp
+	}
+	return lastDDLTimestamps
+}
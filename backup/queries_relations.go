@@ -13,6 +13,8 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
 )
 
 func tableAndSchemaFilterClause() string {
@@ -194,6 +196,50 @@ JOIN (
 	return SelectAsOidToStringMap(connection, query)
 }
 
+/*
+ * Leaf partitions are identified by their root partition table, as filters
+ * and masking policies are given for the root table.  RootName is quoted and
+ * schema-qualified, as in the table filter file and masking policy.
+ */
+type PartitionLeaf struct {
+	Oid        uint32
+	Schema     string
+	Name       string
+	RootName   string
+	IsExternal bool
+}
+
+func GetPartitionLeaves(connection *dbconn.DBConn) []PartitionLeaf {
+	query := `
+SELECT
+	r.parchildrelid AS oid,
+	quote_ident(cn.nspname) AS schema,
+	quote_ident(c.relname) AS name,
+	quote_ident(rn.nspname) || '.' || quote_ident(rc.relname) AS rootname,
+	e.reloid IS NOT NULL AS isexternal
+FROM pg_partition p
+JOIN pg_partition_rule r
+	ON p.oid = r.paroid
+JOIN pg_class c
+	ON r.parchildrelid = c.oid
+JOIN pg_namespace cn
+	ON c.relnamespace = cn.oid
+JOIN pg_class rc
+	ON p.parrelid = rc.oid
+JOIN pg_namespace rn
+	ON rc.relnamespace = rn.oid
+LEFT JOIN pg_exttable e
+	ON r.parchildrelid = e.reloid
+WHERE p.paristemplate = false
+AND p.parlevel = (SELECT max(parlevel) FROM pg_partition WHERE parrelid = p.parrelid)
+ORDER BY r.parchildrelid;`
+
+	results := make([]PartitionLeaf, 0)
+	err := connection.Select(&results, query)
+	gplog.FatalOnError(err)
+	return results
+}
+
 type ColumnDefinition struct {
 	Oid         uint32 `db:"attrelid"`
 	Num         int    `db:"attnum"`
@@ -663,13 +709,114 @@ ORDER BY v2.oid, referencedobject;`, SchemaFilterClause("n"))
 	return views
 }
 
-func LockTables(connection *dbconn.DBConn, tables []Relation) {
+const LOCK_BATCH_SIZE = 100
+
+/*
+ * Tables are locked LOCK_BATCH_SIZE at a time to reduce round trips for
+ * databases with many partitions.  If lockWaitTimeout is 0, each LOCK
+ * statement waits as long as it takes to acquire its locks; otherwise it is
+ * canceled after lockWaitTimeout seconds and retried up to lockRetries times.
+ */
+func LockTables(connection *dbconn.DBConn, tables []Relation, lockWaitTimeout int, lockRetries int) {
 	gplog.Info("Acquiring ACCESS SHARE locks on tables")
 	progressBar := utils.NewProgressBar(len(tables), "Locks acquired: ", utils.PB_VERBOSE)
 	progressBar.Start()
-	for _, table := range tables {
-		connection.MustExec(fmt.Sprintf("LOCK TABLE %s IN ACCESS SHARE MODE", table.ToString()))
-		progressBar.Increment()
+	if lockWaitTimeout > 0 {
+		connection.MustExec(fmt.Sprintf("SET statement_timeout = %d", lockWaitTimeout*1000))
+	}
+	for start := 0; start < len(tables); start += LOCK_BATCH_SIZE {
+		end := start + LOCK_BATCH_SIZE
+		if end > len(tables) {
+			end = len(tables)
+		}
+		lockTableBatch(connection, tables[start:end], lockWaitTimeout, lockRetries)
+		for i := start; i < end; i++ {
+			progressBar.Increment()
+		}
+	}
+	if lockWaitTimeout > 0 {
+		connection.MustExec("SET statement_timeout = 0")
 	}
 	progressBar.Finish()
 }
+
+/*
+ * A canceled LOCK statement aborts the transaction it is in, so each attempt
+ * is made in a savepoint to keep the locks acquired by earlier batches.  Each
+ * timeout and what blocked it is recorded in the backup report.
+ */
+func lockTableBatch(connection *dbconn.DBConn, tables []Relation, lockWaitTimeout int, lockRetries int) {
+	tableNames := make([]string, len(tables))
+	for i, table := range tables {
+		tableNames[i] = table.ToString()
+	}
+	lockQuery := fmt.Sprintf("LOCK TABLE %s IN ACCESS SHARE MODE", strings.Join(tableNames, ", "))
+	if lockWaitTimeout == 0 {
+		connection.MustExec(lockQuery)
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		connection.MustExec("SAVEPOINT gpbackup_lock_tables")
+		_, err := connection.Exec(lockQuery)
+		if err == nil {
+			connection.MustExec("RELEASE SAVEPOINT gpbackup_lock_tables")
+			return
+		}
+		connection.MustExec("ROLLBACK TO SAVEPOINT gpbackup_lock_tables")
+		if pqErr, ok := err.(*pq.Error); !ok || pqErr.Code != "57014" {
+			gplog.Fatal(err, "Unable to acquire ACCESS SHARE locks on tables")
+		}
+		blockerStr := "the blocking lock has since been released"
+		if blockers := GetLockBlockers(connection, tables); len(blockers) > 0 {
+			blockerStrs := make([]string, len(blockers))
+			for i, blocker := range blockers {
+				blockerStrs[i] = fmt.Sprintf("%s held by pid %d", blocker.ToString(), blocker.Pid)
+			}
+			blockerStr = "blocked by the ACCESS EXCLUSIVE lock on " + strings.Join(blockerStrs, ", ")
+		}
+		backupReport.LockWaits = append(backupReport.LockWaits, fmt.Sprintf("Attempt %d timed out after %d seconds; %s", attempt, lockWaitTimeout, blockerStr))
+		if attempt > lockRetries {
+			gplog.Fatal(errors.Errorf("Unable to acquire ACCESS SHARE locks on tables within %d seconds after %d attempt(s); %s", lockWaitTimeout, attempt, blockerStr), "")
+		}
+		gplog.Warn("Timed out after %d seconds acquiring ACCESS SHARE locks on tables (attempt %d of %d); %s", lockWaitTimeout, attempt, lockRetries+1, blockerStr)
+	}
+}
+
+type LockBlocker struct {
+	Schema string
+	Name   string
+	Pid    int
+}
+
+func (blocker LockBlocker) ToString() string {
+	return utils.MakeFQN(blocker.Schema, blocker.Name)
+}
+
+/*
+ * Only an ACCESS EXCLUSIVE lock, whether held or requested, conflicts with an
+ * ACCESS SHARE lock.
+ */
+func GetLockBlockers(connection *dbconn.DBConn, tables []Relation) []LockBlocker {
+	oids := make([]string, len(tables))
+	for i, table := range tables {
+		oids[i] = fmt.Sprintf("%d", table.Oid)
+	}
+	query := fmt.Sprintf(`
+SELECT DISTINCT
+	quote_ident(n.nspname) AS schema,
+	quote_ident(c.relname) AS name,
+	l.pid
+FROM pg_locks l
+JOIN pg_class c ON l.relation = c.oid
+JOIN pg_namespace n ON c.relnamespace = n.oid
+WHERE l.locktype = 'relation'
+AND l.mode = 'AccessExclusiveLock'
+AND l.pid <> pg_backend_pid()
+AND l.relation IN (%s)
+ORDER BY schema, name, l.pid;`, strings.Join(oids, ", "))
+
+	results := make([]LockBlocker, 0)
+	err := connection.Select(&results, query)
+	gplog.FatalOnError(err)
+	return results
+}
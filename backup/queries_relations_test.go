@@ -0,0 +1,78 @@
+package backup_test
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/lib/pq"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var _ = Describe("backup/queries_relations tests", func() {
+	Describe("LockTables", func() {
+		foo := backup.Relation{Oid: 1, Schema: "public", Name: "foo"}
+		bar := backup.Relation{Oid: 2, Schema: "public", Name: "bar"}
+		timeoutErr := &pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"}
+		blockerHeader := []string{"schema", "name", "pid"}
+		noResult := sqlmock.NewResult(0, 0)
+		BeforeEach(func() {
+			backup.SetReport(&utils.Report{})
+		})
+
+		It("locks tables in batches", func() {
+			tables := make([]backup.Relation, backup.LOCK_BATCH_SIZE+1)
+			tableNames := make([]string, backup.LOCK_BATCH_SIZE)
+			for i := range tables {
+				tables[i] = backup.Relation{Oid: uint32(i), Schema: "public", Name: fmt.Sprintf("table%d", i)}
+				if i < backup.LOCK_BATCH_SIZE {
+					tableNames[i] = tables[i].ToString()
+				}
+			}
+			mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf("LOCK TABLE %s IN ACCESS SHARE MODE", strings.Join(tableNames, ", ")))).WillReturnResult(noResult)
+			mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf("LOCK TABLE public.table%d IN ACCESS SHARE MODE", backup.LOCK_BATCH_SIZE))).WillReturnResult(noResult)
+			backup.LockTables(connectionPool, tables, 0, 0)
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("sets a timeout and locks tables in a savepoint", func() {
+			mock.ExpectExec("SET statement_timeout = 30000").WillReturnResult(noResult)
+			mock.ExpectExec("SAVEPOINT gpbackup_lock_tables").WillReturnResult(noResult)
+			mock.ExpectExec(regexp.QuoteMeta("LOCK TABLE public.foo, public.bar IN ACCESS SHARE MODE")).WillReturnResult(noResult)
+			mock.ExpectExec("RELEASE SAVEPOINT gpbackup_lock_tables").WillReturnResult(noResult)
+			mock.ExpectExec("SET statement_timeout = 0").WillReturnResult(noResult)
+			backup.LockTables(connectionPool, []backup.Relation{foo, bar}, 30, 0)
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("retries a lock that times out and reports what blocked it", func() {
+			mock.ExpectExec("SET statement_timeout = 30000").WillReturnResult(noResult)
+			mock.ExpectExec("SAVEPOINT gpbackup_lock_tables").WillReturnResult(noResult)
+			mock.ExpectExec(regexp.QuoteMeta("LOCK TABLE public.foo, public.bar IN ACCESS SHARE MODE")).WillReturnError(timeoutErr)
+			mock.ExpectExec("ROLLBACK TO SAVEPOINT gpbackup_lock_tables").WillReturnResult(noResult)
+			mock.ExpectQuery("SELECT DISTINCT").WillReturnRows(sqlmock.NewRows(blockerHeader).AddRow("public", "bar", 1234))
+			mock.ExpectExec("SAVEPOINT gpbackup_lock_tables").WillReturnResult(noResult)
+			mock.ExpectExec(regexp.QuoteMeta("LOCK TABLE public.foo, public.bar IN ACCESS SHARE MODE")).WillReturnResult(noResult)
+			mock.ExpectExec("RELEASE SAVEPOINT gpbackup_lock_tables").WillReturnResult(noResult)
+			mock.ExpectExec("SET statement_timeout = 0").WillReturnResult(noResult)
+			backup.LockTables(connectionPool, []backup.Relation{foo, bar}, 30, 1)
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+			Expect(logfile).To(Say(regexp.QuoteMeta("Timed out after 30 seconds acquiring ACCESS SHARE locks on tables (attempt 1 of 2); blocked by the ACCESS EXCLUSIVE lock on public.bar held by pid 1234")))
+			Expect(backup.GetReport().LockWaits).To(Equal([]string{"Attempt 1 timed out after 30 seconds; blocked by the ACCESS EXCLUSIVE lock on public.bar held by pid 1234"}))
+		})
+		It("panics when a lock times out and there are no retries left", func() {
+			mock.ExpectExec("SET statement_timeout = 30000").WillReturnResult(noResult)
+			mock.ExpectExec("SAVEPOINT gpbackup_lock_tables").WillReturnResult(noResult)
+			mock.ExpectExec(regexp.QuoteMeta("LOCK TABLE public.foo IN ACCESS SHARE MODE")).WillReturnError(timeoutErr)
+			mock.ExpectExec("ROLLBACK TO SAVEPOINT gpbackup_lock_tables").WillReturnResult(noResult)
+			mock.ExpectQuery("SELECT DISTINCT").WillReturnRows(sqlmock.NewRows(blockerHeader))
+			defer testhelper.ShouldPanicWithMessage("Unable to acquire ACCESS SHARE locks on tables within 30 seconds after 1 attempt(s); the blocking lock has since been released")
+			backup.LockTables(connectionPool, []backup.Relation{foo}, 30, 0)
+		})
+	})
+})
@@ -221,6 +221,23 @@ func SchemaFilterClause(namespace string) string {
 	return fmt.Sprintf(`%s.nspname NOT LIKE 'pg_temp_%%' AND %s.nspname NOT LIKE 'pg_toast%%' AND %s.nspname NOT IN ('gp_toolkit', 'information_schema', 'pg_aoseg', 'pg_bitmapindex', 'pg_catalog') %s`, namespace, namespace, namespace, schemaFilterClauseStr)
 }
 
+// A list of roles we want or don't want to back up, formatted as a WHERE clause on each role field
+func RoleFilterClause(roleFields ...string) string {
+	filterClauses := make([]string, 0, len(roleFields))
+	for _, roleField := range roleFields {
+		if len(*includeRoles) > 0 {
+			filterClauses = append(filterClauses, fmt.Sprintf("%s IN (%s)", roleField, utils.SliceToQuotedString(*includeRoles)))
+		}
+		if len(*excludeRoles) > 0 {
+			filterClauses = append(filterClauses, fmt.Sprintf("%s NOT IN (%s)", roleField, utils.SliceToQuotedString(*excludeRoles)))
+		}
+	}
+	if len(filterClauses) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nWHERE %s", strings.Join(filterClauses, "\nAND "))
+}
+
 type MetadataQueryStruct struct {
 	Oid        uint32
 	Privileges sql.NullString
@@ -321,3 +338,20 @@ SELECT
 	}
 	return metadataMap
 }
+
+/*
+ * GPDB 6.21 and later can export a distributed snapshot, so that each
+ * connection in the pool sees the database as of the same point in time.
+ */
+func SupportsSynchronizedSnapshots(connection *dbconn.DBConn) bool {
+	return connection.Version.AtLeast("6.21.0")
+}
+
+func ExportSnapshot(connection *dbconn.DBConn) string {
+	return dbconn.MustSelectString(connection, "SELECT pg_catalog.pg_export_snapshot() AS string", 0)
+}
+
+// This must be the first statement executed in the transaction on whichConn.
+func ImportSnapshot(connection *dbconn.DBConn, whichConn int, snapshotID string) {
+	connection.MustExec(fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s'", snapshotID), whichConn)
+}
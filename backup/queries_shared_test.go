@@ -6,6 +6,7 @@ import (
 
 	"github.com/greenplum-db/gp-common-go-libs/structmatcher"
 	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/testutils"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -146,4 +147,46 @@ FROM table o JOIN pg_shdescription d ON (d.objoid = oid AND d.classoid = 'table'
 			structmatcher.ExpectStructsToMatch(&expectedTwo, &resultTwo)
 		})
 	})
+	Describe("RoleFilterClause", func() {
+		AfterEach(func() {
+			backup.SetIncludeRoles([]string{})
+			backup.SetExcludeRoles([]string{})
+		})
+		It("returns an empty clause if there is no role filter", func() {
+			Expect(backup.RoleFilterClause("rolname")).To(Equal(""))
+		})
+		It("filters each role field on the included roles", func() {
+			backup.SetIncludeRoles([]string{"role1", "role2"})
+			Expect(backup.RoleFilterClause("pg_get_userbyid(roleid)", "pg_get_userbyid(member)")).To(Equal(`
+WHERE pg_get_userbyid(roleid) IN ('role1','role2')
+AND pg_get_userbyid(member) IN ('role1','role2')`))
+		})
+		It("filters each role field on the excluded roles", func() {
+			backup.SetExcludeRoles([]string{"role1"})
+			Expect(backup.RoleFilterClause("rolname")).To(Equal(`
+WHERE rolname NOT IN ('role1')`))
+		})
+	})
+	Describe("synchronized snapshots", func() {
+		It("supports synchronized snapshots starting in GPDB 6.21", func() {
+			testutils.SetDBVersion(connectionPool, "6.20.0")
+			Expect(backup.SupportsSynchronizedSnapshots(connectionPool)).To(BeFalse())
+			testutils.SetDBVersion(connectionPool, "6.21.0")
+			Expect(backup.SupportsSynchronizedSnapshots(connectionPool)).To(BeTrue())
+		})
+		It("exports a snapshot", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_catalog.pg_export_snapshot() AS string")).WillReturnRows(sqlmock.NewRows([]string{"string"}).AddRow("00000003-0000001B-1"))
+			Expect(backup.ExportSnapshot(connectionPool)).To(Equal("00000003-0000001B-1"))
+		})
+		It("imports a snapshot", func() {
+			mock.ExpectExec(regexp.QuoteMeta("SET TRANSACTION SNAPSHOT '00000003-0000001B-1'")).WillReturnResult(sqlmock.NewResult(0, 0))
+			backup.ImportSnapshot(connectionPool, 0, "00000003-0000001B-1")
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("reports whether the connections were consistent", func() {
+			Expect(backup.GetTransactionConsistency(1, "")).To(Equal("Yes"))
+			Expect(backup.GetTransactionConsistency(4, "00000003-0000001B-1")).To(Equal("Yes, 4 connections shared a snapshot"))
+			Expect(backup.GetTransactionConsistency(4, "")).To(Equal("No, 4 connections each had their own snapshot"))
+		})
+	})
 })
@@ -0,0 +1,178 @@
+package backup
+
+/*
+ * This file contains functions related to the backup journal and to
+ * gpbackup --resume, which finishes a backup that was interrupted after some
+ * of its table data had been backed up.
+ */
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * The journal is started once the tables whose data will be backed up are
+ * known, so a backup interrupted while backing up metadata cannot be resumed.
+ */
+func InitializeJournal(tables []Relation) {
+	header := utils.JournalHeader{
+		CommandLine: strings.Join(os.Args, " "),
+		Flags:       journalFlags,
+		Tables:      make([]utils.JournalTable, len(tables)),
+		AO:          globalTOC.IncrementalMetadata.AO,
+	}
+	for i, table := range tables {
+		header.Tables[i] = utils.JournalTable{Oid: table.Oid, Schema: table.Schema, Name: table.Name}
+	}
+	journalFilename := globalFPInfo.GetJournalFilePath()
+	gplog.Verbose("Recording backed up tables in journal %s", journalFilename)
+	journal, err := utils.NewJournal(journalFilename, header)
+	if err != nil {
+		gplog.Fatal(err, "Unable to create backup journal %s", journalFilename)
+	}
+	globalJournal = journal
+}
+
+func AddTableToJournal(table Relation, tableDef TableDefinition, rowsCopied int64, backupFile string) {
+	entry := utils.JournalEntry{
+		Oid:             table.Oid,
+		Schema:          table.Schema,
+		Name:            table.Name,
+		AttributeString: ConstructTableAttributesList(tableDef.ColumnDefs),
+		RowsCopied:      rowsCopied,
+		File:            backupFile,
+	}
+	err := globalJournal.AddEntry(entry)
+	if err != nil {
+		gplog.Fatal(err, "Unable to write to backup journal %s", globalFPInfo.GetJournalFilePath())
+	}
+}
+
+/*
+ * The files of the interrupted backup are checked before the backup
+ * directory is used, so that no report is written for a backup that cannot be
+ * resumed.  The config and report files written when the backup failed are
+ * removed, as they are written again once it finishes.
+ */
+func InitializeResume(fpInfo utils.FilePathInfo) {
+	timestamp := fpInfo.Timestamp
+	if iohelper.FileExistsAndIsReadable(fpInfo.GetTOCFilePath()) {
+		gplog.Fatal(errors.Errorf("Backup %s has already completed, so it cannot be resumed.", timestamp), "")
+	}
+	journalFilename := fpInfo.GetJournalFilePath()
+	if !iohelper.FileExistsAndIsReadable(journalFilename) {
+		gplog.Fatal(errors.Errorf("Journal file %s does not exist, so backup %s cannot be resumed.  A backup can only be resumed once it has started backing up data.", journalFilename, timestamp), "")
+	}
+	salt, err := utils.ReadJournalEncryptionSalt(journalFilename)
+	if err != nil {
+		gplog.Fatal(err, "Unable to read backup journal %s", journalFilename)
+	}
+	if backupReport.Encrypted {
+		InitializeEncryptionKey(salt)
+	}
+	journal, err := utils.OpenJournal(journalFilename)
+	if err != nil {
+		gplog.Fatal(err, "Unable to read backup journal %s", journalFilename)
+	}
+	ValidateResumeFlags(journal.Header, journalFlags, timestamp)
+
+	lockFilename := fmt.Sprintf("/tmp/%s.lck", timestamp)
+	if iohelper.FileExistsAndIsReadable(lockFilename) {
+		gplog.Fatal(errors.Errorf("Lock file %s exists, so backup %s may still be in progress.  If it is not, remove the lock file and try again.", lockFilename, timestamp), "")
+	}
+	utils.CreateBackupLockFile(timestamp)
+	for _, filename := range []string{fpInfo.GetConfigFilePath(), fpInfo.GetBackupReportFilePath()} {
+		err = os.Remove(filename)
+		if err != nil && !os.IsNotExist(err) {
+			gplog.Fatal(err, "Unable to remove file %s", filename)
+		}
+	}
+	globalJournal = journal
+	gplog.Info("Found %d table(s) whose data was backed up before backup %s was interrupted", len(journal.Entries), timestamp)
+}
+
+func ValidateResumeFlags(header utils.JournalHeader, currentFlags map[string]string, timestamp string) {
+	if !reflect.DeepEqual(header.Flags, currentFlags) {
+		gplog.Fatal(errors.Errorf("Backup %s must be resumed with the flags it was started with.  It was started with the command: %s", timestamp, header.CommandLine), "")
+	}
+}
+
+/*
+ * The metadata of a resumed backup is backed up again, so the tables whose
+ * data is backed up must be the same as when the backup started.
+ */
+func ValidateResumeTables(journalTables []utils.JournalTable, tables []Relation) {
+	journalTableSet := make(map[utils.JournalTable]bool, len(journalTables))
+	for _, table := range journalTables {
+		journalTableSet[table] = true
+	}
+	for _, table := range tables {
+		if !journalTableSet[utils.JournalTable{Oid: table.Oid, Schema: table.Schema, Name: table.Name}] {
+			gplog.Fatal(errors.Errorf("Table %s was not part of backup %s when it started, so the backup cannot be resumed.", table.ToString(), globalFPInfo.Timestamp), "")
+		}
+	}
+	if len(tables) != len(journalTables) {
+		gplog.Fatal(errors.Errorf("Tables that were part of backup %s when it started no longer exist, so the backup cannot be resumed.", globalFPInfo.Timestamp), "")
+	}
+}
+
+/*
+ * Returns the tables whose data still needs to be backed up, along with the
+ * number of rows copied for each table whose data was backed up before the
+ * backup was interrupted.  A table is backed up again if its columns have
+ * changed, if it is an append-optimized table that has been modified, or if
+ * its data files are missing or have changed size since gpbackup_helper
+ * recorded their checksums.
+ */
+func GetTablesToResume(tables []Relation, tableDefs map[uint32]TableDefinition) ([]Relation, map[uint32]int64) {
+	ValidateResumeTables(globalJournal.Header.Tables, tables)
+	infos, sizes := utils.GetDataFileInfoAndSizesOnAllHosts(globalCluster, globalFPInfo)
+	tablesToBackUp := make([]Relation, 0)
+	rowsCopied := make(map[uint32]int64, 0)
+	for _, table := range tables {
+		entry, ok := globalJournal.Entries[table.Oid]
+		if !ok {
+			tablesToBackUp = append(tablesToBackUp, table)
+			continue
+		}
+		if reason := getResumeInvalidReason(table, tableDefs[table.Oid], entry, infos, sizes); reason != "" {
+			gplog.Warn("Data for table %s will be backed up again because %s", table.ToString(), reason)
+			tablesToBackUp = append(tablesToBackUp, table)
+			continue
+		}
+		rowsCopied[table.Oid] = entry.RowsCopied
+	}
+	if len(rowsCopied) > 0 {
+		gplog.Info("Skipping data backup of %d table(s) that were backed up before backup %s was interrupted", len(rowsCopied), globalFPInfo.Timestamp)
+		gplog.Warn("Data for tables backed up before the interruption was read in an earlier transaction than data for the remaining tables")
+	}
+	return tablesToBackUp, rowsCopied
+}
+
+func getResumeInvalidReason(table Relation, tableDef TableDefinition, entry utils.JournalEntry, infos map[int]map[uint32]utils.DataFileInfo, sizes map[int]map[uint32]int64) string {
+	if entry.AttributeString != ConstructTableAttributesList(tableDef.ColumnDefs) {
+		return "its columns have changed"
+	}
+	if journalAOEntry, ok := globalJournal.Header.AO[table.ToString()]; ok && journalAOEntry != globalTOC.IncrementalMetadata.AO[table.ToString()] {
+		return "it has been modified"
+	}
+	for _, contentID := range globalCluster.ContentIDs {
+		if contentID == -1 {
+			continue
+		}
+		info, hasInfo := infos[contentID][table.Oid]
+		actualSize, hasFile := sizes[contentID][table.Oid]
+		if !hasInfo || !hasFile || actualSize != info.Size {
+			return fmt.Sprintf("its data file for segment %d is missing or has changed size", contentID)
+		}
+	}
+	return ""
+}
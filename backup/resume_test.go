@@ -0,0 +1,121 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("backup/resume tests", func() {
+	Describe("ValidateResumeFlags", func() {
+		header := utils.JournalHeader{CommandLine: "gpbackup --dbname testdb --jobs 2", Flags: map[string]string{"dbname": "testdb", "jobs": "2"}}
+		It("passes if the flags are the same as those the backup was started with", func() {
+			backup.ValidateResumeFlags(header, map[string]string{"dbname": "testdb", "jobs": "2"}, "20170101010101")
+		})
+		It("panics if a flag has a different value", func() {
+			defer testhelper.ShouldPanicWithMessage("Backup 20170101010101 must be resumed with the flags it was started with.  It was started with the command: gpbackup --dbname testdb --jobs 2")
+			backup.ValidateResumeFlags(header, map[string]string{"dbname": "testdb", "jobs": "4"}, "20170101010101")
+		})
+		It("panics if a flag is missing", func() {
+			defer testhelper.ShouldPanicWithMessage("must be resumed with the flags it was started with")
+			backup.ValidateResumeFlags(header, map[string]string{"dbname": "testdb"}, "20170101010101")
+		})
+	})
+	Describe("ValidateResumeTables", func() {
+		journalTables := []utils.JournalTable{{Oid: 1, Schema: "public", Name: "foo"}, {Oid: 2, Schema: "public", Name: "bar"}}
+		It("passes if the tables are the same as when the backup started", func() {
+			backup.ValidateResumeTables(journalTables, []backup.Relation{{Oid: 2, Schema: "public", Name: "bar"}, {Oid: 1, Schema: "public", Name: "foo"}})
+		})
+		It("panics if a table has been added", func() {
+			defer testhelper.ShouldPanicWithMessage("Table public.baz was not part of backup 20170101010101 when it started, so the backup cannot be resumed.")
+			backup.ValidateResumeTables(journalTables, []backup.Relation{{Oid: 1, Schema: "public", Name: "foo"}, {Oid: 2, Schema: "public", Name: "bar"}, {Oid: 3, Schema: "public", Name: "baz"}})
+		})
+		It("panics if a table has been renamed", func() {
+			defer testhelper.ShouldPanicWithMessage("Table public.baz was not part of backup 20170101010101 when it started")
+			backup.ValidateResumeTables(journalTables, []backup.Relation{{Oid: 1, Schema: "public", Name: "foo"}, {Oid: 2, Schema: "public", Name: "baz"}})
+		})
+		It("panics if a table has been dropped", func() {
+			defer testhelper.ShouldPanicWithMessage("Tables that were part of backup 20170101010101 when it started no longer exist, so the backup cannot be resumed.")
+			backup.ValidateResumeTables(journalTables, []backup.Relation{{Oid: 1, Schema: "public", Name: "foo"}})
+		})
+	})
+	Describe("GetTablesToResume", func() {
+		var testExecutor *testhelper.TestExecutor
+		foo := backup.Relation{Oid: 1, Schema: "public", Name: "foo"}
+		bar := backup.Relation{Oid: 2, Schema: "public", Name: "bar"}
+		baz := backup.Relation{Oid: 3, Schema: "public", Name: "baz"}
+		tables := []backup.Relation{foo, bar, baz}
+		tableDefs := map[uint32]backup.TableDefinition{
+			1: {ColumnDefs: []backup.ColumnDefinition{{Name: "i"}}},
+			2: {ColumnDefs: []backup.ColumnDefinition{{Name: "j"}}},
+			3: {ColumnDefs: []backup.ColumnDefinition{{Name: "k"}}},
+		}
+		var journal *utils.Journal
+		BeforeEach(func() {
+			testExecutor = &testhelper.TestExecutor{}
+			testCluster := testutils.SetDefaultSegmentConfiguration()
+			testCluster.Executor = testExecutor
+			backup.SetCluster(testCluster)
+			journal = &utils.Journal{
+				Header: utils.JournalHeader{Tables: []utils.JournalTable{{Oid: 1, Schema: "public", Name: "foo"}, {Oid: 2, Schema: "public", Name: "bar"}, {Oid: 3, Schema: "public", Name: "baz"}}},
+				Entries: map[uint32]utils.JournalEntry{
+					1: {Oid: 1, Schema: "public", Name: "foo", AttributeString: "(i)", RowsCopied: 10},
+					2: {Oid: 2, Schema: "public", Name: "bar", AttributeString: "(j)", RowsCopied: 20},
+				},
+			}
+			backup.SetJournal(journal)
+			toc := &utils.TOC{}
+			toc.InitializeEntryMap()
+			backup.SetTOC(toc)
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{Stdouts: map[int]string{
+				0: "1 12 aaaa\n2 56 bbbb\n12 gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_1.gz\n56 gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_2.gz",
+				1: "1 34 cccc\n2 78 dddd\n34 gpseg1/backups/20170101/20170101010101/gpbackup_1_20170101010101_1.gz\n78 gpseg1/backups/20170101/20170101010101/gpbackup_1_20170101010101_2.gz",
+			}}
+		})
+		AfterEach(func() {
+			backup.SetJournal(nil)
+			testutils.SetupTestCluster()
+		})
+		It("skips tables whose data was backed up before the backup was interrupted", func() {
+			tablesToBackUp, rowsCopied := backup.GetTablesToResume(tables, tableDefs)
+			Expect(tablesToBackUp).To(Equal([]backup.Relation{baz}))
+			Expect(rowsCopied).To(Equal(map[uint32]int64{1: 10, 2: 20}))
+		})
+		It("backs up a table again if its data file has changed size", func() {
+			testExecutor.ClusterOutput.Stdouts[1] = "1 34 cccc\n2 78 dddd\n34 gpseg1/backups/20170101/20170101010101/gpbackup_1_20170101010101_1.gz\n70 gpseg1/backups/20170101/20170101010101/gpbackup_1_20170101010101_2.gz"
+			tablesToBackUp, rowsCopied := backup.GetTablesToResume(tables, tableDefs)
+			Expect(tablesToBackUp).To(Equal([]backup.Relation{bar, baz}))
+			Expect(rowsCopied).To(Equal(map[uint32]int64{1: 10}))
+			Expect(logfile).To(Say("Data for table public.bar will be backed up again because its data file for segment 1 is missing or has changed size"))
+		})
+		It("backs up a table again if its data file is missing", func() {
+			testExecutor.ClusterOutput.Stdouts[0] = "1 12 aaaa\n2 56 bbbb\n56 gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_2.gz"
+			tablesToBackUp, _ := backup.GetTablesToResume(tables, tableDefs)
+			Expect(tablesToBackUp).To(Equal([]backup.Relation{foo, baz}))
+		})
+		It("backs up a table again if no checksum was recorded for its data file", func() {
+			testExecutor.ClusterOutput.Stdouts[0] = "2 56 bbbb\n12 gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_1.gz\n56 gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_2.gz"
+			tablesToBackUp, _ := backup.GetTablesToResume(tables, tableDefs)
+			Expect(tablesToBackUp).To(Equal([]backup.Relation{foo, baz}))
+		})
+		It("backs up a table again if its columns have changed", func() {
+			changedTableDefs := map[uint32]backup.TableDefinition{1: tableDefs[1], 2: {ColumnDefs: []backup.ColumnDefinition{{Name: "j"}, {Name: "l"}}}, 3: tableDefs[3]}
+			tablesToBackUp, _ := backup.GetTablesToResume(tables, changedTableDefs)
+			Expect(tablesToBackUp).To(Equal([]backup.Relation{bar, baz}))
+			Expect(logfile).To(Say("Data for table public.bar will be backed up again because its columns have changed"))
+		})
+		It("backs up an append-optimized table again if it has been modified", func() {
+			journal.Header.AO = map[string]utils.AOEntry{"public.foo": {Modcount: 1, LastDDLTimestamp: "2017-01-01 01:01:01"}}
+			backup.SetTOC(&utils.TOC{IncrementalMetadata: utils.IncrementalEntries{AO: map[string]utils.AOEntry{"public.foo": {Modcount: 2, LastDDLTimestamp: "2017-01-01 01:01:01"}}}})
+			tablesToBackUp, _ := backup.GetTablesToResume(tables, tableDefs)
+			Expect(tablesToBackUp).To(Equal([]backup.Relation{foo, baz}))
+			Expect(logfile).To(Say("Data for table public.foo will be backed up again because it has been modified"))
+		})
+	})
+})
@@ -38,14 +38,12 @@ func GenerateTupleStatisticsQuery(table Relation, tupleStat TupleStatistic) stri
 SET
 	relpages = %d::int,
 	reltuples = %f::real
-WHERE relname = '%s'
-AND relnamespace = %d;`
+WHERE oid = '%s'::regclass::oid;`
 	return fmt.Sprintf(
 		tupleQuery,
 		tupleStat.RelPages,
 		tupleStat.RelTuples,
-		strings.Replace(tupleStat.Table, "'", "''", -1),
-		table.SchemaOid)
+		strings.Replace(table.ToString(), "'", "''", -1))
 }
 
 func GenerateAttributeStatisticsQuery(table Relation, attStat AttributeStatistic) string {
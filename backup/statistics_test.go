@@ -27,8 +27,7 @@ var _ = Describe("backup/statistics tests", func() {
 SET
 	relpages = 0::int,
 	reltuples = 0.000000::real
-WHERE relname = 'testtable'
-AND relnamespace = 0;`)
+WHERE oid = 'testschema.testtable'::regclass::oid;`)
 		})
 		It("prints tuple and attribute stats for single table with stats", func() {
 			testutils.SetDBVersion(connectionPool, "6.0.0")
@@ -45,8 +44,7 @@ AND relnamespace = 0;`)
 SET
 	relpages = 0::int,
 	reltuples = 0.000000::real
-WHERE relname = 'testtable'
-AND relnamespace = 0;
+WHERE oid = 'testschema.testtable'::regclass::oid;
 
 
 DELETE FROM pg_statistic WHERE starelid = 'testschema.testtable'::regclass::oid AND staattnum = 0;
@@ -114,8 +112,7 @@ INSERT INTO pg_statistic VALUES (
 SET
 	relpages = 0::int,
 	reltuples = 0.000000::real
-WHERE relname = '"test''table"'
-AND relnamespace = 0;`))
+WHERE oid = 'testschema."test''table"'::regclass::oid;`))
 		})
 
 	})
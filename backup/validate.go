@@ -2,6 +2,7 @@ package backup
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
@@ -17,8 +18,22 @@ import (
 func validateFilterLists() {
 	ValidateFilterSchemas(connectionPool, *excludeSchemas)
 	ValidateFilterSchemas(connectionPool, *includeSchemas)
+	ValidateFilterRoles(connectionPool, *excludeRoles)
+	ValidateFilterRoles(connectionPool, *includeRoles)
 	ValidateFilterTables(connectionPool, *excludeTables)
 	ValidateFilterTables(connectionPool, *includeTables)
+	filterTables := make([]string, 0, len(tableFilters))
+	for table := range tableFilters {
+		filterTables = append(filterTables, table)
+	}
+	sort.Strings(filterTables)
+	ValidateFilterTables(connectionPool, filterTables)
+	maskedTables := make([]string, 0, len(maskingPolicy))
+	for table := range maskingPolicy {
+		maskedTables = append(maskedTables, table)
+	}
+	sort.Strings(maskedTables)
+	ValidateFilterTables(connectionPool, maskedTables)
 }
 
 func ValidateFilterSchemas(connection *dbconn.DBConn, schemaList []string) {
@@ -37,6 +52,22 @@ func ValidateFilterSchemas(connection *dbconn.DBConn, schemaList []string) {
 	}
 }
 
+func ValidateFilterRoles(connection *dbconn.DBConn, roleList []string) {
+	if len(roleList) > 0 {
+		quotedRolesStr := utils.SliceToQuotedString(roleList)
+		query := fmt.Sprintf("SELECT rolname AS string FROM pg_authid WHERE rolname IN (%s)", quotedRolesStr)
+		resultRoles := dbconn.MustSelectStringSlice(connection, query)
+		if len(resultRoles) < len(roleList) {
+			roleSet := utils.NewIncludeSet(resultRoles)
+			for _, role := range roleList {
+				if !roleSet.MatchesFilter(role) {
+					gplog.Fatal(nil, "Role %s does not exist", role)
+				}
+			}
+		}
+	}
+}
+
 func ValidateFilterTables(connection *dbconn.DBConn, tableList []string) {
 	if len(tableList) > 0 {
 		utils.ValidateFQNs(tableList)
@@ -79,23 +110,108 @@ func ValidateFlagCombinations(flags *pflag.FlagSet) {
 	utils.CheckExclusiveFlags(flags, "exclude-schema", "include-schema")
 	utils.CheckExclusiveFlags(flags, "exclude-schema", "exclude-table", "include-table", "exclude-table-file", "include-table-file")
 	utils.CheckExclusiveFlags(flags, "exclude-table", "exclude-table-file", "leaf-partition-data")
-	utils.CheckExclusiveFlags(flags, "jobs", "metadata-only", "single-data-file")
+	utils.CheckExclusiveFlags(flags, "jobs", "metadata-only")
+	utils.CheckExclusiveFlags(flags, "metadata-only", "single-data-file")
 	utils.CheckExclusiveFlags(flags, "metadata-only", "leaf-partition-data")
 	utils.CheckExclusiveFlags(flags, "no-compression", "compression-level")
-	if *pluginConfigFile != "" && !(*singleDataFile || *metadataOnly) {
-		gplog.Fatal(errors.Errorf("--plugin-config must be specified with either --single-data-file or --metadata-only"), "")
+	utils.CheckExclusiveFlags(flags, "no-compression", "compression-type")
+	utils.CheckExclusiveFlags(flags, "incremental", "metadata-only")
+	utils.CheckExclusiveFlags(flags, "resume", "metadata-only")
+	utils.CheckExclusiveFlags(flags, "resume", "single-data-file")
+	utils.CheckExclusiveFlags(flags, "metadata-only", "table-filter-file")
+	utils.CheckExclusiveFlags(flags, "incremental", "table-filter-file")
+	utils.CheckExclusiveFlags(flags, "masking-policy-file", "metadata-only")
+	utils.CheckExclusiveFlags(flags, "masking-policy-file", "incremental")
+	utils.CheckExclusiveFlags(flags, "masking-policy-file", "with-stats")
+	utils.CheckExclusiveFlags(flags, "exclude-role", "include-role")
+	utils.CheckExclusiveFlags(flags, "globals-only", "data-only")
+	utils.CheckExclusiveFlags(flags, "globals-only", "metadata-only")
+	utils.CheckExclusiveFlags(flags, "globals-only", "exclude-schema")
+	utils.CheckExclusiveFlags(flags, "globals-only", "exclude-table")
+	utils.CheckExclusiveFlags(flags, "globals-only", "exclude-table-file")
+	utils.CheckExclusiveFlags(flags, "globals-only", "include-schema")
+	utils.CheckExclusiveFlags(flags, "globals-only", "include-table")
+	utils.CheckExclusiveFlags(flags, "globals-only", "include-table-file")
+	utils.CheckExclusiveFlags(flags, "globals-only", "incremental")
+	utils.CheckExclusiveFlags(flags, "globals-only", "jobs")
+	utils.CheckExclusiveFlags(flags, "globals-only", "leaf-partition-data")
+	utils.CheckExclusiveFlags(flags, "globals-only", "masking-policy-file")
+	utils.CheckExclusiveFlags(flags, "globals-only", "resume")
+	utils.CheckExclusiveFlags(flags, "globals-only", "single-data-file")
+	utils.CheckExclusiveFlags(flags, "globals-only", "table-filter-file")
+	utils.CheckExclusiveFlags(flags, "globals-only", "with-stats")
+	/*
+	 * Objects backed up outside of --globals-only are still owned by and
+	 * granted to the roles that a role filter would leave out.
+	 */
+	if (flags.Changed("include-role") || flags.Changed("exclude-role")) && !*globalsOnly {
+		gplog.Fatal(errors.Errorf("--globals-only must be specified with --include-role or --exclude-role"), "")
+	}
+	if *incremental && !*leafPartitionData {
+		gplog.Fatal(errors.Errorf("--leaf-partition-data must be specified with --incremental"), "")
+	}
+	if flags.Changed("from-timestamp") && !*incremental {
+		gplog.Fatal(errors.Errorf("--incremental must be specified with --from-timestamp"), "")
+	}
+	if flags.Changed("lock-retries") && !flags.Changed("lock-wait-timeout") {
+		gplog.Fatal(errors.Errorf("--lock-wait-timeout must be specified with --lock-retries"), "")
+	}
+	if *format == "plain" {
+		for _, flagName := range []string{"compression-level", "compression-type", "encryption-key-file", "incremental", "jobs", "plugin-config", "resume", "single-data-file", "with-stats"} {
+			if flags.Changed(flagName) {
+				gplog.Fatal(errors.Errorf("--%s cannot be used with --format=plain", flagName), "")
+			}
+		}
+	}
+	if *pluginConfigFile != "" && !(*singleDataFile || *metadataOnly || *globalsOnly) {
+		gplog.Fatal(errors.Errorf("--plugin-config must be specified with --single-data-file, --metadata-only, or --globals-only"), "")
 	}
 }
 
-func ValidateCompressionLevel(compressionLevel int) {
-	//We treat 0 as a default value and so assume the flag is not set if it is 0
-	if compressionLevel < 0 || compressionLevel > 9 {
-		gplog.Fatal(errors.Errorf("Compression level must be between 1 and 9"), "")
+/*
+ * Without --leaf-partition-data, the data of a partition table is copied from
+ * its root table, so a filter or masking policy given for one of its leaf
+ * partitions would be ignored.
+ */
+func ValidateLeafPartitionFilters(leaves []PartitionLeaf) {
+	if *leafPartitionData {
+		return
 	}
+	for _, leaf := range leaves {
+		leafName := utils.MakeFQN(leaf.Schema, leaf.Name)
+		if _, ok := tableFilters[leafName]; ok {
+			gplog.Fatal(errors.Errorf("Table %s in the table filter file is a leaf partition of %s.  Filter %s instead, or use --leaf-partition-data.", leafName, leaf.RootName, leaf.RootName), "")
+		}
+		if _, ok := maskingPolicy[leafName]; ok {
+			gplog.Fatal(errors.Errorf("Table %s in the masking policy is a leaf partition of %s.  Mask %s instead, or use --leaf-partition-data.", leafName, leaf.RootName, leaf.RootName), "")
+		}
+	}
+}
+
+func ValidateCompressionLevel(compressionType string, compressionLevel int) {
+	//We treat 0 as a default value and so assume the flag is not set if it is 0
+	err := utils.ValidateCompressionTypeAndLevel(compressionType, compressionLevel)
+	gplog.FatalOnError(err)
 }
 
 func ValidateFlagValues() {
 	utils.ValidateFullPath(*backupDir)
 	utils.ValidateFullPath(*pluginConfigFile)
-	ValidateCompressionLevel(*compressionLevel)
+	utils.ValidateFullPath(*encryptionKeyFile)
+	ValidateCompressionLevel(*compressionType, *compressionLevel)
+	if *format != "directory" && *format != "plain" {
+		gplog.Fatal(errors.Errorf("Format %s is invalid.  The format must be either directory or plain.", *format), "")
+	}
+	if *lockWaitTimeout < 0 {
+		gplog.Fatal(errors.Errorf("--lock-wait-timeout must be a non-negative number of seconds"), "")
+	}
+	if *lockRetries < 0 {
+		gplog.Fatal(errors.Errorf("--lock-retries must be a non-negative number"), "")
+	}
+	if *fromTimestamp != "" && !utils.IsValidTimestamp(*fromTimestamp) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", *fromTimestamp), "")
+	}
+	if *resume != "" && !utils.IsValidTimestamp(*resume) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", *resume), "")
+	}
 }
@@ -40,6 +40,26 @@ var _ = Describe("backup/validate tests", func() {
 			backup.ValidateFilterSchemas(connectionPool, filterList)
 		})
 	})
+	Describe("ValidateFilterRoles", func() {
+		It("passes if there are no filter roles", func() {
+			backup.ValidateFilterRoles(connectionPool, filterList)
+		})
+		It("passes if every role is present in database", func() {
+			two_role_rows := sqlmock.NewRows([]string{"string"}).
+				AddRow("role1").AddRow("role2")
+			mock.ExpectQuery("SELECT (.*)").WillReturnRows(two_role_rows)
+			filterList = []string{"role1", "role2"}
+			backup.ValidateFilterRoles(connectionPool, filterList)
+		})
+		It("panics if role is not present in database", func() {
+			single_role_row := sqlmock.NewRows([]string{"string"}).
+				AddRow("role1")
+			mock.ExpectQuery("SELECT (.*)").WillReturnRows(single_role_row)
+			filterList = []string{"role1", "role2"}
+			defer testhelper.ShouldPanicWithMessage("Role role2 does not exist")
+			backup.ValidateFilterRoles(connectionPool, filterList)
+		})
+	})
 	Describe("ValidateFilterTables", func() {
 		var tableRows, partitionTables *sqlmock.Rows
 		BeforeEach(func() {
@@ -118,20 +138,70 @@ var _ = Describe("backup/validate tests", func() {
 			})
 		})
 	})
+	Describe("ValidateLeafPartitionFilters", func() {
+		leaves := []backup.PartitionLeaf{{Oid: 2, Schema: "public", Name: "sales_1_prt_1", RootName: "public.sales"}}
+		AfterEach(func() {
+			backup.SetTableFilters(nil)
+			backup.SetMaskingPolicy(nil)
+			backup.SetLeafPartitionData(false)
+		})
+		It("accepts a filter on the root of a partition table", func() {
+			backup.SetTableFilters(map[string]string{"public.sales": "id > 10"})
+			backup.ValidateLeafPartitionFilters(leaves)
+		})
+		It("accepts a filter on a leaf partition with --leaf-partition-data", func() {
+			backup.SetTableFilters(map[string]string{"public.sales_1_prt_1": "id > 10"})
+			backup.SetLeafPartitionData(true)
+			backup.ValidateLeafPartitionFilters(leaves)
+		})
+		It("panics on a filter on a leaf partition without --leaf-partition-data", func() {
+			backup.SetTableFilters(map[string]string{"public.sales_1_prt_1": "id > 10"})
+			defer testhelper.ShouldPanicWithMessage("Table public.sales_1_prt_1 in the table filter file is a leaf partition of public.sales.  Filter public.sales instead, or use --leaf-partition-data.")
+			backup.ValidateLeafPartitionFilters(leaves)
+		})
+		It("accepts a masking policy for a leaf partition with --leaf-partition-data", func() {
+			backup.SetMaskingPolicy(backup.MaskingPolicy{"public.sales_1_prt_1": {"name": {Function: "nullify"}}})
+			backup.SetLeafPartitionData(true)
+			backup.ValidateLeafPartitionFilters(leaves)
+		})
+		It("panics on a masking policy for a leaf partition without --leaf-partition-data", func() {
+			backup.SetMaskingPolicy(backup.MaskingPolicy{"public.sales_1_prt_1": {"name": {Function: "nullify"}}})
+			defer testhelper.ShouldPanicWithMessage("Table public.sales_1_prt_1 in the masking policy is a leaf partition of public.sales.  Mask public.sales instead, or use --leaf-partition-data.")
+			backup.ValidateLeafPartitionFilters(leaves)
+		})
+	})
 	Describe("ValidateCompressionLevel", func() {
 		It("validates a compression level between 1 and 9", func() {
 			compressLevel := 5
-			backup.ValidateCompressionLevel(compressLevel)
+			backup.ValidateCompressionLevel("gzip", compressLevel)
 		})
 		It("panics if given a compression level < 0", func() {
 			compressLevel := -2
 			defer testhelper.ShouldPanicWithMessage("Compression level must be between 1 and 9")
-			backup.ValidateCompressionLevel(compressLevel)
+			backup.ValidateCompressionLevel("gzip", compressLevel)
 		})
 		It("panics if given a compression level > 9", func() {
 			compressLevel := 11
 			defer testhelper.ShouldPanicWithMessage("Compression level must be between 1 and 9")
-			backup.ValidateCompressionLevel(compressLevel)
+			backup.ValidateCompressionLevel("gzip", compressLevel)
+		})
+		It("validates a compression level between 1 and 19 for zstd", func() {
+			compressLevel := 15
+			backup.ValidateCompressionLevel("zstd", compressLevel)
+		})
+		It("panics if given a compression level > 12 for lz4", func() {
+			compressLevel := 15
+			defer testhelper.ShouldPanicWithMessage("Compression level must be between 1 and 12 for compression type lz4")
+			backup.ValidateCompressionLevel("lz4", compressLevel)
+		})
+		It("panics if given a compression level with compression type none", func() {
+			compressLevel := 5
+			defer testhelper.ShouldPanicWithMessage("Cannot specify a compression level with compression type none")
+			backup.ValidateCompressionLevel("none", compressLevel)
+		})
+		It("panics if given an unsupported compression type", func() {
+			defer testhelper.ShouldPanicWithMessage("Compression type bzip2 is not supported.  Valid compression types are gzip, lz4, none, zstd.")
+			backup.ValidateCompressionLevel("bzip2", 0)
 		})
 	})
 })
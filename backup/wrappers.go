@@ -8,7 +8,10 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
 )
 
 /*
@@ -37,11 +40,34 @@ func InitializeConnectionPool() {
 	connectionPool.MustConnect(*numJobs)
 	utils.SetDatabaseVersion(connectionPool)
 	InitializeMetadataParams(connectionPool)
+	snapshotID = ""
 	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
 		connectionPool.MustExec("SET application_name TO 'gpbackup'", connNum)
 		connectionPool.MustBegin(connNum)
+		if connNum == 0 && connectionPool.NumConns > 1 && SupportsSynchronizedSnapshots(connectionPool) {
+			snapshotID = ExportSnapshot(connectionPool)
+			gplog.Verbose("Sharing snapshot %s across %d connections", snapshotID, connectionPool.NumConns)
+		} else if snapshotID != "" {
+			ImportSnapshot(connectionPool, connNum, snapshotID)
+		}
 		SetSessionGUCs(connNum)
 	}
+	if connectionPool.NumConns > 1 && snapshotID == "" {
+		gplog.Warn("GPDB %s cannot share a snapshot between connections, so tables backed up on different connections may not be consistent with each other", connectionPool.Version.VersionString)
+	}
+}
+
+/*
+ * Data backed up on a single connection, or on connections sharing a snapshot,
+ * is consistent as of the start of the backup.
+ */
+func GetTransactionConsistency(numConns int, snapshotID string) string {
+	if numConns == 1 {
+		return "Yes"
+	} else if snapshotID != "" {
+		return fmt.Sprintf("Yes, %d connections shared a snapshot", numConns)
+	}
+	return fmt.Sprintf("No, %d connections each had their own snapshot", numConns)
 }
 
 func SetSessionGUCs(connNum int) {
@@ -69,7 +95,7 @@ func InitializeBackupReport() {
 	isExcludeSchemaFiltered := len(*excludeSchemas) > 0
 	isExcludeTableFiltered := len(*excludeTables) > 0
 	dbSize := ""
-	if !*metadataOnly && !isIncludeSchemaFiltered && !isIncludeTableFiltered && !isExcludeSchemaFiltered && !isExcludeTableFiltered {
+	if !*metadataOnly && !*globalsOnly && !isIncludeSchemaFiltered && !isIncludeTableFiltered && !isExcludeSchemaFiltered && !isExcludeTableFiltered {
 		gplog.Verbose("Getting database size")
 		dbSize = GetDBSize(connectionPool)
 	}
@@ -78,11 +104,62 @@ func InitializeBackupReport() {
 		DatabaseSize: dbSize,
 		BackupConfig: config,
 	}
-	utils.InitializeCompressionParameters(!*noCompression, *compressionLevel)
-	backupReport.SetBackupParamsFromFlags(*dataOnly, *metadataOnly, "", isIncludeSchemaFiltered, isIncludeTableFiltered, isExcludeSchemaFiltered, isExcludeTableFiltered, *singleDataFile, *withStats)
+	utils.InitializeCompressionParameters(!*noCompression, *compressionType, *compressionLevel)
+	backupReport.SetBackupParamsFromFlags(*dataOnly, *metadataOnly || *globalsOnly, "", isIncludeSchemaFiltered, isIncludeTableFiltered, isExcludeSchemaFiltered, isExcludeTableFiltered, *singleDataFile, *withStats)
+	backupReport.GlobalsOnly = *globalsOnly
+	backupReport.IncludeRoleFiltered = len(*includeRoles) > 0
+	backupReport.ExcludeRoleFiltered = len(*excludeRoles) > 0
+	backupReport.Incremental = *incremental
+	backupReport.Format = *format
+	backupReport.TransactionConsistency = GetTransactionConsistency(connectionPool.NumConns, snapshotID)
+	backupReport.TableFilters = tableFilters
+	backupReport.RowFiltered = len(tableFilters) > 0
+	backupReport.MaskingPolicyFingerprint = maskingPolicyFingerprint
+	backupReport.LeafPartitionData = *leafPartitionData
+	backupReport.Encrypted = *encryptionKeyFile != ""
+	salt := ""
+	if backupReport.Encrypted {
+		salt = utils.GenerateEncryptionSalt()
+	}
+	InitializeEncryptionKey(salt)
 	backupReport.ConstructBackupParamsString()
 }
 
+/*
+ * Each full backup has its own salt, while an incremental backup uses the salt
+ * of the backup it is based on and a resumed backup keeps its original salt,
+ * so that every data file needed to restore a backup has the same key.
+ */
+func InitializeEncryptionKey(salt string) {
+	utils.InitializeEncryptionKey(*encryptionKeyFile, salt)
+	if *encryptionKeyFile != "" {
+		_, key := utils.GetEncryptionParameters()
+		backupReport.EncryptionSalt = salt
+		backupReport.EncryptionKeyFingerprint = utils.GetEncryptionKeyFingerprint(key)
+	}
+}
+
+/*
+ * The keys of the returned map are the file types passed to GetBackupFilePath,
+ * so that gprestore can find each file from its key.
+ */
+func GetMetadataFileChecksums() map[string]string {
+	filetypes := []string{"metadata", "table of contents"}
+	if *withStats {
+		filetypes = append(filetypes, "statistics")
+	}
+	checksums := make(map[string]string, len(filetypes))
+	for _, filetype := range filetypes {
+		filename := globalFPInfo.GetBackupFilePath(filetype)
+		checksum, err := utils.GetFileChecksum(filename)
+		if err != nil {
+			gplog.Fatal(err, "Unable to compute checksum of %s file %s", filetype, filename)
+		}
+		checksums[filetype] = checksum
+	}
+	return checksums
+}
+
 func InitializeFilterLists() {
 	if *excludeTableFile != "" {
 		*excludeTables = iohelper.MustReadLinesFromFile(*excludeTableFile)
@@ -90,6 +167,33 @@ func InitializeFilterLists() {
 	if *includeTableFile != "" {
 		*includeTables = iohelper.MustReadLinesFromFile(*includeTableFile)
 	}
+	if *tableFilterFile != "" {
+		tableFilters = ReadTableFilterFile(*tableFilterFile)
+	}
+	if *maskingPolicyFile != "" {
+		maskingPolicy, maskingPolicyFingerprint = ReadMaskingPolicyFile(*maskingPolicyFile)
+		maskingSecret = GenerateMaskingSecret()
+	}
+}
+
+/*
+ * The table filter file is a YAML map from each table to a predicate, such as
+ *   public.events: event_time > now() - interval '90 days'
+ */
+func ReadTableFilterFile(filename string) map[string]string {
+	contents, err := operating.System.ReadFile(filename)
+	gplog.FatalOnError(err)
+	filters := make(map[string]string, 0)
+	err = yaml.Unmarshal(contents, &filters)
+	if err != nil {
+		gplog.Fatal(err, "Unable to parse table filter file %s", filename)
+	}
+	for table, filter := range filters {
+		if strings.TrimSpace(filter) == "" {
+			gplog.Fatal(errors.Errorf("The filter for table %s in table filter file %s is empty", table, filename), "")
+		}
+	}
+	return filters
 }
 
 func CreateBackupDirectoriesOnAllHosts() {
@@ -108,7 +212,7 @@ func CreateBackupDirectoriesOnAllHosts() {
 func RetrieveAndProcessTables() ([]Relation, []Relation, map[uint32]TableDefinition) {
 	gplog.Info("Gathering list of tables for backup")
 	tables := GetAllUserTables(connectionPool)
-	LockTables(connectionPool, tables)
+	LockTables(connectionPool, tables, *lockWaitTimeout, *lockRetries)
 
 	/*
 	 * We expand the includeTables list to include parent and leaf partitions that may not have been
@@ -123,6 +227,7 @@ func RetrieveAndProcessTables() ([]Relation, []Relation, map[uint32]TableDefinit
 		*includeTables = expandedIncludeTables
 	}
 	tableDefs := ConstructDefinitionsForTables(connectionPool, tables)
+	InitializePartitionLeaves()
 	metadataTables, dataTables := SplitTablesByPartitionType(tables, tableDefs, userPassedIncludeTables)
 	objectCounts["Tables"] = len(metadataTables)
 
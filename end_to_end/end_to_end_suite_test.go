@@ -293,6 +293,142 @@ var _ = Describe("backup end to end integration tests", func() {
 
 			os.RemoveAll(backupdir)
 		})
+		It("runs gpbackup and gprestore with incremental and leaf-partition-data flags", func() {
+			backupdir := "/tmp/incremental"
+			testhelper.AssertQueryRuns(backupConn, "CREATE TABLE public.ao_foo (i int) WITH (appendonly=true) DISTRIBUTED BY (i); INSERT INTO public.ao_foo SELECT generate_series(1, 100);")
+			testhelper.AssertQueryRuns(backupConn, "CREATE TABLE public.ao_bar (i int) WITH (appendonly=true) DISTRIBUTED BY (i); INSERT INTO public.ao_bar SELECT generate_series(1, 100);")
+			defer testhelper.AssertQueryRuns(backupConn, "DROP TABLE public.ao_foo; DROP TABLE public.ao_bar;")
+
+			fullTimestamp := gpbackup(gpbackupPath, "--leaf-partition-data", "--backup-dir", backupdir)
+			testhelper.AssertQueryRuns(backupConn, "INSERT INTO public.ao_foo SELECT generate_series(101, 150);")
+			incrementalTimestamp := gpbackup(gpbackupPath, "--leaf-partition-data", "--incremental", "--backup-dir", backupdir)
+
+			tocFile, _ := filepath.Glob(filepath.Join(backupdir, "*-1/backups/*", incrementalTimestamp, "*toc.yaml"))
+			toc := utils.NewTOC(tocFile[0])
+			for _, entry := range toc.DataEntries {
+				if entry.Name == "ao_bar" {
+					Expect(entry.Timestamp).To(Equal(fullTimestamp))
+				} else {
+					Expect(entry.Timestamp).To(Equal(""))
+				}
+			}
+
+			gprestore(gprestorePath, incrementalTimestamp, "--redirect-db", "restoredb", "--backup-dir", backupdir)
+
+			assertDataRestored(restoreConn, publicSchemaTupleCounts)
+			assertDataRestored(restoreConn, schema2TupleCounts)
+			assertDataRestored(restoreConn, map[string]int{"public.ao_foo": 150, "public.ao_bar": 100})
+
+			os.RemoveAll(backupdir)
+		})
+		It("records backups in the history file and lists them with gpbackup history", func() {
+			timestamp := gpbackup(gpbackupPath, "--metadata-only")
+
+			command := exec.Command(gpbackupPath, "history", "--dbname", "testdb", "--type", "metadata-only", "--limit", "1")
+			output, err := command.CombinedOutput()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(output)).To(MatchRegexp(fmt.Sprintf(`%s\s+testdb\s+Success\s+metadata-only`, timestamp)))
+		})
+		It("deletes a backup with gpbackup delete", func() {
+			backupdir := "/tmp/delete"
+			timestamp := gpbackup(gpbackupPath, "--backup-dir", backupdir)
+			backupDirs, _ := filepath.Glob(filepath.Join(backupdir, "*/backups/*", timestamp))
+			Expect(backupDirs).ToNot(BeEmpty())
+
+			command := exec.Command(gpbackupPath, "delete", "--timestamp", timestamp)
+			output, err := command.CombinedOutput()
+			Expect(err).ToNot(HaveOccurred(), string(output))
+
+			backupDirs, _ = filepath.Glob(filepath.Join(backupdir, "*/backups/*", timestamp))
+			Expect(backupDirs).To(BeEmpty())
+			output, _ = exec.Command(gpbackupPath, "history").CombinedOutput()
+			Expect(string(output)).ToNot(ContainSubstring(timestamp))
+
+			os.RemoveAll(backupdir)
+		})
+		It("verifies a backup with gprestore --verify-only", func() {
+			backupdir := "/tmp/verify"
+			timestamp := gpbackup(gpbackupPath, "--backup-dir", backupdir)
+			output := gprestore(gprestorePath, timestamp, "--verify-only", "--backup-dir", backupdir)
+			Expect(string(output)).To(ContainSubstring("Backup verification complete"))
+
+			dataFiles, _ := filepath.Glob(filepath.Join(backupdir, "*0/backups/*", timestamp, "gpbackup_0_*.gz"))
+			Expect(dataFiles).ToNot(BeEmpty())
+			_ = ioutil.WriteFile(dataFiles[0], []byte("corrupted"), 0644)
+			command := exec.Command(gprestorePath, "--timestamp", timestamp, "--verify-only", "--backup-dir", backupdir)
+			output, err := command.CombinedOutput()
+			Expect(err).To(HaveOccurred())
+			Expect(string(output)).To(ContainSubstring("Backup verification failed"))
+
+			os.RemoveAll(backupdir)
+		})
+		It("runs gpbackup and gprestore with encryption", func() {
+			backupdir := "/tmp/encryption"
+			keyFile := "/tmp/gpbackup_encryption_key"
+			_ = ioutil.WriteFile(keyFile, []byte("format=passphrase\ncorrect horse battery staple\n"), 0600)
+			defer os.Remove(keyFile)
+			timestamp := gpbackup(gpbackupPath, "--backup-dir", backupdir, "--encryption-key-file", keyFile)
+
+			metadataFile, _ := filepath.Glob(filepath.Join(backupdir, "*-1/backups/*", timestamp, "*metadata.sql"))
+			contents, _ := ioutil.ReadFile(metadataFile[0])
+			Expect(string(contents)).ToNot(ContainSubstring("CREATE TABLE"))
+			command := exec.Command(gprestorePath, "--timestamp", timestamp, "--redirect-db", "restoredb", "--backup-dir", backupdir)
+			output, err := command.CombinedOutput()
+			Expect(err).To(HaveOccurred())
+			Expect(string(output)).To(ContainSubstring("The --encryption-key-file flag must be used to restore"))
+
+			gprestore(gprestorePath, timestamp, "--redirect-db", "restoredb", "--backup-dir", backupdir, "--encryption-key-file", keyFile)
+			assertRelationsCreated(restoreConn, 32)
+			assertDataRestored(restoreConn, publicSchemaTupleCounts)
+			assertDataRestored(restoreConn, schema2TupleCounts)
+
+			os.RemoveAll(backupdir)
+		})
+		It("runs gpbackup and gprestore with encryption and a single data file", func() {
+			backupdir := "/tmp/encryption_single_data_file"
+			keyFile := "/tmp/gpbackup_encryption_key"
+			_ = ioutil.WriteFile(keyFile, []byte("format=passphrase\ncorrect horse battery staple\n"), 0600)
+			defer os.Remove(keyFile)
+			timestamp := gpbackup(gpbackupPath, "--backup-dir", backupdir, "--single-data-file", "--encryption-key-file", keyFile)
+			gprestore(gprestorePath, timestamp, "--redirect-db", "restoredb", "--backup-dir", backupdir, "--encryption-key-file", keyFile)
+			assertRelationsCreated(restoreConn, 32)
+			assertDataRestored(restoreConn, publicSchemaTupleCounts)
+			assertDataRestored(restoreConn, schema2TupleCounts)
+
+			os.RemoveAll(backupdir)
+		})
+		It("runs gpbackup and gprestore with zstd compression", func() {
+			if _, err := exec.LookPath("zstd"); err != nil {
+				Skip("zstd is not installed")
+			}
+			backupdir := "/tmp/zstd_compression"
+			timestamp := gpbackup(gpbackupPath, "--compression-type", "zstd", "--backup-dir", backupdir)
+			gprestore(gprestorePath, timestamp, "--redirect-db", "restoredb", "--backup-dir", backupdir)
+			configFile, _ := filepath.Glob(filepath.Join(backupdir, "*-1/backups/*", timestamp, "*config.yaml"))
+			contents, _ := ioutil.ReadFile(configFile[0])
+			dataFiles, _ := filepath.Glob(filepath.Join(backupdir, "*0/backups/*", timestamp, "gpbackup_0_*.zst"))
+
+			Expect(string(contents)).To(ContainSubstring("compressiontype: zstd"))
+			Expect(dataFiles).ToNot(BeEmpty())
+			assertRelationsCreated(restoreConn, 32)
+			assertDataRestored(restoreConn, publicSchemaTupleCounts)
+			assertDataRestored(restoreConn, schema2TupleCounts)
+
+			os.RemoveAll(backupdir)
+		})
+		It("runs gpbackup and gprestore with zstd compression and a single data file", func() {
+			if _, err := exec.LookPath("zstd"); err != nil {
+				Skip("zstd is not installed")
+			}
+			backupdir := "/tmp/zstd_compression_single_data_file"
+			timestamp := gpbackup(gpbackupPath, "--compression-type", "zstd", "--single-data-file", "--backup-dir", backupdir)
+			gprestore(gprestorePath, timestamp, "--redirect-db", "restoredb", "--backup-dir", backupdir)
+			assertRelationsCreated(restoreConn, 32)
+			assertDataRestored(restoreConn, publicSchemaTupleCounts)
+			assertDataRestored(restoreConn, schema2TupleCounts)
+
+			os.RemoveAll(backupdir)
+		})
 		It("runs gpbackup and gprestore with no-compression flag", func() {
 			backupdir := "/tmp/no_compression"
 			timestamp := gpbackup(gpbackupPath, "--no-compression", "--backup-dir", backupdir)
@@ -345,6 +481,29 @@ var _ = Describe("backup end to end integration tests", func() {
 			os.RemoveAll(backupdir)
 		})
 
+		It("runs gpbackup and gprestore with single-data-file and jobs flags", func() {
+			backupdir := "/tmp/single_data_file"
+			timestamp := gpbackup(gpbackupPath, "--single-data-file", "--jobs", "4", "--backup-dir", backupdir)
+			gprestore(gprestorePath, timestamp, "--redirect-db", "restoredb", "--backup-dir", backupdir, "--jobs", "2")
+
+			assertRelationsCreated(restoreConn, 32)
+			assertDataRestored(restoreConn, publicSchemaTupleCounts)
+			assertDataRestored(restoreConn, schema2TupleCounts)
+
+			os.RemoveAll(backupdir)
+		})
+		It("runs gprestore without the jobs flag on a backup taken with single-data-file and jobs flags", func() {
+			backupdir := "/tmp/single_data_file"
+			timestamp := gpbackup(gpbackupPath, "--single-data-file", "--jobs", "4", "--backup-dir", backupdir)
+			gprestore(gprestorePath, timestamp, "--redirect-db", "restoredb", "--backup-dir", backupdir)
+
+			assertRelationsCreated(restoreConn, 32)
+			assertDataRestored(restoreConn, publicSchemaTupleCounts)
+			assertDataRestored(restoreConn, schema2TupleCounts)
+
+			os.RemoveAll(backupdir)
+		})
+
 		It("runs gpbackup and gprestore with plugin, single-data-file, and no-compression", func() {
 			pluginDir := "/tmp/plugin_dest"
 			pluginExecutablePath := fmt.Sprintf("%s/go/src/github.com/greenplum-db/gpbackup/plugins/example_plugin.sh", os.Getenv("HOME"))
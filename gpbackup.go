@@ -22,6 +22,8 @@ func main() {
 			DoSetup()
 			DoBackup()
 		}}
+	rootCmd.AddCommand(NewDeleteCommand())
+	rootCmd.AddCommand(NewHistoryCommand())
 	rootCmd.SetArgs(utils.HandleSingleDashes(os.Args[1:]))
 	DoInit(rootCmd)
 	if err := rootCmd.Execute(); err != nil {
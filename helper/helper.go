@@ -4,9 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"sort"
@@ -19,6 +22,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 )
 
 /*
@@ -26,31 +30,57 @@ import (
  */
 
 var (
-	CleanupGroup  *sync.WaitGroup
-	currentPipe   string
-	errBuf        bytes.Buffer
-	lastPipe      string
-	nextPipe      string
-	version       string
-	wasTerminated bool
-	writeHandle   *os.File
-	writer        *bufio.Writer
+	CleanupGroup    *sync.WaitGroup
+	dataStreams     []*dataStream
+	streamErrorOnce sync.Once
+	version         string
+	wasTerminated   bool
 )
 
+/*
+ * Each data file on a segment is read or written by its own goroutine, which
+ * serves the pipes for the tables in that file one at a time.  A backup only
+ * has more than one data file per segment if it was taken with --jobs.
+ */
+type dataStream struct {
+	index       int
+	dataFile    string
+	oidList     []int
+	currentPipe string
+	lastPipe    string
+	nextPipe    string
+	writer      *bufio.Writer
+	writeHandle *os.File
+	errBuf      bytes.Buffer
+}
+
 /*
  * Command-line flags
  */
 var (
-	backupAgent      *bool
-	compressionLevel *int
-	content          *int
-	dataFile         *string
-	oidFile          *string
-	pipeFile         *string
-	pluginConfigFile *string
-	printVersion     *bool
-	restoreAgent     *bool
-	tocFile          *string
+	backupAgent       *bool
+	checksumFile      *string
+	compressionLevel  *int
+	compressionType   *string
+	content           *int
+	dataFile          *string
+	numDataStreams    *int
+	decrypt           *bool
+	encrypt           *bool
+	encryptionKeyFile *string
+	encryptionSalt    *string
+	keyFingerprint    *bool
+	oid               *int
+	oidFile           *string
+	onErrorContinue   *bool
+	pipeFile          *string
+	pluginConfigFile  *string
+	printVersion      *bool
+	readTableData     *bool
+	restoreAgent      *bool
+	tocFile           *string
+	verifyAgent       *bool
+	writeTableData    *bool
 )
 
 func DoHelper() {
@@ -61,6 +91,16 @@ func DoHelper() {
 		doBackupAgent()
 	} else if *restoreAgent {
 		doRestoreAgent()
+	} else if *verifyAgent {
+		doVerifyAgent()
+	} else if *writeTableData {
+		doWriteTableData()
+	} else if *readTableData {
+		doReadTableData()
+	} else if *encrypt {
+		doEncrypt()
+	} else if *decrypt {
+		doDecrypt()
 	}
 }
 
@@ -70,15 +110,28 @@ func InitializeGlobals() {
 	gplog.InitializeLogging("gpbackup_helper", "")
 
 	backupAgent = flag.Bool("backup-agent", false, "Use gpbackup_helper as an agent for backup")
+	checksumFile = flag.String("checksum-file", "", "Absolute path to the file containing the checksums of the data files on the segment")
 	content = flag.Int("content", -2, "Content ID of the corresponding segment")
-	compressionLevel = flag.Int("compression-level", 0, "The level of compression to use with gzip. O indicates no compression.")
+	compressionLevel = flag.Int("compression-level", 0, "The level of compression to use. O indicates no compression.")
+	compressionType = flag.String("compression-type", "gzip", "The type of compression to use")
 	dataFile = flag.String("data-file", "", "Absolute path to the data file")
+	numDataStreams = flag.Int("data-streams", 1, "The number of data files to write in parallel for backup")
+	decrypt = flag.Bool("decrypt", false, "Decrypt data from stdin to stdout")
+	encrypt = flag.Bool("encrypt", false, "Encrypt data from stdin to stdout")
+	encryptionKeyFile = flag.String("encryption-key-file", "", "Absolute path to the file containing the encryption key or passphrase")
+	encryptionSalt = flag.String("encryption-salt", "", "The salt of the backup, used to derive the encryption key from a passphrase")
+	keyFingerprint = flag.Bool("key-fingerprint", false, "Print the fingerprint of the encryption key and exit")
+	oid = flag.Int("oid", 0, "The oid of the table whose data file is read or written")
 	oidFile = flag.String("oid-file", "", "Absolute path to the file containing a list of oids to restore")
+	onErrorContinue = flag.Bool("on-error-continue", false, "Log checksum mismatches and continue restore, instead of exiting on first mismatch")
 	pipeFile = flag.String("pipe-file", "", "Absolute path to the pipe file")
 	pluginConfigFile = flag.String("plugin-config", "", "The configuration file to use for a plugin")
 	printVersion = flag.Bool("version", false, "Print version number and exit")
+	readTableData = flag.Bool("read-table-data", false, "Read the data file of a table to stdout, verifying its checksum")
 	restoreAgent = flag.Bool("restore-agent", false, "Use gpbackup_helper as an agent for restore")
 	tocFile = flag.String("toc-file", "", "Absolute path to the table of contents file")
+	verifyAgent = flag.Bool("verify-agent", false, "Use gpbackup_helper as an agent for backup verification")
+	writeTableData = flag.Bool("write-table-data", false, "Write the data file of a table from stdin, recording its checksum")
 
 	flag.Parse()
 	if *printVersion {
@@ -86,6 +139,15 @@ func InitializeGlobals() {
 		os.Exit(0)
 	}
 	operating.InitializeSystemFunctions()
+	utils.InitializeEncryptionKey(*encryptionKeyFile, *encryptionSalt)
+	if *keyFingerprint {
+		_, key := utils.GetEncryptionParameters()
+		if key == nil {
+			gplog.Fatal(errors.Errorf("--key-fingerprint requires --encryption-key-file"), "")
+		}
+		fmt.Println(utils.GetEncryptionKeyFingerprint(key))
+		os.Exit(0)
+	}
 }
 
 /*
@@ -93,55 +155,73 @@ func InitializeGlobals() {
  */
 
 func doBackupAgent() {
-	var lastRead uint64
+	oidList := getOidListFromFile()
+	oids := make([]uint32, len(oidList))
+	for i, oid := range oidList {
+		oids[i] = uint32(oid)
+	}
+	initializeDataStreams(oidList, utils.AssignDataStreams(oids, *numDataStreams))
+
 	toc := &utils.SegmentTOC{}
 	toc.DataEntries = make(map[uint]utils.SegmentDataEntry, 0)
+	var tocMutex sync.Mutex
+	runDataStreams(func(stream *dataStream) {
+		streamEntries := backupDataStream(stream)
+		tocMutex.Lock()
+		for oid, entry := range streamEntries {
+			toc.DataEntries[oid] = entry
+		}
+		tocMutex.Unlock()
+	})
+	toc.WriteToFileAndMakeReadOnly(*tocFile)
+	log("Finished writing segment TOC")
+}
 
-	oidList := getOidListFromFile()
+func backupDataStream(stream *dataStream) map[uint]utils.SegmentDataEntry {
+	var lastRead uint64
+	toc := &utils.SegmentTOC{}
+	toc.DataEntries = make(map[uint]utils.SegmentDataEntry, 0)
+	oidList := stream.oidList
 
-	currentPipe = fmt.Sprintf("%s_%d", *pipeFile, oidList[0])
+	stream.currentPipe = fmt.Sprintf("%s_%d", *pipeFile, oidList[0])
 	log(fmt.Sprintf("Opening pipe for oid %d", oidList[0]))
 	/*
 	 * It is important that we create the reader before creating the writer
 	 * so that we establish a connection to the first pipe (created by gpbackup)
 	 * and properly clean it up if an error occurs while creating the writer.
 	 */
-	reader, readHandle := getBackupPipeReader(currentPipe)
-	finalWriter, gzipWriter, bufIoWriter, writeHandle, writeCmd := getBackupPipeWriter(*compressionLevel)
+	reader, readHandle := getBackupPipeReader(stream.currentPipe)
+	finalWriter, compressWriter, encryptWriter, bufIoWriter, writeHandle, writeCmd := getBackupPipeWriter(stream, *compressionLevel)
 	for i, oid := range oidList {
 		if i < len(oidList)-1 {
-			nextPipe = fmt.Sprintf("%s_%d", *pipeFile, oidList[i+1])
-			createPipe(nextPipe)
+			stream.nextPipe = fmt.Sprintf("%s_%d", *pipeFile, oidList[i+1])
+			createPipe(stream.nextPipe)
 		} else {
-			nextPipe = ""
+			stream.nextPipe = ""
 		}
 
 		log(fmt.Sprintf("Backing up table with oid %d\n", oid))
-		numBytes, err := io.Copy(finalWriter, reader)
-		gplog.FatalOnError(err, strings.Trim(errBuf.String(), "\x00"))
+		hasher := sha256.New()
+		numBytes, err := io.Copy(io.MultiWriter(finalWriter, hasher), reader)
+		gplog.FatalOnError(err, strings.Trim(stream.errBuf.String(), "\x00"))
 		log(fmt.Sprintf("Read %d bytes\n", numBytes))
 
 		lastProcessed := lastRead + uint64(numBytes)
-		toc.AddSegmentDataEntry(uint(oid), lastRead, lastProcessed)
+		toc.AddSegmentDataEntry(uint(oid), lastRead, lastProcessed, fmt.Sprintf("%x", hasher.Sum(nil)), stream.index)
 		lastRead = lastProcessed
 
-		lastPipe = currentPipe
-		currentPipe = nextPipe
+		stream.lastPipe = stream.currentPipe
+		stream.currentPipe = stream.nextPipe
 		_ = readHandle.Close()
-		removeFileIfExists(lastPipe)
-		if currentPipe != "" {
+		removeFileIfExists(stream.lastPipe)
+		if stream.currentPipe != "" {
 			log(fmt.Sprintf("Opening pipe for oid %d\n", oidList[i+1]))
-			reader, readHandle = getBackupPipeReader(currentPipe)
+			reader, readHandle = getBackupPipeReader(stream.currentPipe)
 		}
 	}
 
-	/*
-	 * The order for flushing and closing the writers below is very specific
-	 * to ensure all data is written to the file and file handles are not leaked.
-	 */
-	if gzipWriter != nil {
-		_ = gzipWriter.Close()
-	}
+	err := closeBackupWriters(compressWriter, encryptWriter)
+	gplog.FatalOnError(err)
 	_ = bufIoWriter.Flush()
 	_ = writeHandle.Close()
 	if *pluginConfigFile != "" {
@@ -155,11 +235,10 @@ func doBackupAgent() {
 		if err := writeCmd.Wait(); err != nil {
 			handle := iohelper.MustOpenFileForWriting(fmt.Sprintf("%s_error", *pipeFile))
 			_ = handle.Close()
-			gplog.Fatal(err, strings.Trim(errBuf.String(), "\x00"))
+			gplog.Fatal(err, strings.Trim(stream.errBuf.String(), "\x00"))
 		}
 	}
-	toc.WriteToFileAndMakeReadOnly(*tocFile)
-	log("Finished writing segment TOC")
+	return toc.DataEntries
 }
 
 func getBackupPipeReader(currentPipe string) (io.Reader, io.ReadCloser) {
@@ -172,37 +251,70 @@ func getBackupPipeReader(currentPipe string) (io.Reader, io.ReadCloser) {
 	return reader, readHandle
 }
 
-func getBackupPipeWriter(compressLevel int) (io.Writer, *gzip.Writer, *bufio.Writer, io.WriteCloser, *exec.Cmd) {
+/*
+ * Data is compressed before it is encrypted, as encrypted data does not
+ * compress, so the writers are chained as compression -> encryption -> file.
+ */
+func getBackupPipeWriter(stream *dataStream, compressLevel int) (io.Writer, io.WriteCloser, *utils.EncryptWriter, *bufio.Writer, io.WriteCloser, *exec.Cmd) {
 	var writeHandle io.WriteCloser
 	var err error
 	var writeCmd *exec.Cmd
 	if *pluginConfigFile != "" {
-		writeCmd, writeHandle = startBackupPluginCommand()
+		writeCmd, writeHandle = startBackupPluginCommand(stream)
 	} else {
-		writeHandle, err = os.Create(*dataFile)
+		writeHandle, err = os.Create(stream.dataFile)
 		gplog.FatalOnError(err)
 	}
 
+	finalWriter, compressWriter, encryptWriter, bufIoWriter := getBackupWriters(writeHandle, compressLevel)
+	return finalWriter, compressWriter, encryptWriter, bufIoWriter, writeHandle, writeCmd
+}
+
+func getBackupWriters(writeHandle io.Writer, compressLevel int) (io.Writer, io.WriteCloser, *utils.EncryptWriter, *bufio.Writer) {
 	var finalWriter io.Writer
-	var gzipWriter *gzip.Writer
+	var compressWriter io.WriteCloser
+	var encryptWriter *utils.EncryptWriter
+	var err error
 	bufIoWriter := bufio.NewWriter(writeHandle)
 	finalWriter = bufIoWriter
-	if compressLevel > 0 {
-		gzipWriter, err = gzip.NewWriterLevel(bufIoWriter, compressLevel)
+	if _, key := utils.GetEncryptionParameters(); key != nil {
+		encryptWriter, err = utils.NewEncryptWriter(bufIoWriter, key)
 		gplog.FatalOnError(err)
-		finalWriter = gzipWriter
+		finalWriter = encryptWriter
+	}
+	if compressLevel > 0 {
+		compressWriter = getCompressWriter(finalWriter, *compressionType, compressLevel)
+		finalWriter = compressWriter
+	}
+	return finalWriter, compressWriter, encryptWriter, bufIoWriter
+}
+
+/*
+ * The order for closing the writers below is very specific to ensure all data
+ * is written to the buffered writer, which the caller then flushes.
+ */
+func closeBackupWriters(compressWriter io.WriteCloser, encryptWriter *utils.EncryptWriter) error {
+	if compressWriter != nil {
+		if err := compressWriter.Close(); err != nil {
+			return err
+		}
 	}
-	return finalWriter, gzipWriter, bufIoWriter, writeHandle, writeCmd
+	if encryptWriter != nil {
+		if err := encryptWriter.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func startBackupPluginCommand() (*exec.Cmd, io.WriteCloser) {
+func startBackupPluginCommand(stream *dataStream) (*exec.Cmd, io.WriteCloser) {
 	pluginConfig := utils.ReadPluginConfig(*pluginConfigFile)
-	cmdStr := fmt.Sprintf("%s backup_data %s %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath, *dataFile)
+	cmdStr := fmt.Sprintf("%s backup_data %s %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath, stream.dataFile)
 	writeCmd := exec.Command("bash", "-c", cmdStr)
 
 	writeHandle, err := writeCmd.StdinPipe()
 	gplog.FatalOnError(err)
-	writeCmd.Stderr = &errBuf
+	writeCmd.Stderr = &stream.errBuf
 	err = writeCmd.Start()
 	gplog.FatalOnError(err)
 	return writeCmd, writeHandle
@@ -214,25 +326,33 @@ func startBackupPluginCommand() (*exec.Cmd, io.WriteCloser) {
 
 func doRestoreAgent() {
 	tocEntries := utils.NewSegmentTOC(*tocFile).DataEntries
-	var lastByte uint64
 	oidList := getOidListFromFile()
+	initializeDataStreams(oidList, getSegmentTOCStreams(tocEntries))
+	runDataStreams(func(stream *dataStream) {
+		restoreDataStream(stream, tocEntries)
+	})
+}
+
+func restoreDataStream(stream *dataStream, tocEntries map[uint]utils.SegmentDataEntry) {
+	var lastByte uint64
+	oidList := stream.oidList
 
-	currentPipe = fmt.Sprintf("%s_%d", *pipeFile, oidList[0])
+	stream.currentPipe = fmt.Sprintf("%s_%d", *pipeFile, oidList[0])
 	log(fmt.Sprintf("Opening pipe for oid %d", oidList[0]))
 	/*
 	 * It is important that we create the writer before creating the reader
 	 * so that we establish a connection to the first pipe (created by gprestore)
 	 * and properly clean it up if an error occurs while creating the reader.
 	 */
-	writer, writeHandle = getRestorePipeWriter(currentPipe)
-	reader := getRestorePipeReader()
+	stream.writer, stream.writeHandle = getRestorePipeWriter(stream.currentPipe)
+	reader := getRestorePipeReader(stream)
 	for i, oid := range oidList {
 		log(fmt.Sprintf("Restoring table with oid %d", oid))
 		if i < len(oidList)-1 {
-			nextPipe = fmt.Sprintf("%s_%d", *pipeFile, oidList[i+1])
-			createPipe(nextPipe)
+			stream.nextPipe = fmt.Sprintf("%s_%d", *pipeFile, oidList[i+1])
+			createPipe(stream.nextPipe)
 		} else {
-			nextPipe = ""
+			stream.nextPipe = ""
 		}
 		start := tocEntries[uint(oid)].StartByte
 		end := tocEntries[uint(oid)].EndByte
@@ -240,57 +360,82 @@ func doRestoreAgent() {
 		_, err := reader.Discard(int(start - lastByte))
 		gplog.FatalOnError(err)
 		log(fmt.Sprintf("Discarded %d bytes", start-lastByte))
-		bytesRead, err := io.CopyN(writer, reader, int64(end-start))
+		hasher := sha256.New()
+		bytesRead, err := io.CopyN(io.MultiWriter(stream.writer, hasher), reader, int64(end-start))
 		log(fmt.Sprintf("Read %d bytes", bytesRead))
-		gplog.FatalOnError(err, errBuf.String())
+		gplog.FatalOnError(err, stream.errBuf.String())
+		verifyChecksum(oid, tocEntries[uint(oid)].Checksum, hasher)
 		log(fmt.Sprintf("Closing pipe for oid %d", oid))
-		flushAndCloseRestoreWriter()
+		flushAndCloseRestoreWriter(stream)
 		lastByte = end
 
-		lastPipe = currentPipe
-		currentPipe = nextPipe
-		removeFileIfExists(lastPipe)
-		if currentPipe != "" {
+		stream.lastPipe = stream.currentPipe
+		stream.currentPipe = stream.nextPipe
+		removeFileIfExists(stream.lastPipe)
+		if stream.currentPipe != "" {
 			log(fmt.Sprintf("Opening pipe for oid %d", oid))
-			writer, writeHandle = getRestorePipeWriter(currentPipe)
+			stream.writer, stream.writeHandle = getRestorePipeWriter(stream.currentPipe)
 		}
 	}
 }
 
-func getRestorePipeReader() *bufio.Reader {
+/*
+ * The checksum is verified before the pipe is closed, and on a mismatch an
+ * error file for the table's pipe is created, which makes the COPY program
+ * exit with an error so that the table's data is not committed.  A mismatch
+ * is also reported through the agent's error file as well as the helper log,
+ * so that gprestore reports it even when the agent continues past it.
+ */
+func verifyChecksum(oid int, expectedChecksum string, hasher hash.Hash) {
+	if expectedChecksum == "" {
+		// Backups taken before checksums were recorded have no checksum to verify
+		return
+	}
+	actualChecksum := fmt.Sprintf("%x", hasher.Sum(nil))
+	if actualChecksum == expectedChecksum {
+		return
+	}
+	for _, errorFile := range []string{fmt.Sprintf("%s_%d_error", *pipeFile, oid), fmt.Sprintf("%s_error", *pipeFile)} {
+		handle := iohelper.MustOpenFileForWriting(errorFile)
+		_ = handle.Close()
+	}
+	errMsg := fmt.Sprintf("Checksum mismatch for data of table with oid %d: expected %s, found %s", oid, expectedChecksum, actualChecksum)
+	if *onErrorContinue {
+		gplog.Error("Segment %d: %s", *content, errMsg)
+		return
+	}
+	gplog.Fatal(errors.Errorf("Segment %d: %s", *content, errMsg), "")
+}
+
+func getRestorePipeReader(stream *dataStream) *bufio.Reader {
 	var readHandle io.Reader
 	var err error
 	if *pluginConfigFile != "" {
-		readHandle = startRestorePluginCommand()
+		readHandle = startRestorePluginCommand(stream)
 		defer func() {
-			if len(errBuf.String()) != 0 {
-				gplog.Error(errBuf.String())
+			if len(stream.errBuf.String()) != 0 {
+				gplog.Error(stream.errBuf.String())
 			}
 		}()
 	} else {
-		readHandle, err = os.Open(*dataFile)
+		readHandle, err = os.Open(stream.dataFile)
 		gplog.FatalOnError(err)
 	}
+	readHandle = getDecryptReader(readHandle, stream.dataFile)
 
-	var bufIoReader *bufio.Reader
-	if strings.HasSuffix(*dataFile, ".gz") {
-		gzipReader, err := gzip.NewReader(readHandle)
-		gplog.FatalOnError(err)
-		bufIoReader = bufio.NewReader(gzipReader)
-	} else {
-		bufIoReader = bufio.NewReader(readHandle)
-	}
-	return bufIoReader
+	dataReader, err := getDecompressReader(readHandle, stream.dataFile)
+	gplog.FatalOnError(err)
+	return bufio.NewReader(dataReader)
 }
 
-func startRestorePluginCommand() io.Reader {
+func startRestorePluginCommand(stream *dataStream) io.Reader {
 	pluginConfig := utils.ReadPluginConfig(*pluginConfigFile)
-	cmdStr := fmt.Sprintf("%s restore_data %s %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath, *dataFile)
+	cmdStr := fmt.Sprintf("%s restore_data %s %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath, stream.dataFile)
 	cmd := exec.Command("bash", "-c", cmdStr)
 
 	readHandle, err := cmd.StdoutPipe()
 	gplog.FatalOnError(err)
-	cmd.Stderr = &errBuf
+	cmd.Stderr = &stream.errBuf
 
 	err = cmd.Start()
 	gplog.FatalOnError(err)
@@ -305,10 +450,472 @@ func getRestorePipeWriter(currentPipe string) (*bufio.Writer, *os.File) {
 	return pipeWriter, fileHandle
 }
 
+/*
+ * Table data file specific functions
+ */
+
+/*
+ * When each table has its own data file, gpbackup and gprestore run the
+ * helper in the COPY command to write or read the table's data file, so that
+ * the file's checksum is computed as the data is streamed through it instead
+ * of by reading the file again.
+ */
+func doWriteTableData() {
+	writeHandle, err := os.Create(*dataFile)
+	gplog.FatalOnError(err)
+	hasher := sha256.New()
+	finalWriter, compressWriter, encryptWriter, bufIoWriter := getBackupWriters(io.MultiWriter(writeHandle, hasher), *compressionLevel)
+	_, err = io.Copy(finalWriter, bufio.NewReader(os.Stdin))
+	gplog.FatalOnError(err)
+	err = closeBackupWriters(compressWriter, encryptWriter)
+	gplog.FatalOnError(err)
+	err = bufIoWriter.Flush()
+	gplog.FatalOnError(err)
+	err = writeHandle.Close()
+	gplog.FatalOnError(err)
+	info, err := os.Stat(*dataFile)
+	gplog.FatalOnError(err)
+
+	/*
+	 * The line is written with a single call to an O_APPEND file, so that lines
+	 * written by the COPY commands of different connections are not interleaved.
+	 */
+	checksumHandle, err := os.OpenFile(*checksumFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	gplog.FatalOnError(err)
+	_, err = checksumHandle.WriteString(utils.FormatDataFileInfo(uint32(*oid), utils.DataFileInfo{Size: info.Size(), Checksum: fmt.Sprintf("%x", hasher.Sum(nil))}))
+	gplog.FatalOnError(err)
+	err = checksumHandle.Close()
+	gplog.FatalOnError(err)
+}
+
+/*
+ * All of the data is written out before the checksum is verified, as COPY
+ * only fails once the program exits, and a mismatch makes the helper exit
+ * with an error so that the COPY fails before it commits.
+ */
+func doReadTableData() {
+	expectedChecksum := ""
+	if *checksumFile != "" {
+		contents, err := ioutil.ReadFile(*checksumFile)
+		gplog.FatalOnError(err)
+		info, ok := utils.ParseDataFileInfo(string(contents))[uint32(*oid)]
+		if !ok {
+			gplog.Fatal(errors.Errorf("Segment %d: No checksum is recorded in %s for the data of table with oid %d", *content, *checksumFile, *oid), "")
+		}
+		expectedChecksum = info.Checksum
+	}
+	readHandle, err := os.Open(*dataFile)
+	gplog.FatalOnError(err)
+	defer readHandle.Close()
+	hasher := sha256.New()
+	fileReader := io.TeeReader(bufio.NewReader(readHandle), hasher)
+	dataReader, err := getDecompressReader(getDecryptReader(fileReader, *dataFile), *dataFile)
+	gplog.FatalOnError(err)
+	output := bufio.NewWriter(os.Stdout)
+	_, err = io.Copy(output, dataReader)
+	gplog.FatalOnError(err)
+	err = output.Flush()
+	gplog.FatalOnError(err)
+	// Read any bytes after the end of the compressed data so that the checksum covers the whole file
+	_, err = io.Copy(ioutil.Discard, fileReader)
+	gplog.FatalOnError(err)
+
+	actualChecksum := fmt.Sprintf("%x", hasher.Sum(nil))
+	if expectedChecksum != "" && actualChecksum != expectedChecksum {
+		gplog.Fatal(errors.Errorf("Segment %d: Checksum mismatch for data file %s of table with oid %d: expected %s, found %s", *content, *dataFile, *oid, expectedChecksum, actualChecksum), "")
+	}
+}
+
+/*
+ * Verify specific functions
+ */
+
+/*
+ * The verification agent is only given a segment TOC file for a backup with a
+ * single data file per segment, or one per stream for a backup taken with
+ * --jobs; otherwise each table has its own data file.
+ * Results are printed to stdout for gprestore to parse, and errors that apply
+ * to the data file as a whole cause the agent to exit with an error.
+ */
+func doVerifyAgent() {
+	oidList := getOidListFromFile()
+	if *tocFile != "" {
+		verifySingleDataFiles(oidList)
+		return
+	}
+	for _, oid := range oidList {
+		fmt.Println(verifyTableDataFile(uint32(oid)))
+	}
+}
+
+func verifyTableDataFile(oid uint32) utils.DataFileVerification {
+	verification := utils.DataFileVerification{Oid: oid}
+	filename := getTableDataFilePath(oid)
+	log(fmt.Sprintf("Verifying data file %s", filename))
+	info, err := os.Stat(filename)
+	if err != nil {
+		verification.Error = fmt.Sprintf("Cannot access data file %s: %v", filename, err)
+		return verification
+	}
+	verification.Size = info.Size()
+	handle, err := os.Open(filename)
+	if err != nil {
+		verification.Error = fmt.Sprintf("Cannot open data file %s: %v", filename, err)
+		return verification
+	}
+	defer handle.Close()
+
+	hasher := sha256.New()
+	fileReader := io.TeeReader(handle, hasher)
+	var dataReader io.Reader = fileReader
+	if _, key := utils.GetEncryptionParameters(); key != nil {
+		dataReader, err = utils.NewDecryptReader(fileReader, key)
+		if err != nil {
+			verification.Error = fmt.Sprintf("Unable to decrypt data file %s: %v", filename, err)
+			return verification
+		}
+	}
+	dataReader, err = getDecompressReader(dataReader, filename)
+	if err != nil {
+		verification.Error = fmt.Sprintf("Unable to decompress data file %s: %v", filename, err)
+		return verification
+	}
+	verification.Rows, err = utils.CountCSVRows(dataReader)
+	if err != nil {
+		verification.Error = fmt.Sprintf("Unable to read data file %s: %v", filename, err)
+		return verification
+	}
+	// Read any bytes after the end of the compressed data so that the checksum covers the whole file
+	_, err = io.Copy(ioutil.Discard, fileReader)
+	if err != nil {
+		verification.Error = fmt.Sprintf("Unable to read data file %s: %v", filename, err)
+		return verification
+	}
+	verification.Checksum = fmt.Sprintf("%x", hasher.Sum(nil))
+	return verification
+}
+
+/*
+ * The data file path passed to the agent is that of a single data file, so
+ * the oid is inserted before the compression extension, if any.
+ */
+func getTableDataFilePath(oid uint32) string {
+	return insertIntoDataFilePath(fmt.Sprintf("_%d", oid))
+}
+
+func verifySingleDataFiles(oidList []int) {
+	tocEntries := utils.NewSegmentTOC(*tocFile).DataEntries
+	entryOids := make([]int, 0)
+	for _, oid := range oidList {
+		if _, ok := tocEntries[uint(oid)]; ok {
+			entryOids = append(entryOids, oid)
+		} else {
+			fmt.Println(utils.DataFileVerification{Oid: uint32(oid), Error: "Table is not in the segment table of contents"})
+		}
+	}
+	initializeDataStreams(entryOids, getSegmentTOCStreams(tocEntries))
+	for _, stream := range dataStreams {
+		verifyDataStream(stream, tocEntries)
+	}
+}
+
+func verifyDataStream(stream *dataStream, tocEntries map[uint]utils.SegmentDataEntry) {
+	var expectedSize uint64
+	for _, entry := range tocEntries {
+		if entry.Stream == stream.index && entry.EndByte > expectedSize {
+			expectedSize = entry.EndByte
+		}
+	}
+
+	entryOids := make([]uint, len(stream.oidList))
+	for i, oid := range stream.oidList {
+		entryOids[i] = uint(oid)
+	}
+	sort.Slice(entryOids, func(i int, j int) bool {
+		return tocEntries[entryOids[i]].StartByte < tocEntries[entryOids[j]].StartByte
+	})
+
+	dataFile := stream.dataFile
+	readHandle, err := os.Open(dataFile)
+	gplog.FatalOnError(err)
+	defer readHandle.Close()
+	dataReader, err := getDecompressReader(getDecryptReader(readHandle, dataFile), dataFile)
+	gplog.FatalOnError(err)
+	reader := bufio.NewReader(dataReader)
+
+	var lastByte uint64
+	var readErr error
+	for _, oid := range entryOids {
+		entry := tocEntries[oid]
+		verification := utils.DataFileVerification{Oid: uint32(oid), Size: int64(entry.EndByte - entry.StartByte)}
+		if readErr == nil && entry.StartByte > lastByte {
+			var numDiscarded int
+			numDiscarded, readErr = reader.Discard(int(entry.StartByte - lastByte))
+			lastByte += uint64(numDiscarded)
+			if readErr == io.EOF {
+				readErr = errors.Errorf("Data file %s ends at byte %d, expected %d", dataFile, lastByte, expectedSize)
+			}
+		}
+		if readErr != nil {
+			verification.Error = readErr.Error()
+			fmt.Println(verification)
+			continue
+		}
+		log(fmt.Sprintf("Verifying data for table with oid %d; Start Byte: %d; End Byte: %d", oid, entry.StartByte, entry.EndByte))
+		hasher := sha256.New()
+		tableReader := &io.LimitedReader{R: reader, N: int64(entry.EndByte - entry.StartByte)}
+		verification.Rows, readErr = utils.CountCSVRows(io.TeeReader(tableReader, hasher))
+		lastByte = entry.EndByte - uint64(tableReader.N)
+		verification.Checksum = fmt.Sprintf("%x", hasher.Sum(nil))
+		if readErr != nil {
+			readErr = errors.Wrapf(readErr, "Unable to read data file %s", dataFile)
+			verification.Error = readErr.Error()
+		} else if tableReader.N > 0 {
+			readErr = errors.Errorf("Data file %s ends at byte %d, expected %d", dataFile, lastByte, expectedSize)
+			verification.Error = readErr.Error()
+		} else if entry.Checksum != "" && verification.Checksum != entry.Checksum {
+			verification.Error = fmt.Sprintf("Checksum mismatch: expected %s, found %s", entry.Checksum, verification.Checksum)
+		}
+		fmt.Println(verification)
+	}
+	if readErr != nil {
+		// The error has already been reported for each table that could not be read
+		return
+	}
+
+	// Reading the rest of the file also verifies the end of the compressed data, such as the gzip trailer
+	numRemaining, err := io.Copy(ioutil.Discard, reader)
+	if err != nil {
+		gplog.Fatal(err, "Unable to read data file %s", dataFile)
+	}
+	if actualSize := lastByte + uint64(numRemaining); actualSize != expectedSize {
+		gplog.Fatal(errors.Errorf("Data file %s contains %d bytes of data, expected %d", dataFile, actualSize, expectedSize), "")
+	}
+}
+
+/*
+ * Compression specific functions
+ */
+
+/*
+ * gzip data is compressed and decompressed in the helper itself; the other
+ * codecs are run as external programs that the data is streamed through.
+ */
+func getCompressWriter(writer io.Writer, compressType string, compressLevel int) io.WriteCloser {
+	if compressType == "gzip" {
+		gzipWriter, err := gzip.NewWriterLevel(writer, compressLevel)
+		gplog.FatalOnError(err)
+		return gzipWriter
+	}
+	compression, err := utils.NewCompression(compressType, compressLevel)
+	gplog.FatalOnError(err)
+	cmd := exec.Command("bash", "-c", compression.CompressCommand)
+	cmd.Stdout = writer
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	gplog.FatalOnError(err)
+	err = cmd.Start()
+	gplog.FatalOnError(err)
+	return &commandWriter{cmd: cmd, stdin: stdin, stderr: stderr}
+}
+
+// Returns the reader unchanged if the file is not compressed
+func getDecompressReader(reader io.Reader, filename string) (io.Reader, error) {
+	compression, ok := utils.GetCompressionForFile(filename)
+	if !ok {
+		return reader, nil
+	}
+	if compression.Name == "gzip" {
+		return gzip.NewReader(reader)
+	}
+	cmd := exec.Command("bash", "-c", compression.DecompressCommand)
+	cmd.Stdin = reader
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandReader{cmd: cmd, stdout: stdout, stderr: stderr}, nil
+}
+
+type commandWriter struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *bytes.Buffer
+}
+
+func (w *commandWriter) Write(p []byte) (int, error) {
+	return w.stdin.Write(p)
+}
+
+// Waits for the program to write out all of the compressed data
+func (w *commandWriter) Close() error {
+	_ = w.stdin.Close()
+	return getCommandError(w.cmd, w.stderr)
+}
+
+/*
+ * The program's exit status is only checked once all of its output has been
+ * read, so that corrupt data is reported as an error instead of as the end
+ * of the data.
+ */
+type commandReader struct {
+	cmd    *exec.Cmd
+	stdout io.Reader
+	stderr *bytes.Buffer
+	err    error
+	done   bool
+}
+
+func (r *commandReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, r.err
+	}
+	n, err := r.stdout.Read(p)
+	if err == io.EOF {
+		r.done = true
+		r.err = io.EOF
+		if cmdErr := getCommandError(r.cmd, r.stderr); cmdErr != nil {
+			r.err = cmdErr
+		}
+		return n, r.err
+	}
+	return n, err
+}
+
+func getCommandError(cmd *exec.Cmd, stderr *bytes.Buffer) error {
+	if err := cmd.Wait(); err != nil {
+		return errors.Wrapf(err, "%s failed: %s", cmd.Args[2], strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+/*
+ * Encryption specific functions
+ */
+
+/*
+ * When each table has its own data file, gpbackup and gprestore run the
+ * helper as a filter in the COPY command to encrypt or decrypt the data.
+ */
+func doEncrypt() {
+	key := getEncryptionKey()
+	output := bufio.NewWriter(os.Stdout)
+	encryptWriter, err := utils.NewEncryptWriter(output, key)
+	gplog.FatalOnError(err)
+	_, err = io.Copy(encryptWriter, bufio.NewReader(os.Stdin))
+	gplog.FatalOnError(err)
+	err = encryptWriter.Close()
+	gplog.FatalOnError(err)
+	err = output.Flush()
+	gplog.FatalOnError(err)
+}
+
+func doDecrypt() {
+	key := getEncryptionKey()
+	decryptReader, err := utils.NewDecryptReader(os.Stdin, key)
+	gplog.FatalOnError(err)
+	output := bufio.NewWriter(os.Stdout)
+	_, err = io.Copy(output, decryptReader)
+	gplog.FatalOnError(err)
+	err = output.Flush()
+	gplog.FatalOnError(err)
+}
+
+func getEncryptionKey() []byte {
+	_, key := utils.GetEncryptionParameters()
+	if key == nil {
+		gplog.Fatal(errors.Errorf("An encryption key file must be specified with --encryption-key-file"), "")
+	}
+	return key
+}
+
+// Returns the reader unchanged if no encryption key was given
+func getDecryptReader(reader io.Reader, filename string) io.Reader {
+	_, key := utils.GetEncryptionParameters()
+	if key == nil {
+		return reader
+	}
+	decryptReader, err := utils.NewDecryptReader(reader, key)
+	if err != nil {
+		gplog.Fatal(err, "Unable to decrypt data file %s", filename)
+	}
+	return decryptReader
+}
+
 /*
  * Shared functions
  */
 
+// Groups the sorted oids by stream, skipping any streams that have no tables
+func initializeDataStreams(oidList []int, oidStreams map[uint32]int) {
+	streamOids := make(map[int][]int, 0)
+	for _, oid := range oidList {
+		index := oidStreams[uint32(oid)]
+		streamOids[index] = append(streamOids[index], oid)
+	}
+	indexes := make([]int, 0)
+	for index := range streamOids {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	dataStreams = make([]*dataStream, len(indexes))
+	for i, index := range indexes {
+		dataStreams[i] = &dataStream{index: index, dataFile: getStreamDataFilePath(index), oidList: streamOids[index]}
+	}
+}
+
+func getSegmentTOCStreams(tocEntries map[uint]utils.SegmentDataEntry) map[uint32]int {
+	oidStreams := make(map[uint32]int, len(tocEntries))
+	for oid, entry := range tocEntries {
+		oidStreams[uint32(oid)] = entry.Stream
+	}
+	return oidStreams
+}
+
+// The first stream uses the data file path passed to the agent
+func getStreamDataFilePath(index int) string {
+	if index == 0 {
+		return *dataFile
+	}
+	return insertIntoDataFilePath(fmt.Sprintf("_stream%d", index))
+}
+
+func insertIntoDataFilePath(suffix string) string {
+	extension := ""
+	if compression, ok := utils.GetCompressionForFile(*dataFile); ok {
+		extension = compression.Extension
+	}
+	return fmt.Sprintf("%s%s%s", strings.TrimSuffix(*dataFile, extension), suffix, extension)
+}
+
+/*
+ * gplog.Fatal panics to unwind the stack, which DoTeardown cannot recover
+ * from in another goroutine, so the first stream to fail tears down the
+ * agent itself.
+ */
+func runDataStreams(streamFunc func(stream *dataStream)) {
+	var streamGroup sync.WaitGroup
+	for _, stream := range dataStreams {
+		streamGroup.Add(1)
+		go func(stream *dataStream) {
+			defer streamGroup.Done()
+			defer func() {
+				if err := recover(); err != nil {
+					streamErrorOnce.Do(DoTeardown)
+				}
+			}()
+			streamFunc(stream)
+		}(stream)
+	}
+	streamGroup.Wait()
+}
+
 func createPipe(pipe string) {
 	err := syscall.Mkfifo(pipe, 0777)
 	gplog.FatalOnError(err)
@@ -327,16 +934,16 @@ func getOidListFromFile() []int {
 	return oidList
 }
 
-func flushAndCloseRestoreWriter() {
-	if writer != nil {
-		err := writer.Flush()
+func flushAndCloseRestoreWriter(stream *dataStream) {
+	if stream.writer != nil {
+		err := stream.writer.Flush()
 		gplog.FatalOnError(err)
-		writer = nil
+		stream.writer = nil
 	}
-	if writeHandle != nil {
-		err := writeHandle.Close()
+	if stream.writeHandle != nil {
+		err := stream.writeHandle.Close()
 		gplog.FatalOnError(err)
-		writeHandle = nil
+		stream.writeHandle = nil
 	}
 }
 
@@ -374,7 +981,7 @@ func DoCleanup() {
 		log("Cleanup complete")
 		CleanupGroup.Done()
 	}()
-	if wasTerminated {
+	if wasTerminated && *pipeFile != "" {
 		/*
 		 * If the agent dies during the last table copy, it can still report
 		 * success, so we create an error file and check for its presence in
@@ -383,10 +990,12 @@ func DoCleanup() {
 		handle := iohelper.MustOpenFileForWriting(fmt.Sprintf("%s_error", *pipeFile))
 		_ = handle.Close()
 	}
-	flushAndCloseRestoreWriter()
-	removeFileIfExists(lastPipe)
-	removeFileIfExists(currentPipe)
-	removeFileIfExists(nextPipe)
+	for _, stream := range dataStreams {
+		flushAndCloseRestoreWriter(stream)
+		removeFileIfExists(stream.lastPipe)
+		removeFileIfExists(stream.currentPipe)
+		removeFileIfExists(stream.nextPipe)
+	}
 }
 
 func log(s string, v ...interface{}) {
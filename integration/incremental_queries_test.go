@@ -0,0 +1,47 @@
+package integration
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/backup"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup integration tests", func() {
+	Describe("GetAOIncrementalMetadata", func() {
+		BeforeEach(func() {
+			testhelper.AssertQueryRuns(connection, "CREATE TABLE public.ao_foo (i int) WITH (appendonly=true) DISTRIBUTED BY (i)")
+			testhelper.AssertQueryRuns(connection, "CREATE TABLE public.aoco_foo (i int) WITH (appendonly=true, orientation=column) DISTRIBUTED BY (i)")
+			testhelper.AssertQueryRuns(connection, "CREATE TABLE public.heap_foo (i int) DISTRIBUTED BY (i)")
+		})
+		AfterEach(func() {
+			testhelper.AssertQueryRuns(connection, "DROP TABLE public.ao_foo")
+			testhelper.AssertQueryRuns(connection, "DROP TABLE public.aoco_foo")
+			testhelper.AssertQueryRuns(connection, "DROP TABLE public.heap_foo")
+		})
+		It("returns entries for append-optimized tables only", func() {
+			aoEntries := backup.GetAOIncrementalMetadata(connection)
+
+			Expect(aoEntries).To(HaveLen(2))
+			Expect(aoEntries).To(HaveKey("public.ao_foo"))
+			Expect(aoEntries).To(HaveKey("public.aoco_foo"))
+			Expect(aoEntries["public.ao_foo"].Modcount).To(Equal(int64(0)))
+			Expect(aoEntries["public.ao_foo"].LastDDLTimestamp).ToNot(Equal(""))
+		})
+		It("increases the modcount when data is inserted", func() {
+			before := backup.GetAOIncrementalMetadata(connection)["public.ao_foo"]
+			testhelper.AssertQueryRuns(connection, "INSERT INTO public.ao_foo SELECT generate_series(1, 10)")
+			after := backup.GetAOIncrementalMetadata(connection)["public.ao_foo"]
+
+			Expect(after.Modcount).To(BeNumerically(">", before.Modcount))
+			Expect(after.LastDDLTimestamp).To(Equal(before.LastDDLTimestamp))
+		})
+		It("changes the last DDL timestamp when the table is truncated", func() {
+			before := backup.GetAOIncrementalMetadata(connection)["public.ao_foo"]
+			testhelper.AssertQueryRuns(connection, "TRUNCATE public.ao_foo")
+			after := backup.GetAOIncrementalMetadata(connection)["public.ao_foo"]
+
+			Expect(after.LastDDLTimestamp).ToNot(Equal(before.LastDDLTimestamp))
+		})
+	})
+})
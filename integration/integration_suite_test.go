@@ -80,6 +80,8 @@ var _ = BeforeEach(func() {
 	buffer = bytes.NewBuffer([]byte(""))
 	backup.SetExcludeSchemas([]string{})
 	backup.SetIncludeSchemas([]string{})
+	backup.SetExcludeRoles([]string{})
+	backup.SetIncludeRoles([]string{})
 	backup.SetExcludeTables([]string{})
 	backup.SetIncludeTables([]string{})
 })
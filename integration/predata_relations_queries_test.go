@@ -338,6 +338,30 @@ PARTITION BY RANGE (year)
 			Expect(partTableMap[leaf33]).To(Equal("l"))
 		})
 	})
+	Describe("GetPartitionLeaves", func() {
+		It("returns each leaf partition with its root table", func() {
+			createStmt := `CREATE TABLE public.summer_sales (id int, year int, month int)
+DISTRIBUTED BY (id)
+PARTITION BY RANGE (year)
+    SUBPARTITION BY RANGE (month)
+       SUBPARTITION TEMPLATE (
+        START (6) END (7) EVERY (1),
+        DEFAULT SUBPARTITION other_months )
+( START (2015) END (2016) EVERY (1) );
+`
+			testhelper.AssertQueryRuns(connection, createStmt)
+			defer testhelper.AssertQueryRuns(connection, "DROP TABLE public.summer_sales")
+
+			leaf1 := testutils.OidFromObjectName(connection, "public", "summer_sales_1_prt_1_2_prt_2", backup.TYPE_RELATION)
+			leaf2 := testutils.OidFromObjectName(connection, "public", "summer_sales_1_prt_1_2_prt_other_months", backup.TYPE_RELATION)
+
+			leaves := backup.GetPartitionLeaves(connection)
+
+			Expect(leaves).To(HaveLen(2))
+			Expect(leaves).To(ContainElement(backup.PartitionLeaf{Oid: leaf1, Schema: "public", Name: "summer_sales_1_prt_1_2_prt_2", RootName: "public.summer_sales"}))
+			Expect(leaves).To(ContainElement(backup.PartitionLeaf{Oid: leaf2, Schema: "public", Name: "summer_sales_1_prt_1_2_prt_other_months", RootName: "public.summer_sales"}))
+		})
+	})
 	Describe("GetColumnDefinitions", func() {
 		emptyColumnACL := []backup.ACL{}
 		It("returns table attribute information for a heap table", func() {
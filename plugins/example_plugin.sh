@@ -37,8 +37,12 @@ restore_data() {
 	cat /tmp/plugin_dest/$filename
 }
 
+delete_backup() {
+  rm -f /tmp/plugin_dest/*$2*
+}
+
 plugin_api_version(){
-  echo "0.1.0"
+  echo "0.2.0"
 }
 
 "$@"
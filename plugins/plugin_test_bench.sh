@@ -3,7 +3,7 @@
 plugin=$1
 plugin_config=$2
 secondary_plugin_config=$3
-SUPPORTED_API_VERSION="0.1.0"
+SUPPORTED_API_VERSION="0.2.0"
 
 # ----------------------------------------------
 # Test suite setup
@@ -102,6 +102,18 @@ fi
 echo "[PASSED] backup_data"
 echo "[PASSED] restore_data"
 
+# ----------------------------------------------
+# Delete function
+# ----------------------------------------------
+
+echo "[RUNNING] delete_backup"
+$plugin delete_backup $plugin_config 20180101010101
+if [ ! $? -eq 0 ]; then
+  echo "Failed to delete backup using plugin"
+  exit 1
+fi
+echo "[PASSED] delete_backup"
+
 # ----------------------------------------------
 # Cleanup functions
 # ----------------------------------------------
@@ -0,0 +1,106 @@
+package restore
+
+/*
+ * This file contains functions related to dropping the objects being restored
+ * before restoring them with gprestore --clean.
+ */
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+var (
+	externalTablePattern = regexp.MustCompile(`CREATE (READABLE|WRITABLE) EXTERNAL `)
+	leftArgPattern       = regexp.MustCompile(`(?m)^\tLEFTARG = (.+?),?$`)
+	rightArgPattern      = regexp.MustCompile(`(?m)^\tRIGHTARG = (.+?),?$`)
+	indexMethodPattern   = regexp.MustCompile(`\bUSING (\w+)`)
+	userMappingPattern   = regexp.MustCompile(`(?m)^CREATE USER MAPPING FOR (.+)\n\tSERVER (.+?);?$`)
+)
+
+/*
+ * Objects are dropped in the reverse of the order in which they are restored,
+ * so that each object is dropped before the objects on which it depends.
+ * Schemas are not dropped, as they may contain objects that are not being
+ * restored.  The constraints, indexes, rules, and triggers of a table and the
+ * sequences it owns are dropped along with the table, so they are not
+ * dropped separately.
+ */
+func GetDropStatements(statements []utils.StatementWithType, ifExists bool) []utils.StatementWithType {
+	dropStatements := make([]utils.StatementWithType, 0)
+	droppedObjects := make(map[string]bool, 0)
+	for i := len(statements) - 1; i >= 0; i-- {
+		statement := statements[i]
+		dropStr := getDropStatement(statement, ifExists)
+		// A base type has two entries, one for its shell type and one for its definition
+		if dropStr == "" || droppedObjects[dropStr] {
+			continue
+		}
+		droppedObjects[dropStr] = true
+		dropStatements = append(dropStatements, utils.StatementWithType{Schema: statement.Schema, Name: statement.Name, ObjectType: statement.ObjectType, ReferenceObject: statement.ReferenceObject, Statement: dropStr})
+	}
+	return dropStatements
+}
+
+func getDropStatement(statement utils.StatementWithType, ifExists bool) string {
+	ifExistsStr := ""
+	if ifExists {
+		ifExistsStr = "IF EXISTS "
+	}
+	objectFQN := utils.MakeFQN(statement.Schema, statement.Name)
+	switch statement.ObjectType {
+	case "TABLE":
+		if externalTablePattern.MatchString(statement.Statement) {
+			return fmt.Sprintf("DROP EXTERNAL TABLE %s%s CASCADE;", ifExistsStr, objectFQN)
+		}
+		return fmt.Sprintf("DROP TABLE %s%s CASCADE;", ifExistsStr, objectFQN)
+	case "SEQUENCE":
+		if statement.ReferenceObject != "" {
+			return ""
+		}
+		return fmt.Sprintf("DROP SEQUENCE %s%s CASCADE;", ifExistsStr, objectFQN)
+	case "VIEW", "TYPE", "DOMAIN", "COLLATION", "CONVERSION", "FUNCTION", "AGGREGATE", "TEXT SEARCH PARSER", "TEXT SEARCH TEMPLATE", "TEXT SEARCH DICTIONARY", "TEXT SEARCH CONFIGURATION":
+		return fmt.Sprintf("DROP %s %s%s CASCADE;", statement.ObjectType, ifExistsStr, objectFQN)
+	case "OPERATOR":
+		leftArg, rightArg := "NONE", "NONE"
+		if matches := leftArgPattern.FindStringSubmatch(statement.Statement); len(matches) > 1 {
+			leftArg = matches[1]
+		}
+		if matches := rightArgPattern.FindStringSubmatch(statement.Statement); len(matches) > 1 {
+			rightArg = matches[1]
+		}
+		return fmt.Sprintf("DROP OPERATOR %s%s (%s, %s) CASCADE;", ifExistsStr, objectFQN, leftArg, rightArg)
+	case "OPERATOR FAMILY", "OPERATOR CLASS":
+		matches := indexMethodPattern.FindStringSubmatch(statement.Statement)
+		if len(matches) < 2 {
+			gplog.Warn("Unable to determine the index method of %s %s, so it will not be dropped", strings.ToLower(statement.ObjectType), objectFQN)
+			return ""
+		}
+		return fmt.Sprintf("DROP %s %s%s USING %s CASCADE;", statement.ObjectType, ifExistsStr, objectFQN, matches[1])
+	case "CAST", "EXTENSION", "PROCEDURAL LANGUAGE", "FOREIGN DATA WRAPPER":
+		return fmt.Sprintf("DROP %s %s%s CASCADE;", statement.ObjectType, ifExistsStr, statement.Name)
+	case "FOREIGN SERVER":
+		return fmt.Sprintf("DROP SERVER %s%s CASCADE;", ifExistsStr, statement.Name)
+	case "USER MAPPING":
+		// The name of a user mapping is ambiguous if the user or server contains " ON ", so we use its statement
+		matches := userMappingPattern.FindStringSubmatch(statement.Statement)
+		if len(matches) < 3 {
+			gplog.Warn("Unable to determine the user and server of user mapping %s, so it will not be dropped", statement.Name)
+			return ""
+		}
+		return fmt.Sprintf("DROP USER MAPPING %sFOR %s SERVER %s;", ifExistsStr, matches[1], matches[2])
+	case "PROTOCOL":
+		return fmt.Sprintf("DROP PROTOCOL %s%s;", ifExistsStr, statement.Name)
+	}
+	return ""
+}
+
+func dropObjects(statements []utils.StatementWithType) {
+	dropStatements := GetDropStatements(statements, *ifExists)
+	gplog.Info("Dropping %d object(s) to be restored", len(dropStatements))
+	ExecuteRestoreMetadataStatements(dropStatements, "Objects dropped", nil, utils.PB_VERBOSE, false)
+}
@@ -0,0 +1,83 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/clean tests", func() {
+	Describe("GetDropStatements", func() {
+		table := utils.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "CREATE TABLE public.foo (i int);"}
+		view := utils.StatementWithType{Schema: "public", Name: "someview", ObjectType: "VIEW", Statement: "CREATE VIEW public.someview AS SELECT * FROM public.foo;"}
+		getDropStrings := func(statements []utils.StatementWithType) []string {
+			dropStrings := make([]string, 0)
+			for _, statement := range statements {
+				dropStrings = append(dropStrings, statement.Statement)
+			}
+			return dropStrings
+		}
+		It("drops objects in the reverse of the order in which they are restored", func() {
+			dropStatements := restore.GetDropStatements([]utils.StatementWithType{table, view}, false)
+			Expect(getDropStrings(dropStatements)).To(Equal([]string{"DROP VIEW public.someview CASCADE;", "DROP TABLE public.foo CASCADE;"}))
+			Expect(dropStatements[0].ObjectType).To(Equal("VIEW"))
+			Expect(dropStatements[0].Name).To(Equal("someview"))
+		})
+		It("uses IF EXISTS if ifExists is true", func() {
+			dropStatements := restore.GetDropStatements([]utils.StatementWithType{table, view}, true)
+			Expect(getDropStrings(dropStatements)).To(Equal([]string{"DROP VIEW IF EXISTS public.someview CASCADE;", "DROP TABLE IF EXISTS public.foo CASCADE;"}))
+		})
+		It("drops external tables with DROP EXTERNAL TABLE", func() {
+			extTable := utils.StatementWithType{Schema: "public", Name: "ext", ObjectType: "TABLE", Statement: "CREATE READABLE EXTERNAL TABLE public.ext (i int) LOCATION ('file://host/file') FORMAT 'TEXT';"}
+			dropStatements := restore.GetDropStatements([]utils.StatementWithType{extTable}, false)
+			Expect(getDropStrings(dropStatements)).To(Equal([]string{"DROP EXTERNAL TABLE public.ext CASCADE;"}))
+		})
+		It("drops sequences that are not owned by a table", func() {
+			sequence := utils.StatementWithType{Schema: "public", Name: "seq", ObjectType: "SEQUENCE", Statement: "CREATE SEQUENCE public.seq;"}
+			ownedSequence := utils.StatementWithType{Schema: "public", Name: "foo_i_seq", ObjectType: "SEQUENCE", ReferenceObject: "public.foo", Statement: "CREATE SEQUENCE public.foo_i_seq;"}
+			dropStatements := restore.GetDropStatements([]utils.StatementWithType{sequence, ownedSequence, table}, false)
+			Expect(getDropStrings(dropStatements)).To(Equal([]string{"DROP TABLE public.foo CASCADE;", "DROP SEQUENCE public.seq CASCADE;"}))
+		})
+		It("drops operators with their argument types", func() {
+			operator := utils.StatementWithType{Schema: "public", Name: "##", ObjectType: "OPERATOR", Statement: "\n\nCREATE OPERATOR public.## (\n\tPROCEDURE = public.path_inter,\n\tLEFTARG = path,\n\tRIGHTARG = path\n);"}
+			prefixOperator := utils.StatementWithType{Schema: "public", Name: "!!", ObjectType: "OPERATOR", Statement: "\n\nCREATE OPERATOR public.!! (\n\tPROCEDURE = public.fact,\n\tRIGHTARG = bigint\n);"}
+			dropStatements := restore.GetDropStatements([]utils.StatementWithType{operator, prefixOperator}, false)
+			Expect(getDropStrings(dropStatements)).To(Equal([]string{"DROP OPERATOR public.!! (NONE, bigint) CASCADE;", "DROP OPERATOR public.## (path, path) CASCADE;"}))
+		})
+		It("drops operator families and classes with their index method", func() {
+			opFamily := utils.StatementWithType{Schema: "public", Name: "opfam", ObjectType: "OPERATOR FAMILY", Statement: "\n\nCREATE OPERATOR FAMILY public.opfam USING hash;"}
+			opClass := utils.StatementWithType{Schema: "public", Name: "opclass", ObjectType: "OPERATOR CLASS", Statement: "\n\nCREATE OPERATOR CLASS public.opclass\n\tFOR TYPE uuid USING hash FAMILY public.opfam AS\n\tSTORAGE uuid;"}
+			dropStatements := restore.GetDropStatements([]utils.StatementWithType{opFamily, opClass}, false)
+			Expect(getDropStrings(dropStatements)).To(Equal([]string{"DROP OPERATOR CLASS public.opclass USING hash CASCADE;", "DROP OPERATOR FAMILY public.opfam USING hash CASCADE;"}))
+		})
+		It("drops user mappings for their user and server", func() {
+			userMapping := utils.StatementWithType{Name: "testrole ON foreignserver", ObjectType: "USER MAPPING", Statement: "\n\nCREATE USER MAPPING FOR testrole\n\tSERVER foreignserver;"}
+			dropStatements := restore.GetDropStatements([]utils.StatementWithType{userMapping}, true)
+			Expect(getDropStrings(dropStatements)).To(Equal([]string{"DROP USER MAPPING IF EXISTS FOR testrole SERVER foreignserver;"}))
+		})
+		It("drops user mappings whose user and server contain ON", func() {
+			userMapping := utils.StatementWithType{Name: `"role ON x" ON "server ON y"`, ObjectType: "USER MAPPING", Statement: "\n\nCREATE USER MAPPING FOR \"role ON x\"\n\tSERVER \"server ON y\"\n\tOPTIONS (user 'foo');"}
+			dropStatements := restore.GetDropStatements([]utils.StatementWithType{userMapping}, false)
+			Expect(getDropStrings(dropStatements)).To(Equal([]string{`DROP USER MAPPING FOR "role ON x" SERVER "server ON y";`}))
+		})
+		It("does not drop a user mapping whose statement cannot be parsed", func() {
+			userMapping := utils.StatementWithType{Name: "testrole", ObjectType: "USER MAPPING", Statement: "CREATE USER MAPPING testrole;"}
+			dropStatements := restore.GetDropStatements([]utils.StatementWithType{userMapping}, false)
+			Expect(dropStatements).To(BeEmpty())
+		})
+		It("drops a base type only once", func() {
+			shellType := utils.StatementWithType{Schema: "public", Name: "base_type", ObjectType: "TYPE", Statement: "CREATE TYPE public.base_type;"}
+			baseType := utils.StatementWithType{Schema: "public", Name: "base_type", ObjectType: "TYPE", Statement: "CREATE TYPE public.base_type (\n\tINPUT = public.base_fn_in,\n\tOUTPUT = public.base_fn_out\n);"}
+			dropStatements := restore.GetDropStatements([]utils.StatementWithType{shellType, baseType}, false)
+			Expect(getDropStrings(dropStatements)).To(Equal([]string{"DROP TYPE public.base_type CASCADE;"}))
+		})
+		It("does not drop schemas or objects that are dropped along with their table", func() {
+			schema := utils.StatementWithType{Name: "public", ObjectType: "SCHEMA", Statement: "CREATE SCHEMA public;"}
+			constraint := utils.StatementWithType{Schema: "public", Name: "foo_pkey", ObjectType: "CONSTRAINT", ReferenceObject: "public.foo", Statement: "ALTER TABLE ONLY public.foo ADD CONSTRAINT foo_pkey PRIMARY KEY (i);"}
+			dropStatements := restore.GetDropStatements([]utils.StatementWithType{schema, table, constraint}, false)
+			Expect(getDropStrings(dropStatements)).To(Equal([]string{"DROP TABLE public.foo CASCADE;"}))
+		})
+	})
+})
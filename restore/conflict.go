@@ -0,0 +1,93 @@
+package restore
+
+/*
+ * This file contains functions related to restoring data into existing tables
+ * with gprestore --truncate-table and --on-conflict.
+ */
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	ON_CONFLICT_APPEND = "append"
+	ON_CONFLICT_FAIL   = "fail"
+	ON_CONFLICT_SKIP   = "skip"
+)
+
+func ValidateOnConflictPolicy(policy string) {
+	if policy != ON_CONFLICT_APPEND && policy != ON_CONFLICT_FAIL && policy != ON_CONFLICT_SKIP {
+		gplog.Fatal(errors.Errorf(`Unknown --on-conflict policy "%s".  The policy must be one of %s, %s, or %s.`, policy, ON_CONFLICT_SKIP, ON_CONFLICT_FAIL, ON_CONFLICT_APPEND), "")
+	}
+}
+
+/*
+ * Tables that are truncated before they are loaded, and the tables of a full
+ * restore, which are created by the restore, never contain rows beforehand.
+ */
+func ValidateDataRestoreIntoExistingTables() {
+	isDataOnly := backupConfig.DataOnly || *dataOnly
+	if *truncateTable && !isDataOnly {
+		gplog.Fatal(errors.Errorf("The truncate-table flag can only be used to restore data only.  Use the data-only flag or restore a data-only backup."), "")
+	}
+	if *onConflict != ON_CONFLICT_APPEND && !isDataOnly {
+		gplog.Fatal(errors.Errorf("The on-conflict flag can only be used to restore data only.  Use the data-only flag or restore a data-only backup."), "")
+	}
+}
+
+func GetTablesWithRows(connection *dbconn.DBConn, tableNames []string) []string {
+	tablesWithRows := make([]string, 0)
+	for _, tableName := range tableNames {
+		hasRows, err := strconv.ParseBool(dbconn.MustSelectString(connection, fmt.Sprintf(`
+SELECT CASE
+	WHEN EXISTS (SELECT 1 FROM %s) THEN 'true'
+	ELSE 'false'
+END AS string;`, tableName)))
+		gplog.FatalOnError(err)
+		if hasRows {
+			tablesWithRows = append(tablesWithRows, tableName)
+		}
+	}
+	return tablesWithRows
+}
+
+/*
+ * With the fail policy, the restore stops before any data is loaded if any
+ * table already contains rows.  With the skip policy, those tables are left
+ * as they are.
+ */
+func FilterDataEntriesOnConflict(dataEntries []utils.MasterDataEntry) []utils.MasterDataEntry {
+	if *onConflict == ON_CONFLICT_APPEND {
+		return dataEntries
+	}
+	tableNames := make([]string, len(dataEntries))
+	for i, entry := range dataEntries {
+		tableNames[i] = getRestoreTableName(entry)
+	}
+	tablesWithRows := GetTablesWithRows(connectionPool, tableNames)
+	if len(tablesWithRows) == 0 {
+		return dataEntries
+	}
+	if *onConflict == ON_CONFLICT_FAIL {
+		gplog.Fatal(errors.Errorf("The following table(s) already contain rows: %s.  Use --truncate-table to replace their data, or --on-conflict=%s or --on-conflict=%s to skip them or add to them.", strings.Join(tablesWithRows, ", "), ON_CONFLICT_SKIP, ON_CONFLICT_APPEND), "")
+	}
+	skippedTables := make(map[string]bool, len(tablesWithRows))
+	for _, tableName := range tablesWithRows {
+		gplog.Warn("Skipping table %s, which already contains rows", tableName)
+		skippedTables[tableName] = true
+	}
+	filteredEntries := make([]utils.MasterDataEntry, 0)
+	for i, entry := range dataEntries {
+		if !skippedTables[tableNames[i]] {
+			filteredEntries = append(filteredEntries, entry)
+		}
+	}
+	return filteredEntries
+}
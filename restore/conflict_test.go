@@ -0,0 +1,61 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/utils"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/conflict tests", func() {
+	Describe("ValidateOnConflictPolicy", func() {
+		It("accepts each known policy", func() {
+			restore.ValidateOnConflictPolicy(restore.ON_CONFLICT_SKIP)
+			restore.ValidateOnConflictPolicy(restore.ON_CONFLICT_FAIL)
+			restore.ValidateOnConflictPolicy(restore.ON_CONFLICT_APPEND)
+		})
+		It("panics on an unknown policy", func() {
+			defer testhelper.ShouldPanicWithMessage(`Unknown --on-conflict policy "replace".  The policy must be one of skip, fail, or append.`)
+			restore.ValidateOnConflictPolicy("replace")
+		})
+	})
+	Describe("FilterDataEntriesOnConflict", func() {
+		dataEntries := []utils.MasterDataEntry{
+			{Schema: "public", Name: "foo", Oid: 1},
+			{Schema: "public", Name: "bar", Oid: 2},
+		}
+		expectTableHasRows := func(hasRows string) {
+			mock.ExpectQuery("SELECT (.*)").WillReturnRows(sqlmock.NewRows([]string{"string"}).AddRow(hasRows))
+		}
+		AfterEach(func() {
+			restore.SetOnConflict(restore.ON_CONFLICT_APPEND)
+		})
+		It("returns every entry without checking the tables with the append policy", func() {
+			restore.SetOnConflict(restore.ON_CONFLICT_APPEND)
+			Expect(restore.FilterDataEntriesOnConflict(dataEntries)).To(Equal(dataEntries))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("leaves out the tables that already contain rows with the skip policy", func() {
+			restore.SetOnConflict(restore.ON_CONFLICT_SKIP)
+			expectTableHasRows("true")
+			expectTableHasRows("false")
+			Expect(restore.FilterDataEntriesOnConflict(dataEntries)).To(Equal(dataEntries[1:]))
+		})
+		It("returns every entry if no table contains rows with the fail policy", func() {
+			restore.SetOnConflict(restore.ON_CONFLICT_FAIL)
+			expectTableHasRows("false")
+			expectTableHasRows("false")
+			Expect(restore.FilterDataEntriesOnConflict(dataEntries)).To(Equal(dataEntries))
+		})
+		It("panics if any table already contains rows with the fail policy", func() {
+			restore.SetOnConflict(restore.ON_CONFLICT_FAIL)
+			expectTableHasRows("true")
+			expectTableHasRows("true")
+			defer testhelper.ShouldPanicWithMessage("The following table(s) already contain rows: public.foo, public.bar.")
+			restore.FilterDataEntriesOnConflict(dataEntries)
+		})
+	})
+})
@@ -17,53 +17,181 @@ var (
 	tableDelim = ","
 )
 
-func CopyTableIn(connection *dbconn.DBConn, tableName string, tableAttributes string, backupFile string, singleDataFile bool, whichConn int) int64 {
-	whichConn = connection.ValidateConnNum(whichConn)
-	usingCompression, compressionProgram := utils.GetCompressionParameters()
+/*
+ * In single-data-file mode, gpbackup_helper creates an error file for a
+ * table's pipe if the table's data does not match its checksum, so that the
+ * COPY fails before it commits.  Otherwise, gpbackup_helper reads the table's
+ * data file and exits with an error if it does not match its checksum.  The
+ * checksum file is empty for a backup taken before checksums were recorded.
+ */
+func GetCopyTableInQuery(tableName string, tableAttributes string, backupFile string, checksumFile string, oid uint32, singleDataFile bool) string {
 	copyCommand := ""
 	if singleDataFile {
-		copyCommand = fmt.Sprintf("PROGRAM 'cat %s'", backupFile)
-	} else if usingCompression && !singleDataFile {
-		copyCommand = fmt.Sprintf("PROGRAM '%s < %s'", compressionProgram.DecompressCommand, backupFile)
+		copyCommand = fmt.Sprintf("PROGRAM 'cat %s && test ! -e %s_error'", backupFile, backupFile)
 	} else {
-		copyCommand = fmt.Sprintf("'%s'", backupFile)
+		copyCommand = fmt.Sprintf("PROGRAM '%s'", utils.GetReadTableDataCommand(backupFile, checksumFile, oid))
 	}
-	query := fmt.Sprintf("COPY %s%s FROM %s WITH CSV DELIMITER '%s' ON SEGMENT;", tableName, tableAttributes, copyCommand, tableDelim)
+	return fmt.Sprintf("COPY %s%s FROM %s WITH CSV DELIMITER '%s' ON SEGMENT;", tableName, tableAttributes, copyCommand, tableDelim)
+}
+
+func CopyTableIn(connection *dbconn.DBConn, tableName string, tableAttributes string, backupFile string, checksumFile string, oid uint32, singleDataFile bool, whichConn int) (int64, error) {
+	query := GetCopyTableInQuery(tableName, tableAttributes, backupFile, checksumFile, oid, singleDataFile)
+	return executeCopyTableIn(connection, query, whichConn)
+}
+
+func executeCopyTableIn(connection *dbconn.DBConn, query string, whichConn int) (int64, error) {
+	whichConn = connection.ValidateConnNum(whichConn)
 	result, err := connection.Exec(query, whichConn)
 	if err != nil {
-		gplog.Fatal(err, "Error loading data into table %s", tableName)
+		return 0, err
 	}
 	numRows, err := result.RowsAffected()
 	gplog.FatalOnError(err)
-	return numRows
+	return numRows, nil
+}
+
+/*
+ * Returns the tables to be restored by each connection.  For a backup with a
+ * single data file per segment, gpbackup_helper serves the tables in each
+ * data stream one at a time, so each connection restores all of the tables in
+ * one stream before moving on to another, and any connections beyond the
+ * number of streams are left idle.  A backup taken without --jobs has only
+ * one stream.  Otherwise, all connections share the tables.
+ */
+func GetRestoreTasks(dataEntries []utils.MasterDataEntry, numConns int) []chan utils.MasterDataEntry {
+	tasks := make([]chan utils.MasterDataEntry, numConns)
+	if !backupConfig.SingleDataFile {
+		sharedTasks := make(chan utils.MasterDataEntry, len(dataEntries))
+		for _, entry := range dataEntries {
+			sharedTasks <- entry
+		}
+		close(sharedTasks)
+		for i := range tasks {
+			tasks[i] = sharedTasks
+		}
+		return tasks
+	}
+	for i := range tasks {
+		tasks[i] = make(chan utils.MasterDataEntry, len(dataEntries))
+	}
+	for stream, entries := range utils.GetDataEntriesByStream(dataEntries) {
+		for _, entry := range entries {
+			tasks[stream%numConns] <- entry
+		}
+	}
+	for _, connTasks := range tasks {
+		close(connTasks)
+	}
+	return tasks
+}
+
+func GetTruncateTableQuery(tableName string) string {
+	return fmt.Sprintf("TRUNCATE TABLE %s;", tableName)
 }
 
-func restoreSingleTableData(entry utils.MasterDataEntry, tableNum uint32, totalTables int, whichConn int) {
-	name := utils.MakeFQN(entry.Schema, entry.Name)
+/*
+ * With --truncate-table, each table is truncated in the same transaction as
+ * the COPY statements that load it, so that a table whose data fails to load
+ * keeps its old data and a resumed restore does not find it empty.  When
+ * restoring to a cluster with a different number of segments, the COPY
+ * statements that load a table from each of its data files are run in one
+ * transaction, so that an error in any data file leaves the table empty.  With
+ * --on-error-continue, a table whose data fails to load, such as one whose
+ * data does not match its checksum, is skipped.
+ */
+func restoreSingleTableData(fpInfo utils.FilePathInfo, entry utils.MasterDataEntry, tableNum uint32, totalTables int, whichConn int) {
+	name := getRestoreTableName(entry)
 	if gplog.GetVerbosity() > gplog.LOGINFO {
 		// No progress bar at this log level, so we note table count here
 		gplog.Verbose("Reading data for table %s from file (table %d of %d)", name, tableNum, totalTables)
 	} else {
 		gplog.Verbose("Reading data for table %s from file", name)
 	}
-	backupFile := ""
-	if backupConfig.SingleDataFile {
-		backupFile = fmt.Sprintf("%s_%d", globalFPInfo.GetSegmentPipePathForCopyCommand(), entry.Oid)
+	inTransaction := *truncateTable || IsResizeRestore()
+	if inTransaction {
+		connectionPool.MustBegin(whichConn)
+	}
+	if *truncateTable {
+		gplog.Verbose("Truncating table %s", name)
+		_, err := connectionPool.Exec(GetTruncateTableQuery(name), whichConn)
+		if err != nil {
+			gplog.Fatal(err, "Error truncating table %s", name)
+		}
+	}
+	var numRowsRestored int64
+	var err error
+	if IsResizeRestore() {
+		for _, query := range GetResizeCopyTableInQueries(fpInfo, name, entry) {
+			var numRows int64
+			numRows, err = executeCopyTableIn(connectionPool, query, whichConn)
+			if err != nil {
+				break
+			}
+			numRowsRestored += numRows
+		}
 	} else {
-		backupFile = globalFPInfo.GetTableBackupFilePathForCopyCommand(entry.Oid, backupConfig.SingleDataFile)
+		backupFile := getTableBackupFile(fpInfo, entry)
+		numRowsRestored, err = CopyTableIn(connectionPool, name, entry.AttributeString, backupFile, getTableChecksumFile(fpInfo, entry), entry.Oid, backupConfig.SingleDataFile, whichConn)
+	}
+	if err != nil {
+		if !*onErrorContinue {
+			gplog.Fatal(err, "Error loading data into table %s", name)
+		}
+		gplog.Error("Error loading data into table %s: %v", name, err)
+		if inTransaction {
+			connectionPool.MustRollback(whichConn)
+		}
+		return
 	}
-	numRowsRestored := CopyTableIn(connectionPool, name, entry.AttributeString, backupFile, backupConfig.SingleDataFile, whichConn)
+	if inTransaction {
+		connectionPool.MustCommit(whichConn)
+	}
+	AddDataEntryToJournal(entry, numRowsRestored)
 	numRowsBackedUp := entry.RowsCopied
-	CheckRowsRestored(numRowsRestored, numRowsBackedUp, name)
+	CheckRowsRestored(fpInfo, numRowsRestored, numRowsBackedUp, name)
+}
+
+func getRestoreTableName(entry utils.MasterDataEntry) string {
+	return getRestoreRelationName(utils.MakeFQN(entry.Schema, entry.Name))
+}
+
+// A relation is restored under its new name, if any, and then into its new schema, if any
+func getRestoreRelationName(relation string) string {
+	if newRelation, ok := relationRenameMap[relation]; ok {
+		relation = newRelation
+	}
+	if len(redirectSchemaMap) == 0 {
+		return relation
+	}
+	schema, name := utils.SplitFQN(relation)
+	if newSchema, ok := redirectSchemaMap[schema]; ok {
+		return utils.MakeFQN(newSchema, name)
+	}
+	return relation
+}
+
+func getTableBackupFile(fpInfo utils.FilePathInfo, entry utils.MasterDataEntry) string {
+	if backupConfig.SingleDataFile {
+		return fmt.Sprintf("%s_%d", fpInfo.GetSegmentPipePathForCopyCommand(), entry.Oid)
+	}
+	return fpInfo.GetTableBackupFilePathForCopyCommand(entry.Oid, backupConfig.SingleDataFile)
+}
+
+// Returns an empty path for a backup taken before checksums were recorded
+func getTableChecksumFile(fpInfo utils.FilePathInfo, entry utils.MasterDataEntry) string {
+	if backupConfig.SingleDataFile || len(entry.Checksums) == 0 {
+		return ""
+	}
+	return fpInfo.GetSegmentChecksumFilePathForCopyCommand()
 }
 
-func CheckRowsRestored(rowsRestored int64, rowsBackedUp int64, tableName string) {
+func CheckRowsRestored(fpInfo utils.FilePathInfo, rowsRestored int64, rowsBackedUp int64, tableName string) {
 	if rowsRestored != rowsBackedUp {
 		rowsErrMsg := fmt.Sprintf("Expected to restore %d rows to table %s, but restored %d instead", rowsBackedUp, tableName, rowsRestored)
 		if *onErrorContinue {
 			gplog.Error(rowsErrMsg)
 		} else {
-			agentErr := CheckAgentErrorsOnSegments()
+			agentErr := CheckAgentErrorsOnSegments(fpInfo)
 			if agentErr != nil {
 				gplog.Error(rowsErrMsg)
 				gplog.Fatal(agentErr, "")
@@ -1,6 +1,7 @@
 package restore_test
 
 import (
+	"errors"
 	"os/user"
 	"regexp"
 
@@ -19,33 +20,43 @@ import (
 
 var _ = Describe("restore/data tests", func() {
 	Describe("CopyTableIn", func() {
-		It("will restore a table from its own file with compression", func() {
-			utils.SetCompressionParameters(true, utils.Compression{Name: "gzip", CompressCommand: "gzip -c -1", DecompressCommand: "gzip -d -c", Extension: ".gz"})
-			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'gzip -d -c < <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz' WITH CSV DELIMITER ',' ON SEGMENT;")
+		AfterEach(func() {
+			restore.SetOnErrorContinue(false)
+		})
+		It("will restore a table from its own file, verifying its checksum", func() {
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'gpbackup_helper --read-table-data --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz --content <SEGID> --checksum-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums --oid 3456' WITH CSV DELIMITER ',' ON SEGMENT;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
-			restore.CopyTableIn(connection, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connection, "public.foo", "(i,j)", filename, "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums", 3456, false, 0)
+			Expect(err).ToNot(HaveOccurred())
 		})
-		It("will restore a table from its own file without compression", func() {
-			utils.SetCompressionParameters(false, utils.Compression{})
-			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM '<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT;")
+		It("will restore a table from its own file without a checksum", func() {
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'gpbackup_helper --read-table-data --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456 --content <SEGID>' WITH CSV DELIMITER ',' ON SEGMENT;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
-			restore.CopyTableIn(connection, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connection, "public.foo", "(i,j)", filename, "", 3456, false, 0)
+			Expect(err).ToNot(HaveOccurred())
 		})
-		It("will restore a table from a single data file with compression", func() {
-			utils.SetCompressionParameters(true, utils.Compression{Name: "gzip", CompressCommand: "gzip -c -1", DecompressCommand: "gzip -d -c", Extension: ".gz"})
-			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456' WITH CSV DELIMITER ',' ON SEGMENT;")
+		It("will restore a table from its own file with encryption", func() {
+			utils.SetEncryptionParameters("/tmp/key", []byte("0123456789abcdef0123456789abcdef"))
+			defer utils.SetEncryptionParameters("", nil)
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'gpbackup_helper --read-table-data --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz --content <SEGID> --checksum-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums --oid 3456 --encryption-key-file /tmp/key' WITH CSV DELIMITER ',' ON SEGMENT;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
-			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456"
-			restore.CopyTableIn(connection, "public.foo", "(i,j)", filename, true, 0)
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
+			_, err := restore.CopyTableIn(connection, "public.foo", "(i,j)", filename, "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums", 3456, false, 0)
+			Expect(err).ToNot(HaveOccurred())
 		})
-		It("will restore a table from a single data file without compression", func() {
-			utils.SetCompressionParameters(false, utils.Compression{})
-			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456' WITH CSV DELIMITER ',' ON SEGMENT;")
+		It("will restore a table from a single data file, failing if the helper found a checksum mismatch", func() {
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456 && test ! -e <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456_error' WITH CSV DELIMITER ',' ON SEGMENT;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456"
-			restore.CopyTableIn(connection, "public.foo", "(i,j)", filename, true, 0)
+			_, err := restore.CopyTableIn(connection, "public.foo", "(i,j)", filename, "", 3456, true, 0)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("returns the error if the data fails to load", func() {
+			mock.ExpectExec("COPY (.*)").WillReturnError(errors.New("program \"gpbackup_helper\" failed"))
+			_, err := restore.CopyTableIn(connection, "public.foo", "(i,j)", "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456", "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums", 3456, false, 0)
+			Expect(err).To(MatchError("program \"gpbackup_helper\" failed"))
 		})
 	})
 	Describe("CheckRowsRestored", func() {
@@ -73,7 +84,7 @@ var _ = Describe("restore/data tests", func() {
 			restore.SetOnErrorContinue(false)
 		})
 		It("does nothing if the number of rows match ", func() {
-			restore.CheckRowsRestored(10, expectedRows, name)
+			restore.CheckRowsRestored(testFPInfo, 10, expectedRows, name)
 		})
 		It("panics if the numbers of rows do not match and there is an error with a segment agent", func() {
 			restore.SetOnErrorContinue(false)
@@ -88,7 +99,7 @@ var _ = Describe("restore/data tests", func() {
 				Expect(stderr).To(gbytes.Say("Expected to restore 10 rows to table public.foo, but restored 5 instead"))
 			}()
 			defer testhelper.ShouldPanicWithMessage("Encountered errors with 1 restore agent(s).  See gbytes.Buffer for a complete list of segments with errors, and see testDir/gpAdminLogs/gpbackup_helper_20170101.log on the corresponding hosts for detailed error messages.")
-			restore.CheckRowsRestored(5, expectedRows, name)
+			restore.CheckRowsRestored(testFPInfo, 5, expectedRows, name)
 		})
 		It("panics if the numbers of rows do not match and there is no error with a segment agent", func() {
 			restore.SetOnErrorContinue(false)
@@ -100,7 +111,7 @@ var _ = Describe("restore/data tests", func() {
 			testCluster.Executor = testExecutor
 			restore.SetCluster(testCluster)
 			defer testhelper.ShouldPanicWithMessage("Expected to restore 10 rows to table public.foo, but restored 5 instead")
-			restore.CheckRowsRestored(5, expectedRows, name)
+			restore.CheckRowsRestored(testFPInfo, 5, expectedRows, name)
 		})
 		It("prints an error if the numbers of rows do not match and onErrorContinue is set", func() {
 			restore.SetOnErrorContinue(true)
@@ -111,7 +122,7 @@ var _ = Describe("restore/data tests", func() {
 			}
 			testCluster.Executor = testExecutor
 			restore.SetCluster(testCluster)
-			restore.CheckRowsRestored(5, expectedRows, name)
+			restore.CheckRowsRestored(testFPInfo, 5, expectedRows, name)
 			Expect(stderr).To(gbytes.Say(regexp.QuoteMeta("[ERROR]:-Expected to restore 10 rows to table public.foo, but restored 5 instead")))
 
 			testExecutor.ClusterOutput = &cluster.RemoteOutput{
@@ -121,8 +132,40 @@ var _ = Describe("restore/data tests", func() {
 			}
 			testCluster.Executor = testExecutor
 			restore.SetCluster(testCluster)
-			restore.CheckRowsRestored(5, expectedRows, name)
+			restore.CheckRowsRestored(testFPInfo, 5, expectedRows, name)
 			Expect(stderr).To(gbytes.Say(regexp.QuoteMeta("[ERROR]:-Expected to restore 10 rows to table public.foo, but restored 5 instead")))
 		})
 	})
+	Describe("GetRestoreTasks", func() {
+		readTasks := func(tasks chan utils.MasterDataEntry) []uint32 {
+			oids := make([]uint32, 0)
+			for entry := range tasks {
+				oids = append(oids, entry.Oid)
+			}
+			return oids
+		}
+		dataEntries := []utils.MasterDataEntry{{Oid: 1, Stream: 0}, {Oid: 2, Stream: 1}, {Oid: 3, Stream: 2}, {Oid: 4, Stream: 0}}
+		It("shares all tables between connections when each table has its own data file", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SingleDataFile: false})
+			tasks := restore.GetRestoreTasks(dataEntries, 2)
+			Expect(tasks).To(HaveLen(2))
+			Expect(tasks[0]).To(Equal(tasks[1]))
+			Expect(readTasks(tasks[0])).To(Equal([]uint32{1, 2, 3, 4}))
+		})
+		It("assigns each data stream to one connection in a backup with a single data file", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SingleDataFile: true})
+			tasks := restore.GetRestoreTasks(dataEntries, 2)
+			Expect(tasks).To(HaveLen(2))
+			Expect(readTasks(tasks[0])).To(Equal([]uint32{1, 4, 3}))
+			Expect(readTasks(tasks[1])).To(Equal([]uint32{2}))
+		})
+		It("leaves connections beyond the number of data streams idle in a backup with a single data file", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SingleDataFile: true})
+			tasks := restore.GetRestoreTasks([]utils.MasterDataEntry{{Oid: 2}, {Oid: 1}}, 3)
+			Expect(tasks).To(HaveLen(3))
+			Expect(readTasks(tasks[0])).To(Equal([]uint32{1, 2}))
+			Expect(readTasks(tasks[1])).To(BeEmpty())
+			Expect(readTasks(tasks[2])).To(BeEmpty())
+		})
+	})
 })
@@ -0,0 +1,109 @@
+package restore
+
+/*
+ * This file contains functions related to gprestore --dry-run, which performs
+ * all of the validation for a restore and then writes the statements the
+ * restore would execute instead of executing them.
+ */
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+func InitializeDryRun(restoreDatabase string) {
+	if *dryRunFile == "" {
+		dryRunWriter = os.Stdout
+	} else {
+		gplog.Info("Writing the statements for the dry run to %s", *dryRunFile)
+		dryRunWriter = iohelper.MustOpenFileForWriting(*dryRunFile)
+	}
+	utils.MustPrintf(dryRunWriter, "--\n-- Statements gprestore would execute to restore backup %s to database %s\n--\n", globalFPInfo.Timestamp, restoreDatabase)
+}
+
+func WriteDryRunComment(s string, v ...interface{}) {
+	utils.MustPrintf(dryRunWriter, "\n-- %s\n", fmt.Sprintf(s, v...))
+}
+
+/*
+ * Each group of statements is preceded by a comment saying whether it is
+ * executed in order or in parallel.  The statements in a parallel group may
+ * be executed in any order.  Statements that a resumed restore skips are left
+ * out.
+ */
+func WriteDryRunStatements(statements []utils.StatementWithType, executeInParallel bool, whichConn int) {
+	statementsToExecute := make([]utils.StatementWithType, 0)
+	for _, statement := range statements {
+		if !WasStatementRestored(statement) {
+			statementsToExecute = append(statementsToExecute, statement)
+		}
+	}
+	if len(statementsToExecute) == 0 {
+		return
+	}
+	if executeInParallel {
+		WriteDryRunComment("The following %d statement(s) are executed in parallel on %d connections", len(statementsToExecute), connectionPool.NumConns)
+	} else {
+		WriteDryRunComment("The following %d statement(s) are executed in order on connection %d", len(statementsToExecute), whichConn)
+	}
+	for _, statement := range statementsToExecute {
+		utils.MustPrintf(dryRunWriter, "%s\n", strings.TrimSpace(statement.Statement))
+	}
+}
+
+/*
+ * Without a single data file, each connection loads the next table in the
+ * list once it is free.  With a single data file, the tables are assigned to
+ * connections by data stream, so the tables for each connection are listed
+ * separately.
+ */
+func WriteDryRunData(fpInfo utils.FilePathInfo, dataEntries []utils.MasterDataEntry, gucStatements []utils.StatementWithType, dataProgressBar utils.ProgressBar) {
+	for whichConn := 0; whichConn < connectionPool.NumConns; whichConn++ {
+		setGUCsForConnection(gucStatements, whichConn)
+	}
+	if !backupConfig.SingleDataFile {
+		WriteDryRunComment("The following %d table(s) are loaded in parallel on %d connections", len(dataEntries), connectionPool.NumConns)
+		for _, entry := range dataEntries {
+			writeDryRunCopy(fpInfo, entry)
+			dataProgressBar.Increment()
+		}
+		return
+	}
+	for whichConn, tasks := range GetRestoreTasks(dataEntries, connectionPool.NumConns) {
+		if len(tasks) == 0 {
+			continue
+		}
+		WriteDryRunComment("The following %d table(s) are loaded in order on connection %d", len(tasks), whichConn)
+		for entry := range tasks {
+			writeDryRunCopy(fpInfo, entry)
+			dataProgressBar.Increment()
+		}
+	}
+}
+
+func writeDryRunCopy(fpInfo utils.FilePathInfo, entry utils.MasterDataEntry) {
+	tableName := getRestoreTableName(entry)
+	inTransaction := *truncateTable || IsResizeRestore()
+	if inTransaction {
+		utils.MustPrintf(dryRunWriter, "BEGIN;\n")
+	}
+	if *truncateTable {
+		utils.MustPrintf(dryRunWriter, "%s\n", GetTruncateTableQuery(tableName))
+	}
+	if IsResizeRestore() {
+		for _, query := range GetResizeCopyTableInQueries(fpInfo, tableName, entry) {
+			utils.MustPrintf(dryRunWriter, "%s\n", query)
+		}
+	} else {
+		query := GetCopyTableInQuery(tableName, entry.AttributeString, getTableBackupFile(fpInfo, entry), getTableChecksumFile(fpInfo, entry), entry.Oid, backupConfig.SingleDataFile)
+		utils.MustPrintf(dryRunWriter, "%s\n", query)
+	}
+	if inTransaction {
+		utils.MustPrintf(dryRunWriter, "COMMIT;\n")
+	}
+}
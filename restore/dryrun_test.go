@@ -0,0 +1,121 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("restore/dryrun tests", func() {
+	var dryRunBuffer *gbytes.Buffer
+	createTable := utils.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.foo (i int);\n"}
+	createView := utils.StatementWithType{Schema: "public", Name: "bar", ObjectType: "VIEW", Statement: "\n\nCREATE VIEW public.bar AS SELECT 1;\n"}
+	sessionGUCs := utils.StatementWithType{ObjectType: "SESSION GUCS", Statement: "\nSET client_encoding = 'UTF8';\n"}
+	BeforeEach(func() {
+		connection, mock = testutils.CreateAndConnectMockDB(2)
+		dryRunBuffer = gbytes.NewBuffer()
+		restore.SetDryRunWriter(dryRunBuffer)
+	})
+	AfterEach(func() {
+		restore.SetDryRunWriter(nil)
+		restore.SetRestoreJournal(nil)
+	})
+	Describe("ExecuteStatements", func() {
+		It("writes statements executed in order instead of executing them", func() {
+			restore.ExecuteStatementsAndCreateProgressBar([]utils.StatementWithType{createTable, createView}, "", utils.PB_NONE, false, 1)
+			Expect(string(dryRunBuffer.Contents())).To(Equal(`
+-- The following 2 statement(s) are executed in order on connection 1
+CREATE TABLE public.foo (i int);
+CREATE VIEW public.bar AS SELECT 1;
+`))
+		})
+		It("writes statements executed in parallel instead of executing them", func() {
+			restore.ExecuteStatementsAndCreateProgressBar([]utils.StatementWithType{createTable, createView}, "", utils.PB_NONE, true)
+			Expect(string(dryRunBuffer.Contents())).To(HavePrefix("\n-- The following 2 statement(s) are executed in parallel on 2 connections\n"))
+		})
+		It("leaves out statements that a resumed restore skips", func() {
+			journal := &utils.RestoreJournal{
+				Statements:  map[string]utils.RestoreJournalEntry{utils.GetStatementChecksum(createTable): {}},
+				DataEntries: map[uint32]utils.RestoreJournalEntry{},
+			}
+			restore.SetRestoreJournal(journal)
+			restore.ExecuteStatementsAndCreateProgressBar([]utils.StatementWithType{createTable, createView}, "", utils.PB_NONE, false)
+			Expect(string(dryRunBuffer.Contents())).To(Equal(`
+-- The following 1 statement(s) are executed in order on connection 0
+CREATE VIEW public.bar AS SELECT 1;
+`))
+		})
+		It("writes nothing if every statement was already restored", func() {
+			journal := &utils.RestoreJournal{
+				Statements:  map[string]utils.RestoreJournalEntry{utils.GetStatementChecksum(createTable): {}},
+				DataEntries: map[uint32]utils.RestoreJournalEntry{},
+			}
+			restore.SetRestoreJournal(journal)
+			restore.ExecuteStatementsAndCreateProgressBar([]utils.StatementWithType{createTable}, "", utils.PB_NONE, false)
+			Expect(dryRunBuffer.Contents()).To(BeEmpty())
+		})
+	})
+	Describe("WriteDryRunData", func() {
+		var fpInfo utils.FilePathInfo
+		dataEntries := []utils.MasterDataEntry{
+			{Schema: "public", Name: "foo", Oid: 1, AttributeString: "(i)", Stream: 0},
+			{Schema: "public", Name: "bar", Oid: 2, AttributeString: "(j)", Stream: 1},
+			{Schema: "public", Name: "baz", Oid: 3, AttributeString: "(k)", Stream: 0},
+		}
+		BeforeEach(func() {
+			utils.SetCompressionParameters(false, utils.Compression{})
+			testCluster := cluster.NewCluster([]cluster.SegConfig{{ContentID: -1, Hostname: "localhost", DataDir: "/data/gpseg-1"}})
+			fpInfo = utils.NewFilePathInfo(testCluster, "", "20170101010101", "gpseg")
+			restore.SetTruncateTable(false)
+		})
+		AfterEach(func() {
+			restore.SetBackupConfig(&utils.BackupConfig{})
+			restore.SetTruncateTable(false)
+		})
+		It("writes the COPY statements shared by all connections when each table has its own data file", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SingleDataFile: false})
+			restore.WriteDryRunData(fpInfo, dataEntries, []utils.StatementWithType{sessionGUCs}, utils.NewProgressBar(3, "", utils.PB_NONE))
+			Expect(string(dryRunBuffer.Contents())).To(Equal(`
+-- The following 1 statement(s) are executed in order on connection 0
+SET client_encoding = 'UTF8';
+
+-- The following 1 statement(s) are executed in order on connection 1
+SET client_encoding = 'UTF8';
+
+-- The following 3 table(s) are loaded in parallel on 2 connections
+COPY public.foo(i) FROM PROGRAM 'gpbackup_helper --read-table-data --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_1 --content <SEGID>' WITH CSV DELIMITER ',' ON SEGMENT;
+COPY public.bar(j) FROM PROGRAM 'gpbackup_helper --read-table-data --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_2 --content <SEGID>' WITH CSV DELIMITER ',' ON SEGMENT;
+COPY public.baz(k) FROM PROGRAM 'gpbackup_helper --read-table-data --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3 --content <SEGID>' WITH CSV DELIMITER ',' ON SEGMENT;
+`))
+		})
+		It("writes the COPY statements for each connection when the backup has a single data file", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SingleDataFile: true})
+			restore.WriteDryRunData(fpInfo, dataEntries, []utils.StatementWithType{sessionGUCs}, utils.NewProgressBar(3, "", utils.PB_NONE))
+			Expect(string(dryRunBuffer.Contents())).To(MatchRegexp(`
+-- The following 2 table\(s\) are loaded in order on connection 0
+COPY public.foo\(i\) FROM PROGRAM 'cat <SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_pipe_\d+_1 && test ! -e <SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_pipe_\d+_1_error' WITH CSV DELIMITER ',' ON SEGMENT;
+COPY public.baz\(k\) FROM PROGRAM 'cat <SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_pipe_\d+_3 && test ! -e <SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_pipe_\d+_3_error' WITH CSV DELIMITER ',' ON SEGMENT;
+
+-- The following 1 table\(s\) are loaded in order on connection 1
+COPY public.bar\(j\) FROM PROGRAM 'cat <SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_pipe_\d+_2 && test ! -e <SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_pipe_\d+_2_error' WITH CSV DELIMITER ',' ON SEGMENT;
+$`))
+		})
+		It("writes each COPY statement in a transaction with a TRUNCATE statement with truncate-table", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SingleDataFile: false})
+			restore.SetTruncateTable(true)
+			restore.WriteDryRunData(fpInfo, dataEntries[:1], []utils.StatementWithType{}, utils.NewProgressBar(1, "", utils.PB_NONE))
+			Expect(string(dryRunBuffer.Contents())).To(HaveSuffix(`
+-- The following 1 table(s) are loaded in parallel on 2 connections
+BEGIN;
+TRUNCATE TABLE public.foo;
+COPY public.foo(i) FROM PROGRAM 'gpbackup_helper --read-table-data --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_1 --content <SEGID>' WITH CSV DELIMITER ',' ON SEGMENT;
+COMMIT;
+`))
+		})
+	})
+})
@@ -1,6 +1,7 @@
 package restore
 
 import (
+	"io"
 	"sync"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
@@ -18,15 +19,23 @@ import (
  */
 
 var (
-	backupConfig     *utils.BackupConfig
-	connectionPool   *dbconn.DBConn
-	globalCluster    *cluster.Cluster
-	globalFPInfo     utils.FilePathInfo
-	globalTOC        *utils.TOC
-	pluginConfig     *utils.PluginConfig
-	restoreStartTime string
-	version          string
-	wasTerminated    bool
+	backupConfig      *utils.BackupConfig
+	connectionPool    *dbconn.DBConn
+	dryRunWriter      io.WriteCloser
+	globalCluster     *cluster.Cluster
+	globalFPInfo      utils.FilePathInfo
+	globalTOC         *utils.TOC
+	journalFlags      map[string]string
+	pluginConfig      *utils.PluginConfig
+	redirectSchemaMap map[string]string
+	relationRenameMap map[string]string
+	tablespaceMapping map[string]utils.TablespaceMapping
+	restoreJournal    *utils.RestoreJournal
+	roleMapping       map[string]string
+	restoreStartTime  string
+	resumeSummary     string
+	version           string
+	wasTerminated     bool
 
 	/*
 	 * Used for synchronizing DoCleanup.  In DoInit() we increment the group
@@ -42,24 +51,43 @@ var (
 
 var (
 	backupDir           *string
+	clean               *bool
 	createDB            *bool
 	dataOnly            *bool
 	debug               *bool
+	dryRun              *bool
+	dryRunFile          *string
+	encryptionKeyFile   *string
 	excludeSchemas      *[]string
 	excludeRelationFile *string
 	excludeRelations    *[]string
+	ifExists            *bool
 	includeSchemas      *[]string
 	includeRelationFile *string
 	includeRelations    *[]string
+	listTOC             *bool
 	metadataOnly        *bool
+	noOwner             *bool
+	noPrivileges        *bool
+	noTablespaces       *bool
 	numJobs             *int
+	onConflict          *string
 	onErrorContinue     *bool
 	pluginConfigFile    *string
 	quiet               *bool
 	redirect            *string
+	redirectSchemas     *[]string
+	renameTo            *[]string
+	resizeCluster       *bool
 	restoreGlobals      *bool
+	resume              *bool
+	roleMap             *[]string
+	tablespaceMap       *[]string
 	timestamp           *string
+	useListFile         *string
+	truncateTable       *bool
 	verbose             *bool
+	verifyOnly          *bool
 	withStats           *bool
 )
 
@@ -79,10 +107,22 @@ func SetCluster(cluster *cluster.Cluster) {
 	globalCluster = cluster
 }
 
+func SetDryRunWriter(writer io.WriteCloser) {
+	dryRunWriter = writer
+}
+
 func SetFPInfo(fpInfo utils.FilePathInfo) {
 	globalFPInfo = fpInfo
 }
 
+func SetMetadataOnly(which bool) {
+	metadataOnly = &which
+}
+
+func SetOnConflict(policy string) {
+	onConflict = &policy
+}
+
 func SetOnErrorContinue(errContinue bool) {
 	onErrorContinue = &errContinue
 }
@@ -91,6 +131,30 @@ func SetNumJobs(jobs int) {
 	numJobs = &jobs
 }
 
+func SetPluginConfigFile(filename string) {
+	pluginConfigFile = &filename
+}
+
+func SetRedirectSchemaMap(schemaMap map[string]string) {
+	redirectSchemaMap = schemaMap
+}
+
+func SetRelationRenameMap(renameMap map[string]string) {
+	relationRenameMap = renameMap
+}
+
+func SetResizeCluster(which bool) {
+	resizeCluster = &which
+}
+
+func SetRestoreJournal(journal *utils.RestoreJournal) {
+	restoreJournal = journal
+}
+
+func SetTruncateTable(truncate bool) {
+	truncateTable = &truncate
+}
+
 func SetTOC(toc *utils.TOC) {
 	globalTOC = toc
 }
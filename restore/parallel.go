@@ -20,6 +20,9 @@ import (
  * an error code.
  */
 func executeStatement(statement utils.StatementWithType, showProgressBar int, whichConn int) uint32 {
+	if WasStatementRestored(statement) {
+		return 0
+	}
 	whichConn = connectionPool.ValidateConnNum(whichConn)
 	_, err := connectionPool.Exec(statement.Statement, whichConn)
 	if err != nil {
@@ -32,6 +35,7 @@ func executeStatement(statement utils.StatementWithType, showProgressBar int, wh
 		}
 		gplog.Fatal(errors.Errorf("%s; see log file %s for details.", err.Error(), gplog.GetLogFilePath()), "Failed to execute statement")
 	}
+	AddStatementToJournal(statement)
 	return 0
 }
 
@@ -40,6 +44,13 @@ func executeStatement(statement utils.StatementWithType, showProgressBar int, wh
  * to N statements in parallel.
  */
 func ExecuteStatements(statements []utils.StatementWithType, progressBar utils.ProgressBar, showProgressBar int, executeInParallel bool, whichConn ...int) {
+	if dryRunWriter != nil {
+		WriteDryRunStatements(statements, executeInParallel, connectionPool.ValidateConnNum(whichConn...))
+		for range statements {
+			progressBar.Increment()
+		}
+		return
+	}
 	var numErrors uint32
 	if !executeInParallel {
 		connNum := connectionPool.ValidateConnNum(whichConn...)
@@ -8,6 +8,8 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
 )
 
@@ -15,12 +17,13 @@ import (
  * Functions to run commands on entire cluster during restore
  */
 
-func VerifyBackupDirectoriesExistOnAllHosts() {
-	remoteOutput := globalCluster.GenerateAndExecuteCommand("Verifying backup directories exist", func(contentID int) string {
-		return fmt.Sprintf("test -d %s", globalFPInfo.GetDirForContent(contentID))
+func VerifyBackupDirectoriesExistOnAllHosts(fpInfo utils.FilePathInfo) {
+	backupFileCluster := GetBackupFileCluster()
+	remoteOutput := backupFileCluster.GenerateAndExecuteCommand("Verifying backup directories exist", func(contentID int) string {
+		return fmt.Sprintf("test -d %s", fpInfo.GetDirForContent(contentID))
 	}, cluster.ON_SEGMENTS_AND_MASTER)
-	globalCluster.CheckClusterError(remoteOutput, "Backup directories missing or inaccessible", func(contentID int) string {
-		return fmt.Sprintf("Backup directory %s missing or inaccessible", globalFPInfo.GetDirForContent(contentID))
+	backupFileCluster.CheckClusterError(remoteOutput, "Backup directories missing or inaccessible", func(contentID int) string {
+		return fmt.Sprintf("Backup directory %s missing or inaccessible", fpInfo.GetDirForContent(contentID))
 	})
 }
 
@@ -68,9 +71,86 @@ func VerifyMetadataFilePaths(withStats bool) {
 	}
 }
 
-func CheckAgentErrorsOnSegments() error {
+/*
+ * Backups taken before checksums were recorded have no checksums in their
+ * config file, in which case there is nothing to verify.
+ */
+func VerifyMetadataFileChecksums(withStats bool) {
+	for _, errMsg := range GetMetadataFileChecksumErrors(withStats) {
+		if *onErrorContinue {
+			gplog.Error(errMsg)
+		} else {
+			gplog.Fatal(errors.Errorf("%s", errMsg), "")
+		}
+	}
+}
+
+func GetMetadataFileChecksumErrors(withStats bool) []string {
+	errMsgs := make([]string, 0)
+	filetypes := []string{"metadata", "table of contents"}
+	if withStats {
+		filetypes = append(filetypes, "statistics")
+	}
+	for _, filetype := range filetypes {
+		expectedChecksum, ok := backupConfig.Checksums[filetype]
+		if !ok {
+			continue
+		}
+		filename := globalFPInfo.GetBackupFilePath(filetype)
+		actualChecksum, err := utils.GetFileChecksum(filename)
+		if err != nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("Unable to compute checksum of %s file %s: %v", filetype, filename, err))
+		} else if actualChecksum != expectedChecksum {
+			errMsgs = append(errMsgs, fmt.Sprintf("Checksum mismatch for %s file %s: expected %s, found %s", filetype, filename, expectedChecksum, actualChecksum))
+		}
+	}
+	return errMsgs
+}
+
+/*
+ * Runs the gpbackup_helper verification agent on each segment and returns
+ * the result for each table, along with an error for each segment on which
+ * the agent failed.
+ */
+func VerifyDataFilesOnAllHosts(fpInfo utils.FilePathInfo, dataEntries []utils.MasterDataEntry) (map[int]map[uint32]utils.DataFileVerification, map[int]string) {
+	oidList := make([]string, len(dataEntries))
+	for i, entry := range dataEntries {
+		oidList[i] = fmt.Sprintf("%d", entry.Oid)
+	}
+	utils.WriteOidListToSegments(oidList, globalCluster, fpInfo)
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Verifying data files", func(contentID int) string {
+		gphome := operating.System.Getenv("GPHOME")
+		oidFile := fpInfo.GetSegmentHelperFilePath(contentID, "oid")
+		backupFile := fpInfo.GetTableBackupFilePath(contentID, 0, true)
+		tocStr := ""
+		if backupConfig.SingleDataFile {
+			tocStr = fmt.Sprintf(" --toc-file %s", fpInfo.GetSegmentTOCFilePath(contentID))
+		}
+		return fmt.Sprintf("source %s/greenplum_path.sh && %s/bin/gpbackup_helper --verify-agent --oid-file %s --data-file %s --content %d%s%s", gphome, gphome, oidFile, backupFile, contentID, tocStr, utils.GetEncryptionFlagsString())
+	}, cluster.ON_SEGMENTS)
+	utils.CleanUpHelperFilesOnAllHosts(globalCluster, fpInfo)
+
+	verifications := make(map[int]map[uint32]utils.DataFileVerification, len(remoteOutput.Stdouts))
+	for contentID, output := range remoteOutput.Stdouts {
+		verifications[contentID] = utils.ParseDataFileVerifications(output)
+	}
+	agentErrors := make(map[int]string, 0)
+	for contentID, err := range remoteOutput.Errors {
+		if err == nil {
+			continue
+		}
+		errStr := strings.TrimSpace(remoteOutput.Stderrs[contentID])
+		if errStr == "" {
+			errStr = err.Error()
+		}
+		agentErrors[contentID] = fmt.Sprintf("Verification of backup files in %s failed: %s", fpInfo.GetDirForContent(contentID), errStr)
+	}
+	return verifications, agentErrors
+}
+
+func CheckAgentErrorsOnSegments(fpInfo utils.FilePathInfo) error {
 	remoteOutput := globalCluster.GenerateAndExecuteCommand("Checking whether segment agents had errors during restore", func(contentID int) string {
-		errorFile := fmt.Sprintf("%s_error", globalFPInfo.GetSegmentPipeFilePath(contentID))
+		errorFile := fmt.Sprintf("%s_error", fpInfo.GetSegmentPipeFilePath(contentID))
 		/*
 		 * If an error file exists we want to indicate an error, as that means
 		 * the agent errored out.  If no file exists, the agent was successful.
@@ -86,7 +166,7 @@ func CheckAgentErrorsOnSegments() error {
 		}
 	}
 	if numErrors > 0 {
-		helperLogName := globalFPInfo.GetHelperLogPath()
+		helperLogName := fpInfo.GetHelperLogPath()
 		return errors.Errorf("Encountered errors with %d restore agent(s).  See %s for a complete list of segments with errors, and see %s on the corresponding hosts for detailed error messages.",
 			numErrors, gplog.GetLogFilePath(), helperLogName)
 	}
@@ -0,0 +1,196 @@
+package restore
+
+/*
+ * This file contains functions related to restoring a backup to a cluster
+ * with a different number of segments with gprestore --resize-cluster.
+ *
+ * The data files of each segment in the backup are read from the host of the
+ * segment in this cluster whose content ID is the content ID of that segment
+ * modulo the number of segments in this cluster, from the backup directory of
+ * that segment or, with --backup-dir, from the directory for the segment in
+ * the backup.  When restoring to a smaller cluster, the files of the segments
+ * that do not exist in this cluster must be copied there first, which is
+ * checked before any table is loaded.  Each file is then loaded through the
+ * master with a COPY that is not ON SEGMENT, so that its rows are
+ * redistributed across the segments of this cluster.
+ */
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Backups taken before the segment count was recorded are assumed to have
+ * been taken on a cluster with the same number of segments as this one.
+ */
+func IsResizeRestore() bool {
+	return backupConfig.SegmentCount != 0 && backupConfig.SegmentCount != len(globalCluster.ContentIDs)-1
+}
+
+/*
+ * Data files are read on the segments they are restored from, so a backup with
+ * a single data file per segment, whose data must be served by gpbackup_helper
+ * from the segment TOC, and a backup whose files are on plugin storage are not
+ * supported when restoring to a different number of segments.
+ */
+func ValidateSegmentCount() {
+	numSegments := len(globalCluster.ContentIDs) - 1
+	if *resizeCluster && backupConfig.SegmentCount == 0 {
+		gplog.Fatal(errors.Errorf("Backup %s does not record the number of segments in the cluster on which it was taken, so it cannot be restored with --resize-cluster", globalFPInfo.Timestamp), "")
+	}
+	if !IsResizeRestore() || backupConfig.MetadataOnly || *metadataOnly {
+		return
+	}
+	if !*resizeCluster {
+		gplog.Fatal(errors.Errorf("Backup %s was taken on a cluster with %d segment(s), but this cluster has %d segment(s).  Use --resize-cluster to restore it to this cluster.", globalFPInfo.Timestamp, backupConfig.SegmentCount, numSegments), "")
+	}
+	if backupConfig.SingleDataFile {
+		gplog.Fatal(errors.Errorf("A backup taken with --single-data-file cannot be restored to a cluster with a different number of segments"), "")
+	}
+	if *pluginConfigFile != "" {
+		gplog.Fatal(errors.Errorf("A backup cannot be restored to a cluster with a different number of segments with --plugin-config"), "")
+	}
+	gplog.Info("Restoring backup taken on a cluster with %d segment(s) to a cluster with %d segment(s); table data will be loaded through the master", backupConfig.SegmentCount, numSegments)
+}
+
+// Returns the content IDs of the segments in the backup whose data files are read from the given segment
+func GetBackupContentIDsForSegment(contentID int) []int {
+	if !IsResizeRestore() {
+		return []int{contentID}
+	}
+	numSegments := len(globalCluster.ContentIDs) - 1
+	backupContentIDs := make([]int, 0)
+	for backupContentID := contentID; backupContentID < backupConfig.SegmentCount; backupContentID += numSegments {
+		backupContentIDs = append(backupContentIDs, backupContentID)
+	}
+	return backupContentIDs
+}
+
+/*
+ * When restoring to a larger cluster, the segments that do not exist in the
+ * backup have no backup directories, so they are left out of the cluster on
+ * which the backup directories are checked.
+ */
+func GetBackupFileCluster() *cluster.Cluster {
+	if !IsResizeRestore() || backupConfig.SegmentCount > len(globalCluster.ContentIDs)-1 {
+		return globalCluster
+	}
+	segConfigs := make([]cluster.SegConfig, 0)
+	for _, contentID := range globalCluster.ContentIDs {
+		if contentID < backupConfig.SegmentCount {
+			segConfigs = append(segConfigs, globalCluster.Segments[contentID])
+		}
+	}
+	backupFileCluster := cluster.NewCluster(segConfigs)
+	backupFileCluster.Executor = globalCluster.Executor
+	return backupFileCluster
+}
+
+/*
+ * Returns the data files and checksum files of the segments in the backup that
+ * are read from each segment in this cluster.
+ */
+func getResizeBackupFiles(fpInfo utils.FilePathInfo, dataEntries []utils.MasterDataEntry) map[int][]string {
+	backupFiles := make(map[int][]string)
+	for _, contentID := range globalCluster.ContentIDs {
+		if contentID == -1 {
+			continue
+		}
+		for _, backupContentID := range GetBackupContentIDsForSegment(contentID) {
+			hasChecksums := false
+			for _, entry := range dataEntries {
+				backupFiles[contentID] = append(backupFiles[contentID], fpInfo.GetTableBackupFilePathForBackupSegment(contentID, backupContentID, entry.Oid))
+				hasChecksums = hasChecksums || len(entry.Checksums) > 0
+			}
+			if hasChecksums {
+				backupFiles[contentID] = append(backupFiles[contentID], fpInfo.GetSegmentChecksumFilePathForBackupSegment(contentID, backupContentID))
+			}
+		}
+	}
+	return backupFiles
+}
+
+/*
+ * The file count cannot be verified when the files of several segments in the
+ * backup are read from one segment in this cluster, so instead every file that
+ * is read is checked to exist before any table is loaded.
+ */
+func VerifyResizeBackupFilesExistOnAllHosts(fpInfo utils.FilePathInfo, dataEntries []utils.MasterDataEntry) {
+	backupFiles := getResizeBackupFiles(fpInfo, dataEntries)
+	backupFileCluster := GetBackupFileCluster()
+	remoteOutput := backupFileCluster.GenerateAndExecuteCommand("Verifying backup files exist", func(contentID int) string {
+		dirSet := make(map[string]bool)
+		for _, backupFile := range backupFiles[contentID] {
+			dirSet[path.Dir(backupFile)] = true
+		}
+		dirs := make([]string, 0, len(dirSet))
+		for dir := range dirSet {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+		return fmt.Sprintf("find %s -maxdepth 1 -type f", strings.Join(dirs, " "))
+	}, cluster.ON_SEGMENTS)
+	backupFileCluster.CheckClusterError(remoteOutput, "Could not verify that backup files exist", func(contentID int) string {
+		return "Could not verify that backup files exist"
+	})
+
+	numMissing := 0
+	for contentID, output := range remoteOutput.Stdouts {
+		foundFiles := make(map[string]bool)
+		for _, foundFile := range strings.Split(output, "\n") {
+			foundFiles[strings.TrimSpace(foundFile)] = true
+		}
+		for _, backupFile := range backupFiles[contentID] {
+			if !foundFiles[backupFile] {
+				gplog.Error("Backup file %s is missing on host %s", backupFile, globalCluster.GetHostForContent(contentID))
+				numMissing++
+			}
+		}
+	}
+	if numMissing > 0 {
+		gplog.Fatal(errors.Errorf("%d backup file(s) needed to restore to this cluster are missing.  When restoring to a cluster with fewer segments, the files of each segment in the backup must first be copied to the backup directory of the segment whose content ID is the content ID of that segment modulo the number of segments in this cluster.", numMissing), "")
+	}
+}
+
+/*
+ * The data file is read over SSH by gpbackup_helper on the host of the segment
+ * in this cluster on which it is stored, which decrypts and decompresses it
+ * and verifies its checksum as in any other restore, so that the COPY fails
+ * before it commits if the data does not match its checksum.
+ */
+func GetResizeCopyTableInQuery(tableName string, tableAttributes string, host string, backupFile string, checksumFile string, backupContentID int, oid uint32) string {
+	gphome := operating.System.Getenv("GPHOME")
+	readCommand := strings.Replace(utils.GetReadTableDataCommand(backupFile, checksumFile, oid), "<SEGID>", strconv.Itoa(backupContentID), -1)
+	remoteCommand := fmt.Sprintf("source %s/greenplum_path.sh && %s/bin/%s", gphome, gphome, readCommand)
+	copyCommand := strings.Join(cluster.ConstructSSHCommand(host, utils.ShellQuote(remoteCommand)), " ")
+	return fmt.Sprintf("COPY %s%s FROM PROGRAM '%s' WITH CSV DELIMITER '%s';", tableName, tableAttributes, strings.Replace(copyCommand, "'", "''", -1), tableDelim)
+}
+
+// Returns one query for each data file of the table, in content ID order of the segments in the backup
+func GetResizeCopyTableInQueries(fpInfo utils.FilePathInfo, tableName string, entry utils.MasterDataEntry) []string {
+	queries := make([]string, backupConfig.SegmentCount)
+	for _, contentID := range globalCluster.ContentIDs {
+		if contentID == -1 {
+			continue
+		}
+		for _, backupContentID := range GetBackupContentIDsForSegment(contentID) {
+			backupFile := fpInfo.GetTableBackupFilePathForBackupSegment(contentID, backupContentID, entry.Oid)
+			checksumFile := ""
+			if len(entry.Checksums) > 0 {
+				checksumFile = fpInfo.GetSegmentChecksumFilePathForBackupSegment(contentID, backupContentID)
+			}
+			queries[backupContentID] = GetResizeCopyTableInQuery(tableName, entry.AttributeString, globalCluster.GetHostForContent(contentID), backupFile, checksumFile, backupContentID, entry.Oid)
+		}
+	}
+	return queries
+}
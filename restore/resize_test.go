@@ -0,0 +1,169 @@
+package restore_test
+
+import (
+	"os/user"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/resize tests", func() {
+	masterSeg := cluster.SegConfig{ContentID: -1, Hostname: "localhost", DataDir: "/data/gpseg-1"}
+	segOne := cluster.SegConfig{ContentID: 0, Hostname: "host1", DataDir: "/data/gpseg0"}
+	segTwo := cluster.SegConfig{ContentID: 1, Hostname: "host2", DataDir: "/data/gpseg1"}
+	var testCluster *cluster.Cluster
+	BeforeEach(func() {
+		operating.System.CurrentUser = func() (*user.User, error) { return &user.User{Username: "testUser", HomeDir: "testDir"}, nil }
+		testCluster = cluster.NewCluster([]cluster.SegConfig{masterSeg, segOne, segTwo})
+		restore.SetCluster(testCluster)
+	})
+	AfterEach(func() {
+		operating.System = operating.InitializeSystemFunctions()
+		restore.SetBackupConfig(&utils.BackupConfig{})
+	})
+	Describe("IsResizeRestore", func() {
+		It("returns false if the backup was taken on a cluster with the same number of segments", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 2})
+			Expect(restore.IsResizeRestore()).To(BeFalse())
+		})
+		It("returns false if the backup does not record the number of segments", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{})
+			Expect(restore.IsResizeRestore()).To(BeFalse())
+		})
+		It("returns true if the backup was taken on a cluster with a different number of segments", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 5})
+			Expect(restore.IsResizeRestore()).To(BeTrue())
+		})
+	})
+	Describe("ValidateSegmentCount", func() {
+		BeforeEach(func() {
+			restore.SetFPInfo(utils.FilePathInfo{Timestamp: "20170101010101"})
+			restore.SetMetadataOnly(false)
+			restore.SetPluginConfigFile("")
+			restore.SetResizeCluster(true)
+		})
+		AfterEach(func() {
+			restore.SetResizeCluster(false)
+		})
+		It("accepts a backup taken on a cluster with a different number of segments", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 5})
+			restore.ValidateSegmentCount()
+		})
+		It("accepts a metadata-only restore without --resize-cluster", func() {
+			restore.SetResizeCluster(false)
+			restore.SetMetadataOnly(true)
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 5})
+			restore.ValidateSegmentCount()
+		})
+		It("panics if the backup does not record the number of segments", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{})
+			defer testhelper.ShouldPanicWithMessage("Backup 20170101010101 does not record the number of segments in the cluster on which it was taken, so it cannot be restored with --resize-cluster")
+			restore.ValidateSegmentCount()
+		})
+		It("panics if the number of segments differs without --resize-cluster", func() {
+			restore.SetResizeCluster(false)
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 5})
+			defer testhelper.ShouldPanicWithMessage("Backup 20170101010101 was taken on a cluster with 5 segment(s), but this cluster has 2 segment(s).  Use --resize-cluster to restore it to this cluster.")
+			restore.ValidateSegmentCount()
+		})
+		It("panics if the backup was taken with --single-data-file", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 5, SingleDataFile: true})
+			defer testhelper.ShouldPanicWithMessage("A backup taken with --single-data-file cannot be restored to a cluster with a different number of segments")
+			restore.ValidateSegmentCount()
+		})
+		It("panics if the backup is restored with --plugin-config", func() {
+			restore.SetPluginConfigFile("/tmp/plugin_config.yaml")
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 5})
+			defer testhelper.ShouldPanicWithMessage("A backup cannot be restored to a cluster with a different number of segments with --plugin-config")
+			restore.ValidateSegmentCount()
+		})
+	})
+	Describe("GetBackupContentIDsForSegment", func() {
+		It("returns the content ID of the segment itself if the number of segments is the same", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 2})
+			Expect(restore.GetBackupContentIDsForSegment(1)).To(Equal([]int{1}))
+		})
+		It("returns the content IDs of the segments in a larger backup modulo the number of segments", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 5})
+			Expect(restore.GetBackupContentIDsForSegment(0)).To(Equal([]int{0, 2, 4}))
+			Expect(restore.GetBackupContentIDsForSegment(1)).To(Equal([]int{1, 3}))
+		})
+		It("returns no content IDs for a segment that does not exist in a smaller backup", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 1})
+			Expect(restore.GetBackupContentIDsForSegment(0)).To(Equal([]int{0}))
+			Expect(restore.GetBackupContentIDsForSegment(1)).To(BeEmpty())
+		})
+	})
+	Describe("GetBackupFileCluster", func() {
+		It("returns the cluster if the backup was taken on a larger cluster", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 5})
+			Expect(restore.GetBackupFileCluster()).To(Equal(testCluster))
+		})
+		It("leaves out the segments that do not exist in a smaller backup", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 1})
+			Expect(restore.GetBackupFileCluster().ContentIDs).To(Equal([]int{-1, 0}))
+		})
+	})
+	Describe("VerifyResizeBackupFilesExistOnAllHosts", func() {
+		entries := []utils.MasterDataEntry{{Schema: "public", Name: "foo", Oid: 3456, Checksums: map[int]string{0: "abc"}}}
+		var testExecutor *testhelper.TestExecutor
+		var fpInfo utils.FilePathInfo
+		BeforeEach(func() {
+			testExecutor = &testhelper.TestExecutor{}
+			testCluster.Executor = testExecutor
+			fpInfo = utils.NewFilePathInfo(testCluster, "", "20170101010101", "gpseg")
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 3})
+		})
+		It("checks that the files of every segment in the backup exist before any table is loaded", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{Stdouts: map[int]string{
+				0: "/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_3456\n/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_checksums\n/data/gpseg0/backups/20170101/20170101010101/gpbackup_2_20170101010101_3456\n/data/gpseg0/backups/20170101/20170101010101/gpbackup_2_20170101010101_checksums\n",
+				1: "/data/gpseg1/backups/20170101/20170101010101/gpbackup_1_20170101010101_3456\n/data/gpseg1/backups/20170101/20170101010101/gpbackup_1_20170101010101_checksums\n",
+			}}
+			restore.VerifyResizeBackupFilesExistOnAllHosts(fpInfo, entries)
+			Expect(testExecutor.NumExecutions).To(Equal(1))
+			Expect(testExecutor.ClusterCommands[0][0]).To(Equal([]string{"ssh", "-o", "StrictHostKeyChecking=no", "testUser@host1", "find /data/gpseg0/backups/20170101/20170101010101 -maxdepth 1 -type f"}))
+		})
+		It("panics if the files of a segment in the backup have not been copied to this cluster", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{Stdouts: map[int]string{
+				0: "/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_3456\n/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_checksums\n",
+				1: "/data/gpseg1/backups/20170101/20170101010101/gpbackup_1_20170101010101_3456\n/data/gpseg1/backups/20170101/20170101010101/gpbackup_1_20170101010101_checksums\n",
+			}}
+			defer testhelper.ShouldPanicWithMessage("2 backup file(s) needed to restore to this cluster are missing")
+			restore.VerifyResizeBackupFilesExistOnAllHosts(fpInfo, entries)
+		})
+	})
+	Describe("GetResizeCopyTableInQueries", func() {
+		entry := utils.MasterDataEntry{Schema: "public", Name: "foo", Oid: 3456, AttributeString: "(i,j)"}
+		var fpInfo utils.FilePathInfo
+		BeforeEach(func() {
+			operating.System.Getenv = func(key string) string { return "/usr/local/gpdb" }
+			fpInfo = utils.NewFilePathInfo(testCluster, "", "20170101010101", "gpseg")
+		})
+		AfterEach(func() {
+			utils.SetEncryptionParameters("", nil)
+		})
+		It("reads each data file of a larger backup with gpbackup_helper on the host on which it is stored", func() {
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 3})
+			Expect(restore.GetResizeCopyTableInQueries(fpInfo, "public.foo", entry)).To(Equal([]string{
+				"COPY public.foo(i,j) FROM PROGRAM 'ssh -o StrictHostKeyChecking=no testUser@host1 ''source /usr/local/gpdb/greenplum_path.sh && /usr/local/gpdb/bin/gpbackup_helper --read-table-data --data-file /data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_3456 --content 0''' WITH CSV DELIMITER ',';",
+				"COPY public.foo(i,j) FROM PROGRAM 'ssh -o StrictHostKeyChecking=no testUser@host2 ''source /usr/local/gpdb/greenplum_path.sh && /usr/local/gpdb/bin/gpbackup_helper --read-table-data --data-file /data/gpseg1/backups/20170101/20170101010101/gpbackup_1_20170101010101_3456 --content 1''' WITH CSV DELIMITER ',';",
+				"COPY public.foo(i,j) FROM PROGRAM 'ssh -o StrictHostKeyChecking=no testUser@host1 ''source /usr/local/gpdb/greenplum_path.sh && /usr/local/gpdb/bin/gpbackup_helper --read-table-data --data-file /data/gpseg0/backups/20170101/20170101010101/gpbackup_2_20170101010101_3456 --content 2''' WITH CSV DELIMITER ',';",
+			}))
+		})
+		It("verifies the checksum of each encrypted data file of a smaller backup", func() {
+			utils.SetEncryptionParameters("/tmp/key", []byte("0123456789abcdef0123456789abcdef"))
+			restore.SetBackupConfig(&utils.BackupConfig{SegmentCount: 1})
+			checksumEntry := entry
+			checksumEntry.Checksums = map[int]string{0: "abc"}
+			Expect(restore.GetResizeCopyTableInQueries(fpInfo, "public.foo", checksumEntry)).To(Equal([]string{
+				"COPY public.foo(i,j) FROM PROGRAM 'ssh -o StrictHostKeyChecking=no testUser@host1 ''source /usr/local/gpdb/greenplum_path.sh && /usr/local/gpdb/bin/gpbackup_helper --read-table-data --data-file /data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_3456 --content 0 --checksum-file /data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_checksums --oid 3456 --encryption-key-file /tmp/key''' WITH CSV DELIMITER ',';",
+			}))
+		})
+	})
+})
@@ -21,26 +21,45 @@ import (
  */
 func initializeFlags(cmd *cobra.Command) {
 	backupDir = cmd.Flags().String("backup-dir", "", "The absolute path of the directory in which the backup files to be restored are located")
+	clean = cmd.Flags().Bool("clean", false, "Drop each object being restored, along with the objects that depend on it, before restoring metadata.  Schemas are not dropped.")
 	createDB = cmd.Flags().Bool("create-db", false, "Create the database before metadata restore")
 	dataOnly = cmd.Flags().Bool("data-only", false, "Only restore data, do not restore metadata")
 	debug = cmd.Flags().Bool("debug", false, "Print verbose and debug log messages")
+	dryRun = cmd.Flags().Bool("dry-run", false, "Validate the restore and write the statements it would execute, without executing them")
+	dryRunFile = cmd.Flags().String("dry-run-file", "", "The absolute path of the file to which --dry-run writes the statements.  If not specified, the statements are written to stdout and log messages are written only to the log file.")
+	encryptionKeyFile = cmd.Flags().String("encryption-key-file", "", "The absolute path of a file containing the key or passphrase with which the backup was encrypted, after a first line of format=hex or format=passphrase.  The file must exist at the same path on every host.")
 	excludeSchemas = cmd.Flags().StringSlice("exclude-schema", []string{}, "Restore all metadata except objects in the specified schema(s). --exclude-schema can be specified multiple times.")
 	excludeRelations = cmd.Flags().StringSlice("exclude-table", []string{}, "Restore all metadata except the specified relation(s). --exclude-table can be specified multiple times.")
 	excludeRelationFile = cmd.Flags().String("exclude-table-file", "", "A file containing a list of fully-qualified relation(s) that will not be restored")
 	cmd.Flags().Bool("help", false, "Help for gprestore")
+	ifExists = cmd.Flags().Bool("if-exists", false, "Skip the objects that do not exist when dropping objects with --clean, instead of failing")
 	includeSchemas = cmd.Flags().StringSlice("include-schema", []string{}, "Restore only the specified schema(s). --include-schema can be specified multiple times.")
 	includeRelations = cmd.Flags().StringSlice("include-table", []string{}, "Restore only the specified relation(s). --include-table can be specified multiple times.")
 	includeRelationFile = cmd.Flags().String("include-table-file", "", "A file containing a list of fully-qualified relation(s) that will be restored")
+	listTOC = cmd.Flags().Bool("list", false, "Print the entries in the table of contents of the backup, with an ID for each entry, and exit")
 	metadataOnly = cmd.Flags().Bool("metadata-only", false, "Only restore metadata, do not restore data")
+	noOwner = cmd.Flags().Bool("no-owner", false, "Do not restore the owners of objects, so that the objects are owned by the user performing the restore")
+	noPrivileges = cmd.Flags().Bool("no-privileges", false, "Do not restore the privileges granted on objects")
+	noTablespaces = cmd.Flags().Bool("no-tablespaces", false, "Restore all objects into the default tablespace of the restore database, and do not restore tablespaces")
 	numJobs = cmd.Flags().Int("jobs", 1, "Number of parallel connections to use when restoring table data and post-data")
+	onConflict = cmd.Flags().String("on-conflict", ON_CONFLICT_APPEND, "What to do with the data of a table that already contains rows when restoring data only: skip the table, fail before loading any data, or append the data to the table")
 	onErrorContinue = cmd.Flags().Bool("on-error-continue", false, "Log errors and continue restore, instead of exiting on first error")
 	pluginConfigFile = cmd.Flags().String("plugin-config", "", "The configuration file to use for a plugin")
 	cmd.Flags().Bool("version", false, "Print version number and exit")
 	quiet = cmd.Flags().Bool("quiet", false, "Suppress non-warning, non-error log messages")
 	redirect = cmd.Flags().String("redirect-db", "", "Restore to the specified database instead of the database that was backed up")
+	redirectSchemas = cmd.Flags().StringSlice("redirect-schema", []string{}, "Restore the objects and data in one schema to another, specified as oldschema=newschema with each schema quoted as in SQL. --redirect-schema can be specified multiple times.")
+	renameTo = cmd.Flags().StringSlice("rename-to", []string{}, "Restore the relation specified by the --include-table in the same position under this name, along with its sequences, constraints, and indexes.  --rename-to can be specified multiple times.")
+	resizeCluster = cmd.Flags().Bool("resize-cluster", false, "Restore a backup taken on a cluster with a different number of segments, loading the data of each table through the master.  When restoring to a cluster with fewer segments, the files of each segment in the backup must first be copied to the backup directory of the segment whose content ID is its content ID modulo the number of segments in this cluster.  --resize-cluster does not support backups taken with --single-data-file or restores with --plugin-config.")
 	restoreGlobals = cmd.Flags().Bool("with-globals", false, "Restore global metadata")
+	resume = cmd.Flags().Bool("resume", false, "Resume a failed or canceled restore of this backup, skipping the objects and tables it already restored.  The other flags must be the same as those the restore was started with.")
+	roleMap = cmd.Flags().StringSlice("role-map", []string{}, "Restore the ownership, privileges, and memberships of one role to another, specified as oldrole=newrole with each role quoted as in SQL.  The new role must exist, and the old role is not restored with --with-globals.  --role-map can be specified multiple times.")
+	tablespaceMap = cmd.Flags().StringSlice("tablespace-map", []string{}, "Restore the objects in one tablespace to another, specified as oldtablespace=newtablespace with each tablespace quoted as in SQL.  The new tablespace must exist unless a location is specified as oldtablespace=newtablespace:location, in which case it is created at that location: a filespace on GPDB 4.3 and 5, or a directory on GPDB 6 and later.  --tablespace-map can be specified multiple times.")
 	timestamp = cmd.Flags().String("timestamp", "", "The timestamp to be restored, in the format YYYYMMDDHHMMSS")
+	useListFile = cmd.Flags().String("use-list", "", "A file containing entries from the output of --list.  Only these entries are restored, in the order in which they are listed within each section, except that the data of a backup taken with --single-data-file is always restored in the order in which it was backed up.")
+	truncateTable = cmd.Flags().Bool("truncate-table", false, "Truncate each table before loading its data, in the same transaction, when restoring data only")
 	verbose = cmd.Flags().Bool("verbose", false, "Print verbose log messages")
+	verifyOnly = cmd.Flags().Bool("verify-only", false, "Verify that the backup files are intact, without restoring anything")
 	withStats = cmd.Flags().Bool("with-stats", false, "Restore query plan statistics")
 
 	_ = cmd.MarkFlagRequired("timestamp")
@@ -63,9 +82,12 @@ func DoValidation(cmd *cobra.Command) {
 	ValidateFlagCombinations(cmd.Flags())
 	utils.ValidateFullPath(*backupDir)
 	utils.ValidateFullPath(*pluginConfigFile)
+	utils.ValidateFullPath(*encryptionKeyFile)
+	utils.ValidateFullPath(*dryRunFile)
 	if !utils.IsValidTimestamp(*timestamp) {
 		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", *timestamp), "")
 	}
+	journalFlags = utils.GetJournalFlags(cmd.Flags())
 }
 
 // This function handles setup that must be done after parsing flags.
@@ -87,6 +109,15 @@ func DoSetup() {
 		InitializeBackupConfig()
 	}
 
+	// Verification and listing only read the backup files, so no restore database is needed
+	if *verifyOnly {
+		InitializeFilterLists()
+		return
+	}
+	if *listTOC {
+		return
+	}
+
 	BackupConfigurationValidation()
 	metadataFilename := globalFPInfo.GetMetadataFilePath()
 	if !backupConfig.DataOnly {
@@ -96,11 +127,31 @@ func DoSetup() {
 	if *redirect != "" {
 		restoreDatabase = *redirect
 	}
-	ValidateDatabaseExistence(restoreDatabase, *createDB, backupConfig.IncludeTableFiltered || backupConfig.DataOnly)
+	if *resume {
+		OpenRestoreJournalForResume()
+	}
+	ValidateDatabaseExistence(restoreDatabase, *createDB && !WasDatabaseCreated(), backupConfig.IncludeTableFiltered || backupConfig.DataOnly)
+	if *dryRun {
+		InitializeDryRun(restoreDatabase)
+	} else if !*resume {
+		InitializeRestoreJournal()
+	}
 	if *createDB {
+		if *dryRun {
+			WriteDryRunComment("The following statements are executed in database postgres")
+		}
 		createDatabase(metadataFilename)
 	}
-	InitializeConnection(restoreDatabase)
+	/*
+	 * The restore database is not created by a dry run, so a dry run with
+	 * --create-db stays connected to the postgres database.
+	 */
+	if !*dryRun || !*createDB {
+		InitializeConnection(restoreDatabase)
+	}
+	if *dryRun {
+		WriteDryRunComment("The following statements are executed in database %s", restoreDatabase)
+	}
 
 	if *restoreGlobals {
 		restoreGlobal(metadataFilename)
@@ -109,13 +160,26 @@ func DoSetup() {
 	/*
 	 * We don't need to validate anything if we're creating the database; we
 	 * should not error out for validation reasons once the restore database exists.
+	 * With --clean, existing relations are dropped before they are restored.
 	 */
-	if !*createDB {
-		ValidateFilterRelationsInRestoreDatabase(connectionPool, *includeRelations)
+	if !*createDB && !*clean {
+		restoreRelations := make([]string, len(*includeRelations))
+		for i, relation := range *includeRelations {
+			restoreRelations[i] = getRestoreRelationName(relation)
+		}
+		ValidateFilterRelationsInRestoreDatabase(connectionPool, restoreRelations)
 	}
 }
 
 func DoRestore() {
+	if *verifyOnly {
+		DoVerify()
+		return
+	}
+	if *listTOC {
+		ListTOCEntries()
+		return
+	}
 	gucStatements := setGUCsForConnection(nil, 0)
 	metadataFilename := globalFPInfo.GetMetadataFilePath()
 	isDataOnly := backupConfig.DataOnly || *dataOnly
@@ -125,10 +189,27 @@ func DoRestore() {
 	}
 
 	if !isMetadataOnly {
-		if *pluginConfigFile == "" {
-			backupFileCount := 2 // 1 for the actual data file, 1 for the segment TOC file
-			if !backupConfig.SingleDataFile {
-				backupFileCount = len(globalTOC.DataEntries)
+		if *pluginConfigFile == "" && !IsResizeRestore() {
+			/*
+			 * An incremental backup only contains data files for the tables
+			 * that changed, so we only count the entries for this backup.
+			 */
+			dataEntries := utils.GetDataEntriesForTimestamp(globalTOC.DataEntries, "")
+			backupFileCount := len(dataEntries)
+			if backupConfig.SingleDataFile {
+				// There is one data file for each data stream, plus the segment TOC file
+				backupFileCount = 0
+				for _, streamEntries := range utils.GetDataEntriesByStream(dataEntries) {
+					if len(streamEntries) > 0 {
+						backupFileCount++
+					}
+				}
+				if backupFileCount > 0 {
+					backupFileCount++
+				}
+			} else if len(dataEntries) > 0 && len(dataEntries[0].Checksums) > 0 {
+				// There is one data file for each table, plus the checksum file
+				backupFileCount++
 			}
 			VerifyBackupFileCountOnSegments(backupFileCount)
 		}
@@ -142,6 +223,10 @@ func DoRestore() {
 	if *withStats && backupConfig.WithStatistics {
 		restoreStatistics()
 	}
+
+	if *dryRun {
+		gplog.Info("Dry run complete; nothing was restored")
+	}
 }
 
 func createDatabase(metadataFilename string) {
@@ -175,6 +260,9 @@ func restorePredata(metadataFilename string) {
 
 	schemaStatements := GetRestoreMetadataStatements("predata", metadataFilename, []string{"SCHEMA"}, []string{}, true, false)
 	statements := GetRestoreMetadataStatements("predata", metadataFilename, []string{}, []string{"SCHEMA"}, true, true)
+	if *clean {
+		dropObjects(statements)
+	}
 
 	progressBar := utils.NewProgressBar(len(schemaStatements)+len(statements), "Pre-data objects restored: ", utils.PB_VERBOSE)
 	progressBar.Start()
@@ -192,55 +280,95 @@ func restoreData(gucStatements []utils.StatementWithType) {
 	}
 	gplog.Info("Restoring data")
 	filteredMasterDataEntries := globalTOC.GetDataEntriesMatching(*includeSchemas, *excludeSchemas, *includeRelations, *excludeRelations)
+	filteredMasterDataEntries = FilterRestoredDataEntries(filteredMasterDataEntries)
+	filteredMasterDataEntries = FilterDataEntriesOnConflict(filteredMasterDataEntries)
+	totalTables := len(filteredMasterDataEntries)
+	dataProgressBar := utils.NewProgressBar(totalTables, "Tables restored: ", utils.PB_INFO)
+	dataProgressBar.Start()
+
+	/*
+	 * For an incremental backup, the data for unchanged tables is in the files
+	 * of earlier backups, so we restore the data from each backup in turn.
+	 */
+	if IsResizeRestore() && dryRunWriter == nil {
+		VerifyResizeBackupFilesExistOnAllHosts(globalFPInfo, utils.GetDataEntriesForTimestamp(filteredMasterDataEntries, ""))
+		for _, dataTimestamp := range utils.GetIncrementalTimestamps(filteredMasterDataEntries) {
+			VerifyResizeBackupFilesExistOnAllHosts(GetFPInfoForTimestamp(dataTimestamp), utils.GetDataEntriesForTimestamp(filteredMasterDataEntries, dataTimestamp))
+		}
+	}
+	var tableNum uint32 = 1
+	restoreDataFromTimestamp(globalFPInfo, utils.GetDataEntriesForTimestamp(filteredMasterDataEntries, ""), gucStatements, dataProgressBar, &tableNum, totalTables)
+	for _, dataTimestamp := range utils.GetIncrementalTimestamps(filteredMasterDataEntries) {
+		fpInfo := GetFPInfoForTimestamp(dataTimestamp)
+		gplog.Verbose("Restoring data from incremental base backup %s", dataTimestamp)
+		restoreDataFromTimestamp(fpInfo, utils.GetDataEntriesForTimestamp(filteredMasterDataEntries, dataTimestamp), gucStatements, dataProgressBar, &tableNum, totalTables)
+	}
+
+	dataProgressBar.Finish()
+	gplog.Info("Data restore complete")
+}
+
+func restoreDataFromTimestamp(fpInfo utils.FilePathInfo, dataEntries []utils.MasterDataEntry, gucStatements []utils.StatementWithType, dataProgressBar utils.ProgressBar, tableNum *uint32, totalTables int) {
+	if wasTerminated || len(dataEntries) == 0 {
+		return
+	}
+	// No data is read during a dry run, so gpbackup_helper is not started
+	if dryRunWriter != nil {
+		WriteDryRunData(fpInfo, dataEntries, gucStatements, dataProgressBar)
+		return
+	}
+	// gpbackup_helper reads the data files whether or not there is a single data file
+	utils.VerifyHelperVersionOnSegments(version, globalCluster)
 	if backupConfig.SingleDataFile {
 		gplog.Verbose("Initializing pipes and gpbackup_helper on segments for single data file restore")
-		utils.VerifyHelperVersionOnSegments(version, globalCluster)
-		filteredOids := make([]string, len(filteredMasterDataEntries))
-		for i, entry := range filteredMasterDataEntries {
+		if fpInfo.Timestamp != globalFPInfo.Timestamp && *pluginConfigFile != "" {
+			pluginConfig.RestoreSegmentTOCs(globalCluster, fpInfo)
+		}
+		filteredOids := make([]string, len(dataEntries))
+		for i, entry := range dataEntries {
 			filteredOids[i] = fmt.Sprintf("%d", entry.Oid)
 		}
-		utils.WriteOidListToSegments(filteredOids, globalCluster, globalFPInfo)
-		firstOid := filteredMasterDataEntries[0].Oid
-		utils.CreateFirstSegmentPipeOnAllHosts(firstOid, globalCluster, globalFPInfo)
-		utils.StartAgent(globalCluster, globalFPInfo, "--restore-agent", *pluginConfigFile, "")
+		utils.WriteOidListToSegments(filteredOids, globalCluster, fpInfo)
+		firstOids := make([]uint32, 0)
+		for _, streamEntries := range utils.GetDataEntriesByStream(dataEntries) {
+			if len(streamEntries) > 0 {
+				firstOids = append(firstOids, streamEntries[0].Oid)
+			}
+		}
+		utils.CreateFirstSegmentPipesOnAllHosts(firstOids, globalCluster, fpInfo)
+		helperFlagsStr := ""
+		if *onErrorContinue {
+			helperFlagsStr = " --on-error-continue"
+		}
+		utils.StartAgent(globalCluster, fpInfo, "--restore-agent", *pluginConfigFile, helperFlagsStr)
 	}
 
-	totalTables := len(filteredMasterDataEntries)
-	dataProgressBar := utils.NewProgressBar(totalTables, "Tables restored: ", utils.PB_INFO)
-	dataProgressBar.Start()
-
 	/*
 	 * We break when an interrupt is received and rely on
 	 * TerminateHangingCopySessions to kill any COPY
 	 * statements in progress if they don't finish on their own.
 	 */
-	var tableNum uint32 = 1
-	tasks := make(chan utils.MasterDataEntry, totalTables)
+	tasks := GetRestoreTasks(dataEntries, connectionPool.NumConns)
 	var workerPool sync.WaitGroup
 	for i := 0; i < connectionPool.NumConns; i++ {
 		workerPool.Add(1)
 		go func(whichConn int) {
 			defer workerPool.Done()
 			setGUCsForConnection(gucStatements, whichConn)
-			for entry := range tasks {
+			for entry := range tasks[whichConn] {
 				if wasTerminated {
 					dataProgressBar.(*pb.ProgressBar).NotPrint = true
 					break
 				}
-				restoreSingleTableData(entry, tableNum, totalTables, whichConn)
-				atomic.AddUint32(&tableNum, 1)
+				restoreSingleTableData(fpInfo, entry, atomic.LoadUint32(tableNum), totalTables, whichConn)
+				atomic.AddUint32(tableNum, 1)
 				dataProgressBar.Increment()
 			}
 		}(i)
 	}
-	for _, entry := range filteredMasterDataEntries {
-		tasks <- entry
-	}
-	close(tasks)
 	workerPool.Wait()
 
-	dataProgressBar.Finish()
-	err := CheckAgentErrorsOnSegments()
+	err := CheckAgentErrorsOnSegments(fpInfo)
 	if err != nil {
 		errMsg := "Error restoring data for one or more tables"
 		if *onErrorContinue {
@@ -249,7 +377,9 @@ func restoreData(gucStatements []utils.StatementWithType) {
 			gplog.Fatal(err, errMsg)
 		}
 	}
-	gplog.Info("Data restore complete")
+	if backupConfig.SingleDataFile && fpInfo.Timestamp != globalFPInfo.Timestamp {
+		utils.CleanUpHelperFilesOnAllHosts(globalCluster, fpInfo)
+	}
 }
 
 func restorePostdata(metadataFilename string) {
@@ -300,9 +430,21 @@ func DoTeardown() {
 	errorCode := gplog.GetErrorCode()
 
 	if globalFPInfo.Timestamp != "" {
-		reportFilename := globalFPInfo.GetRestoreReportFilePath(restoreStartTime)
-		utils.WriteRestoreReportFile(reportFilename, globalFPInfo.Timestamp, restoreStartTime, connectionPool, version, errMsg)
-		utils.EmailReport(globalCluster, globalFPInfo.Timestamp, reportFilename, "gprestore")
+		if !*verifyOnly && !*dryRun && !*listTOC {
+			reportFilename := globalFPInfo.GetRestoreReportFilePath(restoreStartTime)
+			utils.WriteRestoreReportFile(reportFilename, globalFPInfo.Timestamp, restoreStartTime, connectionPool, version, errMsg, resumeSummary)
+			utils.EmailReport(globalCluster, globalFPInfo.Timestamp, reportFilename, "gprestore")
+		}
+		if restoreJournal != nil {
+			_ = restoreJournal.Close()
+			// The journal is kept after any error so that the restore can be resumed
+			if errMsg == "" && errorCode == 0 && !*dryRun {
+				_ = os.Remove(globalFPInfo.GetRestoreJournalFilePath())
+			}
+		}
+		if dryRunWriter != nil && dryRunWriter != os.Stdout {
+			_ = dryRunWriter.Close()
+		}
 		if pluginConfig != nil {
 			pluginConfig.CleanupPluginForRestoreOnAllHosts(globalCluster, pluginConfig.ConfigPath, globalFPInfo.GetDirForContent(-1))
 		}
@@ -322,11 +464,20 @@ func DoCleanup() {
 		CleanupGroup.Done()
 	}()
 	gplog.Verbose("Beginning cleanup")
-	if backupConfig != nil && backupConfig.SingleDataFile {
-		utils.CleanUpSegmentHelperProcesses(globalCluster, globalFPInfo, "restore")
-		utils.CleanUpHelperFilesOnAllHosts(globalCluster, globalFPInfo)
-		if wasTerminated { // These should all end on their own in a successful restore
-			utils.TerminateHangingCopySessions(connectionPool, globalFPInfo, "gprestore")
+	// A dry run or listing starts no helpers, and must not stop those of a restore of the same backup
+	if backupConfig != nil && backupConfig.SingleDataFile && !*dryRun && !*listTOC {
+		fpInfos := []utils.FilePathInfo{globalFPInfo}
+		if globalTOC != nil {
+			for _, dataTimestamp := range utils.GetIncrementalTimestamps(globalTOC.DataEntries) {
+				fpInfos = append(fpInfos, GetFPInfoForTimestamp(dataTimestamp))
+			}
+		}
+		for _, fpInfo := range fpInfos {
+			utils.CleanUpSegmentHelperProcesses(globalCluster, fpInfo, "restore")
+			utils.CleanUpHelperFilesOnAllHosts(globalCluster, fpInfo)
+			if wasTerminated { // These should all end on their own in a successful restore
+				utils.TerminateHangingCopySessions(connectionPool, fpInfo, "gprestore")
+			}
 		}
 	}
 	if connectionPool != nil {
@@ -0,0 +1,111 @@
+package restore
+
+/*
+ * This file contains functions related to the restore journal and to
+ * gprestore --resume, which continues a restore that failed or was canceled
+ * instead of restoring into a fresh database.
+ */
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * A new restore replaces the journal of any earlier restore of the same
+ * backup, so it is only created once the restore database has been validated.
+ */
+func InitializeRestoreJournal() {
+	journalFilename := globalFPInfo.GetRestoreJournalFilePath()
+	header := utils.RestoreJournalHeader{CommandLine: strings.Join(os.Args, " "), Flags: journalFlags}
+	gplog.Verbose("Recording restored objects and tables in journal %s", journalFilename)
+	journal, err := utils.NewRestoreJournal(journalFilename, header)
+	if err != nil {
+		gplog.Fatal(err, "Unable to create restore journal %s", journalFilename)
+	}
+	restoreJournal = journal
+}
+
+func OpenRestoreJournalForResume() {
+	journalFilename := globalFPInfo.GetRestoreJournalFilePath()
+	if !iohelper.FileExistsAndIsReadable(journalFilename) {
+		gplog.Fatal(errors.Errorf("Journal file %s does not exist, so there is no restore of backup %s to resume.", journalFilename, globalFPInfo.Timestamp), "")
+	}
+	journal, err := utils.OpenRestoreJournal(journalFilename)
+	if err != nil {
+		gplog.Fatal(err, "Unable to read restore journal %s", journalFilename)
+	}
+	ValidateResumeFlags(journal.Header, journalFlags)
+	restoreJournal = journal
+	resumeSummary = fmt.Sprintf("%d metadata statement(s) and %d table(s) restored before gprestore was interrupted", len(journal.Statements), len(journal.DataEntries))
+	gplog.Info("Resuming restore; skipping %s", resumeSummary)
+}
+
+func ValidateResumeFlags(header utils.RestoreJournalHeader, currentFlags map[string]string) {
+	if !reflect.DeepEqual(header.Flags, currentFlags) {
+		gplog.Fatal(errors.Errorf("The restore must be resumed with the flags it was started with.  It was started with the command: %s", header.CommandLine), "")
+	}
+}
+
+// A restore with --create-db that is resumed after creating the database must not create it again
+func WasDatabaseCreated() bool {
+	if restoreJournal == nil {
+		return false
+	}
+	for _, entry := range restoreJournal.Statements {
+		if entry.ObjectType == "DATABASE" {
+			return true
+		}
+	}
+	return false
+}
+
+// Session GUCs must be set on every new connection, so they are never skipped.
+func isStatementJournaled(statement utils.StatementWithType) bool {
+	return restoreJournal != nil && statement.ObjectType != "SESSION GUCS"
+}
+
+func WasStatementRestored(statement utils.StatementWithType) bool {
+	return isStatementJournaled(statement) && restoreJournal.HasStatement(statement)
+}
+
+func AddStatementToJournal(statement utils.StatementWithType) {
+	if !isStatementJournaled(statement) {
+		return
+	}
+	err := restoreJournal.AddStatement(statement)
+	if err != nil {
+		gplog.Fatal(err, "Unable to write to restore journal %s", globalFPInfo.GetRestoreJournalFilePath())
+	}
+}
+
+func FilterRestoredDataEntries(dataEntries []utils.MasterDataEntry) []utils.MasterDataEntry {
+	if restoreJournal == nil {
+		return dataEntries
+	}
+	filteredEntries := make([]utils.MasterDataEntry, 0)
+	for _, entry := range dataEntries {
+		if !restoreJournal.HasDataEntry(entry.Oid) {
+			filteredEntries = append(filteredEntries, entry)
+		}
+	}
+	return filteredEntries
+}
+
+// Data loaded by a successful COPY has been committed, even if the row count is wrong.
+func AddDataEntryToJournal(entry utils.MasterDataEntry, rowsRestored int64) {
+	if restoreJournal == nil {
+		return
+	}
+	err := restoreJournal.AddDataEntry(entry, rowsRestored)
+	if err != nil {
+		gplog.Fatal(err, "Unable to write to restore journal %s", globalFPInfo.GetRestoreJournalFilePath())
+	}
+}
@@ -0,0 +1,67 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/resume tests", func() {
+	createDatabase := utils.StatementWithType{ObjectType: "DATABASE", Name: "testdb", Statement: "CREATE DATABASE testdb;"}
+	createTable := utils.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "CREATE TABLE public.foo (i int);"}
+	sessionGUCs := utils.StatementWithType{ObjectType: "SESSION GUCS", Statement: "SET client_encoding = 'UTF8';"}
+	fooEntry := utils.MasterDataEntry{Schema: "public", Name: "foo", Oid: 1, AttributeString: "(i)"}
+	barEntry := utils.MasterDataEntry{Schema: "public", Name: "bar", Oid: 2, AttributeString: "(j)"}
+	AfterEach(func() {
+		restore.SetRestoreJournal(nil)
+	})
+	Describe("ValidateResumeFlags", func() {
+		header := utils.RestoreJournalHeader{CommandLine: "gprestore --timestamp 20170101010101 --jobs 2", Flags: map[string]string{"timestamp": "20170101010101", "jobs": "2"}}
+		It("passes if the flags are the same as those the restore was started with", func() {
+			restore.ValidateResumeFlags(header, map[string]string{"timestamp": "20170101010101", "jobs": "2"})
+		})
+		It("panics if a flag has a different value", func() {
+			defer testhelper.ShouldPanicWithMessage("The restore must be resumed with the flags it was started with.  It was started with the command: gprestore --timestamp 20170101010101 --jobs 2")
+			restore.ValidateResumeFlags(header, map[string]string{"timestamp": "20170101010101", "jobs": "4"})
+		})
+	})
+	Describe("journal lookups", func() {
+		var journal *utils.RestoreJournal
+		BeforeEach(func() {
+			journal = &utils.RestoreJournal{
+				Statements:  map[string]utils.RestoreJournalEntry{},
+				DataEntries: map[uint32]utils.RestoreJournalEntry{},
+			}
+		})
+		It("does nothing when there is no journal", func() {
+			Expect(restore.WasDatabaseCreated()).To(BeFalse())
+			Expect(restore.WasStatementRestored(createTable)).To(BeFalse())
+			Expect(restore.FilterRestoredDataEntries([]utils.MasterDataEntry{fooEntry, barEntry})).To(Equal([]utils.MasterDataEntry{fooEntry, barEntry}))
+		})
+		It("reports whether the database was created", func() {
+			restore.SetRestoreJournal(journal)
+			Expect(restore.WasDatabaseCreated()).To(BeFalse())
+			journal.Statements[utils.GetStatementChecksum(createDatabase)] = utils.RestoreJournalEntry{Type: utils.RESTORE_JOURNAL_STATEMENT, ObjectType: "DATABASE"}
+			Expect(restore.WasDatabaseCreated()).To(BeTrue())
+		})
+		It("skips statements that were restored", func() {
+			journal.Statements[utils.GetStatementChecksum(createTable)] = utils.RestoreJournalEntry{Type: utils.RESTORE_JOURNAL_STATEMENT, ObjectType: "TABLE"}
+			restore.SetRestoreJournal(journal)
+			Expect(restore.WasStatementRestored(createTable)).To(BeTrue())
+			Expect(restore.WasStatementRestored(createDatabase)).To(BeFalse())
+		})
+		It("never skips session GUCs", func() {
+			journal.Statements[utils.GetStatementChecksum(sessionGUCs)] = utils.RestoreJournalEntry{Type: utils.RESTORE_JOURNAL_STATEMENT, ObjectType: "SESSION GUCS"}
+			restore.SetRestoreJournal(journal)
+			Expect(restore.WasStatementRestored(sessionGUCs)).To(BeFalse())
+		})
+		It("filters out tables whose data was restored", func() {
+			journal.DataEntries[2] = utils.RestoreJournalEntry{Type: utils.RESTORE_JOURNAL_DATA, Oid: 2, RowsRestored: 10}
+			restore.SetRestoreJournal(journal)
+			Expect(restore.FilterRestoredDataEntries([]utils.MasterDataEntry{fooEntry, barEntry})).To(Equal([]utils.MasterDataEntry{fooEntry}))
+		})
+	})
+})
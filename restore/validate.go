@@ -2,6 +2,8 @@ package restore
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -19,6 +21,12 @@ import (
 func validateFilterListsInBackupSet() {
 	ValidateFilterSchemasInBackupSet(*includeSchemas)
 	ValidateFilterRelationsInBackupSet(*includeRelations)
+	redirectedSchemas := make([]string, 0, len(redirectSchemaMap))
+	for oldSchema := range redirectSchemaMap {
+		redirectedSchemas = append(redirectedSchemas, oldSchema)
+	}
+	sort.Strings(redirectedSchemas)
+	ValidateFilterSchemasInBackupSet(redirectedSchemas)
 }
 
 func ValidateFilterSchemasInBackupSet(schemaList []string) {
@@ -59,6 +67,109 @@ func ValidateFilterSchemasInBackupSet(schemaList []string) {
 	gplog.Fatal(errors.Errorf("Could not find the following schema(s) in the backup set: %s", strings.Join(keys, ", ")), "")
 }
 
+/*
+ * Each schema must be quoted as it would be in SQL, as for --include-schema,
+ * so that the new schema can be used in the restored statements as is.
+ */
+func ParseRedirectSchemas(redirects []string) map[string]string {
+	schemaMap := make(map[string]string, len(redirects))
+	for _, redirect := range redirects {
+		schemas := strings.SplitN(redirect, "=", 2)
+		if len(schemas) != 2 || !utils.IsValidIdentifier(schemas[0]) || !utils.IsValidIdentifier(schemas[1]) {
+			gplog.Fatal(errors.Errorf("Schema redirection %s is invalid.  Each redirection must be in the format oldschema=newschema, with each schema quoted as it would be in SQL.", redirect), "")
+		}
+		if schemas[0] == schemas[1] {
+			gplog.Fatal(errors.Errorf("Schema %s cannot be redirected to itself", schemas[0]), "")
+		}
+		if _, ok := schemaMap[schemas[0]]; ok {
+			gplog.Fatal(errors.Errorf("Schema %s cannot be redirected more than once", schemas[0]), "")
+		}
+		schemaMap[schemas[0]] = schemas[1]
+	}
+	return schemaMap
+}
+
+func ParseRoleMap(mappings []string) map[string]string {
+	roleMap := make(map[string]string, len(mappings))
+	for _, mapping := range mappings {
+		roles := strings.SplitN(mapping, "=", 2)
+		if len(roles) != 2 || !utils.IsValidIdentifier(roles[0]) || !utils.IsValidIdentifier(roles[1]) {
+			gplog.Fatal(errors.Errorf("Role mapping %s is invalid.  Each mapping must be in the format oldrole=newrole, with each role quoted as it would be in SQL.", mapping), "")
+		}
+		if roles[0] == roles[1] {
+			gplog.Fatal(errors.Errorf("Role %s cannot be mapped to itself", roles[0]), "")
+		}
+		if _, ok := roleMap[roles[0]]; ok {
+			gplog.Fatal(errors.Errorf("Role %s cannot be mapped more than once", roles[0]), "")
+		}
+		roleMap[roles[0]] = roles[1]
+	}
+	return roleMap
+}
+
+/*
+ * Each tablespace may be mapped to a location as well as a new name; see
+ * utils.TablespaceMapping.  Identifiers cannot contain a colon unless they are
+ * quoted, so the first colon after an identifier begins the location.
+ */
+func ParseTablespaceMap(mappings []string) map[string]utils.TablespaceMapping {
+	mappingPattern := regexp.MustCompile(fmt.Sprintf(`^(%s)=(%s)(?::(.+))?$`, utils.IdentifierPattern, utils.IdentifierPattern))
+	tablespaceMapping := make(map[string]utils.TablespaceMapping, len(mappings))
+	for _, mapping := range mappings {
+		matches := mappingPattern.FindStringSubmatch(mapping)
+		if len(matches) == 0 {
+			gplog.Fatal(errors.Errorf("Tablespace mapping %s is invalid.  Each mapping must be in the format oldtablespace=newtablespace or oldtablespace=newtablespace:location, with each tablespace quoted as it would be in SQL.", mapping), "")
+		}
+		if matches[1] == matches[2] && matches[3] == "" {
+			gplog.Fatal(errors.Errorf("Tablespace %s cannot be mapped to itself without a location", matches[1]), "")
+		}
+		if _, ok := tablespaceMapping[matches[1]]; ok {
+			gplog.Fatal(errors.Errorf("Tablespace %s cannot be mapped more than once", matches[1]), "")
+		}
+		tablespaceMapping[matches[1]] = utils.TablespaceMapping{Tablespace: matches[2], Location: matches[3]}
+	}
+	return tablespaceMapping
+}
+
+/*
+ * Each relation to restore is renamed to the new name in the same position, so
+ * that --rename-to can be used with either --include-table or
+ * --include-table-file.  Renaming a relation into a different schema would
+ * leave its indexes and constraints in the original schema.
+ */
+func ParseRenamedRelations(relations []string, newNames []string) map[string]string {
+	renameMap := make(map[string]string, len(newNames))
+	if len(newNames) == 0 {
+		return renameMap
+	}
+	if len(newNames) != len(relations) {
+		gplog.Fatal(errors.Errorf("%d relation(s) to restore and %d new name(s) were specified.  --rename-to must be specified once for each relation to restore.", len(relations), len(newNames)), "")
+	}
+	utils.ValidateFQNs(relations)
+	utils.ValidateFQNs(newNames)
+	renamedTo := make(map[string]string, len(newNames))
+	for i, relation := range relations {
+		newName := newNames[i]
+		oldSchema, _ := utils.SplitFQN(relation)
+		newSchema, _ := utils.SplitFQN(newName)
+		if oldSchema != newSchema {
+			gplog.Fatal(errors.Errorf("Relation %s cannot be renamed to %s in a different schema.  Use --redirect-schema to restore to a different schema.", relation, newName), "")
+		}
+		if relation == newName {
+			gplog.Fatal(errors.Errorf("Relation %s cannot be renamed to itself", relation), "")
+		}
+		if _, ok := renameMap[relation]; ok {
+			gplog.Fatal(errors.Errorf("Relation %s cannot be renamed more than once", relation), "")
+		}
+		if otherRelation, ok := renamedTo[newName]; ok {
+			gplog.Fatal(errors.Errorf("Relations %s and %s cannot both be renamed to %s", otherRelation, relation, newName), "")
+		}
+		renameMap[relation] = newName
+		renamedTo[newName] = relation
+	}
+	return renameMap
+}
+
 func ValidateFilterRelationsInRestoreDatabase(connection *dbconn.DBConn, relationList []string) {
 	if len(relationList) > 0 {
 		utils.ValidateFQNs(relationList)
@@ -138,18 +249,19 @@ END AS string;`, dbname)))
 }
 
 func ValidateBackupFlagCombinations() {
-	if backupConfig.SingleDataFile && *numJobs != 1 {
-		gplog.Fatal(errors.Errorf("Cannot use jobs flag when restoring backups with a single data file per segment."), "")
-	}
 	if (backupConfig.IncludeTableFiltered || backupConfig.DataOnly) && *restoreGlobals {
 		gplog.Fatal(errors.Errorf("Global metadata is not backed up in table-filtered or data-only backups."), "")
 	}
+	if backupConfig.GlobalsOnly && !*restoreGlobals {
+		gplog.Fatal(errors.Errorf("Backup contains only global metadata.  Use the with-globals flag to restore it."), "")
+	}
 	if backupConfig.MetadataOnly && *dataOnly {
 		gplog.Fatal(errors.Errorf("Cannot use data-only flag when restoring metadata-only backup"), "")
 	}
 	if backupConfig.DataOnly && *metadataOnly {
 		gplog.Fatal(errors.Errorf("Cannot use metadata-only flag when restoring data-only backup"), "")
 	}
+	ValidateDataRestoreIntoExistingTables()
 	validateBackupFlagPluginCombinations()
 }
 
@@ -164,10 +276,50 @@ func validateBackupFlagPluginCombinations() {
 func ValidateFlagCombinations(flags *pflag.FlagSet) {
 	utils.CheckExclusiveFlags(flags, "data-only", "with-globals")
 	utils.CheckExclusiveFlags(flags, "data-only", "create-db")
+	utils.CheckExclusiveFlags(flags, "clean", "create-db", "data-only")
 	utils.CheckExclusiveFlags(flags, "debug", "quiet", "verbose")
 	utils.CheckExclusiveFlags(flags, "include-schema", "include-table", "include-table-file")
 	utils.CheckExclusiveFlags(flags, "exclude-schema", "include-schema")
 	utils.CheckExclusiveFlags(flags, "exclude-schema", "exclude-table", "include-table", "exclude-table-file", "include-table-file")
 	utils.CheckExclusiveFlags(flags, "exclude-table", "exclude-table-file", "leaf-partition-data")
 	utils.CheckExclusiveFlags(flags, "metadata-only", "data-only")
+	utils.CheckExclusiveFlags(flags, "no-tablespaces", "tablespace-map")
+	utils.CheckExclusiveFlags(flags, "metadata-only", "on-conflict", "truncate-table")
+	utils.CheckExclusiveFlags(flags, "on-conflict", "truncate-table")
+	utils.CheckExclusiveFlags(flags, "verify-only", "clean")
+	utils.CheckExclusiveFlags(flags, "verify-only", "create-db")
+	utils.CheckExclusiveFlags(flags, "verify-only", "dry-run")
+	utils.CheckExclusiveFlags(flags, "verify-only", "data-only")
+	utils.CheckExclusiveFlags(flags, "verify-only", "metadata-only")
+	utils.CheckExclusiveFlags(flags, "verify-only", "no-owner")
+	utils.CheckExclusiveFlags(flags, "verify-only", "no-privileges")
+	utils.CheckExclusiveFlags(flags, "verify-only", "no-tablespaces")
+	utils.CheckExclusiveFlags(flags, "verify-only", "on-conflict")
+	utils.CheckExclusiveFlags(flags, "verify-only", "plugin-config")
+	utils.CheckExclusiveFlags(flags, "verify-only", "redirect-db")
+	utils.CheckExclusiveFlags(flags, "verify-only", "redirect-schema")
+	utils.CheckExclusiveFlags(flags, "verify-only", "rename-to")
+	utils.CheckExclusiveFlags(flags, "verify-only", "resize-cluster")
+	utils.CheckExclusiveFlags(flags, "verify-only", "resume")
+	utils.CheckExclusiveFlags(flags, "verify-only", "role-map")
+	utils.CheckExclusiveFlags(flags, "verify-only", "tablespace-map")
+	utils.CheckExclusiveFlags(flags, "verify-only", "truncate-table")
+	utils.CheckExclusiveFlags(flags, "verify-only", "with-globals")
+	utils.CheckExclusiveFlags(flags, "verify-only", "with-stats")
+	for _, flagName := range []string{"clean", "create-db", "data-only", "dry-run", "metadata-only", "no-owner", "no-privileges", "no-tablespaces", "on-conflict", "redirect-schema", "rename-to", "resume", "role-map", "tablespace-map", "truncate-table", "use-list", "verify-only", "with-globals", "with-stats"} {
+		utils.CheckExclusiveFlags(flags, "list", flagName)
+	}
+	for _, flagName := range []string{"exclude-schema", "exclude-table", "exclude-table-file", "include-schema", "include-table", "include-table-file", "verify-only"} {
+		utils.CheckExclusiveFlags(flags, "use-list", flagName)
+	}
+	if flags.Changed("rename-to") && !flags.Changed("include-table") && !flags.Changed("include-table-file") {
+		gplog.Fatal(errors.Errorf("--include-table or --include-table-file must be specified with --rename-to"), "")
+	}
+	if flags.Changed("if-exists") && !flags.Changed("clean") {
+		gplog.Fatal(errors.Errorf("--clean must be specified with --if-exists"), "")
+	}
+	ValidateOnConflictPolicy(*onConflict)
+	if flags.Changed("dry-run-file") && !flags.Changed("dry-run") {
+		gplog.Fatal(errors.Errorf("--dry-run must be specified with --dry-run-file"), "")
+	}
 }
@@ -8,6 +8,7 @@ import (
 	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("restore/validate tests", func() {
@@ -59,6 +60,101 @@ var _ = Describe("restore/validate tests", func() {
 			restore.ValidateFilterSchemasInBackupSet(filterList)
 		})
 	})
+	Describe("ParseRedirectSchemas", func() {
+		It("parses each redirection into a map from the old schema to the new schema", func() {
+			schemaMap := restore.ParseRedirectSchemas([]string{"schema1=newschema", `"Schema 2"="New=Schema"`})
+			Expect(schemaMap).To(Equal(map[string]string{"schema1": "newschema", `"Schema 2"`: `"New=Schema"`}))
+		})
+		It("panics if a redirection is not in the format oldschema=newschema", func() {
+			defer testhelper.ShouldPanicWithMessage("Schema redirection schema1 is invalid.  Each redirection must be in the format oldschema=newschema, with each schema quoted as it would be in SQL.")
+			restore.ParseRedirectSchemas([]string{"schema1"})
+		})
+		It("panics if a schema is not quoted as it would be in SQL", func() {
+			defer testhelper.ShouldPanicWithMessage("Schema redirection schema1=New Schema is invalid.  Each redirection must be in the format oldschema=newschema, with each schema quoted as it would be in SQL.")
+			restore.ParseRedirectSchemas([]string{"schema1=New Schema"})
+		})
+		It("panics if a schema is redirected to itself", func() {
+			defer testhelper.ShouldPanicWithMessage("Schema schema1 cannot be redirected to itself")
+			restore.ParseRedirectSchemas([]string{"schema1=schema1"})
+		})
+		It("panics if a schema is redirected more than once", func() {
+			defer testhelper.ShouldPanicWithMessage("Schema schema1 cannot be redirected more than once")
+			restore.ParseRedirectSchemas([]string{"schema1=schema2", "schema1=schema3"})
+		})
+	})
+	Describe("ParseRoleMap", func() {
+		It("parses each mapping into a map from the old role to the new role", func() {
+			roleMap := restore.ParseRoleMap([]string{"prod_owner=dev_owner", `"Prod Readers"="Dev=Readers"`})
+			Expect(roleMap).To(Equal(map[string]string{"prod_owner": "dev_owner", `"Prod Readers"`: `"Dev=Readers"`}))
+		})
+		It("panics if a role is not quoted as it would be in SQL", func() {
+			defer testhelper.ShouldPanicWithMessage("Role mapping prod_owner=Dev Owner is invalid.  Each mapping must be in the format oldrole=newrole, with each role quoted as it would be in SQL.")
+			restore.ParseRoleMap([]string{"prod_owner=Dev Owner"})
+		})
+		It("panics if a role is mapped to itself", func() {
+			defer testhelper.ShouldPanicWithMessage("Role prod_owner cannot be mapped to itself")
+			restore.ParseRoleMap([]string{"prod_owner=prod_owner"})
+		})
+		It("panics if a role is mapped more than once", func() {
+			defer testhelper.ShouldPanicWithMessage("Role prod_owner cannot be mapped more than once")
+			restore.ParseRoleMap([]string{"prod_owner=dev_owner", "prod_owner=test_owner"})
+		})
+	})
+	Describe("ParseTablespaceMap", func() {
+		It("parses each mapping into a map from the old tablespace to the new tablespace and its location", func() {
+			tablespaceMap := restore.ParseTablespaceMap([]string{"ts1=newts", `"Tablespace 2"="New:Tablespace":/data/new:tablespace`, "ts3=ts3:new_filespace"})
+			Expect(tablespaceMap).To(Equal(map[string]utils.TablespaceMapping{
+				"ts1":            {Tablespace: "newts"},
+				`"Tablespace 2"`: {Tablespace: `"New:Tablespace"`, Location: "/data/new:tablespace"},
+				"ts3":            {Tablespace: "ts3", Location: "new_filespace"},
+			}))
+		})
+		It("panics if a mapping is not in the format oldtablespace=newtablespace", func() {
+			defer testhelper.ShouldPanicWithMessage("Tablespace mapping ts1 is invalid.  Each mapping must be in the format oldtablespace=newtablespace or oldtablespace=newtablespace:location, with each tablespace quoted as it would be in SQL.")
+			restore.ParseTablespaceMap([]string{"ts1"})
+		})
+		It("panics if a tablespace is not quoted as it would be in SQL", func() {
+			defer testhelper.ShouldPanicWithMessage("Tablespace mapping ts1=New Tablespace is invalid.")
+			restore.ParseTablespaceMap([]string{"ts1=New Tablespace"})
+		})
+		It("panics if a tablespace is mapped to itself without a location", func() {
+			defer testhelper.ShouldPanicWithMessage("Tablespace ts1 cannot be mapped to itself without a location")
+			restore.ParseTablespaceMap([]string{"ts1=ts1"})
+		})
+		It("panics if a tablespace is mapped more than once", func() {
+			defer testhelper.ShouldPanicWithMessage("Tablespace ts1 cannot be mapped more than once")
+			restore.ParseTablespaceMap([]string{"ts1=ts2", "ts1=ts3"})
+		})
+	})
+	Describe("ParseRenamedRelations", func() {
+		It("maps each relation to the new name in the same position", func() {
+			renameMap := restore.ParseRenamedRelations([]string{"public.foo", `"Schema".bar`}, []string{"public.foo_restored", `"Schema"."Bar Restored"`})
+			Expect(renameMap).To(Equal(map[string]string{"public.foo": "public.foo_restored", `"Schema".bar`: `"Schema"."Bar Restored"`}))
+		})
+		It("returns an empty map if no relations are renamed", func() {
+			Expect(restore.ParseRenamedRelations([]string{"public.foo"}, []string{})).To(BeEmpty())
+		})
+		It("panics if the number of new names does not match the number of relations", func() {
+			defer testhelper.ShouldPanicWithMessage("2 relation(s) to restore and 1 new name(s) were specified.  --rename-to must be specified once for each relation to restore.")
+			restore.ParseRenamedRelations([]string{"public.foo", "public.bar"}, []string{"public.foo_restored"})
+		})
+		It("panics if a relation is renamed into a different schema", func() {
+			defer testhelper.ShouldPanicWithMessage("Relation public.foo cannot be renamed to other.foo in a different schema.  Use --redirect-schema to restore to a different schema.")
+			restore.ParseRenamedRelations([]string{"public.foo"}, []string{"other.foo"})
+		})
+		It("panics if a relation is renamed to itself", func() {
+			defer testhelper.ShouldPanicWithMessage("Relation public.foo cannot be renamed to itself")
+			restore.ParseRenamedRelations([]string{"public.foo"}, []string{"public.foo"})
+		})
+		It("panics if a relation is renamed more than once", func() {
+			defer testhelper.ShouldPanicWithMessage("Relation public.foo cannot be renamed more than once")
+			restore.ParseRenamedRelations([]string{"public.foo", "public.foo"}, []string{"public.foo1", "public.foo2"})
+		})
+		It("panics if two relations are renamed to the same name", func() {
+			defer testhelper.ShouldPanicWithMessage("Relations public.foo and public.bar cannot both be renamed to public.baz")
+			restore.ParseRenamedRelations([]string{"public.foo", "public.bar"}, []string{"public.baz", "public.baz"})
+		})
+	})
 	Describe("ValidateFilterRelationsInRestoreDatabase", func() {
 		It("passes if there are no filter relations", func() {
 			restore.ValidateFilterRelationsInRestoreDatabase(connection, filterList)
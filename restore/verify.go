@@ -0,0 +1,237 @@
+package restore
+
+/*
+ * This file contains functions for gprestore --verify-only, which checks that
+ * the files of a backup set are intact without restoring anything.
+ */
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+type VerificationResult struct {
+	ContentID int
+	Hostname  string
+	Errors    []string
+}
+
+func DoVerify() {
+	gplog.Info("Verifying backup files")
+	masterResult := VerificationResult{ContentID: -1, Hostname: globalCluster.GetHostForContent(-1)}
+	masterResult.Errors = VerifyMetadataFiles()
+	segmentResults := make(map[int]*VerificationResult, 0)
+	for _, contentID := range globalCluster.ContentIDs {
+		if contentID != -1 {
+			segmentResults[contentID] = &VerificationResult{ContentID: contentID, Hostname: globalCluster.GetHostForContent(contentID)}
+		}
+	}
+
+	if globalTOC != nil && !backupConfig.MetadataOnly {
+		utils.VerifyHelperVersionOnSegments(version, globalCluster)
+		dataEntries := globalTOC.GetDataEntriesMatching(*includeSchemas, *excludeSchemas, *includeRelations, *excludeRelations)
+		rowCounts := make(map[uint32]int64, len(dataEntries))
+		failedOids := make(map[uint32]bool, 0)
+		/*
+		 * For an incremental backup, the data files for unchanged tables are in
+		 * the directories of earlier backups, so we verify those as well.
+		 */
+		dataTimestamps := append([]string{""}, utils.GetIncrementalTimestamps(dataEntries)...)
+		for _, dataTimestamp := range dataTimestamps {
+			fpInfo := globalFPInfo
+			if dataTimestamp != "" {
+				fpInfo = GetFPInfoForTimestamp(dataTimestamp)
+			}
+			timestampEntries := utils.GetDataEntriesForTimestamp(dataEntries, dataTimestamp)
+			if len(timestampEntries) == 0 {
+				continue
+			}
+			verifications, agentErrors := VerifyDataFilesOnAllHosts(fpInfo, timestampEntries)
+			for contentID, result := range segmentResults {
+				if agentError, ok := agentErrors[contentID]; ok {
+					result.Errors = append(result.Errors, agentError)
+				}
+				segmentRowCounts, errMsgs := CheckDataFileVerifications(contentID, timestampEntries, verifications[contentID])
+				result.Errors = append(result.Errors, errMsgs...)
+				for _, entry := range timestampEntries {
+					if rows, ok := segmentRowCounts[entry.Oid]; ok {
+						rowCounts[entry.Oid] += rows
+					} else {
+						failedOids[entry.Oid] = true
+					}
+				}
+			}
+		}
+		for oid := range failedOids {
+			delete(rowCounts, oid)
+		}
+		masterResult.Errors = append(masterResult.Errors, CompareRowCounts(dataEntries, rowCounts)...)
+	}
+
+	results := []VerificationResult{masterResult}
+	for _, contentID := range globalCluster.ContentIDs {
+		if contentID != -1 {
+			results = append(results, *segmentResults[contentID])
+		}
+	}
+	numFailed := 0
+	for _, result := range results {
+		for _, errMsg := range result.Errors {
+			gplog.Error("%s: %s", getSegmentDescription(result), errMsg)
+		}
+		if len(result.Errors) > 0 {
+			numFailed++
+		}
+	}
+
+	reportFilename := globalFPInfo.GetVerifyReportFilePath(restoreStartTime)
+	reportFile := iohelper.MustOpenFileForWriting(reportFilename)
+	WriteVerificationReport(reportFile, globalFPInfo.Timestamp, results)
+	err := reportFile.Close()
+	gplog.FatalOnError(err)
+	gplog.Info("Verification report written to %s", reportFilename)
+	if numFailed > 0 {
+		gplog.Fatal(errors.Errorf("Backup verification failed for %d of %d host(s) and segment(s).  See %s for details.", numFailed, len(results), reportFilename), "")
+	}
+	gplog.Info("Backup verification complete")
+}
+
+func getSegmentDescription(result VerificationResult) string {
+	if result.ContentID == -1 {
+		return fmt.Sprintf("Master on host %s", result.Hostname)
+	}
+	return fmt.Sprintf("Segment %d on host %s", result.ContentID, result.Hostname)
+}
+
+/*
+ * The master checks cover the metadata files and the table of contents,
+ * which is also loaded here as gprestore --verify-only skips the usual
+ * backup configuration validation.
+ */
+func VerifyMetadataFiles() []string {
+	errMsgs := make([]string, 0)
+	filetypes := []string{"config", "table of contents", "metadata"}
+	if backupConfig.WithStatistics {
+		filetypes = append(filetypes, "statistics")
+	}
+	for _, filetype := range filetypes {
+		filename := globalFPInfo.GetBackupFilePath(filetype)
+		if !iohelper.FileExistsAndIsReadable(filename) {
+			errMsgs = append(errMsgs, fmt.Sprintf("Cannot access %s file %s", filetype, filename))
+		}
+	}
+	if len(errMsgs) > 0 {
+		return errMsgs
+	}
+	errMsgs = append(errMsgs, GetMetadataFileChecksumErrors(backupConfig.WithStatistics)...)
+
+	globalTOC = utils.NewTOC(globalFPInfo.GetTOCFilePath())
+	globalTOC.InitializeEntryMap()
+	metadataFilename := globalFPInfo.GetMetadataFilePath()
+	metadataFileSize := getFileSize(metadataFilename)
+	errMsgs = append(errMsgs, CheckMetadataEntryRanges("global", globalTOC.GlobalEntries, metadataFilename, metadataFileSize)...)
+	errMsgs = append(errMsgs, CheckMetadataEntryRanges("predata", globalTOC.PredataEntries, metadataFilename, metadataFileSize)...)
+	errMsgs = append(errMsgs, CheckMetadataEntryRanges("postdata", globalTOC.PostdataEntries, metadataFilename, metadataFileSize)...)
+	if backupConfig.WithStatistics {
+		statisticsFilename := globalFPInfo.GetStatisticsFilePath()
+		errMsgs = append(errMsgs, CheckMetadataEntryRanges("statistics", globalTOC.StatisticsEntries, statisticsFilename, getFileSize(statisticsFilename))...)
+	}
+	return errMsgs
+}
+
+// The TOC byte offsets refer to the plaintext of an encrypted file.
+func getFileSize(filename string) uint64 {
+	_, size := utils.MustOpenMetadataFileForReading(filename)
+	return uint64(size)
+}
+
+func CheckMetadataEntryRanges(section string, entries []utils.MetadataEntry, filename string, fileSize uint64) []string {
+	errMsgs := make([]string, 0)
+	for _, entry := range entries {
+		if entry.StartByte > entry.EndByte || entry.EndByte > fileSize {
+			errMsgs = append(errMsgs, fmt.Sprintf("Byte range %d-%d of %s %s in the %s section is outside of file %s, which is %d bytes",
+				entry.StartByte, entry.EndByte, entry.ObjectType, utils.MakeFQN(entry.Schema, entry.Name), section, filename, fileSize))
+		}
+	}
+	return errMsgs
+}
+
+/*
+ * Returns the number of rows found on the segment for each table whose data
+ * passed verification, along with the errors found for the other tables.
+ * Sizes and checksums are only recorded in the master TOC when each table has
+ * its own data file; gpbackup_helper checks the checksums in the segment TOC
+ * for a single data file itself.
+ */
+func CheckDataFileVerifications(contentID int, dataEntries []utils.MasterDataEntry, verifications map[uint32]utils.DataFileVerification) (map[uint32]int64, []string) {
+	rowCounts := make(map[uint32]int64, len(dataEntries))
+	errMsgs := make([]string, 0)
+	for _, entry := range dataEntries {
+		tableName := utils.MakeFQN(entry.Schema, entry.Name)
+		verification, ok := verifications[entry.Oid]
+		if !ok {
+			errMsgs = append(errMsgs, fmt.Sprintf("Data for table %s was not verified", tableName))
+			continue
+		}
+		if verification.Error != "" {
+			errMsgs = append(errMsgs, fmt.Sprintf("Data for table %s is invalid: %s", tableName, verification.Error))
+			continue
+		}
+		if expectedSize, ok := entry.Sizes[contentID]; ok && verification.Size != expectedSize {
+			errMsgs = append(errMsgs, fmt.Sprintf("Data file for table %s is %d bytes, expected %d", tableName, verification.Size, expectedSize))
+			continue
+		}
+		if expectedChecksum, ok := entry.Checksums[contentID]; ok && verification.Checksum != expectedChecksum {
+			errMsgs = append(errMsgs, fmt.Sprintf("Checksum mismatch for data file of table %s: expected %s, found %s", tableName, expectedChecksum, verification.Checksum))
+			continue
+		}
+		rowCounts[entry.Oid] = verification.Rows
+	}
+	return rowCounts, errMsgs
+}
+
+// Tables that failed verification on any segment should not be passed in rowCounts.
+func CompareRowCounts(dataEntries []utils.MasterDataEntry, rowCounts map[uint32]int64) []string {
+	errMsgs := make([]string, 0)
+	for _, entry := range dataEntries {
+		rows, ok := rowCounts[entry.Oid]
+		if ok && rows != entry.RowsCopied {
+			errMsgs = append(errMsgs, fmt.Sprintf("Data files for table %s contain %d rows, expected %d", utils.MakeFQN(entry.Schema, entry.Name), rows, entry.RowsCopied))
+		}
+	}
+	return errMsgs
+}
+
+func WriteVerificationReport(output io.Writer, timestamp string, results []VerificationResult) {
+	fmt.Fprintf(output, "Greenplum Database Backup Verification Report\n\nTimestamp Key: %s\n\n", timestamp)
+	writer := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "SEGMENT\tHOST\tSTATUS")
+	for _, result := range results {
+		segmentStr := fmt.Sprintf("%d", result.ContentID)
+		if result.ContentID == -1 {
+			segmentStr = "master"
+		}
+		statusStr := "PASS"
+		if len(result.Errors) > 0 {
+			statusStr = "FAIL"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", segmentStr, result.Hostname, statusStr)
+	}
+	_ = writer.Flush()
+
+	for _, result := range results {
+		if len(result.Errors) == 0 {
+			continue
+		}
+		fmt.Fprintf(output, "\n%s:\n", getSegmentDescription(result))
+		for _, errMsg := range result.Errors {
+			fmt.Fprintf(output, "  %s\n", errMsg)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("restore/verify tests", func() {
+	Describe("CheckMetadataEntryRanges", func() {
+		It("returns no errors if all byte ranges are within the file", func() {
+			entries := []utils.MetadataEntry{{Schema: "public", Name: "foo", ObjectType: "TABLE", StartByte: 0, EndByte: 20}, {Schema: "public", Name: "bar", ObjectType: "TABLE", StartByte: 20, EndByte: 40}}
+			Expect(restore.CheckMetadataEntryRanges("predata", entries, "/backups/metadata.sql", 40)).To(BeEmpty())
+		})
+		It("returns an error for a byte range that ends after the end of the file", func() {
+			entries := []utils.MetadataEntry{{Schema: "public", Name: "foo", ObjectType: "TABLE", StartByte: 20, EndByte: 50}}
+			Expect(restore.CheckMetadataEntryRanges("predata", entries, "/backups/metadata.sql", 40)).To(Equal([]string{
+				"Byte range 20-50 of TABLE public.foo in the predata section is outside of file /backups/metadata.sql, which is 40 bytes"}))
+		})
+		It("returns an error for a byte range that ends before it starts", func() {
+			entries := []utils.MetadataEntry{{Schema: "public", Name: "foo", ObjectType: "INDEX", StartByte: 30, EndByte: 20}}
+			Expect(restore.CheckMetadataEntryRanges("postdata", entries, "/backups/metadata.sql", 40)).To(Equal([]string{
+				"Byte range 30-20 of INDEX public.foo in the postdata section is outside of file /backups/metadata.sql, which is 40 bytes"}))
+		})
+	})
+	Describe("CheckDataFileVerifications", func() {
+		entry := utils.MasterDataEntry{Schema: "public", Name: "foo", Oid: 3456, RowsCopied: 10, Checksums: map[int]string{0: "aaaa"}, Sizes: map[int]int64{0: 100}}
+		singleDataFileEntry := utils.MasterDataEntry{Schema: "public", Name: "bar", Oid: 4567, RowsCopied: 5}
+		It("returns the row count of each table whose data file is valid", func() {
+			verifications := map[uint32]utils.DataFileVerification{
+				3456: {Oid: 3456, Size: 100, Checksum: "aaaa", Rows: 4},
+				4567: {Oid: 4567, Size: 50, Checksum: "bbbb", Rows: 2},
+			}
+			rowCounts, errMsgs := restore.CheckDataFileVerifications(0, []utils.MasterDataEntry{entry, singleDataFileEntry}, verifications)
+			Expect(rowCounts).To(Equal(map[uint32]int64{3456: 4, 4567: 2}))
+			Expect(errMsgs).To(BeEmpty())
+		})
+		It("returns an error for a data file with an unexpected size", func() {
+			verifications := map[uint32]utils.DataFileVerification{3456: {Oid: 3456, Size: 80, Checksum: "aaaa", Rows: 4}}
+			rowCounts, errMsgs := restore.CheckDataFileVerifications(0, []utils.MasterDataEntry{entry}, verifications)
+			Expect(rowCounts).To(BeEmpty())
+			Expect(errMsgs).To(Equal([]string{"Data file for table public.foo is 80 bytes, expected 100"}))
+		})
+		It("returns an error for a data file with an unexpected checksum", func() {
+			verifications := map[uint32]utils.DataFileVerification{3456: {Oid: 3456, Size: 100, Checksum: "cccc", Rows: 4}}
+			rowCounts, errMsgs := restore.CheckDataFileVerifications(0, []utils.MasterDataEntry{entry}, verifications)
+			Expect(rowCounts).To(BeEmpty())
+			Expect(errMsgs).To(Equal([]string{"Checksum mismatch for data file of table public.foo: expected aaaa, found cccc"}))
+		})
+		It("returns an error reported by the verification agent", func() {
+			verifications := map[uint32]utils.DataFileVerification{3456: {Oid: 3456, Error: "Data ends within a quoted field"}}
+			rowCounts, errMsgs := restore.CheckDataFileVerifications(0, []utils.MasterDataEntry{entry}, verifications)
+			Expect(rowCounts).To(BeEmpty())
+			Expect(errMsgs).To(Equal([]string{"Data for table public.foo is invalid: Data ends within a quoted field"}))
+		})
+		It("returns an error for a table with no verification result", func() {
+			rowCounts, errMsgs := restore.CheckDataFileVerifications(0, []utils.MasterDataEntry{entry}, map[uint32]utils.DataFileVerification{})
+			Expect(rowCounts).To(BeEmpty())
+			Expect(errMsgs).To(Equal([]string{"Data for table public.foo was not verified"}))
+		})
+	})
+	Describe("CompareRowCounts", func() {
+		entries := []utils.MasterDataEntry{{Schema: "public", Name: "foo", Oid: 3456, RowsCopied: 10}, {Schema: "public", Name: "bar", Oid: 4567, RowsCopied: 5}}
+		It("returns no errors if all row counts match", func() {
+			Expect(restore.CompareRowCounts(entries, map[uint32]int64{3456: 10, 4567: 5})).To(BeEmpty())
+		})
+		It("returns an error for each table whose row count does not match", func() {
+			Expect(restore.CompareRowCounts(entries, map[uint32]int64{3456: 9, 4567: 5})).To(Equal([]string{"Data files for table public.foo contain 9 rows, expected 10"}))
+		})
+		It("does not compare the row counts of tables that are not passed in", func() {
+			Expect(restore.CompareRowCounts(entries, map[uint32]int64{4567: 5})).To(BeEmpty())
+		})
+	})
+	Describe("WriteVerificationReport", func() {
+		It("writes the status of each segment and the errors for failed segments", func() {
+			results := []restore.VerificationResult{
+				{ContentID: -1, Hostname: "mdw"},
+				{ContentID: 0, Hostname: "sdw1", Errors: []string{"Data for table public.foo was not verified"}},
+				{ContentID: 1, Hostname: "sdw2"},
+			}
+			restore.WriteVerificationReport(buffer, "20170101010101", results)
+			Expect(buffer).To(Say("Timestamp Key: 20170101010101"))
+			Expect(buffer).To(Say(`SEGMENT\s+HOST\s+STATUS`))
+			Expect(buffer).To(Say(`master\s+mdw\s+PASS`))
+			Expect(buffer).To(Say(`0\s+sdw1\s+FAIL`))
+			Expect(buffer).To(Say(`1\s+sdw2\s+PASS`))
+			Expect(buffer).To(Say(`Segment 0 on host sdw1:\n  Data for table public.foo was not verified`))
+		})
+	})
+})
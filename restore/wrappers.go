@@ -2,12 +2,14 @@ package restore
 
 import (
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 )
 
 /*
@@ -21,8 +23,13 @@ import (
  * Setup and validation wrapper functions
  */
 
+/*
+ * The table of contents for --list, and the statements for a dry run without
+ * --dry-run-file, are written to stdout, so log messages are only written to
+ * the log file.
+ */
 func SetLoggerVerbosity() {
-	if *quiet {
+	if *quiet || *listTOC || (*dryRun && *dryRunFile == "") {
 		gplog.SetVerbosity(gplog.LOGERROR)
 	} else if *debug {
 		gplog.SetVerbosity(gplog.LOGDEBUG)
@@ -59,38 +66,109 @@ SET default_with_oids = off;
 
 func InitializeBackupConfig() {
 	backupConfig = utils.ReadConfigFile(globalFPInfo.GetConfigFilePath())
-	utils.InitializeCompressionParameters(backupConfig.Compressed, 0)
+	if backupConfig.Format == "plain" {
+		gplog.Fatal(errors.Errorf("Backup %s was written as a plain SQL script.  Restore it by running %s with psql.", globalFPInfo.Timestamp, globalFPInfo.GetPlainScriptFilePath()), "")
+	}
+	utils.InitializeCompressionParameters(backupConfig.Compressed, backupConfig.CompressionType, 0)
 	utils.EnsureBackupVersionCompatibility(backupConfig.BackupVersion, version)
 	utils.EnsureDatabaseVersionCompatibility(backupConfig.DatabaseVersion, connectionPool.Version)
+	if !backupConfig.MetadataOnly && !*metadataOnly {
+		utils.VerifyCompressionProgramOnAllHosts(globalCluster)
+	}
+	InitializeEncryption()
+}
+
+/*
+ * The key is checked against the fingerprint recorded at backup time, so that
+ * a wrong key is reported up front rather than as corrupt data part way
+ * through the restore.
+ */
+func InitializeEncryption() {
+	if !backupConfig.Encrypted {
+		if *encryptionKeyFile != "" {
+			gplog.Fatal(errors.Errorf("The --encryption-key-file flag cannot be used to restore a backup taken without encryption."), "")
+		}
+		utils.InitializeEncryptionKey("", "")
+		return
+	}
+	if *encryptionKeyFile == "" {
+		gplog.Fatal(errors.Errorf("Backup was taken with encryption. The --encryption-key-file flag must be used to restore."), "")
+	}
+	utils.InitializeEncryptionKey(*encryptionKeyFile, backupConfig.EncryptionSalt)
+	_, key := utils.GetEncryptionParameters()
+	if utils.GetEncryptionKeyFingerprint(key) != backupConfig.EncryptionKeyFingerprint {
+		gplog.Fatal(errors.Errorf("The key in %s is not the key with which the backup was encrypted.", *encryptionKeyFile), "")
+	}
+	if !backupConfig.MetadataOnly && !*metadataOnly {
+		utils.VerifyHelperVersionOnSegments(version, globalCluster)
+		utils.VerifyEncryptionKeyOnAllHosts(globalCluster)
+	}
+}
+
+/*
+ * The data for tables that had not changed when an incremental backup was
+ * taken is stored in the backup directories of the earlier backups.
+ */
+func GetFPInfoForTimestamp(timestamp string) utils.FilePathInfo {
+	fpInfo := globalFPInfo
+	fpInfo.Timestamp = timestamp
+	return fpInfo
 }
 
 func InitializeFilterLists() {
+	redirectSchemaMap = ParseRedirectSchemas(*redirectSchemas)
+	tablespaceMapping = ParseTablespaceMap(*tablespaceMap)
+	roleMapping = ParseRoleMap(*roleMap)
 	if *excludeRelationFile != "" {
 		*excludeRelations = iohelper.MustReadLinesFromFile(*excludeRelationFile)
 	}
 	if *includeRelationFile != "" {
 		*includeRelations = iohelper.MustReadLinesFromFile(*includeRelationFile)
 	}
+	relationRenameMap = ParseRenamedRelations(*includeRelations, *renameTo)
 }
 
 func BackupConfigurationValidation() {
 	InitializeFilterLists()
+	ValidateSegmentCount()
 
 	gplog.Verbose("Gathering information on backup directories")
-	VerifyBackupDirectoriesExistOnAllHosts()
+	VerifyBackupDirectoriesExistOnAllHosts(globalFPInfo)
 
 	VerifyMetadataFilePaths(*withStats)
+	VerifyMetadataFileChecksums(*withStats)
 
 	tocFilename := globalFPInfo.GetTOCFilePath()
 	globalTOC = utils.NewTOC(tocFilename)
 	globalTOC.InitializeEntryMap()
+	if *useListFile != "" {
+		globalTOC.SelectListEntries(utils.ReadTOCListFile(*useListFile))
+		if backupConfig.SingleDataFile && globalTOC.HasReorderedDataEntries() {
+			gplog.Warn("This backup was taken with --single-data-file, so its data will be restored in the order in which it was backed up rather than the order of the list")
+		}
+	}
+	if backupConfig.Incremental && *pluginConfigFile == "" {
+		for _, dataTimestamp := range utils.GetIncrementalTimestamps(globalTOC.DataEntries) {
+			VerifyBackupDirectoriesExistOnAllHosts(GetFPInfoForTimestamp(dataTimestamp))
+		}
+	}
 	ValidateBackupFlagCombinations()
 
 	validateFilterListsInBackupSet()
+	if backupConfig.MaskingPolicyFingerprint != "" {
+		gplog.Warn("Data in this backup was masked with the masking policy with fingerprint %s, so it differs from the data in the database that was backed up", backupConfig.MaskingPolicyFingerprint)
+	}
+}
+
+func ListTOCEntries() {
+	globalTOC = utils.NewTOC(globalFPInfo.GetTOCFilePath())
+	globalTOC.InitializeEntryMap()
+	utils.MustPrintf(os.Stdout, ";\n; Table of contents of backup %s of database %s\n", globalFPInfo.Timestamp, backupConfig.DatabaseName)
+	utils.WriteTOCList(os.Stdout, globalTOC.GetListEntries())
 }
 
 func RecoverMetadataFilesUsingPlugin() {
-	pluginConfig := utils.ReadPluginConfig(*pluginConfigFile)
+	pluginConfig = utils.ReadPluginConfig(*pluginConfigFile)
 	pluginConfig.CheckPluginExistsOnAllHosts(globalCluster)
 	pluginConfig.CopyPluginConfigToAllHosts(globalCluster, *pluginConfigFile)
 	pluginConfig.SetupPluginForRestoreOnAllHosts(globalCluster, pluginConfig.ConfigPath, globalFPInfo.GetDirForContent(-1))
@@ -115,7 +193,7 @@ func RecoverMetadataFilesUsingPlugin() {
  */
 
 func GetRestoreMetadataStatements(section string, filename string, includeObjectTypes []string, excludeObjectTypes []string, filterSchemas bool, filterRelations bool) []utils.StatementWithType {
-	metadataFile := iohelper.MustOpenFileForReading(filename)
+	metadataFile, _ := utils.MustOpenMetadataFileForReading(filename)
 	var statements []utils.StatementWithType
 	if len(includeObjectTypes) > 0 || len(excludeObjectTypes) > 0 || filterSchemas || filterRelations {
 		var inSchemas, exSchemas, inRelations, exRelations []string
@@ -131,7 +209,20 @@ func GetRestoreMetadataStatements(section string, filename string, includeObject
 	} else {
 		statements = globalTOC.GetAllSQLStatements(section, metadataFile)
 	}
-	return statements
+	statements = utils.SubstituteRenamedRelationsInStatements(statements, relationRenameMap)
+	statements = utils.SubstituteRedirectSchemasInStatements(statements, redirectSchemaMap)
+	if *noTablespaces {
+		statements = utils.RemoveTablespacesFromStatements(statements)
+	} else {
+		statements = utils.SubstituteTablespacesInStatements(statements, tablespaceMapping)
+	}
+	if *noOwner {
+		statements = utils.RemoveOwnersFromStatements(statements)
+	}
+	if *noPrivileges {
+		statements = utils.RemovePrivilegesFromStatements(statements)
+	}
+	return utils.SubstituteRolesInStatements(statements, roleMapping)
 }
 
 func ExecuteRestoreMetadataStatements(statements []utils.StatementWithType, objectsTitle string, progressBar utils.ProgressBar, showProgressBar int, executeInParallel bool) {
@@ -157,7 +248,15 @@ func setGUCsForConnection(gucStatements []utils.StatementWithType, whichConn int
 }
 
 func restoreSchemas(schemaStatements []utils.StatementWithType, progressBar utils.ProgressBar) {
+	if dryRunWriter != nil {
+		ExecuteStatements(schemaStatements, progressBar, utils.PB_VERBOSE, false, 0)
+		return
+	}
 	for _, schema := range schemaStatements {
+		if WasStatementRestored(schema) {
+			progressBar.Increment()
+			continue
+		}
 		_, err := connectionPool.Exec(schema.Statement, 0)
 		if err != nil {
 			fmt.Println()
@@ -167,6 +266,7 @@ func restoreSchemas(schemaStatements []utils.StatementWithType, progressBar util
 				gplog.Fatal(err, "Error encountered while creating schema %s: %s", schema.Name, err.Error())
 			}
 		}
+		AddStatementToJournal(schema)
 		progressBar.Increment()
 	}
 }
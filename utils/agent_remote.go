@@ -14,11 +14,15 @@ import (
  * Functions to run commands on entire cluster during both backup and restore
  */
 
-func CreateFirstSegmentPipeOnAllHosts(oid uint32, c *cluster.Cluster, fpInfo FilePathInfo) {
+// Creates the pipe for the first table in each data stream
+func CreateFirstSegmentPipesOnAllHosts(oids []uint32, c *cluster.Cluster, fpInfo FilePathInfo) {
 	remoteOutput := c.GenerateAndExecuteCommand("Creating segment data pipes", func(contentID int) string {
 		pipeName := fpInfo.GetSegmentPipeFilePath(contentID)
-		pipeName = fmt.Sprintf("%s_%d", pipeName, oid)
-		return fmt.Sprintf("mkfifo %s", pipeName)
+		pipeNames := make([]string, len(oids))
+		for i, oid := range oids {
+			pipeNames[i] = fmt.Sprintf("%s_%d", pipeName, oid)
+		}
+		return fmt.Sprintf("mkfifo %s", strings.Join(pipeNames, " "))
 	}, cluster.ON_SEGMENTS)
 	c.CheckClusterError(remoteOutput, "Unable to create segment data pipes", func(contentID int) string {
 		return "Unable to create segment data pipe"
@@ -59,7 +63,35 @@ func VerifyHelperVersionOnSegments(version string, c *cluster.Cluster) {
 	}
 }
 
-func StartAgent(c *cluster.Cluster, fpInfo FilePathInfo, operation string, pluginConfigFile string, compressStr string) {
+/*
+ * The helper prints the fingerprint of the key in the key file on each host,
+ * which must match that of the key on the master.
+ */
+func VerifyEncryptionKeyOnAllHosts(c *cluster.Cluster) {
+	keyFile := encryptionKeyFile
+	fingerprint := GetEncryptionKeyFingerprint(encryptionKey)
+	encryptionFlags := GetEncryptionFlagsString()
+	remoteOutput := c.GenerateAndExecuteCommand("Verifying encryption key on all hosts", func(contentID int) string {
+		gphome := operating.System.Getenv("GPHOME")
+		return fmt.Sprintf("%s/bin/gpbackup_helper%s --key-fingerprint", gphome, encryptionFlags)
+	}, cluster.ON_HOSTS)
+	c.CheckClusterError(remoteOutput, "Could not read encryption key file on all hosts", func(contentID int) string {
+		return fmt.Sprintf("Could not read encryption key file %s", keyFile)
+	})
+
+	numIncorrect := 0
+	for contentID := range remoteOutput.Stdouts {
+		if strings.TrimSpace(remoteOutput.Stdouts[contentID]) != fingerprint {
+			gplog.Verbose("Encryption key file %s on host %s does not contain the same key as on the master", keyFile, c.GetHostForContent(contentID))
+			numIncorrect++
+		}
+	}
+	if numIncorrect > 0 {
+		cluster.LogFatalClusterError("The encryption key file must contain the same key on every host, but found key files with a different key", cluster.ON_HOSTS, numIncorrect)
+	}
+}
+
+func StartAgent(c *cluster.Cluster, fpInfo FilePathInfo, operation string, pluginConfigFile string, helperFlagsStr string) {
 	remoteOutput := c.GenerateAndExecuteCommand("Starting gpbackup_helper agent", func(contentID int) string {
 		tocFile := fpInfo.GetSegmentTOCFilePath(contentID)
 		oidFile := fpInfo.GetSegmentHelperFilePath(contentID, "oid")
@@ -72,7 +104,7 @@ func StartAgent(c *cluster.Cluster, fpInfo FilePathInfo, operation string, plugi
 			_, configFilename := filepath.Split(pluginConfigFile)
 			pluginStr = fmt.Sprintf(" --plugin-config /tmp/%s", configFilename)
 		}
-		helperCmdStr := fmt.Sprintf("gpbackup_helper %s --toc-file %s --oid-file %s --pipe-file %s --data-file %s --content %d%s%s", operation, tocFile, oidFile, pipeFile, backupFile, contentID, pluginStr, compressStr)
+		helperCmdStr := fmt.Sprintf("gpbackup_helper %s --toc-file %s --oid-file %s --pipe-file %s --data-file %s --content %d%s%s%s", operation, tocFile, oidFile, pipeFile, backupFile, contentID, pluginStr, GetEncryptionFlagsString(), helperFlagsStr)
 
 		return fmt.Sprintf(`cat << HEREDOC > %s
 #!/bin/bash
@@ -91,9 +123,10 @@ chmod +x %s; (nohup %s > /dev/null 2>&1 &) &`, scriptFile, gphomePath, gphomePat
 func CleanUpHelperFilesOnAllHosts(c *cluster.Cluster, fpInfo FilePathInfo) {
 	remoteOutput := c.GenerateAndExecuteCommand("Removing oid list and helper script files from segment data directories", func(contentID int) string {
 		errorFile := fmt.Sprintf("%s_error", fpInfo.GetSegmentPipeFilePath(contentID))
+		tableErrorFiles := fmt.Sprintf("%s_*_error", fpInfo.GetSegmentPipeFilePath(contentID))
 		oidFile := fpInfo.GetSegmentHelperFilePath(contentID, "oid")
 		scriptFile := fpInfo.GetSegmentHelperFilePath(contentID, "script")
-		return fmt.Sprintf("rm -f %s && rm -f %s && rm -f %s", errorFile, oidFile, scriptFile)
+		return fmt.Sprintf("rm -f %s && rm -f %s && rm -f %s && rm -f %s", errorFile, tableErrorFiles, oidFile, scriptFile)
 	}, cluster.ON_SEGMENTS)
 	errMsg := fmt.Sprintf("Unable to remove segment helper file(s). See %s for a complete list of segments with errors and remove manually.",
 		gplog.GetLogFilePath())
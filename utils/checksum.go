@@ -0,0 +1,175 @@
+package utils
+
+/*
+ * This file contains functions for computing and parsing the SHA-256
+ * checksums used to detect corruption of backup files.
+ */
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+)
+
+func GetFileChecksum(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	if _, err = io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+/*
+ * When each table has its own data file, gpbackup_helper writes the data file
+ * in the COPY command, computing the file's checksum as the data is written,
+ * and appends a "<oid> <size> <checksum>" line for it to the checksum file of
+ * the segment.  A table backed up again by a resumed backup has a later line,
+ * which replaces the earlier one.
+ */
+type DataFileInfo struct {
+	Size     int64
+	Checksum string
+}
+
+func FormatDataFileInfo(oid uint32, info DataFileInfo) string {
+	return fmt.Sprintf("%d %d %s\n", oid, info.Size, info.Checksum)
+}
+
+func ParseDataFileInfo(contents string) map[uint32]DataFileInfo {
+	infos := make(map[uint32]DataFileInfo, 0)
+	for _, line := range strings.Split(strings.TrimSpace(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		oid, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		infos[uint32(oid)] = DataFileInfo{Size: size, Checksum: fields[2]}
+	}
+	return infos
+}
+
+/*
+ * The helper compresses and encrypts the data itself, so that its exit status
+ * is the exit status of the COPY program.
+ */
+func GetWriteTableDataCommand(dataFile string, checksumFile string, oid uint32) string {
+	command := fmt.Sprintf("gpbackup_helper --write-table-data --data-file %s --checksum-file %s --oid %d --content <SEGID>", dataFile, checksumFile, oid)
+	if usingCompression {
+		command += fmt.Sprintf(" --compression-type %s --compression-level %d", compressionProgram.Name, compressionProgram.Level)
+	}
+	return command + GetEncryptionFlagsString()
+}
+
+/*
+ * The helper decrypts and decompresses the data itself, and exits with an
+ * error once all of the data has been read if the data file does not match
+ * the checksum recorded for it, so that the COPY fails before it commits.
+ * Backups taken before checksums were recorded have no checksum file.
+ */
+func GetReadTableDataCommand(dataFile string, checksumFile string, oid uint32) string {
+	command := fmt.Sprintf("gpbackup_helper --read-table-data --data-file %s --content <SEGID>", dataFile)
+	if checksumFile != "" {
+		command += fmt.Sprintf(" --checksum-file %s --oid %d", checksumFile, oid)
+	}
+	return command + GetEncryptionFlagsString()
+}
+
+/*
+ * Returns the checksum and size recorded for each table's data file on each
+ * segment.  The checksum file of each segment is read once, after all of the
+ * tables have been backed up; it does not exist if no table data was written.
+ */
+func GetDataFileInfoOnAllHosts(c *cluster.Cluster, fpInfo FilePathInfo) map[int]map[uint32]DataFileInfo {
+	remoteOutput := c.GenerateAndExecuteCommand("Reading data file checksums", func(contentID int) string {
+		return getReadChecksumFileCommand(fpInfo, contentID)
+	}, cluster.ON_SEGMENTS)
+	c.CheckClusterError(remoteOutput, "Unable to read data file checksums", func(contentID int) string {
+		return fmt.Sprintf("Unable to read data file checksums for segment %d on host %s", contentID, c.GetHostForContent(contentID))
+	})
+	infos := make(map[int]map[uint32]DataFileInfo, len(remoteOutput.Stdouts))
+	for contentID, output := range remoteOutput.Stdouts {
+		infos[contentID] = ParseDataFileInfo(output)
+	}
+	return infos
+}
+
+/*
+ * A resumed backup compares the sizes recorded for the data files written
+ * before it was interrupted with their current sizes, so both are read in the
+ * same command.  The checksum file has "<oid> <size> <checksum>" lines and
+ * find prints "<size> <filename>" lines, so each parser skips the other's.
+ */
+func GetDataFileInfoAndSizesOnAllHosts(c *cluster.Cluster, fpInfo FilePathInfo) (map[int]map[uint32]DataFileInfo, map[int]map[uint32]int64) {
+	remoteOutput := c.GenerateAndExecuteCommand("Reading data file checksums and sizes", func(contentID int) string {
+		return fmt.Sprintf(`%s && find %s -maxdepth 1 -name 'gpbackup_%d_%s_*' -printf '%%s %%p\n'`, getReadChecksumFileCommand(fpInfo, contentID), fpInfo.GetDirForContent(contentID), contentID, fpInfo.Timestamp)
+	}, cluster.ON_SEGMENTS)
+	c.CheckClusterError(remoteOutput, "Unable to read data file checksums and sizes", func(contentID int) string {
+		return fmt.Sprintf("Unable to read data file checksums and sizes for segment %d on host %s", contentID, c.GetHostForContent(contentID))
+	})
+	infos := make(map[int]map[uint32]DataFileInfo, len(remoteOutput.Stdouts))
+	sizes := make(map[int]map[uint32]int64, len(remoteOutput.Stdouts))
+	for contentID, output := range remoteOutput.Stdouts {
+		infos[contentID] = ParseDataFileInfo(output)
+		sizes[contentID] = ParseDataFileSizes(output)
+	}
+	return infos, sizes
+}
+
+func getReadChecksumFileCommand(fpInfo FilePathInfo, contentID int) string {
+	checksumFile := fpInfo.GetSegmentChecksumFilePath(contentID)
+	return fmt.Sprintf("(test ! -e %s || cat %s)", checksumFile, checksumFile)
+}
+
+var dataFileOidRegex = regexp.MustCompile(`^gpbackup_-?\d+_\d{14}_(\d+)`)
+
+// Parses output with one "<size> <filename>" line per data file into a map of oids to file sizes in bytes.
+func ParseDataFileSizes(output string) map[uint32]int64 {
+	sizes := make(map[uint32]int64, 0)
+	for oid, value := range parseDataFileValues(output) {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		sizes[oid] = size
+	}
+	return sizes
+}
+
+func parseDataFileValues(output string) map[uint32]string {
+	values := make(map[uint32]string, 0)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		matches := dataFileOidRegex.FindStringSubmatch(path.Base(fields[1]))
+		if len(matches) < 2 {
+			continue
+		}
+		oid, err := strconv.ParseUint(matches[1], 10, 32)
+		if err != nil {
+			continue
+		}
+		values[uint32(oid)] = fields[0]
+	}
+	return values
+}
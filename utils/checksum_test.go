@@ -0,0 +1,82 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/checksum tests", func() {
+	Describe("GetFileChecksum", func() {
+		It("returns the SHA-256 checksum of the file contents", func() {
+			file, _ := ioutil.TempFile("", "gpbackup_checksum")
+			defer os.Remove(file.Name())
+			file.WriteString("abc")
+			file.Close()
+
+			checksum, err := utils.GetFileChecksum(file.Name())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checksum).To(Equal("ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"))
+		})
+		It("returns an error if the file does not exist", func() {
+			_, err := utils.GetFileChecksum("/tmp/gpbackup_checksum_nonexistent")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("ParseDataFileInfo", func() {
+		It("parses the size and checksum of each data file", func() {
+			contents := `3456 1234 1111111111111111111111111111111111111111111111111111111111111111
+4567 0 2222222222222222222222222222222222222222222222222222222222222222
+`
+			Expect(utils.ParseDataFileInfo(contents)).To(Equal(map[uint32]utils.DataFileInfo{
+				3456: {Size: 1234, Checksum: "1111111111111111111111111111111111111111111111111111111111111111"},
+				4567: {Size: 0, Checksum: "2222222222222222222222222222222222222222222222222222222222222222"},
+			}))
+		})
+		It("uses the last line for a data file that was written more than once", func() {
+			contents := utils.FormatDataFileInfo(3456, utils.DataFileInfo{Size: 1234, Checksum: "1111"}) + utils.FormatDataFileInfo(3456, utils.DataFileInfo{Size: 5678, Checksum: "2222"})
+			Expect(utils.ParseDataFileInfo(contents)).To(Equal(map[uint32]utils.DataFileInfo{3456: {Size: 5678, Checksum: "2222"}}))
+		})
+		It("ignores incomplete lines", func() {
+			Expect(utils.ParseDataFileInfo("3456 1234\nabcd 1234 1111\n")).To(BeEmpty())
+		})
+	})
+	Describe("GetWriteTableDataCommand", func() {
+		AfterEach(func() {
+			utils.SetCompressionParameters(false, utils.Compression{})
+			utils.SetEncryptionParameters("", nil)
+		})
+		It("writes the data file with compression and encryption", func() {
+			utils.SetCompressionParameters(true, utils.Compression{Name: "gzip", Level: 8, Extension: ".gz"})
+			utils.SetEncryptionParameters("/tmp/key", []byte("0123456789abcdef0123456789abcdef"))
+			Expect(utils.GetWriteTableDataCommand("/data/gpbackup_<SEGID>_20170101010101_3456.gz", "/data/gpbackup_<SEGID>_20170101010101_checksums", 3456)).To(Equal("gpbackup_helper --write-table-data --data-file /data/gpbackup_<SEGID>_20170101010101_3456.gz --checksum-file /data/gpbackup_<SEGID>_20170101010101_checksums --oid 3456 --content <SEGID> --compression-type gzip --compression-level 8 --encryption-key-file /tmp/key"))
+		})
+		It("writes the data file without compression or encryption", func() {
+			Expect(utils.GetWriteTableDataCommand("/data/gpbackup_<SEGID>_20170101010101_3456", "/data/gpbackup_<SEGID>_20170101010101_checksums", 3456)).To(Equal("gpbackup_helper --write-table-data --data-file /data/gpbackup_<SEGID>_20170101010101_3456 --checksum-file /data/gpbackup_<SEGID>_20170101010101_checksums --oid 3456 --content <SEGID>"))
+		})
+	})
+	Describe("GetReadTableDataCommand", func() {
+		It("verifies the data file against its checksum", func() {
+			Expect(utils.GetReadTableDataCommand("/data/gpbackup_<SEGID>_20170101010101_3456", "/data/gpbackup_<SEGID>_20170101010101_checksums", 3456)).To(Equal("gpbackup_helper --read-table-data --data-file /data/gpbackup_<SEGID>_20170101010101_3456 --content <SEGID> --checksum-file /data/gpbackup_<SEGID>_20170101010101_checksums --oid 3456"))
+		})
+		It("does not verify the data file of a backup without checksums", func() {
+			Expect(utils.GetReadTableDataCommand("/data/gpbackup_<SEGID>_20170101010101_3456", "", 3456)).To(Equal("gpbackup_helper --read-table-data --data-file /data/gpbackup_<SEGID>_20170101010101_3456 --content <SEGID>"))
+		})
+	})
+	Describe("ParseDataFileSizes", func() {
+		It("parses the sizes of data files", func() {
+			output := `1234 /data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_3456.gz
+0 /data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_4567.gz
+`
+			Expect(utils.ParseDataFileSizes(output)).To(Equal(map[uint32]int64{3456: 1234, 4567: 0}))
+		})
+		It("ignores lines with a size that is not a number", func() {
+			output := "abcd /data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_3456.gz"
+			Expect(utils.ParseDataFileSizes(output)).To(BeEmpty())
+		})
+	})
+})
@@ -1,6 +1,14 @@
 package utils
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/pkg/errors"
+)
 
 var (
 	usingCompression   = true
@@ -9,20 +17,107 @@ var (
 
 type Compression struct {
 	Name              string
+	Level             int
 	CompressCommand   string
 	DecompressCommand string
 	Extension         string
 }
 
-func InitializeCompressionParameters(compress bool, compressionLevel int) {
-	usingCompression = compress
-	compressCommand := ""
+/*
+ * Each codec is run as an external program in COPY ... PROGRAM commands;
+ * gpbackup_helper compresses gzip data itself and runs the program for the
+ * other codecs.  Compression levels range from 1 to maxLevel.
+ */
+type compressionCodec struct {
+	compressCommand   string
+	decompressCommand string
+	extension         string
+	defaultLevel      int
+	maxLevel          int
+}
+
+var compressionCodecs = map[string]compressionCodec{
+	"gzip": {compressCommand: "gzip -c -%d", decompressCommand: "gzip -d -c", extension: ".gz", defaultLevel: 1, maxLevel: 9},
+	"lz4":  {compressCommand: "lz4 -c -q -%d", decompressCommand: "lz4 -d -c -q", extension: ".lz4", defaultLevel: 1, maxLevel: 12},
+	"zstd": {compressCommand: "zstd -c -q -%d", decompressCommand: "zstd -d -c -q", extension: ".zst", defaultLevel: 3, maxLevel: 19},
+}
+
+// Returns the supported compression types, including "none"
+func GetCompressionTypes() []string {
+	types := []string{"none"}
+	for name := range compressionCodecs {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// A compression level of 0 means that the codec's default level is used.
+func ValidateCompressionTypeAndLevel(compressionType string, compressionLevel int) error {
+	if compressionType == "none" {
+		if compressionLevel != 0 {
+			return errors.Errorf("Cannot specify a compression level with compression type none")
+		}
+		return nil
+	}
+	codec, ok := compressionCodecs[compressionType]
+	if !ok {
+		return errors.Errorf("Compression type %s is not supported.  Valid compression types are %s.", compressionType, strings.Join(GetCompressionTypes(), ", "))
+	}
+	if compressionLevel < 0 || compressionLevel > codec.maxLevel {
+		return errors.Errorf("Compression level must be between 1 and %d for compression type %s", codec.maxLevel, compressionType)
+	}
+	return nil
+}
+
+/*
+ * Backups taken before the compression type was recorded always used gzip,
+ * so an empty compression type is treated as gzip.
+ */
+func NewCompression(compressionType string, compressionLevel int) (Compression, error) {
+	if compressionType == "" {
+		compressionType = "gzip"
+	}
+	codec, ok := compressionCodecs[compressionType]
+	if !ok {
+		return Compression{}, errors.Errorf("Compression type %s is not supported", compressionType)
+	}
 	if compressionLevel == 0 {
-		compressCommand = "gzip -c -1"
-	} else {
-		compressCommand = fmt.Sprintf("gzip -c -%d", compressionLevel)
+		compressionLevel = codec.defaultLevel
 	}
-	compressionProgram = Compression{Name: "gzip", CompressCommand: compressCommand, DecompressCommand: "gzip -d -c", Extension: ".gz"}
+	return Compression{
+		Name:              compressionType,
+		Level:             compressionLevel,
+		CompressCommand:   fmt.Sprintf(codec.compressCommand, compressionLevel),
+		DecompressCommand: codec.decompressCommand,
+		Extension:         codec.extension,
+	}, nil
+}
+
+/*
+ * Returns the compression used for a data file, based on its extension, so
+ * that gpbackup_helper can decompress a data file without being told how it
+ * was compressed.
+ */
+func GetCompressionForFile(filename string) (Compression, bool) {
+	for name, codec := range compressionCodecs {
+		if strings.HasSuffix(filename, codec.extension) {
+			compression, _ := NewCompression(name, 0)
+			return compression, true
+		}
+	}
+	return Compression{}, false
+}
+
+func InitializeCompressionParameters(compress bool, compressionType string, compressionLevel int) {
+	usingCompression = compress && compressionType != "none"
+	if !usingCompression {
+		compressionProgram = Compression{}
+		return
+	}
+	compression, err := NewCompression(compressionType, compressionLevel)
+	gplog.FatalOnError(err)
+	compressionProgram = compression
 }
 
 func GetCompressionParameters() (bool, Compression) {
@@ -33,3 +128,21 @@ func SetCompressionParameters(compress bool, compression Compression) {
 	usingCompression = compress
 	compressionProgram = compression
 }
+
+/*
+ * gzip is installed everywhere Greenplum is, but the other compression
+ * programs may not be, so we check for them before backing up or restoring
+ * any data.
+ */
+func VerifyCompressionProgramOnAllHosts(c *cluster.Cluster) {
+	if !usingCompression || compressionProgram.Name == "gzip" {
+		return
+	}
+	program := compressionProgram.Name
+	remoteOutput := c.GenerateAndExecuteCommand(fmt.Sprintf("Verifying that %s is installed on all hosts", program), func(contentID int) string {
+		return fmt.Sprintf("command -v %s", program)
+	}, cluster.ON_HOSTS_AND_MASTER)
+	c.CheckClusterError(remoteOutput, fmt.Sprintf("Compression program %s was not found on all hosts", program), func(contentID int) string {
+		return fmt.Sprintf("Compression program %s was not found on host %s", program, c.GetHostForContent(contentID))
+	})
+}
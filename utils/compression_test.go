@@ -34,27 +34,29 @@ var _ = Describe("utils/compression tests", func() {
 		It("initializes properly when passed no compression", func() {
 			useCompress, compression := utils.GetCompressionParameters()
 			defer utils.SetCompressionParameters(useCompress, compression)
-			expectedCompress := utils.Compression{
-				Name:              "gzip",
-				CompressCommand:   "gzip -c -3",
-				DecompressCommand: "gzip -d -c",
-				Extension:         ".gz",
-			}
-			utils.InitializeCompressionParameters(false, 3)
+			utils.InitializeCompressionParameters(false, "gzip", 3)
 			resultUseCompress, resultCompression := utils.GetCompressionParameters()
 			Expect(resultUseCompress).To(BeFalse())
-			structmatcher.ExpectStructsToMatch(&expectedCompress, &resultCompression)
+			structmatcher.ExpectStructsToMatch(&utils.Compression{}, &resultCompression)
+		})
+		It("initializes properly when passed compression type none", func() {
+			useCompress, compression := utils.GetCompressionParameters()
+			defer utils.SetCompressionParameters(useCompress, compression)
+			utils.InitializeCompressionParameters(true, "none", 0)
+			resultUseCompress, _ := utils.GetCompressionParameters()
+			Expect(resultUseCompress).To(BeFalse())
 		})
 		It("initializes properly when passed compression", func() {
 			useCompress, compression := utils.GetCompressionParameters()
 			defer utils.SetCompressionParameters(useCompress, compression)
 			expectedCompress := utils.Compression{
 				Name:              "gzip",
+				Level:             7,
 				CompressCommand:   "gzip -c -7",
 				DecompressCommand: "gzip -d -c",
 				Extension:         ".gz",
 			}
-			utils.InitializeCompressionParameters(true, 7)
+			utils.InitializeCompressionParameters(true, "gzip", 7)
 			resultUseCompress, resultCompression := utils.GetCompressionParameters()
 			Expect(resultUseCompress).To(BeTrue())
 			structmatcher.ExpectStructsToMatch(&expectedCompress, &resultCompression)
@@ -64,14 +66,110 @@ var _ = Describe("utils/compression tests", func() {
 			defer utils.SetCompressionParameters(useCompress, compression)
 			expectedCompress := utils.Compression{
 				Name:              "gzip",
+				Level:             1,
 				CompressCommand:   "gzip -c -1",
 				DecompressCommand: "gzip -d -c",
 				Extension:         ".gz",
 			}
-			utils.InitializeCompressionParameters(true, 0)
+			utils.InitializeCompressionParameters(true, "gzip", 0)
 			resultUseCompress, resultCompression := utils.GetCompressionParameters()
 			Expect(resultUseCompress).To(BeTrue())
 			structmatcher.ExpectStructsToMatch(&expectedCompress, &resultCompression)
 		})
+		It("uses gzip when passed no compression type", func() {
+			useCompress, compression := utils.GetCompressionParameters()
+			defer utils.SetCompressionParameters(useCompress, compression)
+			utils.InitializeCompressionParameters(true, "", 0)
+			_, resultCompression := utils.GetCompressionParameters()
+			Expect(resultCompression.Name).To(Equal("gzip"))
+		})
+		It("initializes properly when passed zstd compression", func() {
+			useCompress, compression := utils.GetCompressionParameters()
+			defer utils.SetCompressionParameters(useCompress, compression)
+			expectedCompress := utils.Compression{
+				Name:              "zstd",
+				Level:             3,
+				CompressCommand:   "zstd -c -q -3",
+				DecompressCommand: "zstd -d -c -q",
+				Extension:         ".zst",
+			}
+			utils.InitializeCompressionParameters(true, "zstd", 0)
+			resultUseCompress, resultCompression := utils.GetCompressionParameters()
+			Expect(resultUseCompress).To(BeTrue())
+			structmatcher.ExpectStructsToMatch(&expectedCompress, &resultCompression)
+		})
+		It("initializes properly when passed lz4 compression", func() {
+			useCompress, compression := utils.GetCompressionParameters()
+			defer utils.SetCompressionParameters(useCompress, compression)
+			expectedCompress := utils.Compression{
+				Name:              "lz4",
+				Level:             9,
+				CompressCommand:   "lz4 -c -q -9",
+				DecompressCommand: "lz4 -d -c -q",
+				Extension:         ".lz4",
+			}
+			utils.InitializeCompressionParameters(true, "lz4", 9)
+			resultUseCompress, resultCompression := utils.GetCompressionParameters()
+			Expect(resultUseCompress).To(BeTrue())
+			structmatcher.ExpectStructsToMatch(&expectedCompress, &resultCompression)
+		})
+	})
+	Describe("ValidateCompressionTypeAndLevel", func() {
+		It("accepts each supported compression type with its default level", func() {
+			for _, compressionType := range utils.GetCompressionTypes() {
+				Expect(utils.ValidateCompressionTypeAndLevel(compressionType, 0)).To(Succeed())
+			}
+		})
+		It("accepts the maximum level of a compression type", func() {
+			Expect(utils.ValidateCompressionTypeAndLevel("zstd", 19)).To(Succeed())
+		})
+		It("rejects a level above the maximum for a compression type", func() {
+			err := utils.ValidateCompressionTypeAndLevel("gzip", 10)
+			Expect(err).To(MatchError("Compression level must be between 1 and 9 for compression type gzip"))
+		})
+		It("rejects an unsupported compression type", func() {
+			err := utils.ValidateCompressionTypeAndLevel("bzip2", 0)
+			Expect(err).To(MatchError("Compression type bzip2 is not supported.  Valid compression types are gzip, lz4, none, zstd."))
+		})
+	})
+	Describe("GetCompressionForFile", func() {
+		It("returns the compression for each compressed file extension", func() {
+			for filename, expectedName := range map[string]string{"gpbackup_0_20170101010101.gz": "gzip", "gpbackup_0_20170101010101_3456.zst": "zstd", "gpbackup_0_20170101010101_3456.lz4": "lz4"} {
+				compression, ok := utils.GetCompressionForFile(filename)
+				Expect(ok).To(BeTrue())
+				Expect(compression.Name).To(Equal(expectedName))
+			}
+		})
+		It("returns false for an uncompressed file", func() {
+			_, ok := utils.GetCompressionForFile("gpbackup_0_20170101010101_3456")
+			Expect(ok).To(BeFalse())
+		})
+	})
+	Describe("VerifyCompressionProgramOnAllHosts", func() {
+		var (
+			useCompress bool
+			compression utils.Compression
+		)
+		BeforeEach(func() {
+			useCompress, compression = utils.GetCompressionParameters()
+		})
+		AfterEach(func() {
+			utils.SetCompressionParameters(useCompress, compression)
+		})
+		It("does not check for gzip", func() {
+			utils.InitializeCompressionParameters(true, "gzip", 0)
+			utils.VerifyCompressionProgramOnAllHosts(testCluster)
+			Expect(testExecutor.NumExecutions).To(Equal(0))
+		})
+		It("checks that the compression program is installed on all hosts", func() {
+			utils.InitializeCompressionParameters(true, "zstd", 0)
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{}
+			utils.VerifyCompressionProgramOnAllHosts(testCluster)
+			Expect(testExecutor.NumExecutions).To(Equal(1))
+			Expect(testExecutor.ClusterCommands[0]).To(HaveLen(2))
+			for _, command := range testExecutor.ClusterCommands[0] {
+				Expect(command[len(command)-1]).To(Equal("command -v zstd"))
+			}
+		})
 	})
 })
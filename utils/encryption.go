@@ -0,0 +1,513 @@
+package utils
+
+/*
+ * This file contains structs and functions for encrypting backup files with
+ * AES-256-GCM.
+ *
+ * An encrypted file consists of a header, containing a magic string and a
+ * random salt from which the file's key is derived, followed by a series of
+ * frames.  Each frame holds up to encryptionChunkSize bytes of plaintext,
+ * sealed with a nonce derived from its position in the file.  The last frame
+ * is marked as such in its additional data, so that truncating the file at a
+ * frame boundary is detected.  As every frame but the last is the same size,
+ * any byte range of the plaintext can be decrypted without reading the rest of
+ * the file, which lets gprestore read statements from an encrypted metadata
+ * file using the byte offsets in the TOC.
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+)
+
+const (
+	encryptionMagic      = "GPBKENC1"
+	encryptionSaltLength = 32
+	encryptionHeaderSize = len(encryptionMagic) + encryptionSaltLength
+	encryptionChunkSize  = 64 * 1024
+	encryptionTagSize    = 16
+	encryptionFrameSize  = encryptionChunkSize + encryptionTagSize
+
+	passphraseIterations = 100000
+)
+
+var (
+	encryptionKey     []byte
+	encryptionKeyFile string
+	encryptionSalt    string
+)
+
+/*
+ * The key file must be at the same path on every host, as data is encrypted
+ * and decrypted by gpbackup_helper on the segment hosts.  The salt is only
+ * used to derive a key from a passphrase; each backup set has its own salt,
+ * which is recorded in the backup config file.
+ */
+func InitializeEncryptionKey(keyFile string, salt string) {
+	encryptionKeyFile = keyFile
+	encryptionSalt = salt
+	encryptionKey = nil
+	if keyFile == "" {
+		return
+	}
+	key, err := ReadEncryptionKeyFile(keyFile, salt)
+	gplog.FatalOnError(err)
+	encryptionKey = key
+}
+
+func GetEncryptionParameters() (string, []byte) {
+	return encryptionKeyFile, encryptionKey
+}
+
+func SetEncryptionParameters(keyFile string, key []byte) {
+	encryptionKeyFile = keyFile
+	encryptionKey = key
+}
+
+func GetEncryptionSalt() string {
+	return encryptionSalt
+}
+
+func GenerateEncryptionSalt() string {
+	salt := make([]byte, encryptionSaltLength)
+	_, err := rand.Read(salt)
+	gplog.FatalOnError(err)
+	return hex.EncodeToString(salt)
+}
+
+/*
+ * Returns the flags with which gpbackup_helper reads the key file, or an
+ * empty string if the backup is not encrypted.
+ */
+func GetEncryptionFlagsString() string {
+	if encryptionKeyFile == "" {
+		return ""
+	}
+	flags := fmt.Sprintf(" --encryption-key-file %s", encryptionKeyFile)
+	if encryptionSalt != "" {
+		flags += fmt.Sprintf(" --encryption-salt %s", encryptionSalt)
+	}
+	return flags
+}
+
+/*
+ * This command is used in COPY ... PROGRAM when a data file is read through
+ * the master; gpbackup_helper otherwise encrypts and decrypts the data itself
+ * as it writes and reads the data files.
+ */
+func GetDecryptCommand() string {
+	return fmt.Sprintf("gpbackup_helper --decrypt%s", GetEncryptionFlagsString())
+}
+
+/*
+ * The first line of a key file names the format of the key that follows it:
+ *
+ *   format=hex         a 256-bit key as 64 hexadecimal characters
+ *   format=passphrase  a passphrase from which the key is derived with PBKDF2
+ *
+ * The rest of the file is the key or passphrase, without its trailing newline.
+ */
+func ReadEncryptionKeyFile(keyFile string, salt string) ([]byte, error) {
+	contents, err := operating.System.ReadFile(keyFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read encryption key file %s", keyFile)
+	}
+	lines := strings.SplitN(string(contents), "\n", 2)
+	header := strings.TrimRight(lines[0], "\r")
+	value := ""
+	if len(lines) == 2 {
+		value = strings.TrimRight(lines[1], "\r\n")
+	}
+	switch header {
+	case "format=hex":
+		key, err := hex.DecodeString(strings.TrimSpace(value))
+		if err != nil || len(key) != 32 {
+			return nil, errors.Errorf("Encryption key file %s must contain a 256-bit key as 64 hexadecimal characters", keyFile)
+		}
+		return key, nil
+	case "format=passphrase":
+		if value == "" {
+			return nil, errors.Errorf("Encryption key file %s does not contain a passphrase", keyFile)
+		}
+		saltBytes, err := hex.DecodeString(salt)
+		if err != nil || len(saltBytes) == 0 {
+			return nil, errors.Errorf("A salt is required to derive a key from the passphrase in encryption key file %s", keyFile)
+		}
+		return deriveKeyFromPassphrase([]byte(value), saltBytes, passphraseIterations), nil
+	default:
+		return nil, errors.Errorf("Encryption key file %s must begin with a line of either format=hex or format=passphrase", keyFile)
+	}
+}
+
+// PBKDF2 with HMAC-SHA256, as described in RFC 8018, producing a single block of output
+func deriveKeyFromPassphrase(passphrase []byte, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha256.New, passphrase)
+	prf.Write(salt)
+	prf.Write([]byte{0, 0, 0, 1})
+	block := prf.Sum(nil)
+	key := make([]byte, len(block))
+	copy(key, block)
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(block)
+		block = prf.Sum(block[:0])
+		for j := range key {
+			key[j] ^= block[j]
+		}
+	}
+	return key
+}
+
+/*
+ * The fingerprint is stored in the backup config file so that gprestore can
+ * check that it has been given the right key without storing the key itself.
+ */
+func GetEncryptionKeyFingerprint(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("gpbackup encryption key fingerprint"))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+/*
+ * The same passphrase gives a different key for each backup set, so checking
+ * whether a backup was encrypted with the current key file means deriving the
+ * key again with the salt of that backup.
+ */
+func IsEncryptionKeyForBackup(salt string, fingerprint string) bool {
+	if encryptionKeyFile == "" {
+		return false
+	}
+	key, err := ReadEncryptionKeyFile(encryptionKeyFile, salt)
+	return err == nil && GetEncryptionKeyFingerprint(key) == fingerprint
+}
+
+func newFileCipher(key []byte, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func getFrameNonce(frameNum uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], frameNum)
+	return nonce
+}
+
+func getFrameAdditionalData(isLastFrame bool) []byte {
+	if isLastFrame {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func IsEncryptedFile(filename string) bool {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, len(encryptionMagic))
+	_, err = io.ReadFull(file, magic)
+	return err == nil && string(magic) == encryptionMagic
+}
+
+/*
+ * Structs and functions for writing encrypted data
+ */
+
+/*
+ * Close must be called once all data has been written to write the last
+ * frame; it does not close the underlying writer.
+ */
+type EncryptWriter struct {
+	writer   io.Writer
+	aead     cipher.AEAD
+	frameNum uint64
+	chunk    []byte
+	frame    []byte
+}
+
+func NewEncryptWriter(writer io.Writer, key []byte) (*EncryptWriter, error) {
+	salt := make([]byte, encryptionSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newFileCipher(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = writer.Write(append([]byte(encryptionMagic), salt...)); err != nil {
+		return nil, err
+	}
+	return &EncryptWriter{writer: writer, aead: aead, chunk: make([]byte, 0, encryptionChunkSize), frame: make([]byte, 0, encryptionFrameSize)}, nil
+}
+
+func (w *EncryptWriter) Write(p []byte) (int, error) {
+	numWritten := 0
+	for len(p) > 0 {
+		// A full chunk is only written once more data arrives, as until then it may be the last
+		if len(w.chunk) == encryptionChunkSize {
+			if err := w.writeFrame(false); err != nil {
+				return numWritten, err
+			}
+		}
+		n := copy(w.chunk[len(w.chunk):cap(w.chunk)], p)
+		w.chunk = w.chunk[:len(w.chunk)+n]
+		p = p[n:]
+		numWritten += n
+	}
+	return numWritten, nil
+}
+
+func (w *EncryptWriter) Close() error {
+	return w.writeFrame(true)
+}
+
+func (w *EncryptWriter) writeFrame(isLastFrame bool) error {
+	w.frame = w.aead.Seal(w.frame[:0], getFrameNonce(w.frameNum), w.chunk, getFrameAdditionalData(isLastFrame))
+	w.frameNum++
+	w.chunk = w.chunk[:0]
+	_, err := w.writer.Write(w.frame)
+	return err
+}
+
+func EncryptBytes(plaintext []byte, key []byte) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	encryptWriter, err := NewEncryptWriter(&buffer, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = encryptWriter.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err = encryptWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+/*
+ * Structs and functions for reading encrypted data
+ */
+
+var errDecryption = errors.New("Unable to decrypt data: the data is corrupt or the encryption key is incorrect")
+
+func readEncryptionHeader(header []byte, key []byte) (cipher.AEAD, error) {
+	if string(header[:len(encryptionMagic)]) != encryptionMagic {
+		return nil, errors.New("Data is not encrypted in the expected format")
+	}
+	return newFileCipher(key, header[len(encryptionMagic):])
+}
+
+type DecryptReader struct {
+	reader    *bufio.Reader
+	aead      cipher.AEAD
+	frameNum  uint64
+	frame     []byte
+	plaintext []byte
+	done      bool
+}
+
+func NewDecryptReader(reader io.Reader, key []byte) (*DecryptReader, error) {
+	bufReader := bufio.NewReaderSize(reader, encryptionFrameSize)
+	header := make([]byte, encryptionHeaderSize)
+	if _, err := io.ReadFull(bufReader, header); err != nil {
+		return nil, errors.Wrap(err, "Unable to read encryption header")
+	}
+	aead, err := readEncryptionHeader(header, key)
+	if err != nil {
+		return nil, err
+	}
+	return &DecryptReader{reader: bufReader, aead: aead, frame: make([]byte, encryptionFrameSize)}, nil
+}
+
+func (r *DecryptReader) Read(p []byte) (int, error) {
+	for len(r.plaintext) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plaintext)
+	r.plaintext = r.plaintext[n:]
+	return n, nil
+}
+
+func (r *DecryptReader) readFrame() error {
+	frameSize, err := io.ReadFull(r.reader, r.frame)
+	isLastFrame := false
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		isLastFrame = true
+	} else if err != nil {
+		return err
+	} else if _, err = r.reader.Peek(1); err == io.EOF {
+		isLastFrame = true
+	}
+	plaintext, err := r.aead.Open(r.frame[:0], getFrameNonce(r.frameNum), r.frame[:frameSize], getFrameAdditionalData(isLastFrame))
+	if err != nil {
+		return errDecryption
+	}
+	r.frameNum++
+	r.plaintext = plaintext
+	r.done = isLastFrame
+	return nil
+}
+
+/*
+ * DecryptReaderAt provides random access to the plaintext of an encrypted
+ * file.  It keeps the most recently decrypted chunk, as statements are
+ * generally read in order and are much smaller than a chunk.
+ */
+type DecryptReaderAt struct {
+	reader        io.ReaderAt
+	aead          cipher.AEAD
+	size          int64
+	numFrames     int64
+	lastFrameSize int64
+	mutex         sync.Mutex
+	chunkNum      int64
+	chunk         []byte
+}
+
+func NewDecryptReaderAt(reader io.ReaderAt, encryptedSize int64, key []byte) (*DecryptReaderAt, error) {
+	header := make([]byte, encryptionHeaderSize)
+	if _, err := reader.ReadAt(header, 0); err != nil {
+		return nil, errors.Wrap(err, "Unable to read encryption header")
+	}
+	aead, err := readEncryptionHeader(header, key)
+	if err != nil {
+		return nil, err
+	}
+	dataSize := encryptedSize - int64(encryptionHeaderSize)
+	numFrames := (dataSize + encryptionFrameSize - 1) / encryptionFrameSize
+	lastFrameSize := dataSize - (numFrames-1)*encryptionFrameSize
+	if numFrames == 0 || lastFrameSize < encryptionTagSize {
+		return nil, errDecryption
+	}
+	readerAt := &DecryptReaderAt{
+		reader:        reader,
+		aead:          aead,
+		size:          (numFrames-1)*encryptionChunkSize + lastFrameSize - encryptionTagSize,
+		numFrames:     numFrames,
+		lastFrameSize: lastFrameSize,
+		chunkNum:      -1,
+	}
+	// Decrypting the last chunk verifies that the file has not been truncated
+	if _, err = readerAt.getChunk(numFrames - 1); err != nil {
+		return nil, err
+	}
+	return readerAt, nil
+}
+
+// Returns the size of the plaintext
+func (r *DecryptReaderAt) Size() int64 {
+	return r.size
+}
+
+func (r *DecryptReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	numRead := 0
+	for numRead < len(p) {
+		if offset >= r.size {
+			return numRead, io.EOF
+		}
+		chunk, err := r.getChunk(offset / encryptionChunkSize)
+		if err != nil {
+			return numRead, err
+		}
+		n := copy(p[numRead:], chunk[offset%encryptionChunkSize:])
+		numRead += n
+		offset += int64(n)
+	}
+	return numRead, nil
+}
+
+func (r *DecryptReaderAt) getChunk(chunkNum int64) ([]byte, error) {
+	if chunkNum == r.chunkNum {
+		return r.chunk, nil
+	}
+	isLastFrame := chunkNum == r.numFrames-1
+	frameSize := int64(encryptionFrameSize)
+	if isLastFrame {
+		frameSize = r.lastFrameSize
+	}
+	frame := make([]byte, frameSize)
+	if _, err := r.reader.ReadAt(frame, int64(encryptionHeaderSize)+chunkNum*encryptionFrameSize); err != nil && err != io.EOF {
+		return nil, err
+	}
+	chunk, err := r.aead.Open(frame[:0], getFrameNonce(uint64(chunkNum)), frame, getFrameAdditionalData(isLastFrame))
+	if err != nil {
+		return nil, errDecryption
+	}
+	r.chunkNum = chunkNum
+	r.chunk = chunk
+	return chunk, nil
+}
+
+/*
+ * Reads the contents of a file that may or may not be encrypted, so that
+ * files from unencrypted backups can be read as before.
+ */
+func ReadFileWithDecryption(filename string) ([]byte, error) {
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil || !bytes.HasPrefix(contents, []byte(encryptionMagic)) {
+		return contents, err
+	}
+	if encryptionKey == nil {
+		return nil, errors.Errorf("File %s is encrypted, but no encryption key was provided", filename)
+	}
+	reader, err := NewDecryptReader(bytes.NewReader(contents), encryptionKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to decrypt file %s", filename)
+	}
+	plaintext := bytes.Buffer{}
+	if _, err = plaintext.ReadFrom(reader); err != nil {
+		return nil, errors.Wrapf(err, "Unable to decrypt file %s", filename)
+	}
+	return plaintext.Bytes(), nil
+}
+
+/*
+ * Opens a metadata or statistics file for reading statements from it, and
+ * returns the size of its plaintext contents as well.
+ */
+func MustOpenMetadataFileForReading(filename string) (io.ReaderAt, int64) {
+	file, err := os.Open(filename)
+	gplog.FatalOnError(err)
+	info, err := file.Stat()
+	gplog.FatalOnError(err)
+	if !IsEncryptedFile(filename) {
+		return file, info.Size()
+	}
+	if encryptionKey == nil {
+		gplog.Fatal(errors.Errorf("File %s is encrypted, but no encryption key was provided", filename), "")
+	}
+	reader, err := NewDecryptReaderAt(file, info.Size(), encryptionKey)
+	if err != nil {
+		gplog.Fatal(err, "Unable to decrypt file %s", filename)
+	}
+	return reader, reader.Size()
+}
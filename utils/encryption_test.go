@@ -0,0 +1,270 @@
+package utils_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/encryption tests", func() {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	otherKey := []byte("fedcba9876543210fedcba9876543210")
+	chunkSize := 64 * 1024
+
+	makePlaintext := func(size int) []byte {
+		plaintext := make([]byte, size)
+		for i := range plaintext {
+			plaintext[i] = byte(i % 251)
+		}
+		return plaintext
+	}
+	encrypt := func(plaintext []byte) []byte {
+		ciphertext, err := utils.EncryptBytes(plaintext, key)
+		Expect(err).ToNot(HaveOccurred())
+		return ciphertext
+	}
+	decrypt := func(ciphertext []byte, key []byte) ([]byte, error) {
+		reader, err := utils.NewDecryptReader(bytes.NewReader(ciphertext), key)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(reader)
+	}
+	writeTempFile := func(contents []byte) string {
+		file, _ := ioutil.TempFile("", "gpbackup_encryption")
+		_, _ = file.Write(contents)
+		_ = file.Close()
+		return file.Name()
+	}
+
+	Describe("ReadEncryptionKeyFile", func() {
+		salt := "000102030405060708090a0b0c0d0e0f"
+		It("reads a hex-encoded 256-bit key", func() {
+			filename := writeTempFile([]byte("format=hex\n" + hex.EncodeToString(key) + "\n"))
+			defer os.Remove(filename)
+			result, err := utils.ReadEncryptionKeyFile(filename, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal(key))
+		})
+		It("returns an error for a hex key that is not 256 bits", func() {
+			filename := writeTempFile([]byte("format=hex\n0123456789abcdef\n"))
+			defer os.Remove(filename)
+			_, err := utils.ReadEncryptionKeyFile(filename, "")
+			Expect(err).To(MatchError(ContainSubstring("must contain a 256-bit key")))
+		})
+		It("derives a key from a passphrase and the salt with PBKDF2", func() {
+			filename := writeTempFile([]byte("format=passphrase\nmy passphrase\n"))
+			defer os.Remove(filename)
+			result, err := utils.ReadEncryptionKeyFile(filename, salt)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(HaveLen(32))
+			sameResult, _ := utils.ReadEncryptionKeyFile(filename, salt)
+			Expect(sameResult).To(Equal(result))
+			otherResult, _ := utils.ReadEncryptionKeyFile(filename, "0f0e0d0c0b0a09080706050403020100")
+			Expect(otherResult).ToNot(Equal(result))
+		})
+		It("returns an error for a passphrase without a salt", func() {
+			filename := writeTempFile([]byte("format=passphrase\nmy passphrase\n"))
+			defer os.Remove(filename)
+			_, err := utils.ReadEncryptionKeyFile(filename, "")
+			Expect(err).To(MatchError(ContainSubstring("A salt is required")))
+		})
+		It("returns an error for an empty passphrase", func() {
+			filename := writeTempFile([]byte("format=passphrase\n\n"))
+			defer os.Remove(filename)
+			_, err := utils.ReadEncryptionKeyFile(filename, salt)
+			Expect(err).To(MatchError(ContainSubstring("does not contain a passphrase")))
+		})
+		It("returns an error for a key file without a format line", func() {
+			filename := writeTempFile([]byte(hex.EncodeToString(key) + "\n"))
+			defer os.Remove(filename)
+			_, err := utils.ReadEncryptionKeyFile(filename, salt)
+			Expect(err).To(MatchError(ContainSubstring("must begin with a line of either format=hex or format=passphrase")))
+		})
+		It("returns an error if the key file does not exist", func() {
+			_, err := utils.ReadEncryptionKeyFile("/tmp/gpbackup_encryption_nonexistent", salt)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("GenerateEncryptionSalt", func() {
+		It("generates a different salt each time", func() {
+			salt := utils.GenerateEncryptionSalt()
+			Expect(salt).To(HaveLen(64))
+			Expect(utils.GenerateEncryptionSalt()).ToNot(Equal(salt))
+		})
+	})
+	Describe("IsEncryptionKeyForBackup", func() {
+		It("derives the key again with the salt of the other backup", func() {
+			filename := writeTempFile([]byte("format=passphrase\nmy passphrase\n"))
+			defer os.Remove(filename)
+			otherSalt := utils.GenerateEncryptionSalt()
+			otherKey, _ := utils.ReadEncryptionKeyFile(filename, otherSalt)
+			utils.InitializeEncryptionKey(filename, utils.GenerateEncryptionSalt())
+			defer utils.InitializeEncryptionKey("", "")
+
+			Expect(utils.IsEncryptionKeyForBackup(otherSalt, utils.GetEncryptionKeyFingerprint(otherKey))).To(BeTrue())
+			Expect(utils.IsEncryptionKeyForBackup(otherSalt, utils.GetEncryptionKeyFingerprint(key))).To(BeFalse())
+		})
+	})
+	Describe("GetEncryptionFlagsString", func() {
+		It("returns no flags without encryption", func() {
+			Expect(utils.GetEncryptionFlagsString()).To(Equal(""))
+		})
+		It("passes the salt along with the key file", func() {
+			filename := writeTempFile([]byte("format=hex\n" + hex.EncodeToString(key) + "\n"))
+			defer os.Remove(filename)
+			utils.InitializeEncryptionKey(filename, "0011")
+			defer utils.InitializeEncryptionKey("", "")
+			Expect(utils.GetEncryptionFlagsString()).To(Equal(fmt.Sprintf(" --encryption-key-file %s --encryption-salt 0011", filename)))
+		})
+	})
+	Describe("GetEncryptionKeyFingerprint", func() {
+		It("returns the same fingerprint for the same key", func() {
+			Expect(utils.GetEncryptionKeyFingerprint(key)).To(Equal(utils.GetEncryptionKeyFingerprint(key)))
+			Expect(utils.GetEncryptionKeyFingerprint(key)).To(HaveLen(32))
+		})
+		It("returns different fingerprints for different keys", func() {
+			Expect(utils.GetEncryptionKeyFingerprint(key)).ToNot(Equal(utils.GetEncryptionKeyFingerprint(otherKey)))
+		})
+	})
+	Describe("EncryptWriter and DecryptReader", func() {
+		DescribeTable("round trips data", func(size int) {
+			plaintext := makePlaintext(size)
+			ciphertext := encrypt(plaintext)
+			Expect(bytes.Contains(ciphertext, plaintext[:size/2])).To(Equal(size == 0))
+			result, err := decrypt(ciphertext, key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal(plaintext[:size:size]))
+		},
+			Entry("with no data", 0),
+			Entry("with less than one chunk of data", 100),
+			Entry("with exactly one chunk of data", chunkSize),
+			Entry("with more than one chunk of data", 3*chunkSize+5),
+		)
+		It("round trips data written in small pieces", func() {
+			plaintext := makePlaintext(2*chunkSize + 7)
+			buffer := bytes.Buffer{}
+			writer, err := utils.NewEncryptWriter(&buffer, key)
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < len(plaintext); i += 1000 {
+				end := i + 1000
+				if end > len(plaintext) {
+					end = len(plaintext)
+				}
+				_, err = writer.Write(plaintext[i:end])
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(writer.Close()).To(Succeed())
+			result, err := decrypt(buffer.Bytes(), key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal(plaintext))
+		})
+		It("returns an error when decrypting with the wrong key", func() {
+			_, err := decrypt(encrypt(makePlaintext(100)), otherKey)
+			Expect(err).To(MatchError(ContainSubstring("the data is corrupt or the encryption key is incorrect")))
+		})
+		It("returns an error when the data has been modified", func() {
+			ciphertext := encrypt(makePlaintext(100))
+			ciphertext[len(ciphertext)-20] ^= 1
+			_, err := decrypt(ciphertext, key)
+			Expect(err).To(MatchError(ContainSubstring("the data is corrupt or the encryption key is incorrect")))
+		})
+		It("returns an error when the data has been truncated at a frame boundary", func() {
+			ciphertext := encrypt(makePlaintext(2*chunkSize + 5))
+			headerSize := 8 + 32
+			frameSize := chunkSize + 16
+			_, err := decrypt(ciphertext[:headerSize+frameSize], key)
+			Expect(err).To(MatchError(ContainSubstring("the data is corrupt or the encryption key is incorrect")))
+		})
+		It("returns an error when the data is not encrypted", func() {
+			_, err := decrypt([]byte("this data was never encrypted, so it has no encryption header"), key)
+			Expect(err).To(MatchError("Data is not encrypted in the expected format"))
+		})
+	})
+	Describe("DecryptReaderAt", func() {
+		It("reads byte ranges of the plaintext", func() {
+			plaintext := makePlaintext(3*chunkSize + 5)
+			ciphertext := encrypt(plaintext)
+			reader, err := utils.NewDecryptReaderAt(bytes.NewReader(ciphertext), int64(len(ciphertext)), key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reader.Size()).To(Equal(int64(len(plaintext))))
+
+			for _, byteRange := range [][2]int{{10, 20}, {chunkSize - 3, chunkSize + 3}, {5, 2*chunkSize + 10}, {3*chunkSize + 1, 3*chunkSize + 5}} {
+				result := make([]byte, byteRange[1]-byteRange[0])
+				_, err = reader.ReadAt(result, int64(byteRange[0]))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result).To(Equal(plaintext[byteRange[0]:byteRange[1]]))
+			}
+		})
+		It("returns io.EOF when reading past the end of the plaintext", func() {
+			ciphertext := encrypt(makePlaintext(100))
+			reader, err := utils.NewDecryptReaderAt(bytes.NewReader(ciphertext), int64(len(ciphertext)), key)
+			Expect(err).ToNot(HaveOccurred())
+			result := make([]byte, 10)
+			numRead, err := reader.ReadAt(result, 95)
+			Expect(numRead).To(Equal(5))
+			Expect(err).To(Equal(io.EOF))
+		})
+		It("returns an error when the data has been truncated", func() {
+			ciphertext := encrypt(makePlaintext(2*chunkSize + 5))
+			truncated := ciphertext[:len(ciphertext)-21]
+			_, err := utils.NewDecryptReaderAt(bytes.NewReader(truncated), int64(len(truncated)), key)
+			Expect(err).To(MatchError(ContainSubstring("the data is corrupt or the encryption key is incorrect")))
+		})
+	})
+	Describe("Encrypted metadata files", func() {
+		BeforeEach(func() {
+			utils.SetEncryptionParameters("/tmp/key", key)
+		})
+		AfterEach(func() {
+			utils.SetEncryptionParameters("", nil)
+		})
+		It("counts plaintext bytes when writing an encrypted file and reads statements back", func() {
+			file, _ := ioutil.TempFile("", "gpbackup_encryption")
+			_ = file.Close()
+			defer os.Remove(file.Name())
+
+			fileWithByteCount := utils.NewFileWithByteCountFromFile(file.Name())
+			statements := []string{"CREATE SCHEMA foo;\n", "CREATE TABLE foo.bar (i int);\n"}
+			for _, statement := range statements {
+				fileWithByteCount.MustPrintf(statement)
+			}
+			Expect(fileWithByteCount.ByteCount).To(Equal(uint64(len(statements[0] + statements[1]))))
+			fileWithByteCount.Close()
+			Expect(utils.IsEncryptedFile(file.Name())).To(BeTrue())
+
+			reader, size := utils.MustOpenMetadataFileForReading(file.Name())
+			Expect(size).To(Equal(int64(len(statements[0] + statements[1]))))
+			result := make([]byte, len(statements[1]))
+			_, err := reader.ReadAt(result, int64(len(statements[0])))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result)).To(Equal(statements[1]))
+		})
+		It("writes and reads an encrypted table of contents", func() {
+			file, _ := ioutil.TempFile("", "gpbackup_encryption")
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+			defer os.Remove(file.Name())
+
+			toc := &utils.TOC{}
+			toc.InitializeEntryMap()
+			toc.AddMasterDataEntry("public", "foo", 3456, "(i)", 10)
+			toc.WriteToFileAndMakeReadOnly(file.Name())
+			Expect(utils.IsEncryptedFile(file.Name())).To(BeTrue())
+
+			result := utils.NewTOC(file.Name())
+			Expect(result.DataEntries).To(HaveLen(1))
+			Expect(result.DataEntries[0].Oid).To(Equal(uint32(3456)))
+			Expect(result.DataEntries[0].RowsCopied).To(Equal(int64(10)))
+		})
+	})
+})
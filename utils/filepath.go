@@ -45,11 +45,16 @@ func (backupFPInfo *FilePathInfo) IsUserSpecifiedBackupDir() bool {
 }
 
 func (backupFPInfo *FilePathInfo) GetDirForContent(contentID int) string {
+	return path.Join(backupFPInfo.GetBackupsDirForContent(contentID), backupFPInfo.Timestamp[0:8], backupFPInfo.Timestamp)
+}
+
+// This is the directory containing the backup directories for all timestamps
+func (backupFPInfo *FilePathInfo) GetBackupsDirForContent(contentID int) string {
 	if backupFPInfo.IsUserSpecifiedBackupDir() {
 		segDir := fmt.Sprintf("%s%d", backupFPInfo.UserSpecifiedSegPrefix, contentID)
-		return path.Join(backupFPInfo.UserSpecifiedBackupDir, segDir, "backups", backupFPInfo.Timestamp[0:8], backupFPInfo.Timestamp)
+		return path.Join(backupFPInfo.UserSpecifiedBackupDir, segDir, "backups")
 	}
-	return path.Join(backupFPInfo.SegDirMap[contentID], "backups", backupFPInfo.Timestamp[0:8], backupFPInfo.Timestamp)
+	return path.Join(backupFPInfo.SegDirMap[contentID], "backups")
 }
 
 func (backupFPInfo *FilePathInfo) replaceCopyFormatStringsInPath(templateFilePath string, contentID int) string {
@@ -79,11 +84,48 @@ func (backupFPInfo *FilePathInfo) GetTableBackupFilePathForCopyCommand(tableOid
 	if usingCompression {
 		backupFilePath += compressionProgram.Extension
 	}
+	return path.Join(backupFPInfo.getSegmentDirForCopyCommand(), backupFilePath)
+}
+
+func (backupFPInfo *FilePathInfo) getSegmentDirForCopyCommand() string {
 	baseDir := "<SEG_DATA_DIR>"
 	if backupFPInfo.IsUserSpecifiedBackupDir() {
 		baseDir = path.Join(backupFPInfo.UserSpecifiedBackupDir, fmt.Sprintf("%s<SEGID>", backupFPInfo.UserSpecifiedSegPrefix))
 	}
-	return path.Join(baseDir, "backups", backupFPInfo.Timestamp[0:8], backupFPInfo.Timestamp, backupFilePath)
+	return path.Join(baseDir, "backups", backupFPInfo.Timestamp[0:8], backupFPInfo.Timestamp)
+}
+
+/*
+ * When each table has its own data file, gpbackup_helper records the size and
+ * checksum of each data file on a segment in this file as the data is written.
+ */
+func (backupFPInfo *FilePathInfo) GetSegmentChecksumFilePath(contentID int) string {
+	templateFilePath := backupFPInfo.GetSegmentChecksumFilePathForCopyCommand()
+	return backupFPInfo.replaceCopyFormatStringsInPath(templateFilePath, contentID)
+}
+
+func (backupFPInfo *FilePathInfo) GetSegmentChecksumFilePathForCopyCommand() string {
+	return path.Join(backupFPInfo.getSegmentDirForCopyCommand(), fmt.Sprintf("gpbackup_<SEGID>_%s_checksums", backupFPInfo.Timestamp))
+}
+
+/*
+ * When restoring to a cluster with a different number of segments, the data
+ * files of a segment in the backup may be in the backup directory of another
+ * segment in the restore cluster.
+ */
+func (backupFPInfo *FilePathInfo) GetTableBackupFilePathForBackupSegment(contentID int, backupContentID int, tableOid uint32) string {
+	templateFilePath := backupFPInfo.GetTableBackupFilePathForCopyCommand(tableOid, false)
+	return backupFPInfo.replaceCopyFormatStringsForBackupSegment(templateFilePath, contentID, backupContentID)
+}
+
+func (backupFPInfo *FilePathInfo) GetSegmentChecksumFilePathForBackupSegment(contentID int, backupContentID int) string {
+	templateFilePath := backupFPInfo.GetSegmentChecksumFilePathForCopyCommand()
+	return backupFPInfo.replaceCopyFormatStringsForBackupSegment(templateFilePath, contentID, backupContentID)
+}
+
+func (backupFPInfo *FilePathInfo) replaceCopyFormatStringsForBackupSegment(templateFilePath string, contentID int, backupContentID int) string {
+	filePath := strings.Replace(templateFilePath, "<SEG_DATA_DIR>", backupFPInfo.SegDirMap[contentID], -1)
+	return strings.Replace(filePath, "<SEGID>", strconv.Itoa(backupContentID), -1)
 }
 
 var metadataFilenameMap = map[string]string{
@@ -92,6 +134,8 @@ var metadataFilenameMap = map[string]string{
 	"statistics":        "statistics.sql",
 	"table of contents": "toc.yaml",
 	"report":            "report",
+	"journal":           "journal",
+	"plain script":      "script.sql",
 }
 
 func (backupFPInfo *FilePathInfo) GetBackupFilePath(filetype string) string {
@@ -118,10 +162,27 @@ func (backupFPInfo *FilePathInfo) GetRestoreReportFilePath(restoreTimestamp stri
 	return path.Join(backupFPInfo.GetDirForContent(-1), fmt.Sprintf("gprestore_%s_%s_report", backupFPInfo.Timestamp, restoreTimestamp))
 }
 
+// There is one restore journal per backup, so only one restore of a backup can be resumed at a time.
+func (backupFPInfo *FilePathInfo) GetRestoreJournalFilePath() string {
+	return path.Join(backupFPInfo.GetDirForContent(-1), fmt.Sprintf("gprestore_%s_journal", backupFPInfo.Timestamp))
+}
+
+func (backupFPInfo *FilePathInfo) GetVerifyReportFilePath(restoreTimestamp string) string {
+	return path.Join(backupFPInfo.GetDirForContent(-1), fmt.Sprintf("gprestore_%s_%s_verify_report", backupFPInfo.Timestamp, restoreTimestamp))
+}
+
 func (backupFPInfo *FilePathInfo) GetConfigFilePath() string {
 	return backupFPInfo.GetBackupFilePath("config")
 }
 
+func (backupFPInfo *FilePathInfo) GetPlainScriptFilePath() string {
+	return backupFPInfo.GetBackupFilePath("plain script")
+}
+
+func (backupFPInfo *FilePathInfo) GetJournalFilePath() string {
+	return backupFPInfo.GetBackupFilePath("journal")
+}
+
 func (backupFPInfo *FilePathInfo) GetSegmentTOCFilePath(contentID int) string {
 	return fmt.Sprintf("%s/gpbackup_%d_%s_toc.yaml", backupFPInfo.GetDirForContent(contentID), contentID, backupFPInfo.Timestamp)
 }
@@ -48,6 +48,18 @@ var _ = Describe("utils/filepath tests", func() {
 			Expect(fpInfo.GetDirForContent(-1)).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101"))
 		})
 	})
+	Describe("GetBackupsDirForContent", func() {
+		It("returns the directory containing all backups", func() {
+			c.Segments[0] = cluster.SegConfig{DataDir: segDirOne}
+			fpInfo := utils.NewFilePathInfo(c, "", "20170101010101", "gpseg")
+			Expect(fpInfo.GetBackupsDirForContent(-1)).To(Equal("/data/gpseg-1/backups"))
+			Expect(fpInfo.GetBackupsDirForContent(0)).To(Equal("/data/gpseg0/backups"))
+		})
+		It("returns the directory containing all backups based on the user specified path", func() {
+			fpInfo := utils.NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg")
+			Expect(fpInfo.GetBackupsDirForContent(-1)).To(Equal("/foo/bar/gpseg-1/backups"))
+		})
+	})
 	Describe("GetTableBackupFilePathForCopyCommand()", func() {
 		It("returns table file path for copy command", func() {
 			fpInfo := utils.NewFilePathInfo(c, "", "20170101010101", "gpseg")
@@ -66,6 +78,16 @@ var _ = Describe("utils/filepath tests", func() {
 			Expect(fpInfo.GetTableBackupFilePathForCopyCommand(1234, true)).To(Equal("/foo/bar/gpseg<SEGID>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101"))
 		})
 	})
+	Describe("GetSegmentChecksumFilePath", func() {
+		It("returns the checksum file path for copy command", func() {
+			fpInfo := utils.NewFilePathInfo(c, "", "20170101010101", "gpseg")
+			Expect(fpInfo.GetSegmentChecksumFilePathForCopyCommand()).To(Equal("<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums"))
+		})
+		It("returns the checksum file path for a segment based on user specified path", func() {
+			fpInfo := utils.NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg")
+			Expect(fpInfo.GetSegmentChecksumFilePath(0)).To(Equal("/foo/bar/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_checksums"))
+		})
+	})
 	Describe("GetReportFilePath", func() {
 		It("returns report file path", func() {
 			fpInfo := utils.NewFilePathInfo(c, "", "20170101010101", "gpseg")
@@ -94,6 +116,22 @@ var _ = Describe("utils/filepath tests", func() {
 			Expect(fpInfo.GetTableBackupFilePath(-1, 1234, true)).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101/gpbackup_-1_20170101010101"))
 		})
 	})
+	Describe("GetTableBackupFilePathForBackupSegment", func() {
+		It("returns the path of the data file of a segment in the backup in the directory of another segment", func() {
+			fpInfo := utils.NewFilePathInfo(c, "", "20170101010101", "gpseg")
+			Expect(fpInfo.GetTableBackupFilePathForBackupSegment(-1, 3, 1234)).To(Equal("/data/gpseg-1/backups/20170101/20170101010101/gpbackup_3_20170101010101_1234"))
+		})
+		It("returns the path of the data file of a segment in the backup based on user specified path", func() {
+			fpInfo := utils.NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg")
+			Expect(fpInfo.GetTableBackupFilePathForBackupSegment(-1, 3, 1234)).To(Equal("/foo/bar/gpseg3/backups/20170101/20170101010101/gpbackup_3_20170101010101_1234"))
+		})
+	})
+	Describe("GetSegmentChecksumFilePathForBackupSegment", func() {
+		It("returns the path of the checksum file of a segment in the backup in the directory of another segment", func() {
+			fpInfo := utils.NewFilePathInfo(c, "", "20170101010101", "gpseg")
+			Expect(fpInfo.GetSegmentChecksumFilePathForBackupSegment(-1, 3)).To(Equal("/data/gpseg-1/backups/20170101/20170101010101/gpbackup_3_20170101010101_checksums"))
+		})
+	})
 	Describe("ParseSegPrefix", func() {
 		AfterEach(func() {
 			operating.System.Glob = filepath.Glob
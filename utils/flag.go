@@ -30,6 +30,23 @@ func CheckExclusiveFlags(flags *pflag.FlagSet, flagNames ...string) {
 	}
 }
 
+/*
+ * Returns the flags that were set, for recording in a backup or restore
+ * journal.  Flags that only affect logging, or that make a restore a dry
+ * run, may differ when the backup or restore is resumed, so they are not
+ * recorded.
+ */
+func GetJournalFlags(flags *pflag.FlagSet) map[string]string {
+	ignoredFlags := map[string]bool{"debug": true, "dry-run": true, "dry-run-file": true, "quiet": true, "resume": true, "verbose": true}
+	journalFlags := make(map[string]string, 0)
+	flags.Visit(func(flag *pflag.Flag) {
+		if !ignoredFlags[flag.Name] {
+			journalFlags[flag.Name] = flag.Value.String()
+		}
+	})
+	return journalFlags
+}
+
 /*
  * Functions for validating flag values
  */
@@ -61,6 +61,17 @@ var _ = Describe("utils/flag tests", func() {
 				utils.CheckExclusiveFlags(flagSet, "stringFlag", "boolFlag")
 			})
 		})
+		Context("GetJournalFlags", func() {
+			It("records the flags that were set, except those that only affect logging or make a dry run", func() {
+				_ = flagSet.Bool("verbose", false, "")
+				_ = flagSet.Bool("dry-run", false, "")
+				_ = flagSet.String("resume", "", "")
+				_ = flagSet.StringSlice("sliceFlag", []string{}, "")
+				err := flagSet.Parse([]string{"--stringFlag", "foo", "--verbose", "--dry-run", "--resume", "20170101010101", "--sliceFlag", "a", "--sliceFlag", "b"})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(utils.GetJournalFlags(flagSet)).To(Equal(map[string]string{"stringFlag": "foo", "sliceFlag": "[a,b]"}))
+			})
+		})
 		Context("HandleSingleDashes", func() {
 			It("replaces single dash at beginning of command", func() {
 				result := utils.HandleSingleDashes([]string{"-some_flag", "some_argument"})
@@ -0,0 +1,243 @@
+package utils
+
+/*
+ * This file contains structs and functions related to the backup history file,
+ * which records every backup taken on the cluster so that backups can be found
+ * without searching the backup directories.
+ */
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	HISTORY_STATUS_SUCCESS = "Success"
+	HISTORY_STATUS_FAILURE = "Failure"
+)
+
+type History struct {
+	Entries []HistoryEntry
+}
+
+type HistoryEntry struct {
+	BackupConfig   `yaml:",inline"`
+	Timestamp      string
+	EndTime        string
+	Status         string
+	ErrorMessage   string
+	BackupDir      string
+	DatabaseSize   string
+	IncludeSchemas []string
+	ExcludeSchemas []string
+	IncludeTables  []string
+	ExcludeTables  []string
+	TableFilters   map[string]string
+	ObjectCounts   map[string]int
+}
+
+type HistoryFilter struct {
+	DatabaseName   string
+	Status         string
+	BackupType     string
+	WithStatistics bool
+	Before         string
+	After          string
+	Limit          int
+}
+
+func GetHistoryFilePath(masterDataDir string) string {
+	return path.Join(masterDataDir, "gpbackup_history.yaml")
+}
+
+// A missing history file is treated as an empty history, as no backups have been recorded yet.
+func ReadHistoryFile(filename string) *History {
+	history := &History{}
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		if operating.System.IsNotExist(err) {
+			return history
+		}
+		gplog.Fatal(err, "Could not read history file %s", filename)
+	}
+	err = yaml.Unmarshal(contents, history)
+	if err != nil {
+		gplog.Fatal(err, "Could not parse history file %s", filename)
+	}
+	return history
+}
+
+/*
+ * We write the history to a temporary file and then rename it, so that the
+ * history file is never left partially written if the process is interrupted.
+ */
+func (history *History) WriteToFile(filename string) {
+	tempFilename := fmt.Sprintf("%s.%d.tmp", filename, operating.System.Getpid())
+	historyFile := iohelper.MustOpenFileForWriting(tempFilename)
+	historyContents, err := yaml.Marshal(history)
+	gplog.FatalOnError(err)
+	MustPrintBytes(historyFile, historyContents)
+	err = historyFile.Close()
+	gplog.FatalOnError(err)
+	err = os.Rename(tempFilename, filename)
+	gplog.FatalOnError(err)
+}
+
+/*
+ * Multiple backups may finish at the same time, so we hold an exclusive lock
+ * on a separate lock file while reading and rewriting the history file.
+ */
+func LockHistoryFile(filename string) *os.File {
+	lockFile, err := os.OpenFile(fmt.Sprintf("%s.lck", filename), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		gplog.Fatal(err, "Could not open lock file for history file %s", filename)
+	}
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		gplog.Fatal(err, "Could not lock history file %s", filename)
+	}
+	return lockFile
+}
+
+func UnlockHistoryFile(lockFile *os.File) {
+	_ = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+	_ = lockFile.Close()
+}
+
+func AddHistoryEntry(filename string, entry HistoryEntry) {
+	lockFile := LockHistoryFile(filename)
+	defer UnlockHistoryFile(lockFile)
+	history := ReadHistoryFile(filename)
+	history.AddEntry(entry)
+	history.WriteToFile(filename)
+}
+
+/*
+ * Entries are kept in descending timestamp order, so the most recent backup is
+ * always first.  A backup that is resumed with gpbackup --resume replaces the
+ * entry recorded when it was interrupted.
+ */
+func (history *History) AddEntry(entry HistoryEntry) {
+	if existingEntry := history.FindEntry(entry.Timestamp); existingEntry != nil {
+		*existingEntry = entry
+		return
+	}
+	history.Entries = append(history.Entries, entry)
+	sort.SliceStable(history.Entries, func(i int, j int) bool {
+		return history.Entries[i].Timestamp > history.Entries[j].Timestamp
+	})
+}
+
+func (history *History) FindEntry(timestamp string) *HistoryEntry {
+	for i := range history.Entries {
+		if history.Entries[i].Timestamp == timestamp {
+			return &history.Entries[i]
+		}
+	}
+	return nil
+}
+
+func (history *History) FilterEntries(filter HistoryFilter) []HistoryEntry {
+	entries := make([]HistoryEntry, 0)
+	for _, entry := range history.Entries {
+		if filter.Limit > 0 && len(entries) >= filter.Limit {
+			break
+		}
+		if entry.MatchesFilter(filter) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (entry *HistoryEntry) MatchesFilter(filter HistoryFilter) bool {
+	if filter.DatabaseName != "" && UnquoteIdent(entry.DatabaseName) != UnquoteIdent(filter.DatabaseName) {
+		return false
+	}
+	if filter.Status != "" && !strings.EqualFold(entry.Status, filter.Status) {
+		return false
+	}
+	if filter.BackupType != "" && !strings.EqualFold(entry.GetBackupType(), filter.BackupType) {
+		return false
+	}
+	if filter.WithStatistics && !entry.WithStatistics {
+		return false
+	}
+	if filter.Before != "" && entry.Timestamp >= filter.Before {
+		return false
+	}
+	if filter.After != "" && entry.Timestamp <= filter.After {
+		return false
+	}
+	return true
+}
+
+func (entry *HistoryEntry) GetBackupType() string {
+	if entry.MetadataOnly {
+		return "metadata-only"
+	} else if entry.DataOnly {
+		return "data-only"
+	} else if entry.Incremental {
+		return "incremental"
+	} else if entry.Format == "plain" {
+		return "plain"
+	} else if entry.MaskingPolicyFingerprint != "" {
+		return "masked"
+	} else if entry.RowFiltered {
+		return "row-filtered"
+	}
+	return "full"
+}
+
+func (entry *HistoryEntry) GetDuration() string {
+	if entry.EndTime == "" {
+		return ""
+	}
+	endTime, err := time.ParseInLocation("20060102150405", entry.EndTime, operating.System.Local)
+	if err != nil {
+		return ""
+	}
+	_, _, duration := GetDurationInfo(entry.Timestamp, endTime)
+	return duration
+}
+
+func UnquoteIdent(ident string) string {
+	if matches := QuotedIdentifier.FindStringSubmatch(ident); len(matches) > 1 {
+		return ReplacerUnescape.Replace(matches[1])
+	}
+	return ident
+}
+
+func ValidateHistoryFilter(filter HistoryFilter) {
+	if filter.Status != "" && !strings.EqualFold(filter.Status, HISTORY_STATUS_SUCCESS) && !strings.EqualFold(filter.Status, HISTORY_STATUS_FAILURE) {
+		gplog.Fatal(errors.Errorf("Status %s is invalid.  Valid statuses are success and failure.", filter.Status), "")
+	}
+	validTypes := []string{"full", "incremental", "plain", "masked", "row-filtered", "data-only", "metadata-only"}
+	if filter.BackupType != "" {
+		isValidType := false
+		for _, backupType := range validTypes {
+			if strings.EqualFold(filter.BackupType, backupType) {
+				isValidType = true
+			}
+		}
+		if !isValidType {
+			gplog.Fatal(errors.Errorf("Backup type %s is invalid.  Valid types are %s.", filter.BackupType, strings.Join(validTypes, ", ")), "")
+		}
+	}
+	for _, timestamp := range []string{filter.Before, filter.After} {
+		if timestamp != "" && !IsValidTimestamp(timestamp) {
+			gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", timestamp), "")
+		}
+	}
+}
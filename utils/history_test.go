@@ -0,0 +1,163 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/history tests", func() {
+	full := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", WithStatistics: true}, Timestamp: "20170101010101", Status: utils.HISTORY_STATUS_SUCCESS}
+	incremental := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", Incremental: true}, Timestamp: "20170102010101", Status: utils.HISTORY_STATUS_SUCCESS}
+	failed := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: `"TestDB"`}, Timestamp: "20170103010101", Status: utils.HISTORY_STATUS_FAILURE}
+	metadataOnly := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "otherdb", MetadataOnly: true}, Timestamp: "20170104010101", Status: utils.HISTORY_STATUS_SUCCESS}
+	plain := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", Format: "plain"}, Timestamp: "20170107010101", Status: utils.HISTORY_STATUS_SUCCESS}
+	masked := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", MaskingPolicyFingerprint: "0123456789abcdef"}, Timestamp: "20170106010101", Status: utils.HISTORY_STATUS_SUCCESS}
+	rowFiltered := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", RowFiltered: true}, Timestamp: "20170105010101", Status: utils.HISTORY_STATUS_SUCCESS, TableFilters: map[string]string{"public.foo": "id > 10"}}
+	var history *utils.History
+	BeforeEach(func() {
+		history = &utils.History{}
+		history.AddEntry(incremental)
+		history.AddEntry(metadataOnly)
+		history.AddEntry(full)
+		history.AddEntry(failed)
+	})
+	Describe("AddEntry", func() {
+		It("keeps entries in descending timestamp order", func() {
+			Expect(history.Entries).To(Equal([]utils.HistoryEntry{metadataOnly, failed, incremental, full}))
+		})
+		It("replaces an existing entry with the same timestamp", func() {
+			resumed := failed
+			resumed.Status = utils.HISTORY_STATUS_SUCCESS
+			resumed.ErrorMessage = ""
+			history.AddEntry(resumed)
+			Expect(history.Entries).To(Equal([]utils.HistoryEntry{metadataOnly, resumed, incremental, full}))
+		})
+	})
+	Describe("FindEntry", func() {
+		It("returns the entry with the given timestamp", func() {
+			Expect(*history.FindEntry("20170102010101")).To(Equal(incremental))
+		})
+		It("returns nil if there is no entry with the given timestamp", func() {
+			Expect(history.FindEntry("20170105010101")).To(BeNil())
+		})
+	})
+	Describe("FilterEntries", func() {
+		It("returns all entries with an empty filter", func() {
+			Expect(history.FilterEntries(utils.HistoryFilter{})).To(Equal([]utils.HistoryEntry{metadataOnly, failed, incremental, full}))
+		})
+		It("filters on database name", func() {
+			Expect(history.FilterEntries(utils.HistoryFilter{DatabaseName: "testdb"})).To(Equal([]utils.HistoryEntry{incremental, full}))
+		})
+		It("filters on a database name requiring quotes", func() {
+			Expect(history.FilterEntries(utils.HistoryFilter{DatabaseName: "TestDB"})).To(Equal([]utils.HistoryEntry{failed}))
+		})
+		It("filters on status regardless of case", func() {
+			Expect(history.FilterEntries(utils.HistoryFilter{Status: "failure"})).To(Equal([]utils.HistoryEntry{failed}))
+		})
+		It("filters on backup type", func() {
+			Expect(history.FilterEntries(utils.HistoryFilter{BackupType: "full"})).To(Equal([]utils.HistoryEntry{failed, full}))
+			Expect(history.FilterEntries(utils.HistoryFilter{BackupType: "incremental"})).To(Equal([]utils.HistoryEntry{incremental}))
+			Expect(history.FilterEntries(utils.HistoryFilter{BackupType: "metadata-only"})).To(Equal([]utils.HistoryEntry{metadataOnly}))
+		})
+		It("does not treat a backup with filtered rows as a full backup", func() {
+			history.AddEntry(rowFiltered)
+			Expect(history.FilterEntries(utils.HistoryFilter{BackupType: "full"})).To(Equal([]utils.HistoryEntry{failed, full}))
+			Expect(history.FilterEntries(utils.HistoryFilter{BackupType: "row-filtered"})).To(Equal([]utils.HistoryEntry{rowFiltered}))
+		})
+		It("does not treat a plain backup as a full backup", func() {
+			history.AddEntry(plain)
+			Expect(history.FilterEntries(utils.HistoryFilter{BackupType: "full"})).To(Equal([]utils.HistoryEntry{failed, full}))
+			Expect(history.FilterEntries(utils.HistoryFilter{BackupType: "plain"})).To(Equal([]utils.HistoryEntry{plain}))
+		})
+		It("does not treat a masked backup as a full backup", func() {
+			history.AddEntry(masked)
+			Expect(history.FilterEntries(utils.HistoryFilter{BackupType: "full"})).To(Equal([]utils.HistoryEntry{failed, full}))
+			Expect(history.FilterEntries(utils.HistoryFilter{BackupType: "masked"})).To(Equal([]utils.HistoryEntry{masked}))
+		})
+		It("filters on statistics", func() {
+			Expect(history.FilterEntries(utils.HistoryFilter{WithStatistics: true})).To(Equal([]utils.HistoryEntry{full}))
+		})
+		It("filters on timestamp range", func() {
+			Expect(history.FilterEntries(utils.HistoryFilter{After: "20170101010101", Before: "20170104010101"})).To(Equal([]utils.HistoryEntry{failed, incremental}))
+		})
+		It("limits the number of entries returned", func() {
+			Expect(history.FilterEntries(utils.HistoryFilter{DatabaseName: "testdb", Limit: 1})).To(Equal([]utils.HistoryEntry{incremental}))
+		})
+		It("finds the last successful full backup of a database with statistics", func() {
+			filter := utils.HistoryFilter{DatabaseName: "testdb", Status: "success", BackupType: "full", WithStatistics: true, Limit: 1}
+			Expect(history.FilterEntries(filter)).To(Equal([]utils.HistoryEntry{full}))
+		})
+	})
+	Describe("GetDuration", func() {
+		It("returns the duration of the backup", func() {
+			entry := utils.HistoryEntry{Timestamp: "20170101010101", EndTime: "20170101020304"}
+			Expect(entry.GetDuration()).To(Equal("1:02:03"))
+		})
+		It("returns an empty string if the end time is not recorded", func() {
+			entry := utils.HistoryEntry{Timestamp: "20170101010101"}
+			Expect(entry.GetDuration()).To(Equal(""))
+		})
+	})
+	Describe("ValidateHistoryFilter", func() {
+		It("accepts a valid filter", func() {
+			utils.ValidateHistoryFilter(utils.HistoryFilter{Status: "Success", BackupType: "Incremental", Before: "20170101010101"})
+		})
+		It("panics on an invalid status", func() {
+			defer testhelper.ShouldPanicWithMessage("Status unknown is invalid.  Valid statuses are success and failure.")
+			utils.ValidateHistoryFilter(utils.HistoryFilter{Status: "unknown"})
+		})
+		It("panics on an invalid backup type", func() {
+			defer testhelper.ShouldPanicWithMessage("Backup type partial is invalid.  Valid types are full, incremental, plain, masked, row-filtered, data-only, metadata-only.")
+			utils.ValidateHistoryFilter(utils.HistoryFilter{BackupType: "partial"})
+		})
+		It("panics on an invalid timestamp", func() {
+			defer testhelper.ShouldPanicWithMessage("Timestamp 2017 is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.")
+			utils.ValidateHistoryFilter(utils.HistoryFilter{After: "2017"})
+		})
+	})
+	Describe("AddHistoryEntry", func() {
+		var tempDir string
+		BeforeEach(func() {
+			var err error
+			tempDir, err = ioutil.TempDir("", "history_test")
+			Expect(err).ToNot(HaveOccurred())
+			operating.System = operating.InitializeSystemFunctions()
+			operating.System.Now = func() time.Time { return time.Date(2017, 1, 1, 1, 1, 1, 1, time.Local) }
+		})
+		AfterEach(func() {
+			_ = os.RemoveAll(tempDir)
+		})
+		It("returns an empty history if the history file does not exist", func() {
+			Expect(utils.ReadHistoryFile(path.Join(tempDir, "gpbackup_history.yaml")).Entries).To(BeEmpty())
+		})
+		It("creates the history file and adds entries to it", func() {
+			historyFilename := utils.GetHistoryFilePath(tempDir)
+			entry := utils.HistoryEntry{
+				BackupConfig: utils.BackupConfig{DatabaseName: "testdb", Compressed: true},
+				Timestamp:    "20170101010101",
+				Status:       utils.HISTORY_STATUS_SUCCESS,
+				ObjectCounts: map[string]int{"tables": 2},
+			}
+			utils.AddHistoryEntry(historyFilename, entry)
+			utils.AddHistoryEntry(historyFilename, incremental)
+
+			history := utils.ReadHistoryFile(historyFilename)
+			Expect(history.Entries).To(HaveLen(2))
+			Expect(history.Entries[0].Timestamp).To(Equal("20170102010101"))
+			Expect(history.Entries[0].Incremental).To(BeTrue())
+			Expect(history.Entries[1].Timestamp).To(Equal("20170101010101"))
+			Expect(history.Entries[1].DatabaseName).To(Equal("testdb"))
+			Expect(history.Entries[1].Compressed).To(BeTrue())
+			Expect(history.Entries[1].ObjectCounts).To(Equal(map[string]int{"tables": 2}))
+		})
+	})
+})
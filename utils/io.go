@@ -98,9 +98,32 @@ func NewFileWithByteCount(writer io.Writer) *FileWithByteCount {
 	return &FileWithByteCount{"", writer, nil, 0}
 }
 
+/*
+ * If an encryption key has been initialized, the file is encrypted as it is
+ * written.  ByteCount counts the plaintext bytes in either case, as the byte
+ * offsets in the TOC refer to the plaintext.
+ */
 func NewFileWithByteCountFromFile(filename string) *FileWithByteCount {
 	file := iohelper.MustOpenFileForWriting(filename)
-	return &FileWithByteCount{filename, file, file, 0}
+	if encryptionKey == nil {
+		return &FileWithByteCount{filename, file, file, 0}
+	}
+	encryptWriter, err := NewEncryptWriter(file, encryptionKey)
+	gplog.FatalOnError(err)
+	return &FileWithByteCount{filename, encryptWriter, &encryptedFileCloser{encryptWriter, file}, 0}
+}
+
+type encryptedFileCloser struct {
+	*EncryptWriter
+	file io.WriteCloser
+}
+
+func (closer *encryptedFileCloser) Close() error {
+	err := closer.EncryptWriter.Close()
+	if closeErr := closer.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
 func (file *FileWithByteCount) Close() {
@@ -128,3 +151,11 @@ func (file *FileWithByteCount) MustPrintf(s string, v ...interface{}) {
 	}
 	file.ByteCount += uint64(bytesWritten)
 }
+
+func (file *FileWithByteCount) MustCopyFrom(reader io.Reader) {
+	bytesWritten, err := io.Copy(file.writer, reader)
+	if err != nil {
+		gplog.Fatal(err, "Unable to write to file")
+	}
+	file.ByteCount += uint64(bytesWritten)
+}
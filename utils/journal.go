@@ -0,0 +1,359 @@
+package utils
+
+/*
+ * This file contains structs and functions related to the backup and restore
+ * journals, in which gpbackup and gprestore record their progress as they go
+ * so that an interrupted backup or restore can be finished with --resume.
+ */
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * The header records what the backup depends on: the flags it was started
+ * with, the tables whose data it backs up, and the state of its
+ * append-optimized tables.
+ */
+type JournalHeader struct {
+	CommandLine string
+	Flags       map[string]string
+	Tables      []JournalTable
+	AO          map[string]AOEntry
+}
+
+type JournalTable struct {
+	Oid    uint32
+	Schema string
+	Name   string
+}
+
+type JournalEntry struct {
+	Oid             uint32
+	Schema          string
+	Name            string
+	AttributeString string
+	RowsCopied      int64
+	File            string
+}
+
+/*
+ * The journal has one record per line, beginning with the header, and each
+ * record is written and synced as a whole.  If the process is killed while
+ * writing a record, the partial line is discarded when the journal is read.
+ */
+type Journal struct {
+	Header  JournalHeader
+	Entries map[uint32]JournalEntry
+	file    *os.File
+	mutex   sync.Mutex
+}
+
+func NewJournal(filename string, header JournalHeader) (*Journal, error) {
+	file, err := createJournalFile(filename, header)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{Header: header, Entries: make(map[uint32]JournalEntry, 0), file: file}, nil
+}
+
+/*
+ * Reads the journal of an interrupted backup and opens it so that the tables
+ * backed up after resuming are added to it.  An entry for a table that was
+ * backed up more than once replaces the earlier entry.
+ */
+func OpenJournal(filename string) (*Journal, error) {
+	journal := &Journal{Entries: make(map[uint32]JournalEntry, 0)}
+	file, err := openJournalFile(filename, &journal.Header, func(line []byte) error {
+		entry := JournalEntry{}
+		if err := decodeJournalRecord(line, &entry); err != nil {
+			return err
+		}
+		journal.Entries[entry.Oid] = entry
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	journal.file = file
+	return journal, nil
+}
+
+func (journal *Journal) AddEntry(entry JournalEntry) error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	if err := writeJournalRecord(journal.file, entry); err != nil {
+		return err
+	}
+	journal.Entries[entry.Oid] = entry
+	return nil
+}
+
+func (journal *Journal) Close() error {
+	return journal.file.Close()
+}
+
+/*
+ * The restore journal records each metadata statement executed and each table
+ * whose data was loaded by gprestore, so that gprestore --resume can skip them.
+ * Statements are identified by a checksum of their text, which is the same
+ * each time a backup is restored with the same flags.
+ */
+type RestoreJournalHeader struct {
+	CommandLine string
+	Flags       map[string]string
+}
+
+const (
+	RESTORE_JOURNAL_STATEMENT = "statement"
+	RESTORE_JOURNAL_DATA      = "data"
+)
+
+type RestoreJournalEntry struct {
+	Type         string
+	ObjectType   string
+	Name         string
+	Checksum     string
+	Oid          uint32
+	RowsRestored int64
+}
+
+type RestoreJournal struct {
+	Header      RestoreJournalHeader
+	Statements  map[string]RestoreJournalEntry
+	DataEntries map[uint32]RestoreJournalEntry
+	file        *os.File
+	mutex       sync.Mutex
+}
+
+func NewRestoreJournal(filename string, header RestoreJournalHeader) (*RestoreJournal, error) {
+	file, err := createJournalFile(filename, header)
+	if err != nil {
+		return nil, err
+	}
+	journal := &RestoreJournal{Header: header, file: file}
+	journal.initializeEntryMaps()
+	return journal, nil
+}
+
+func OpenRestoreJournal(filename string) (*RestoreJournal, error) {
+	journal := &RestoreJournal{}
+	journal.initializeEntryMaps()
+	file, err := openJournalFile(filename, &journal.Header, func(line []byte) error {
+		entry := RestoreJournalEntry{}
+		if err := decodeJournalRecord(line, &entry); err != nil {
+			return err
+		}
+		journal.addEntryToMaps(entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	journal.file = file
+	return journal, nil
+}
+
+func (journal *RestoreJournal) initializeEntryMaps() {
+	journal.Statements = make(map[string]RestoreJournalEntry, 0)
+	journal.DataEntries = make(map[uint32]RestoreJournalEntry, 0)
+}
+
+func (journal *RestoreJournal) addEntryToMaps(entry RestoreJournalEntry) {
+	if entry.Type == RESTORE_JOURNAL_DATA {
+		journal.DataEntries[entry.Oid] = entry
+	} else {
+		journal.Statements[entry.Checksum] = entry
+	}
+}
+
+func (journal *RestoreJournal) addEntry(entry RestoreJournalEntry) error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	if err := writeJournalRecord(journal.file, entry); err != nil {
+		return err
+	}
+	journal.addEntryToMaps(entry)
+	return nil
+}
+
+func (journal *RestoreJournal) AddStatement(statement StatementWithType) error {
+	return journal.addEntry(RestoreJournalEntry{
+		Type:       RESTORE_JOURNAL_STATEMENT,
+		ObjectType: statement.ObjectType,
+		Name:       MakeFQN(statement.Schema, statement.Name),
+		Checksum:   GetStatementChecksum(statement),
+	})
+}
+
+func (journal *RestoreJournal) HasStatement(statement StatementWithType) bool {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	_, ok := journal.Statements[GetStatementChecksum(statement)]
+	return ok
+}
+
+func (journal *RestoreJournal) AddDataEntry(entry MasterDataEntry, rowsRestored int64) error {
+	return journal.addEntry(RestoreJournalEntry{
+		Type:         RESTORE_JOURNAL_DATA,
+		Name:         MakeFQN(entry.Schema, entry.Name),
+		Oid:          entry.Oid,
+		RowsRestored: rowsRestored,
+	})
+}
+
+func (journal *RestoreJournal) HasDataEntry(oid uint32) bool {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	_, ok := journal.DataEntries[oid]
+	return ok
+}
+
+func (journal *RestoreJournal) Close() error {
+	return journal.file.Close()
+}
+
+func GetStatementChecksum(statement StatementWithType) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(statement.Statement)))
+}
+
+/*
+ * Functions shared by the backup and restore journals
+ */
+
+/*
+ * The key with which the records of an encrypted journal are encrypted may be
+ * derived from a passphrase and the salt of the backup, so the salt is stored
+ * unencrypted on the first line of the journal, before the header.
+ */
+type journalPreamble struct {
+	EncryptionSalt string
+}
+
+func createJournalFile(filename string, header interface{}) (*os.File, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	preamble, _ := json.Marshal(journalPreamble{EncryptionSalt: GetEncryptionSalt()})
+	if _, err = file.Write(append(preamble, '\n')); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if err = writeJournalRecord(file, header); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+/*
+ * Returns the salt with which the encryption key must be derived before the
+ * journal can be opened.
+ */
+func ReadJournalEncryptionSalt(filename string) (string, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	lineLength := bytes.IndexByte(contents, '\n')
+	if lineLength == -1 {
+		return "", errors.Errorf("Journal %s does not contain a header", filename)
+	}
+	preamble := journalPreamble{}
+	if err = json.Unmarshal(contents[:lineLength], &preamble); err != nil {
+		return "", errors.Wrapf(err, "Unable to read line 1 of journal %s", filename)
+	}
+	return preamble.EncryptionSalt, nil
+}
+
+/*
+ * Reads the header and passes each complete entry line to addEntry, then
+ * truncates any partial line and opens the journal for appending.
+ */
+func openJournalFile(filename string, header interface{}, addEntry func(line []byte) error) (*os.File, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	validLength := 0
+	lineNum := 0
+	for ; ; lineNum++ {
+		lineLength := bytes.IndexByte(contents[validLength:], '\n')
+		if lineLength == -1 {
+			break
+		}
+		line := contents[validLength : validLength+lineLength]
+		if lineNum == 0 {
+			err = json.Unmarshal(line, &journalPreamble{})
+		} else if lineNum == 1 {
+			err = decodeJournalRecord(line, header)
+		} else {
+			err = addEntry(line)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to read line %d of journal %s", lineNum+1, filename)
+		}
+		validLength += lineLength + 1
+	}
+	if lineNum < 2 {
+		return nil, errors.Errorf("Journal %s does not contain a header", filename)
+	}
+	if err = os.Truncate(filename, int64(validLength)); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+}
+
+func writeJournalRecord(file *os.File, record interface{}) error {
+	line, err := encodeJournalRecord(record)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(line); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Each record of the journal of an encrypted backup is encrypted separately.
+func encodeJournalRecord(record interface{}) ([]byte, error) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if _, key := GetEncryptionParameters(); key != nil {
+		ciphertext, err := EncryptBytes(line, key)
+		if err != nil {
+			return nil, err
+		}
+		line = []byte(base64.StdEncoding.EncodeToString(ciphertext))
+	}
+	return append(line, '\n'), nil
+}
+
+func decodeJournalRecord(line []byte, record interface{}) error {
+	if _, key := GetEncryptionParameters(); key != nil {
+		ciphertext, err := base64.StdEncoding.DecodeString(string(line))
+		if err != nil {
+			return err
+		}
+		reader, err := NewDecryptReader(bytes.NewReader(ciphertext), key)
+		if err != nil {
+			return err
+		}
+		if line, err = ioutil.ReadAll(reader); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(line, record)
+}
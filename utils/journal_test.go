@@ -0,0 +1,158 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/journal tests", func() {
+	var filename string
+	header := utils.JournalHeader{
+		CommandLine: "gpbackup --dbname testdb --jobs 2",
+		Flags:       map[string]string{"dbname": "testdb", "jobs": "2"},
+		Tables:      []utils.JournalTable{{Oid: 3456, Schema: "public", Name: "foo"}, {Oid: 4567, Schema: "public", Name: "bar"}},
+		AO:          map[string]utils.AOEntry{"public.bar": {Modcount: 3, LastDDLTimestamp: "2017-01-01 01:01:01"}},
+	}
+	fooEntry := utils.JournalEntry{Oid: 3456, Schema: "public", Name: "foo", AttributeString: "(i)", RowsCopied: 10, File: "<SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_3456.gz"}
+	barEntry := utils.JournalEntry{Oid: 4567, Schema: "public", Name: "bar", AttributeString: "(j)", RowsCopied: 20, File: "<SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_4567.gz"}
+
+	BeforeEach(func() {
+		file, _ := ioutil.TempFile("", "gpbackup_journal")
+		_ = file.Close()
+		filename = file.Name()
+	})
+	AfterEach(func() {
+		_ = os.Remove(filename)
+	})
+	writeJournal := func(entries ...utils.JournalEntry) {
+		journal, err := utils.NewJournal(filename, header)
+		Expect(err).ToNot(HaveOccurred())
+		for _, entry := range entries {
+			Expect(journal.AddEntry(entry)).To(Succeed())
+		}
+		Expect(journal.Close()).To(Succeed())
+	}
+
+	It("reads back the header and entries that were written", func() {
+		writeJournal(fooEntry, barEntry)
+
+		journal, err := utils.OpenJournal(filename)
+		Expect(err).ToNot(HaveOccurred())
+		defer journal.Close()
+		Expect(journal.Header).To(Equal(header))
+		Expect(journal.Entries).To(Equal(map[uint32]utils.JournalEntry{3456: fooEntry, 4567: barEntry}))
+	})
+	It("appends entries after the journal is reopened", func() {
+		writeJournal(fooEntry)
+		journal, err := utils.OpenJournal(filename)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(journal.AddEntry(barEntry)).To(Succeed())
+		Expect(journal.Close()).To(Succeed())
+
+		journal, err = utils.OpenJournal(filename)
+		Expect(err).ToNot(HaveOccurred())
+		defer journal.Close()
+		Expect(journal.Entries).To(Equal(map[uint32]utils.JournalEntry{3456: fooEntry, 4567: barEntry}))
+	})
+	It("keeps the latest entry for a table that was backed up more than once", func() {
+		updatedEntry := fooEntry
+		updatedEntry.RowsCopied = 11
+		writeJournal(fooEntry, updatedEntry)
+
+		journal, err := utils.OpenJournal(filename)
+		Expect(err).ToNot(HaveOccurred())
+		defer journal.Close()
+		Expect(journal.Entries).To(Equal(map[uint32]utils.JournalEntry{3456: updatedEntry}))
+	})
+	It("discards a partially written entry and appends after the last complete entry", func() {
+		writeJournal(fooEntry)
+		file, _ := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+		_, _ = file.WriteString(`{"Oid":4567,"Schema":"pub`)
+		_ = file.Close()
+
+		journal, err := utils.OpenJournal(filename)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(journal.Entries).To(Equal(map[uint32]utils.JournalEntry{3456: fooEntry}))
+		Expect(journal.AddEntry(barEntry)).To(Succeed())
+		Expect(journal.Close()).To(Succeed())
+
+		journal, err = utils.OpenJournal(filename)
+		Expect(err).ToNot(HaveOccurred())
+		defer journal.Close()
+		Expect(journal.Entries).To(Equal(map[uint32]utils.JournalEntry{3456: fooEntry, 4567: barEntry}))
+	})
+	It("returns an error if the journal does not contain a header", func() {
+		_, err := utils.OpenJournal(filename)
+		Expect(err).To(MatchError(ContainSubstring("does not contain a header")))
+	})
+	It("returns an error if an entry is corrupt", func() {
+		writeJournal(fooEntry)
+		file, _ := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+		_, _ = file.WriteString("not a journal entry\n")
+		_ = file.Close()
+
+		_, err := utils.OpenJournal(filename)
+		Expect(err).To(MatchError(ContainSubstring("Unable to read line 4 of journal")))
+	})
+	Context("with encryption", func() {
+		BeforeEach(func() {
+			utils.SetEncryptionParameters("/tmp/key", []byte("0123456789abcdef0123456789abcdef"))
+		})
+		AfterEach(func() {
+			utils.SetEncryptionParameters("", nil)
+		})
+		It("encrypts each record and reads them back", func() {
+			writeJournal(fooEntry)
+			contents, _ := ioutil.ReadFile(filename)
+			Expect(string(contents)).ToNot(ContainSubstring("public"))
+
+			journal, err := utils.OpenJournal(filename)
+			Expect(err).ToNot(HaveOccurred())
+			defer journal.Close()
+			Expect(journal.Header).To(Equal(header))
+			Expect(journal.Entries).To(Equal(map[uint32]utils.JournalEntry{3456: fooEntry}))
+		})
+		It("records the salt of the backup unencrypted", func() {
+			keyFile, _ := ioutil.TempFile("", "gpbackup_journal_key")
+			_, _ = keyFile.WriteString("format=passphrase\nmy passphrase\n")
+			_ = keyFile.Close()
+			defer os.Remove(keyFile.Name())
+			utils.InitializeEncryptionKey(keyFile.Name(), "0011")
+			defer utils.InitializeEncryptionKey("", "")
+			writeJournal(fooEntry)
+
+			salt, err := utils.ReadJournalEncryptionSalt(filename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(salt).To(Equal("0011"))
+		})
+	})
+	Describe("RestoreJournal", func() {
+		restoreHeader := utils.RestoreJournalHeader{CommandLine: "gprestore --timestamp 20170101010101", Flags: map[string]string{"timestamp": "20170101010101"}}
+		createTable := utils.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "CREATE TABLE public.foo (i int);"}
+		createIndex := utils.StatementWithType{Schema: "public", Name: "foo_idx", ObjectType: "INDEX", Statement: "CREATE INDEX foo_idx ON public.foo USING btree (i);"}
+		dataEntry := utils.MasterDataEntry{Schema: "public", Name: "foo", Oid: 3456, AttributeString: "(i)"}
+
+		It("reads back the statements and data entries that were written", func() {
+			journal, err := utils.NewRestoreJournal(filename, restoreHeader)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(journal.AddStatement(createTable)).To(Succeed())
+			Expect(journal.AddDataEntry(dataEntry, 10)).To(Succeed())
+			Expect(journal.Close()).To(Succeed())
+
+			journal, err = utils.OpenRestoreJournal(filename)
+			Expect(err).ToNot(HaveOccurred())
+			defer journal.Close()
+			Expect(journal.Header).To(Equal(restoreHeader))
+			Expect(journal.HasStatement(createTable)).To(BeTrue())
+			Expect(journal.HasStatement(createIndex)).To(BeFalse())
+			Expect(journal.HasDataEntry(3456)).To(BeTrue())
+			Expect(journal.HasDataEntry(4567)).To(BeFalse())
+			Expect(journal.DataEntries[3456]).To(Equal(utils.RestoreJournalEntry{Type: utils.RESTORE_JOURNAL_DATA, Name: "public.foo", Oid: 3456, RowsRestored: 10}))
+		})
+	})
+})
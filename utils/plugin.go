@@ -14,6 +14,17 @@ import (
 	yaml "gopkg.in/yaml.v2"
 )
 
+/*
+ * Plugins implementing any API version from the minimum to the current one
+ * are supported.  The delete_backup command was added in API version 0.2.0,
+ * so it is only called for plugins reporting that version or later.
+ */
+var (
+	MinimumPluginAPIVersion      = semver.MustParse("0.1.0")
+	CurrentPluginAPIVersion      = semver.MustParse("0.2.0")
+	DeleteBackupPluginAPIVersion = semver.MustParse("0.2.0")
+)
+
 type PluginConfig struct {
 	ExecutablePath string
 	ConfigPath     string
@@ -56,6 +67,32 @@ func (plugin *PluginConfig) RestoreFile(filenamePath string) {
 	gplog.FatalOnError(err, string(output))
 }
 
+func (plugin *PluginConfig) DeleteBackup(timestamp string) {
+	version := plugin.GetPluginAPIVersion()
+	if version.LT(DeleteBackupPluginAPIVersion) {
+		gplog.Warn("Plugin %s API version %s does not support deleting backups; files stored by the plugin for backup %s must be deleted manually", plugin.ExecutablePath, version, timestamp)
+		return
+	}
+	command := fmt.Sprintf("%s delete_backup %s %s", plugin.ExecutablePath, plugin.ConfigPath, timestamp)
+	output, err := exec.Command("bash", "-c", command).CombinedOutput()
+	gplog.FatalOnError(err, string(output))
+}
+
+func (plugin *PluginConfig) GetPluginAPIVersion() semver.Version {
+	command := fmt.Sprintf("%s plugin_api_version", plugin.ExecutablePath)
+	output, err := exec.Command("bash", "-c", command).CombinedOutput()
+	gplog.FatalOnError(err, string(output))
+	version, err := semver.Make(strings.TrimSpace(string(output)))
+	if err != nil {
+		gplog.Fatal(fmt.Errorf("Unable to parse plugin API version: %s", err.Error()), "")
+	}
+	return version
+}
+
+func IsSupportedPluginAPIVersion(version semver.Version) bool {
+	return version.GTE(MinimumPluginAPIVersion) && version.LTE(CurrentPluginAPIVersion)
+}
+
 func (plugin *PluginConfig) CheckPluginExistsOnAllHosts(c *cluster.Cluster) {
 	remoteOutput := c.GenerateAndExecuteCommand("Checking that plugin exists on all hosts", func(contentID int) string {
 		return fmt.Sprintf("source %s/greenplum_path.sh && %s plugin_api_version", operating.System.Getenv("GPHOME"), plugin.ExecutablePath)
@@ -66,13 +103,12 @@ func (plugin *PluginConfig) CheckPluginExistsOnAllHosts(c *cluster.Cluster) {
 
 	numIncorrect := 0
 	for contentID := range remoteOutput.Stdouts {
-		supportedVersion, _ := semver.Make("0.1.0")
 		version, err := semver.Make(strings.TrimSpace(remoteOutput.Stdouts[contentID]))
 		if err != nil {
 			gplog.Fatal(fmt.Errorf("Unable to parse plugin API version: %s", err.Error()), "")
 		}
-		if !version.Equals(supportedVersion) {
-			gplog.Verbose("Plugin %s API version %s is not compatibile with supported API version %s", plugin.ExecutablePath, version, supportedVersion)
+		if !IsSupportedPluginAPIVersion(version) {
+			gplog.Verbose("Plugin %s API version %s is not compatibile with supported API versions %s through %s", plugin.ExecutablePath, version, MinimumPluginAPIVersion, CurrentPluginAPIVersion)
 			numIncorrect++
 		}
 	}
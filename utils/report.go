@@ -21,19 +21,34 @@ import (
 )
 
 type BackupConfig struct {
-	BackupVersion         string
-	DatabaseName          string
-	DatabaseVersion       string
-	Compressed            bool
-	DataOnly              bool
-	IncludeSchemaFiltered bool
-	IncludeTableFiltered  bool
-	ExcludeSchemaFiltered bool
-	ExcludeTableFiltered  bool
-	MetadataOnly          bool
-	Plugin                string
-	SingleDataFile        bool
-	WithStatistics        bool
+	BackupVersion            string
+	DatabaseName             string
+	DatabaseVersion          string
+	Compressed               bool
+	CompressionType          string
+	DataOnly                 bool
+	Encrypted                bool
+	EncryptionKeyFingerprint string
+	EncryptionSalt           string
+	MaskingPolicyFingerprint string
+	IncludeSchemaFiltered    bool
+	IncludeTableFiltered     bool
+	ExcludeSchemaFiltered    bool
+	ExcludeTableFiltered     bool
+	IncludeRoleFiltered      bool
+	ExcludeRoleFiltered      bool
+	Format                   string
+	FromTimestamp            string
+	GlobalsOnly              bool
+	Incremental              bool
+	LeafPartitionData        bool
+	MetadataOnly             bool
+	Plugin                   string
+	RowFiltered              bool
+	SegmentCount             int
+	SingleDataFile           bool
+	WithStatistics           bool
+	Checksums                map[string]string
 }
 
 /*
@@ -42,8 +57,11 @@ type BackupConfig struct {
  * file that we will want to read in for a restore.
  */
 type Report struct {
-	BackupParamsString string
-	DatabaseSize       string
+	BackupParamsString     string
+	DatabaseSize           string
+	TransactionConsistency string
+	TableFilters           map[string]string
+	LockWaits              []string
 	BackupConfig
 }
 
@@ -58,8 +76,9 @@ func ParseErrorMessage(errStr string) string {
 }
 
 func (report *Report) SetBackupParamsFromFlags(dataOnly bool, ddlOnly bool, plugin string, isIncludeSchemaFiltered bool, isIncludeTableFiltered bool, isExcludeSchemaFiltered bool, isExcludeTableFiltered bool, singleDataFile bool, withStats bool) {
-	compressed, _ := GetCompressionParameters()
+	compressed, compression := GetCompressionParameters()
 	report.Compressed = compressed
+	report.CompressionType = compression.Name
 	report.IncludeSchemaFiltered = isIncludeSchemaFiltered
 	report.IncludeTableFiltered = isIncludeTableFiltered
 	report.ExcludeSchemaFiltered = isExcludeSchemaFiltered
@@ -85,13 +104,22 @@ func (report *Report) ConstructBackupParamsString() {
 	if report.ExcludeTableFiltered {
 		filterStr += "Exclude Table Filter"
 	}
+	if report.IncludeRoleFiltered {
+		filterStr += "Include Role Filter"
+	}
+	if report.ExcludeRoleFiltered {
+		filterStr += "Exclude Role Filter"
+	}
 	if filterStr == "" {
 		filterStr = "None"
 	}
 	compressStr := "None"
-	_, program := GetCompressionParameters()
 	if report.Compressed {
-		compressStr = program.Name
+		// Backups taken before the compression type was recorded always used gzip
+		compressStr = "gzip"
+		if report.CompressionType != "" {
+			compressStr = report.CompressionType
+		}
 	}
 	pluginStr := "None"
 	if report.Plugin != "" {
@@ -104,8 +132,13 @@ func (report *Report) ConstructBackupParamsString() {
 	if report.MetadataOnly {
 		sectionStr = "Metadata Only"
 	}
+	if report.GlobalsOnly {
+		sectionStr = "Global Metadata Only"
+	}
 	filesStr := "Multiple Data Files Per Segment"
-	if report.MetadataOnly {
+	if report.Format == "plain" {
+		filesStr = "Plain SQL Script"
+	} else if report.MetadataOnly {
 		filesStr = "No Data Files"
 	} else if report.SingleDataFile {
 		filesStr = "Single Data File Per Segment"
@@ -121,6 +154,35 @@ Object Filtering: %s
 Includes Statistics: %s
 Data File Format: %s`
 	report.BackupParamsString = fmt.Sprintf(backupParamsTemplate, compressStr, pluginStr, sectionStr, filterStr, statsStr, filesStr)
+	if report.Incremental {
+		report.BackupParamsString += fmt.Sprintf("\nIncremental Backup: Based on %s", report.FromTimestamp)
+	}
+	if report.Encrypted {
+		report.BackupParamsString += fmt.Sprintf("\nEncryption: AES-256-GCM, key fingerprint %s", report.EncryptionKeyFingerprint)
+	}
+	if report.MaskingPolicyFingerprint != "" {
+		report.BackupParamsString += fmt.Sprintf("\nMasking Policy: Data masked with policy fingerprint %s", report.MaskingPolicyFingerprint)
+	}
+	if report.TransactionConsistency != "" {
+		report.BackupParamsString += fmt.Sprintf("\nTransactionally Consistent: %s", report.TransactionConsistency)
+	}
+	if len(report.TableFilters) > 0 {
+		tables := make([]string, 0, len(report.TableFilters))
+		for table := range report.TableFilters {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+		report.BackupParamsString += "\nRow Filters:"
+		for _, table := range tables {
+			report.BackupParamsString += fmt.Sprintf("\n\t%s WHERE %s", table, report.TableFilters[table])
+		}
+	}
+	if len(report.LockWaits) > 0 {
+		report.BackupParamsString += "\nLock Waits:"
+		for _, lockWait := range report.LockWaits {
+			report.BackupParamsString += fmt.Sprintf("\n\t%s", lockWait)
+		}
+	}
 }
 
 func ReadConfigFile(filename string) *BackupConfig {
@@ -182,7 +244,7 @@ Backup Status: %s
 	gplog.FatalOnError(err)
 }
 
-func WriteRestoreReportFile(reportFilename string, backupTimestamp string, startTimestamp string, connection *dbconn.DBConn, restoreVersion string, errMsg string) {
+func WriteRestoreReportFile(reportFilename string, backupTimestamp string, startTimestamp string, connection *dbconn.DBConn, restoreVersion string, errMsg string, resumeSummary string) {
 	reportFile := iohelper.MustOpenFileForWriting(reportFilename)
 	reportFileTemplate := `Greenplum Database Restore Report
 
@@ -192,7 +254,7 @@ gprestore Version: %s
 
 Database Name: %s
 Command Line: %s
-
+%s
 Start Time: %s
 End Time: %s
 Duration: %s
@@ -209,9 +271,14 @@ Restore Status: %s`
 		restoreStatus = fmt.Sprintf("Failure\nRestore Error: %s", errMsg)
 	}
 
+	resumeStr := ""
+	if resumeSummary != "" {
+		resumeStr = fmt.Sprintf("Resumed From: %s\n", resumeSummary)
+	}
+
 	MustPrintf(reportFile, reportFileTemplate,
 		backupTimestamp, connection.Version.VersionString, restoreVersion,
-		connection.DBName, gprestoreCommandLine,
+		connection.DBName, gprestoreCommandLine, resumeStr,
 		start, end, duration, restoreStatus)
 	err := operating.System.Chmod(reportFilename, 0444)
 	gplog.FatalOnError(err)
@@ -181,7 +181,7 @@ types                        1000`))
 
 		It("writes a report for a failed restore", func() {
 			gplog.SetErrorCode(2)
-			utils.WriteRestoreReportFile("filename", timestamp, restoreStartTime, connection, restoreVersion, "Cannot access /tmp/backups: Permission denied")
+			utils.WriteRestoreReportFile("filename", timestamp, restoreStartTime, connection, restoreVersion, "Cannot access /tmp/backups: Permission denied", "")
 			Expect(buffer).To(gbytes.Say(`Greenplum Database Restore Report
 
 Timestamp Key: 20170101010101
@@ -200,7 +200,7 @@ Restore Error: Cannot access /tmp/backups: Permission denied`))
 		})
 		It("writes a report for a successful restore", func() {
 			gplog.SetErrorCode(0)
-			utils.WriteRestoreReportFile("filename", timestamp, restoreStartTime, connection, restoreVersion, "")
+			utils.WriteRestoreReportFile("filename", timestamp, restoreStartTime, connection, restoreVersion, "", "")
 			Expect(buffer).To(gbytes.Say(`Greenplum Database Restore Report
 
 Timestamp Key: 20170101010101
@@ -218,7 +218,7 @@ Restore Status: Success`))
 		})
 		It("writes a report for a successful restore with errors", func() {
 			gplog.SetErrorCode(1)
-			utils.WriteRestoreReportFile("filename", timestamp, restoreStartTime, connection, restoreVersion, "")
+			utils.WriteRestoreReportFile("filename", timestamp, restoreStartTime, connection, restoreVersion, "", "")
 			Expect(buffer).To(gbytes.Say(`Greenplum Database Restore Report
 
 Timestamp Key: 20170101010101
@@ -234,19 +234,38 @@ Duration: 4:03:01
 
 Restore Status: Success but non-fatal errors occurred. See log file .+ for details.`))
 		})
+		It("writes a report for a resumed restore", func() {
+			gplog.SetErrorCode(0)
+			utils.WriteRestoreReportFile("filename", timestamp, restoreStartTime, connection, restoreVersion, "", "10 metadata statement(s) and 2 table(s) restored before gprestore was interrupted")
+			Expect(buffer).To(gbytes.Say(`Greenplum Database Restore Report
+
+Timestamp Key: 20170101010101
+GPDB Version: 5\.0\.0 build test
+gprestore Version: 0\.1\.0
+
+Database Name: testdb
+Command Line: .*
+Resumed From: 10 metadata statement\(s\) and 2 table\(s\) restored before gprestore was interrupted
+
+Start Time: 2017-01-01 01:01:02
+End Time: 2017-01-01 05:04:03
+Duration: 4:03:01
+
+Restore Status: Success`))
+		})
 	})
 	Describe("SetBackupParamFromFlags", func() {
 		var backupReport *utils.Report
 		AfterEach(func() {
-			utils.InitializeCompressionParameters(false, 0)
+			utils.InitializeCompressionParameters(false, "gzip", 0)
 		})
 		It("configures the Report struct correctly", func() {
 			backupReport = &utils.Report{}
-			utils.InitializeCompressionParameters(true, 0)
+			utils.InitializeCompressionParameters(true, "gzip", 0)
 			backupReport.SetBackupParamsFromFlags(true, true, "plugin", true, true, true, true, true, true)
 			structmatcher.ExpectStructsToMatch(backupReport.BackupConfig, utils.BackupConfig{
 				BackupVersion: "", DatabaseName: "", DatabaseVersion: "",
-				DataOnly: true, Compressed: true, Plugin: "plugin", IncludeSchemaFiltered: true,
+				DataOnly: true, Compressed: true, CompressionType: "gzip", Plugin: "plugin", IncludeSchemaFiltered: true,
 				IncludeTableFiltered: true, ExcludeSchemaFiltered: true, ExcludeTableFiltered: true,
 				MetadataOnly: true, WithStatistics: true, SingleDataFile: true,
 			})
@@ -258,10 +277,100 @@ Restore Status: Success but non-fatal errors occurred. See log file .+ for detai
 			backupReport = &utils.Report{}
 		})
 		AfterEach(func() {
-			utils.InitializeCompressionParameters(false, 0)
+			utils.InitializeCompressionParameters(false, "gzip", 0)
+		})
+		It("includes the base backup for an incremental backup", func() {
+			utils.InitializeCompressionParameters(true, "gzip", 0)
+			backupReport.SetBackupParamsFromFlags(false, false, "", false, false, false, false, false, false)
+			backupReport.Incremental = true
+			backupReport.FromTimestamp = "20170101010101"
+			backupReport.ConstructBackupParamsString()
+			Expect(backupReport.BackupParamsString).To(Equal(`Compression: gzip
+Plugin Executable: None
+Backup Section: All Sections
+Object Filtering: None
+Includes Statistics: No
+Data File Format: Multiple Data Files Per Segment
+Incremental Backup: Based on 20170101010101`))
+		})
+		It("includes the compression type for a backup using zstd", func() {
+			utils.InitializeCompressionParameters(true, "zstd", 0)
+			backupReport.SetBackupParamsFromFlags(false, false, "", false, false, false, false, false, false)
+			backupReport.ConstructBackupParamsString()
+			Expect(backupReport.BackupParamsString).To(Equal(`Compression: zstd
+Plugin Executable: None
+Backup Section: All Sections
+Object Filtering: None
+Includes Statistics: No
+Data File Format: Multiple Data Files Per Segment`))
+		})
+		It("includes gzip compression for a backup taken before the compression type was recorded", func() {
+			backupReport.Compressed = true
+			backupReport.ConstructBackupParamsString()
+			Expect(backupReport.BackupParamsString).To(HavePrefix("Compression: gzip\n"))
+		})
+		It("includes the plain script format for a plain backup", func() {
+			backupReport.Format = "plain"
+			backupReport.ConstructBackupParamsString()
+			Expect(backupReport.BackupParamsString).To(ContainSubstring("\nData File Format: Plain SQL Script"))
+		})
+		It("includes the key fingerprint for an encrypted backup", func() {
+			utils.InitializeCompressionParameters(true, "gzip", 0)
+			backupReport.SetBackupParamsFromFlags(false, false, "", false, false, false, false, false, false)
+			backupReport.Encrypted = true
+			backupReport.EncryptionKeyFingerprint = "0123456789abcdef0123456789abcdef"
+			backupReport.ConstructBackupParamsString()
+			Expect(backupReport.BackupParamsString).To(Equal(`Compression: gzip
+Plugin Executable: None
+Backup Section: All Sections
+Object Filtering: None
+Includes Statistics: No
+Data File Format: Multiple Data Files Per Segment
+Encryption: AES-256-GCM, key fingerprint 0123456789abcdef0123456789abcdef`))
+		})
+		It("includes whether the backup is transactionally consistent", func() {
+			utils.InitializeCompressionParameters(true, "gzip", 0)
+			backupReport.SetBackupParamsFromFlags(false, false, "", false, false, false, false, false, false)
+			backupReport.TransactionConsistency = "Yes, 4 connections shared a snapshot"
+			backupReport.ConstructBackupParamsString()
+			Expect(backupReport.BackupParamsString).To(HaveSuffix("\nData File Format: Multiple Data Files Per Segment\nTransactionally Consistent: Yes, 4 connections shared a snapshot"))
+		})
+		It("includes the filter of each table whose rows were filtered", func() {
+			utils.InitializeCompressionParameters(true, "gzip", 0)
+			backupReport.SetBackupParamsFromFlags(false, false, "", false, false, false, false, false, false)
+			backupReport.TableFilters = map[string]string{"public.foo": "i > 10", "public.bar": "j < 5"}
+			backupReport.ConstructBackupParamsString()
+			Expect(backupReport.BackupParamsString).To(HaveSuffix("\nData File Format: Multiple Data Files Per Segment\nRow Filters:\n\tpublic.bar WHERE j < 5\n\tpublic.foo WHERE i > 10"))
+		})
+		It("includes each timed out attempt to lock tables and what blocked it", func() {
+			utils.InitializeCompressionParameters(true, "gzip", 0)
+			backupReport.SetBackupParamsFromFlags(false, false, "", false, false, false, false, false, false)
+			backupReport.LockWaits = []string{"Attempt 1 timed out after 30 seconds; blocked by the ACCESS EXCLUSIVE lock on public.bar held by pid 1234"}
+			backupReport.ConstructBackupParamsString()
+			Expect(backupReport.BackupParamsString).To(HaveSuffix("\nData File Format: Multiple Data Files Per Segment\nLock Waits:\n\tAttempt 1 timed out after 30 seconds; blocked by the ACCESS EXCLUSIVE lock on public.bar held by pid 1234"))
+		})
+		It("includes the fingerprint of the masking policy for a masked backup", func() {
+			utils.InitializeCompressionParameters(true, "gzip", 0)
+			backupReport.SetBackupParamsFromFlags(false, false, "", false, false, false, false, false, false)
+			backupReport.MaskingPolicyFingerprint = "0123456789abcdef0123456789abcdef"
+			backupReport.ConstructBackupParamsString()
+			Expect(backupReport.BackupParamsString).To(HaveSuffix("\nData File Format: Multiple Data Files Per Segment\nMasking Policy: Data masked with policy fingerprint 0123456789abcdef0123456789abcdef"))
+		})
+		It("includes the global metadata section and the role filter for a role-filtered globals-only backup", func() {
+			utils.InitializeCompressionParameters(true, "gzip", 0)
+			backupReport.SetBackupParamsFromFlags(false, true, "", false, false, false, false, false, false)
+			backupReport.GlobalsOnly = true
+			backupReport.IncludeRoleFiltered = true
+			backupReport.ConstructBackupParamsString()
+			Expect(backupReport.BackupParamsString).To(Equal(`Compression: gzip
+Plugin Executable: None
+Backup Section: Global Metadata Only
+Object Filtering: Include Role Filter
+Includes Statistics: No
+Data File Format: No Data Files`))
 		})
 		DescribeTable("Backup type classification", func(dataOnly bool, ddlOnly bool, noCompression bool, plugin string, isIncludeSchemaFiltered bool, isIncludeTableFiltered bool, isExcludeSchemaFiltered bool, isExcludeTableFiltered bool, singleDataFile bool, withStats bool, expectedType string) {
-			utils.InitializeCompressionParameters(!noCompression, 0)
+			utils.InitializeCompressionParameters(!noCompression, "gzip", 0)
 			backupReport.SetBackupParamsFromFlags(dataOnly, ddlOnly, plugin, isIncludeSchemaFiltered, isIncludeTableFiltered, isExcludeSchemaFiltered, isExcludeTableFiltered, singleDataFile, withStats)
 			backupReport.ConstructBackupParamsString()
 			Expect(backupReport.BackupParamsString).To(Equal(expectedType))
@@ -0,0 +1,134 @@
+package utils
+
+/*
+ * This file contains structs and functions used to decide which backups
+ * recorded in the backup history file may be deleted.
+ */
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+)
+
+type RetentionPolicy struct {
+	DatabaseName string
+	KeepLast     int
+	KeepDays     int
+}
+
+/*
+ * A backup is expired if it is older than the KeepLast-th most recent
+ * successful full backup of its database and older than KeepDays days; a rule
+ * that is not specified does not prevent a backup from expiring.  Backups that
+ * a retained incremental backup depends on are never expired.
+ */
+func (history *History) GetExpiredEntries(policy RetentionPolicy) []HistoryEntry {
+	daysCutoff := ""
+	if policy.KeepDays > 0 {
+		daysCutoff = operating.System.Now().AddDate(0, 0, -policy.KeepDays).Format("20060102150405")
+	}
+	lastCutoffs := make(map[string]string, 0)
+	if policy.KeepLast > 0 {
+		lastCutoffs = history.getKeepLastCutoffs(policy.KeepLast)
+	}
+
+	expired := make(map[string]bool, 0)
+	for _, entry := range history.Entries {
+		if policy.DatabaseName != "" && UnquoteIdent(entry.DatabaseName) != UnquoteIdent(policy.DatabaseName) {
+			continue
+		}
+		if policy.KeepLast > 0 && entry.Timestamp >= lastCutoffs[UnquoteIdent(entry.DatabaseName)] {
+			continue
+		}
+		if policy.KeepDays > 0 && entry.Timestamp >= daysCutoff {
+			continue
+		}
+		expired[entry.Timestamp] = true
+	}
+	for _, entry := range history.Entries {
+		if expired[entry.Timestamp] {
+			continue
+		}
+		for _, baseTimestamp := range history.GetIncrementalBases(entry) {
+			delete(expired, baseTimestamp)
+		}
+	}
+
+	expiredEntries := make([]HistoryEntry, 0)
+	for _, entry := range history.Entries {
+		if expired[entry.Timestamp] {
+			expiredEntries = append(expiredEntries, entry)
+		}
+	}
+	return expiredEntries
+}
+
+/*
+ * Returns a map of database names to the timestamp of the keepLast-th most
+ * recent successful full backup of that database.  Databases with fewer than
+ * keepLast such backups map to an empty string, so no backup is older.
+ */
+func (history *History) getKeepLastCutoffs(keepLast int) map[string]string {
+	numFullBackups := make(map[string]int, 0)
+	cutoffs := make(map[string]string, 0)
+	for _, entry := range history.Entries {
+		dbName := UnquoteIdent(entry.DatabaseName)
+		if _, ok := cutoffs[dbName]; !ok {
+			cutoffs[dbName] = ""
+		}
+		if entry.Status != HISTORY_STATUS_SUCCESS || entry.GetBackupType() != "full" {
+			continue
+		}
+		numFullBackups[dbName]++
+		if numFullBackups[dbName] == keepLast {
+			cutoffs[dbName] = entry.Timestamp
+		}
+	}
+	return cutoffs
+}
+
+/*
+ * Returns the timestamps of all backups that an incremental backup depends
+ * on, following the chain of base backups back to a full backup.
+ */
+func (history *History) GetIncrementalBases(entry HistoryEntry) []string {
+	bases := make([]string, 0)
+	for entry.Incremental && entry.FromTimestamp != "" {
+		bases = append(bases, entry.FromTimestamp)
+		baseEntry := history.FindEntry(entry.FromTimestamp)
+		if baseEntry == nil {
+			break
+		}
+		entry = *baseEntry
+	}
+	return bases
+}
+
+func (history *History) GetDependentEntries(timestamp string) []HistoryEntry {
+	dependents := make([]HistoryEntry, 0)
+	for _, entry := range history.Entries {
+		for _, baseTimestamp := range history.GetIncrementalBases(entry) {
+			if baseTimestamp == timestamp {
+				dependents = append(dependents, entry)
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+func (history *History) RemoveEntry(timestamp string) {
+	for i, entry := range history.Entries {
+		if entry.Timestamp == timestamp {
+			history.Entries = append(history.Entries[:i], history.Entries[i+1:]...)
+			return
+		}
+	}
+}
+
+func RemoveHistoryEntry(filename string, timestamp string) {
+	lockFile := LockHistoryFile(filename)
+	defer UnlockHistoryFile(lockFile)
+	history := ReadHistoryFile(filename)
+	history.RemoveEntry(timestamp)
+	history.WriteToFile(filename)
+}
@@ -0,0 +1,106 @@
+package utils_test
+
+import (
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/retention tests", func() {
+	success := utils.HISTORY_STATUS_SUCCESS
+	full1 := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb"}, Timestamp: "20170101010101", Status: success}
+	incr1 := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", Incremental: true, FromTimestamp: "20170101010101"}, Timestamp: "20170102010101", Status: success}
+	full2 := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb"}, Timestamp: "20170103010101", Status: success}
+	failed := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb"}, Timestamp: "20170104010101", Status: utils.HISTORY_STATUS_FAILURE}
+	full3 := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb"}, Timestamp: "20170105010101", Status: success}
+	incr2 := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", Incremental: true, FromTimestamp: "20170105010101"}, Timestamp: "20170106010101", Status: success}
+	other := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "otherdb"}, Timestamp: "20170101020202", Status: success}
+	var history *utils.History
+	BeforeEach(func() {
+		history = &utils.History{}
+		for _, entry := range []utils.HistoryEntry{full1, incr1, full2, failed, full3, incr2, other} {
+			history.AddEntry(entry)
+		}
+		operating.System.Now = func() time.Time { return time.Date(2017, 1, 10, 1, 1, 1, 1, time.Local) }
+	})
+	Describe("GetExpiredEntries", func() {
+		It("expires backups older than the last N successful full backups of each database", func() {
+			expired := history.GetExpiredEntries(utils.RetentionPolicy{KeepLast: 2})
+			Expect(expired).To(Equal([]utils.HistoryEntry{incr1, full1}))
+		})
+		It("does not count a backup with filtered rows toward the last N full backups", func() {
+			rowFiltered := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", RowFiltered: true}, Timestamp: "20170107010101", Status: success}
+			history.AddEntry(rowFiltered)
+			expired := history.GetExpiredEntries(utils.RetentionPolicy{KeepLast: 2})
+			Expect(expired).To(Equal([]utils.HistoryEntry{incr1, full1}))
+		})
+		It("does not count a plain backup toward the last N full backups", func() {
+			plain := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", Format: "plain"}, Timestamp: "20170107010101", Status: success}
+			history.AddEntry(plain)
+			expired := history.GetExpiredEntries(utils.RetentionPolicy{KeepLast: 2})
+			Expect(expired).To(Equal([]utils.HistoryEntry{incr1, full1}))
+		})
+		It("does not count a masked backup toward the last N full backups", func() {
+			masked := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", MaskingPolicyFingerprint: "0123456789abcdef"}, Timestamp: "20170107010101", Status: success}
+			history.AddEntry(masked)
+			expired := history.GetExpiredEntries(utils.RetentionPolicy{KeepLast: 2})
+			Expect(expired).To(Equal([]utils.HistoryEntry{incr1, full1}))
+		})
+		It("expires nothing if a database has fewer than N successful full backups", func() {
+			expired := history.GetExpiredEntries(utils.RetentionPolicy{KeepLast: 4})
+			Expect(expired).To(BeEmpty())
+		})
+		It("expires backups older than the specified number of days", func() {
+			expired := history.GetExpiredEntries(utils.RetentionPolicy{KeepDays: 6})
+			Expect(expired).To(Equal([]utils.HistoryEntry{full2, incr1, other, full1}))
+		})
+		It("retains a backup if any rule retains it", func() {
+			expired := history.GetExpiredEntries(utils.RetentionPolicy{KeepLast: 1, KeepDays: 7})
+			Expect(expired).To(Equal([]utils.HistoryEntry{incr1, full1}))
+		})
+		It("only expires backups of the specified database", func() {
+			expired := history.GetExpiredEntries(utils.RetentionPolicy{DatabaseName: "otherdb", KeepDays: 6})
+			Expect(expired).To(Equal([]utils.HistoryEntry{other}))
+		})
+		It("retains backups that a retained incremental backup depends on", func() {
+			expired := history.GetExpiredEntries(utils.RetentionPolicy{DatabaseName: "testdb", KeepDays: 5})
+			Expect(expired).To(Equal([]utils.HistoryEntry{failed, full2, incr1, full1}))
+
+			expired = history.GetExpiredEntries(utils.RetentionPolicy{DatabaseName: "testdb", KeepDays: 4})
+			Expect(expired).To(Equal([]utils.HistoryEntry{failed, full2, incr1, full1}))
+		})
+	})
+	Describe("GetIncrementalBases", func() {
+		It("returns the whole chain of base backups", func() {
+			incr3 := utils.HistoryEntry{BackupConfig: utils.BackupConfig{DatabaseName: "testdb", Incremental: true, FromTimestamp: "20170106010101"}, Timestamp: "20170107010101", Status: success}
+			history.AddEntry(incr3)
+			Expect(history.GetIncrementalBases(incr3)).To(Equal([]string{"20170106010101", "20170105010101"}))
+		})
+		It("returns no bases for a full backup", func() {
+			Expect(history.GetIncrementalBases(full1)).To(BeEmpty())
+		})
+	})
+	Describe("GetDependentEntries", func() {
+		It("returns the incremental backups that depend on a backup", func() {
+			Expect(history.GetDependentEntries("20170105010101")).To(Equal([]utils.HistoryEntry{incr2}))
+		})
+		It("returns no entries for a backup that nothing depends on", func() {
+			Expect(history.GetDependentEntries("20170103010101")).To(BeEmpty())
+		})
+	})
+	Describe("RemoveEntry", func() {
+		It("removes the entry with the given timestamp", func() {
+			history.RemoveEntry("20170103010101")
+			Expect(history.FindEntry("20170103010101")).To(BeNil())
+			Expect(history.Entries).To(HaveLen(6))
+		})
+		It("does nothing if there is no entry with the given timestamp", func() {
+			history.RemoveEntry("20170109010101")
+			Expect(history.Entries).To(HaveLen(7))
+		})
+	})
+})
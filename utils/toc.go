@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
@@ -12,12 +14,14 @@ import (
 )
 
 type TOC struct {
-	metadataEntryMap  map[string]*[]MetadataEntry
-	GlobalEntries     []MetadataEntry
-	PredataEntries    []MetadataEntry
-	PostdataEntries   []MetadataEntry
-	StatisticsEntries []MetadataEntry
-	DataEntries       []MasterDataEntry
+	metadataEntryMap    map[string]*[]MetadataEntry
+	listSelection       map[string][]int
+	GlobalEntries       []MetadataEntry
+	PredataEntries      []MetadataEntry
+	PostdataEntries     []MetadataEntry
+	StatisticsEntries   []MetadataEntry
+	DataEntries         []MasterDataEntry
+	IncrementalMetadata IncrementalEntries
 }
 
 type SegmentTOC struct {
@@ -39,16 +43,37 @@ type MasterDataEntry struct {
 	Oid             uint32
 	AttributeString string
 	RowsCopied      int64
+	Timestamp       string
+	Checksums       map[int]string
+	Sizes           map[int]int64
+	Stream          int
+	Filter          string
+}
+
+/*
+ * IncrementalEntries holds the state of each append-optimized table at the
+ * time of the backup, so that a later incremental backup can determine which
+ * tables have changed and need their data backed up again.
+ */
+type IncrementalEntries struct {
+	AO map[string]AOEntry
+}
+
+type AOEntry struct {
+	Modcount         int64
+	LastDDLTimestamp string
 }
 
 type SegmentDataEntry struct {
 	StartByte uint64
 	EndByte   uint64
+	Checksum  string
+	Stream    int
 }
 
 func NewTOC(filename string) *TOC {
 	toc := &TOC{}
-	contents, err := operating.System.ReadFile(filename)
+	contents, err := ReadFileWithDecryption(filename)
 	gplog.FatalOnError(err)
 	err = yaml.Unmarshal(contents, toc)
 	gplog.FatalOnError(err)
@@ -68,6 +93,10 @@ func (toc *TOC) WriteToFileAndMakeReadOnly(filename string) {
 	tocFile := iohelper.MustOpenFileForWriting(filename)
 	tocContents, err := yaml.Marshal(toc)
 	gplog.FatalOnError(err)
+	if encryptionKey != nil {
+		tocContents, err = EncryptBytes(tocContents, encryptionKey)
+		gplog.FatalOnError(err)
+	}
 	MustPrintBytes(tocFile, tocContents)
 	err = operating.System.Chmod(filename, 0444)
 	gplog.FatalOnError(err)
@@ -91,7 +120,7 @@ type StatementWithType struct {
 }
 
 func (toc *TOC) GetSQLStatementForObjectTypes(section string, metadataFile io.ReaderAt, includeObjectTypes []string, excludeObjectTypes []string, includeSchemas []string, excludeSchemas []string, includeRelations []string, excludeRelations []string) []StatementWithType {
-	entries := *toc.metadataEntryMap[section]
+	entries := toc.getMetadataEntries(section)
 	objectSet, schemaSet, relationSet := constructFilterSets(includeObjectTypes, excludeObjectTypes, includeSchemas, excludeSchemas, includeRelations, excludeRelations)
 	statements := make([]StatementWithType, 0)
 	for _, entry := range entries {
@@ -137,7 +166,7 @@ func shouldIncludeStatement(entry MetadataEntry, objectSet *FilterSet, schemaSet
 }
 
 func (toc *TOC) GetAllSQLStatements(section string, metadataFile io.ReaderAt) []StatementWithType {
-	entries := *toc.metadataEntryMap[section]
+	entries := toc.getMetadataEntries(section)
 	statements := make([]StatementWithType, 0)
 	for _, entry := range entries {
 		contents := make([]byte, entry.EndByte-entry.StartByte)
@@ -168,7 +197,7 @@ func (toc *TOC) GetDataEntriesMatching(includeSchemas []string, excludeSchemas [
 		}
 	}
 	matchingEntries := make([]MasterDataEntry, 0)
-	for _, entry := range toc.DataEntries {
+	for _, entry := range toc.getDataEntries() {
 		validSchema := restoreAllSchemas || schemaSet.MatchesFilter(entry.Schema)
 		tableFQN := MakeFQN(entry.Schema, entry.Name)
 		validTable := restoreAllTables || tableSet.MatchesFilter(tableFQN)
@@ -192,6 +221,138 @@ func SubstituteRedirectDatabaseInStatements(statements []StatementWithType, oldN
 	return statements
 }
 
+/*
+ * Schema-qualified names are rewritten where they name an object, as are the
+ * names in statements on the schemas themselves.  String literals and
+ * dollar-quoted strings such as function bodies are left unchanged, except for
+ * literals that name an object, such as the regclass literals in sequence
+ * defaults and the sequence names passed to setval.  A name is only rewritten if it is not part of a longer
+ * identifier.
+ */
+func SubstituteRedirectSchemasInStatements(statements []StatementWithType, schemaMap map[string]string) []StatementWithType {
+	if len(schemaMap) == 0 {
+		return statements
+	}
+	redirect := newSchemaRedirector(schemaMap)
+	for i := range statements {
+		statements[i].Statement = redirect(statements[i].Statement)
+		statements[i].ReferenceObject = redirect(statements[i].ReferenceObject)
+		if newSchema, ok := schemaMap[statements[i].Schema]; ok {
+			statements[i].Schema = newSchema
+		}
+		if newSchema, ok := schemaMap[statements[i].Name]; ok && statements[i].ObjectType == "SCHEMA" {
+			statements[i].Name = newSchema
+		}
+	}
+	return statements
+}
+
+func SubstituteRedirectSchemasInFQNs(fqns []string, schemaMap map[string]string) []string {
+	if len(schemaMap) == 0 {
+		return fqns
+	}
+	redirect := newSchemaRedirector(schemaMap)
+	redirectedFQNs := make([]string, len(fqns))
+	for i, fqn := range fqns {
+		redirectedFQNs[i] = redirect(fqn)
+	}
+	return redirectedFQNs
+}
+
+func newSchemaRedirector(schemaMap map[string]string) func(string) string {
+	oldSchemas := make([]string, 0, len(schemaMap))
+	for oldSchema := range schemaMap {
+		oldSchemas = append(oldSchemas, regexp.QuoteMeta(oldSchema))
+	}
+	sort.Strings(oldSchemas)
+	alternation := strings.Join(oldSchemas, "|")
+	qualifiedNamePattern := regexp.MustCompile(fmt.Sprintf(`(^|[^\w"$.])(%s)\.`, alternation))
+	schemaNamePattern := regexp.MustCompile(fmt.Sprintf(`(\bSCHEMA )(%s)(;|\s|$)`, alternation))
+	replaceSchemas := func(pattern *regexp.Regexp, text string) string {
+		return pattern.ReplaceAllStringFunc(text, func(match string) string {
+			groups := pattern.FindStringSubmatch(match)
+			return groups[1] + schemaMap[groups[2]] + match[len(groups[1])+len(groups[2]):]
+		})
+	}
+	return func(text string) string {
+		return replaceInObjectNames(text, func(code string) string {
+			return replaceSchemas(schemaNamePattern, replaceSchemas(qualifiedNamePattern, code))
+		})
+	}
+}
+
+var (
+	dollarQuotePattern          = regexp.MustCompile(`^\$(?:[A-Za-z_][A-Za-z0-9_]*)?\$`)
+	objectIdentifierCastPattern = regexp.MustCompile(`^::(?:pg_catalog\.)?reg(?:class|proc|procedure|type|oper|operator)\b`)
+	sequenceFunctionPattern     = regexp.MustCompile(`\b(?:pg_catalog\.)?(?:setval|nextval|currval)\($`)
+)
+
+/*
+ * Applies replace to the parts of a statement outside of string literals and
+ * dollar-quoted strings, and to the contents of literals that name an object,
+ * either by being cast to an object identifier type or by being the sequence
+ * passed to a sequence function such as setval.  Quoted identifiers are passed
+ * to replace with the rest of the statement.
+ */
+func replaceInObjectNames(text string, replace func(string) string) string {
+	result := ""
+	codeStart := 0
+	for i := 0; i < len(text); {
+		switch {
+		case text[i] == '"':
+			i = findClosingQuote(text, i, false)
+		case text[i] == '\'':
+			escaped := i > 0 && (text[i-1] == 'E' || text[i-1] == 'e') && (i == 1 || !isIdentifierChar(text[i-2]))
+			end := findClosingQuote(text, i, escaped)
+			literal := text[i:end]
+			if end-i >= 2 && text[end-1] == '\'' && (objectIdentifierCastPattern.MatchString(text[end:]) || sequenceFunctionPattern.MatchString(text[:i])) {
+				literal = "'" + replace(literal[1:len(literal)-1]) + "'"
+			}
+			result += replace(text[codeStart:i]) + literal
+			i, codeStart = end, end
+		case text[i] == '$' && (i == 0 || !isIdentifierChar(text[i-1])):
+			tag := dollarQuotePattern.FindString(text[i:])
+			if tag == "" {
+				i++
+				continue
+			}
+			end := len(text)
+			if closing := strings.Index(text[i+len(tag):], tag); closing != -1 {
+				end = i + len(tag) + closing + len(tag)
+			}
+			result += replace(text[codeStart:i]) + text[i:end]
+			i, codeStart = end, end
+		default:
+			i++
+		}
+	}
+	return result + replace(text[codeStart:])
+}
+
+/*
+ * Returns the index just past the quote that closes the quoted string starting
+ * at start, or the length of the text if the string is not closed.  Doubled
+ * quotes and, if escaped is set, backslash escapes do not close the string.
+ */
+func findClosingQuote(text string, start int, escaped bool) int {
+	quote := text[start]
+	for i := start + 1; i < len(text); i++ {
+		switch {
+		case escaped && text[i] == '\\':
+			i++
+		case text[i] == quote && i+1 < len(text) && text[i+1] == quote:
+			i++
+		case text[i] == quote:
+			return i + 1
+		}
+	}
+	return len(text)
+}
+
+func isIdentifierChar(char byte) bool {
+	return char == '_' || char == '$' || ('a' <= char && char <= 'z') || ('A' <= char && char <= 'Z') || ('0' <= char && char <= '9') || char >= 0x80
+}
+
 func RemoveActiveRole(activeUser string, statements []StatementWithType) []StatementWithType {
 	newStatements := make([]StatementWithType, 0)
 	for _, statement := range statements {
@@ -232,10 +393,94 @@ func (toc *TOC) AddStatisticsEntry(schema string, name string, objectType string
 }
 
 func (toc *TOC) AddMasterDataEntry(schema string, name string, oid uint32, attributeString string, rowsCopied int64) {
-	toc.DataEntries = append(toc.DataEntries, MasterDataEntry{schema, name, oid, attributeString, rowsCopied})
+	toc.DataEntries = append(toc.DataEntries, MasterDataEntry{schema, name, oid, attributeString, rowsCopied, "", nil, nil, 0, ""})
 }
 
-func (toc *SegmentTOC) AddSegmentDataEntry(oid uint, startByte uint64, endByte uint64) {
+/*
+ * For tables that have not changed since a previous backup, we copy the data
+ * entry from that backup's TOC instead of backing up the data again.  Entries
+ * with an empty Timestamp refer to the backup to which the TOC belongs, so we
+ * fill in the previous backup's timestamp here; entries that already refer to
+ * an earlier backup keep that reference, so a chain of incremental backups
+ * always points directly at the backup containing the data.
+ */
+func (toc *TOC) AddIncrementalDataEntry(entry MasterDataEntry, previousTimestamp string) {
+	if entry.Timestamp == "" {
+		entry.Timestamp = previousTimestamp
+	}
+	toc.DataEntries = append(toc.DataEntries, entry)
+}
+
+/*
+ * Returns the entries whose data is stored in the backup with the given
+ * timestamp, where an empty timestamp indicates the current backup.
+ */
+func GetDataEntriesForTimestamp(dataEntries []MasterDataEntry, timestamp string) []MasterDataEntry {
+	matchingEntries := make([]MasterDataEntry, 0)
+	for _, entry := range dataEntries {
+		if entry.Timestamp == timestamp {
+			matchingEntries = append(matchingEntries, entry)
+		}
+	}
+	return matchingEntries
+}
+
+/*
+ * Returns the timestamps of all backups other than the current one that hold
+ * data for the given entries, in ascending order.
+ */
+func GetIncrementalTimestamps(dataEntries []MasterDataEntry) []string {
+	timestampSet := make(map[string]bool, 0)
+	timestamps := make([]string, 0)
+	for _, entry := range dataEntries {
+		if entry.Timestamp != "" && !timestampSet[entry.Timestamp] {
+			timestampSet[entry.Timestamp] = true
+			timestamps = append(timestamps, entry.Timestamp)
+		}
+	}
+	sort.Strings(timestamps)
+	return timestamps
+}
+
+func (toc *SegmentTOC) AddSegmentDataEntry(oid uint, startByte uint64, endByte uint64, checksum string, stream int) {
 	// We use uint for oid since the flags package does not have a uint32 flag
-	toc.DataEntries[oid] = SegmentDataEntry{startByte, endByte}
+	toc.DataEntries[oid] = SegmentDataEntry{startByte, endByte, checksum, stream}
+}
+
+/*
+ * With --single-data-file and --jobs, each segment writes one data file per
+ * job, called a data stream, so that several tables can be copied at once.
+ * Tables are assigned to streams round-robin in oid order, which is the order
+ * in which gpbackup_helper processes them, so that gpbackup and the helper
+ * can each compute the assignment from the same list of oids.  The stream of
+ * each table is recorded in the master and segment TOCs for restore.
+ */
+func AssignDataStreams(oids []uint32, numStreams int) map[uint32]int {
+	sortedOids := make([]uint32, len(oids))
+	copy(sortedOids, oids)
+	sort.Slice(sortedOids, func(i int, j int) bool {
+		return sortedOids[i] < sortedOids[j]
+	})
+	streams := make(map[uint32]int, len(oids))
+	for i, oid := range sortedOids {
+		streams[oid] = i % numStreams
+	}
+	return streams
+}
+
+// Returns the entries in each stream in oid order, in which gpbackup_helper serves them
+func GetDataEntriesByStream(dataEntries []MasterDataEntry) [][]MasterDataEntry {
+	streamEntries := make([][]MasterDataEntry, 0)
+	for _, entry := range dataEntries {
+		for len(streamEntries) <= entry.Stream {
+			streamEntries = append(streamEntries, make([]MasterDataEntry, 0))
+		}
+		streamEntries[entry.Stream] = append(streamEntries[entry.Stream], entry)
+	}
+	for _, entries := range streamEntries {
+		sort.Slice(entries, func(i int, j int) bool {
+			return entries[i].Oid < entries[j].Oid
+		})
+	}
+	return streamEntries
 }
@@ -0,0 +1,184 @@
+package utils
+
+/*
+ * This file contains structs and functions related to listing the entries of
+ * a table of contents with gprestore --list, and to restoring only the
+ * entries in an edited copy of that list with gprestore --use-list.
+ */
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Entries are numbered in the order in which they are restored, so the ID of
+ * each entry is the same each time the table of contents of a backup is
+ * listed.
+ */
+var listSections = []string{"global", "predata", "data", "postdata", "statistics"}
+
+type TOCListEntry struct {
+	ID              int
+	Section         string
+	ObjectType      string
+	Schema          string
+	Name            string
+	ReferenceObject string
+	Size            int64
+	RowsCopied      int64
+	index           int
+}
+
+/*
+ * The size of a data entry is the size of its data files on all segments, and
+ * is -1 if the sizes were not recorded in the table of contents.  The row
+ * count of a metadata entry is always -1.
+ */
+func (toc *TOC) GetListEntries() []TOCListEntry {
+	listEntries := make([]TOCListEntry, 0)
+	for _, section := range listSections {
+		if section == "data" {
+			for i, entry := range toc.DataEntries {
+				size := int64(-1)
+				if entry.Sizes != nil {
+					size = 0
+					for _, segmentSize := range entry.Sizes {
+						size += segmentSize
+					}
+				}
+				listEntries = append(listEntries, TOCListEntry{Section: section, ObjectType: "TABLE DATA", Schema: entry.Schema, Name: entry.Name, Size: size, RowsCopied: entry.RowsCopied, index: i})
+			}
+			continue
+		}
+		for i, entry := range *toc.metadataEntryMap[section] {
+			listEntries = append(listEntries, TOCListEntry{Section: section, ObjectType: entry.ObjectType, Schema: entry.Schema, Name: entry.Name, ReferenceObject: entry.ReferenceObject, Size: int64(entry.EndByte - entry.StartByte), RowsCopied: -1, index: i})
+		}
+	}
+	for i := range listEntries {
+		listEntries[i].ID = i + 1
+	}
+	return listEntries
+}
+
+func WriteTOCList(writer io.Writer, listEntries []TOCListEntry) {
+	MustPrintf(writer, ";\n; ID; Section; Object Type; Schema; Name; Reference Object; Size; Rows\n;\n")
+	for _, entry := range listEntries {
+		MustPrintf(writer, "%d; %s; %s; %s; %s; %s; %s; %s\n", entry.ID, entry.Section, entry.ObjectType, listField(entry.Schema), listField(entry.Name), listField(entry.ReferenceObject), listCount(entry.Size), listCount(entry.RowsCopied))
+	}
+}
+
+func listField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func listCount(count int64) string {
+	if count < 0 {
+		return "-"
+	}
+	return strconv.FormatInt(count, 10)
+}
+
+/*
+ * As with pg_restore, only the ID at the start of each line is read, and
+ * blank lines and lines beginning with a semicolon are ignored, so entries can
+ * be removed, reordered, or commented out.
+ */
+func ReadTOCListFile(filename string) []int {
+	contents, err := operating.System.ReadFile(filename)
+	gplog.FatalOnError(err)
+	ids := make([]int, 0)
+	for lineNum, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		idStr := strings.TrimSpace(strings.SplitN(line, ";", 2)[0])
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			gplog.Fatal(errors.Errorf("Line %d of list file %s does not begin with an entry ID", lineNum+1, filename), "")
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+/*
+ * Once entries are selected, only the selected entries are returned when
+ * statements and data entries are retrieved from the table of contents, in
+ * the order in which they appear in the list within each section.  Sections
+ * are always restored in the same order.  Session GUCs are set on every
+ * connection gprestore makes, so they are always selected.
+ */
+func (toc *TOC) SelectListEntries(ids []int) {
+	listEntries := toc.GetListEntries()
+	selection := make(map[string][]int, len(listSections))
+	for _, entry := range listEntries {
+		if entry.ObjectType == "SESSION GUCS" {
+			selection[entry.Section] = append(selection[entry.Section], entry.index)
+		}
+	}
+	selectedIDs := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if id < 1 || id > len(listEntries) {
+			gplog.Fatal(errors.Errorf("Entry %d in the list does not exist in the table of contents of this backup", id), "")
+		}
+		if selectedIDs[id] {
+			gplog.Fatal(errors.Errorf("Entry %d appears more than once in the list", id), "")
+		}
+		selectedIDs[id] = true
+		entry := listEntries[id-1]
+		if entry.ObjectType != "SESSION GUCS" {
+			selection[entry.Section] = append(selection[entry.Section], entry.index)
+		}
+	}
+	toc.listSelection = selection
+}
+
+func (toc *TOC) getMetadataEntries(section string) []MetadataEntry {
+	entries := *toc.metadataEntryMap[section]
+	if toc.listSelection == nil {
+		return entries
+	}
+	selectedEntries := make([]MetadataEntry, len(toc.listSelection[section]))
+	for i, index := range toc.listSelection[section] {
+		selectedEntries[i] = entries[index]
+	}
+	return selectedEntries
+}
+
+func (toc *TOC) getDataEntries() []MasterDataEntry {
+	if toc.listSelection == nil {
+		return toc.DataEntries
+	}
+	selectedEntries := make([]MasterDataEntry, len(toc.listSelection["data"]))
+	for i, index := range toc.listSelection["data"] {
+		selectedEntries[i] = toc.DataEntries[index]
+	}
+	return selectedEntries
+}
+
+/*
+ * The data of a backup with a single data file per segment is served by
+ * gpbackup_helper in oid order within each stream, so it cannot be restored
+ * in any other order.  This reports whether the selected data entries are
+ * listed in a different order.
+ */
+func (toc *TOC) HasReorderedDataEntries() bool {
+	lastOids := make(map[int]uint32, 0)
+	for _, entry := range toc.getDataEntries() {
+		if lastOid, ok := lastOids[entry.Stream]; ok && entry.Oid < lastOid {
+			return true
+		}
+		lastOids[entry.Stream] = entry.Oid
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package utils_test
+
+import (
+	"bytes"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("utils/toc_list tests", func() {
+	gucs := utils.StatementWithType{ObjectType: "SESSION GUCS", Statement: "SET client_encoding = 'UTF8';\n"}
+	function := utils.StatementWithType{Schema: "public", Name: "somefunction", ObjectType: "FUNCTION", Statement: "CREATE FUNCTION public.somefunction() RETURNS integer AS 'SELECT 1' LANGUAGE sql;\n"}
+	table := utils.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "CREATE TABLE public.foo (i int);\n"}
+	view := utils.StatementWithType{Schema: "public", Name: "someview", ObjectType: "VIEW", Statement: "CREATE VIEW public.someview AS SELECT 1;\n"}
+	index := utils.StatementWithType{Schema: "public", Name: "someindex", ObjectType: "INDEX", ReferenceObject: "public.foo", Statement: "CREATE INDEX someindex ON public.foo(i);\n"}
+	var metadataFile *bytes.Reader
+	BeforeEach(func() {
+		toc, backupfile = testutils.InitializeTestTOC(buffer, "metadata")
+		contents := ""
+		for _, entry := range []struct {
+			statement utils.StatementWithType
+			section   string
+		}{{gucs, "global"}, {function, "predata"}, {table, "predata"}, {view, "predata"}, {index, "postdata"}} {
+			start := backupfile.ByteCount
+			backupfile.ByteCount += uint64(len(entry.statement.Statement))
+			contents += entry.statement.Statement
+			toc.AddMetadataEntry(entry.statement.Schema, entry.statement.Name, entry.statement.ObjectType, entry.statement.ReferenceObject, start, backupfile, entry.section)
+		}
+		metadataFile = bytes.NewReader([]byte(contents))
+		toc.DataEntries = []utils.MasterDataEntry{
+			{Schema: "public", Name: "foo", Oid: 1, RowsCopied: 10, Sizes: map[int]int64{0: 100, 1: 200}},
+			{Schema: "public", Name: "bar", Oid: 2, RowsCopied: 20},
+		}
+	})
+	Describe("WriteTOCList", func() {
+		It("lists every entry with an ID in restore order", func() {
+			listBuffer := gbytes.NewBuffer()
+			utils.WriteTOCList(listBuffer, toc.GetListEntries())
+			Expect(string(listBuffer.Contents())).To(Equal(`;
+; ID; Section; Object Type; Schema; Name; Reference Object; Size; Rows
+;
+1; global; SESSION GUCS; -; -; -; 30; -
+2; predata; FUNCTION; public; somefunction; -; 82; -
+3; predata; TABLE; public; foo; -; 33; -
+4; predata; VIEW; public; someview; -; 41; -
+5; data; TABLE DATA; public; foo; -; 300; 10
+6; data; TABLE DATA; public; bar; -; -; 20
+7; postdata; INDEX; public; someindex; public.foo; 41; -
+`))
+		})
+	})
+	Describe("ReadTOCListFile", func() {
+		AfterEach(func() {
+			operating.System = operating.InitializeSystemFunctions()
+		})
+		It("reads the ID of each entry in order, ignoring comments and blank lines", func() {
+			operating.System.ReadFile = func(filename string) ([]byte, error) {
+				return []byte(";\n; ID; Section\n;\n4; predata; VIEW; public; someview\n\n;3; predata; TABLE; public; foo\n 2 ; predata; FUNCTION\n"), nil
+			}
+			Expect(utils.ReadTOCListFile("/tmp/list")).To(Equal([]int{4, 2}))
+		})
+		It("panics if a line does not begin with an ID", func() {
+			operating.System.ReadFile = func(filename string) ([]byte, error) {
+				return []byte("4; predata; VIEW\npredata; TABLE\n"), nil
+			}
+			defer testhelper.ShouldPanicWithMessage("Line 2 of list file /tmp/list does not begin with an entry ID")
+			utils.ReadTOCListFile("/tmp/list")
+		})
+	})
+	Describe("SelectListEntries", func() {
+		It("returns only the selected statements and data entries, in list order", func() {
+			toc.SelectListEntries([]int{4, 6, 2, 5})
+			Expect(toc.GetAllSQLStatements("global", metadataFile)).To(Equal([]utils.StatementWithType{gucs}))
+			Expect(toc.GetAllSQLStatements("predata", metadataFile)).To(Equal([]utils.StatementWithType{view, function}))
+			Expect(toc.GetAllSQLStatements("postdata", metadataFile)).To(BeEmpty())
+			Expect(toc.GetSQLStatementForObjectTypes("predata", metadataFile, []string{"VIEW"}, []string{}, []string{}, []string{}, []string{}, []string{})).To(Equal([]utils.StatementWithType{view}))
+			dataEntries := toc.GetDataEntriesMatching([]string{}, []string{}, []string{}, []string{})
+			Expect(dataEntries).To(HaveLen(2))
+			Expect(dataEntries[0].Name).To(Equal("bar"))
+			Expect(dataEntries[1].Name).To(Equal("foo"))
+			Expect(toc.DataEntries).To(HaveLen(2))
+		})
+		It("panics if an entry does not exist", func() {
+			defer testhelper.ShouldPanicWithMessage("Entry 8 in the list does not exist in the table of contents of this backup")
+			toc.SelectListEntries([]int{2, 8})
+		})
+		It("panics if an entry is listed twice", func() {
+			defer testhelper.ShouldPanicWithMessage("Entry 2 appears more than once in the list")
+			toc.SelectListEntries([]int{2, 3, 2})
+		})
+	})
+	Describe("HasReorderedDataEntries", func() {
+		It("returns false if the data entries are listed in oid order", func() {
+			toc.SelectListEntries([]int{5, 6})
+			Expect(toc.HasReorderedDataEntries()).To(BeFalse())
+		})
+		It("returns true if the data entries are not listed in oid order", func() {
+			toc.SelectListEntries([]int{6, 5})
+			Expect(toc.HasReorderedDataEntries()).To(BeTrue())
+		})
+		It("returns false if only data entries in different streams are out of oid order", func() {
+			toc.DataEntries[1].Stream = 1
+			toc.SelectListEntries([]int{6, 5})
+			Expect(toc.HasReorderedDataEntries()).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,172 @@
+package utils
+
+/*
+ * This file contains functions related to restoring relations under new names
+ * with gprestore --rename-to.
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/pkg/errors"
+)
+
+var (
+	fqnPattern             = regexp.MustCompile(`^("(?:[^"]|"")+"|[^".]+)\.("(?:[^"]|"")+"|[^".]+)$`)
+	unquotedIdentPattern   = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+	identifierCharPattern  = regexp.MustCompile(`^[\w"$]`)
+	renamedDependentTypes  = map[string]bool{"SEQUENCE": true, "SEQUENCE OWNER": true, "CONSTRAINT": true, "INDEX": true}
+	renamedRelationalTypes = map[string]bool{"SEQUENCE": true, "SEQUENCE OWNER": true, "INDEX": true}
+)
+
+func SplitFQN(fqn string) (string, string) {
+	matches := fqnPattern.FindStringSubmatch(fqn)
+	if len(matches) == 0 {
+		gplog.Fatal(errors.Errorf("%s is not a fully-qualified name", fqn), "")
+	}
+	return matches[1], matches[2]
+}
+
+/*
+ * Sequences, constraints, and indexes are renamed along with their relation,
+ * as the names of sequences and indexes must be unique within a schema and
+ * each primary key and unique constraint creates an index of the same name.
+ * A dependent object whose name begins with the name of its relation, as the
+ * names of generated sequences, constraints, and indexes do, has that prefix
+ * replaced with the new name of the relation; any other dependent object has
+ * the new name of the relation and an underscore prepended to its name.
+ */
+func GetRenamedDependentName(oldRelation string, newRelation string, name string) string {
+	_, oldName := SplitFQN(oldRelation)
+	_, newName := SplitFQN(newRelation)
+	oldPrefix := unquoteIdentifier(oldName)
+	newPrefix := unquoteIdentifier(newName)
+	unquotedName := unquoteIdentifier(name)
+	if strings.HasPrefix(unquotedName, oldPrefix) {
+		return quoteIdentifier(newPrefix + strings.TrimPrefix(unquotedName, oldPrefix))
+	}
+	return quoteIdentifier(newPrefix + "_" + unquotedName)
+}
+
+func unquoteIdentifier(ident string) string {
+	if matches := QuotedIdentifier.FindStringSubmatch(ident); len(matches) > 1 {
+		return strings.Replace(matches[1], `""`, `"`, -1)
+	}
+	return ident
+}
+
+func quoteIdentifier(ident string) string {
+	if unquotedIdentPattern.MatchString(ident) {
+		return ident
+	}
+	return fmt.Sprintf(`"%s"`, strings.Replace(ident, `"`, `""`, -1))
+}
+
+/*
+ * The renamed relations and the sequences and indexes that depend on them are
+ * renamed wherever their qualified names name an object, including in
+ * sequence defaults, in foreign keys that reference them, and in their
+ * statistics, but not in other string literals or in function bodies.
+ * Constraint and index names are not qualified, so they are only renamed in
+ * the statements for the renamed relations and their dependent objects.
+ */
+func SubstituteRenamedRelationsInStatements(statements []StatementWithType, renameMap map[string]string) []StatementWithType {
+	if len(renameMap) == 0 {
+		return statements
+	}
+	qualifiedNames := make(map[string]string, len(renameMap))
+	dependentNames := make(map[string]map[string]string, len(renameMap))
+	for oldRelation, newRelation := range renameMap {
+		qualifiedNames[oldRelation] = newRelation
+		dependentNames[oldRelation] = make(map[string]string)
+	}
+	for _, statement := range statements {
+		newRelation, ok := renameMap[statement.ReferenceObject]
+		if !ok || !renamedDependentTypes[statement.ObjectType] {
+			continue
+		}
+		newName := GetRenamedDependentName(statement.ReferenceObject, newRelation, statement.Name)
+		if renamedRelationalTypes[statement.ObjectType] {
+			qualifiedNames[MakeFQN(statement.Schema, statement.Name)] = MakeFQN(statement.Schema, newName)
+		}
+		if statement.ObjectType == "CONSTRAINT" || statement.ObjectType == "INDEX" {
+			dependentNames[statement.ReferenceObject][statement.Name] = newName
+		}
+	}
+
+	qualifiedNamePattern := regexp.MustCompile(fmt.Sprintf(`(^|[^\w"$.])(%s)`, getAlternation(qualifiedNames)))
+	dependentNamePatterns := make(map[string]*regexp.Regexp, len(renameMap))
+	for relation, names := range dependentNames {
+		if len(names) > 0 {
+			dependentNamePatterns[relation] = regexp.MustCompile(fmt.Sprintf(`(\b(?:INDEX|CONSTRAINT|CLUSTER ON) )(%s)`, getAlternation(names)))
+		}
+	}
+	for i := range statements {
+		relation := ""
+		if fqn := MakeFQN(statements[i].Schema, statements[i].Name); statements[i].ObjectType == "TABLE" && renameMap[fqn] != "" {
+			relation = fqn
+		} else if renameMap[statements[i].ReferenceObject] != "" && renamedDependentTypes[statements[i].ObjectType] {
+			relation = statements[i].ReferenceObject
+		}
+		dependentNamePattern, renameDependents := dependentNamePatterns[relation]
+		statements[i].Statement = replaceInObjectNames(statements[i].Statement, func(code string) string {
+			code = replaceIdentifiers(code, qualifiedNamePattern, qualifiedNames)
+			if renameDependents {
+				code = replaceIdentifiers(code, dependentNamePattern, dependentNames[relation])
+			}
+			return code
+		})
+		if relation != "" && statements[i].ReferenceObject == "" {
+			_, statements[i].Name = SplitFQN(renameMap[relation])
+		} else if relation != "" {
+			statements[i].Name = GetRenamedDependentName(relation, renameMap[relation], statements[i].Name)
+		}
+		statements[i].ReferenceObject = replaceIdentifiers(statements[i].ReferenceObject, qualifiedNamePattern, qualifiedNames)
+	}
+	return statements
+}
+
+// Longer names come first so that a name is not matched by a prefix of it.
+func getAlternation(names map[string]string) string {
+	alternatives := make([]string, 0, len(names))
+	for name := range names {
+		alternatives = append(alternatives, name)
+	}
+	sort.Slice(alternatives, func(i, j int) bool {
+		if len(alternatives[i]) != len(alternatives[j]) {
+			return len(alternatives[i]) > len(alternatives[j])
+		}
+		return alternatives[i] < alternatives[j]
+	})
+	for i := range alternatives {
+		alternatives[i] = regexp.QuoteMeta(alternatives[i])
+	}
+	return strings.Join(alternatives, "|")
+}
+
+/*
+ * The first group of the pattern matches the text before an identifier and
+ * the second matches the identifier itself.  Go regular expressions cannot
+ * look ahead, so an identifier followed by another identifier character is
+ * skipped here, as it is part of a longer identifier.
+ */
+func replaceIdentifiers(text string, pattern *regexp.Regexp, replacements map[string]string) string {
+	var result bytes.Buffer
+	last := 0
+	for _, match := range pattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[4], match[5]
+		if identifierCharPattern.MatchString(text[end:]) {
+			continue
+		}
+		result.WriteString(text[last:start])
+		result.WriteString(replacements[text[start:end]])
+		last = end
+	}
+	result.WriteString(text[last:])
+	return result.String()
+}
@@ -0,0 +1,65 @@
+package utils_test
+
+import (
+	"github.com/greenplum-db/gpbackup/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/toc_rename tests", func() {
+	Describe("GetRenamedDependentName", func() {
+		It("replaces the name of the relation at the start of the name", func() {
+			Expect(utils.GetRenamedDependentName("public.foo", "public.foo_restored", "foo_i_seq")).To(Equal("foo_restored_i_seq"))
+		})
+		It("prepends the new name of the relation to any other name", func() {
+			Expect(utils.GetRenamedDependentName("public.foo", "public.foo_restored", "some_index")).To(Equal("foo_restored_some_index"))
+		})
+		It("quotes the new name if it requires quoting", func() {
+			Expect(utils.GetRenamedDependentName(`public."Foo"`, `public."Foo Restored"`, `"Foo_pkey"`)).To(Equal(`"Foo Restored_pkey"`))
+			Expect(utils.GetRenamedDependentName(`public."Foo"`, "public.foo_restored", `"Foo_pkey"`)).To(Equal("foo_restored_pkey"))
+		})
+	})
+	Describe("SubstituteRenamedRelationsInStatements", func() {
+		renameMap := map[string]string{"public.foo": "public.foo_restored"}
+		table := utils.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.foo (\n\ti integer DEFAULT nextval('public.foo_i_seq'::regclass) NOT NULL\n) DISTRIBUTED BY (i);\n\nCOMMENT ON TABLE public.foo IS 'public.foo';"}
+		sequence := utils.StatementWithType{Schema: "public", Name: "foo_i_seq", ObjectType: "SEQUENCE", ReferenceObject: "public.foo", Statement: "\n\nCREATE SEQUENCE public.foo_i_seq\n\tSTART WITH 1;\n\nSELECT pg_catalog.setval('public.foo_i_seq', 1, false);\n"}
+		sequenceOwner := utils.StatementWithType{Schema: "public", Name: "foo_i_seq", ObjectType: "SEQUENCE OWNER", ReferenceObject: "public.foo", Statement: "\n\nALTER SEQUENCE public.foo_i_seq OWNED BY public.foo.i;\n"}
+		constraint := utils.StatementWithType{Schema: "public", Name: "foo_pkey", ObjectType: "CONSTRAINT", ReferenceObject: "public.foo", Statement: "\n\nALTER TABLE ONLY public.foo ADD CONSTRAINT foo_pkey PRIMARY KEY (i);\n\nCOMMENT ON CONSTRAINT foo_pkey ON public.foo IS 'primary key';"}
+		index := utils.StatementWithType{Schema: "public", Name: "idx", ObjectType: "INDEX", ReferenceObject: "public.foo", Statement: "\n\nCREATE INDEX idx ON public.foo USING btree (i);\nALTER INDEX public.idx SET TABLESPACE test_tablespace;\nALTER TABLE public.foo CLUSTER ON idx;"}
+		It("renames a relation and the sequences, constraints, and indexes that depend on it", func() {
+			statements := utils.SubstituteRenamedRelationsInStatements([]utils.StatementWithType{table, sequence, sequenceOwner, constraint, index}, renameMap)
+			Expect(statements).To(Equal([]utils.StatementWithType{
+				{Schema: "public", Name: "foo_restored", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.foo_restored (\n\ti integer DEFAULT nextval('public.foo_restored_i_seq'::regclass) NOT NULL\n) DISTRIBUTED BY (i);\n\nCOMMENT ON TABLE public.foo_restored IS 'public.foo';"},
+				{Schema: "public", Name: "foo_restored_i_seq", ObjectType: "SEQUENCE", ReferenceObject: "public.foo_restored", Statement: "\n\nCREATE SEQUENCE public.foo_restored_i_seq\n\tSTART WITH 1;\n\nSELECT pg_catalog.setval('public.foo_restored_i_seq', 1, false);\n"},
+				{Schema: "public", Name: "foo_restored_i_seq", ObjectType: "SEQUENCE OWNER", ReferenceObject: "public.foo_restored", Statement: "\n\nALTER SEQUENCE public.foo_restored_i_seq OWNED BY public.foo_restored.i;\n"},
+				{Schema: "public", Name: "foo_restored_pkey", ObjectType: "CONSTRAINT", ReferenceObject: "public.foo_restored", Statement: "\n\nALTER TABLE ONLY public.foo_restored ADD CONSTRAINT foo_restored_pkey PRIMARY KEY (i);\n\nCOMMENT ON CONSTRAINT foo_restored_pkey ON public.foo_restored IS 'primary key';"},
+				{Schema: "public", Name: "foo_restored_idx", ObjectType: "INDEX", ReferenceObject: "public.foo_restored", Statement: "\n\nCREATE INDEX foo_restored_idx ON public.foo_restored USING btree (i);\nALTER INDEX public.foo_restored_idx SET TABLESPACE test_tablespace;\nALTER TABLE public.foo_restored CLUSTER ON foo_restored_idx;"},
+			}))
+		})
+		It("renames a relation referenced by a foreign key of another relation", func() {
+			foreignKey := utils.StatementWithType{Schema: "public", Name: "bar_i_fkey", ObjectType: "CONSTRAINT", ReferenceObject: "public.bar", Statement: "\n\nALTER TABLE ONLY public.bar ADD CONSTRAINT bar_i_fkey FOREIGN KEY (i) REFERENCES public.foo(i);\n"}
+			statements := utils.SubstituteRenamedRelationsInStatements([]utils.StatementWithType{foreignKey}, renameMap)
+			Expect(statements[0].Name).To(Equal("bar_i_fkey"))
+			Expect(statements[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.bar ADD CONSTRAINT bar_i_fkey FOREIGN KEY (i) REFERENCES public.foo_restored(i);\n"))
+		})
+		It("renames a relation in its statistics", func() {
+			statistics := utils.StatementWithType{Schema: "public", Name: "foo", ObjectType: "STATISTICS", Statement: "\n\nUPDATE pg_class\nSET\n\trelpages = 1::int,\n\treltuples = 1.000000::real\nWHERE oid = 'public.foo'::regclass::oid;\n\n\nDELETE FROM pg_statistic WHERE starelid = 'public.foo'::regclass::oid AND staattnum = 1;\n"}
+			statements := utils.SubstituteRenamedRelationsInStatements([]utils.StatementWithType{statistics}, renameMap)
+			Expect(statements[0].Statement).To(Equal("\n\nUPDATE pg_class\nSET\n\trelpages = 1::int,\n\treltuples = 1.000000::real\nWHERE oid = 'public.foo_restored'::regclass::oid;\n\n\nDELETE FROM pg_statistic WHERE starelid = 'public.foo_restored'::regclass::oid AND staattnum = 1;\n"))
+		})
+		It("does not rename a relation whose name begins with the name of a renamed relation", func() {
+			otherTable := utils.StatementWithType{Schema: "public", Name: "foobar", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.foobar (\n\ti integer\n) INHERITS (public.foo, otherschema.public.foo);\n"}
+			statements := utils.SubstituteRenamedRelationsInStatements([]utils.StatementWithType{otherTable}, renameMap)
+			Expect(statements[0]).To(Equal(utils.StatementWithType{Schema: "public", Name: "foobar", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.foobar (\n\ti integer\n) INHERITS (public.foo_restored, otherschema.public.foo);\n"}))
+		})
+		It("does not rename the constraints of another relation", func() {
+			otherConstraint := utils.StatementWithType{Schema: "public", Name: "foo_pkey", ObjectType: "CONSTRAINT", ReferenceObject: "public.baz", Statement: "\n\nALTER TABLE ONLY public.baz ADD CONSTRAINT foo_pkey PRIMARY KEY (i);\n"}
+			statements := utils.SubstituteRenamedRelationsInStatements([]utils.StatementWithType{constraint, otherConstraint}, renameMap)
+			Expect(statements[1]).To(Equal(otherConstraint))
+		})
+		It("returns the statements unchanged if no relations are renamed", func() {
+			statements := utils.SubstituteRenamedRelationsInStatements([]utils.StatementWithType{table}, map[string]string{})
+			Expect(statements).To(Equal([]utils.StatementWithType{table}))
+		})
+	})
+})
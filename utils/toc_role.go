@@ -0,0 +1,94 @@
+package utils
+
+/*
+ * This file contains functions related to restoring objects with different
+ * owners and privileges with gprestore --role-map, --no-owner, and
+ * --no-privileges.
+ */
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ownerPattern      = regexp.MustCompile(fmt.Sprintf(`(?m)^ALTER .* OWNER TO (%s);$`, IdentifierPattern))
+	grantPattern      = regexp.MustCompile(fmt.Sprintf(`(?m)^GRANT .* TO (PUBLIC|%s)(?: WITH GRANT OPTION)?;$`, IdentifierPattern))
+	revokePattern     = regexp.MustCompile(fmt.Sprintf(`(?m)^REVOKE .* FROM (PUBLIC|%s);$`, IdentifierPattern))
+	roleMemberPattern = regexp.MustCompile(fmt.Sprintf(`(?m)^GRANT (%s) TO (%s)(?: WITH ADMIN OPTION)? GRANTED BY (%s);$`, IdentifierPattern, IdentifierPattern, IdentifierPattern))
+)
+
+/*
+ * Roles are replaced in the owner, GRANT, and REVOKE statements of each
+ * object, including those for column privileges, and in role memberships.
+ * The new roles must already exist, so the statements that create the old
+ * roles are not restored.
+ */
+func SubstituteRolesInStatements(statements []StatementWithType, roleMap map[string]string) []StatementWithType {
+	if len(roleMap) == 0 {
+		return statements
+	}
+	substitutedStatements := make([]StatementWithType, 0, len(statements))
+	for _, statement := range statements {
+		if _, ok := roleMap[statement.Name]; ok && statement.ObjectType == "ROLE" {
+			continue
+		}
+		if statement.ObjectType == "ROLE GRANT" {
+			statement.Statement = replaceRoles(statement.Statement, roleMemberPattern, roleMap)
+			if newRole, ok := roleMap[statement.Name]; ok {
+				statement.Name = newRole
+			}
+		} else {
+			statement.Statement = replaceRoles(statement.Statement, ownerPattern, roleMap)
+			statement.Statement = replaceRoles(statement.Statement, grantPattern, roleMap)
+			statement.Statement = replaceRoles(statement.Statement, revokePattern, roleMap)
+		}
+		substitutedStatements = append(substitutedStatements, statement)
+	}
+	return substitutedStatements
+}
+
+// Each group of the pattern matches a role.
+func replaceRoles(text string, pattern *regexp.Regexp, roleMap map[string]string) string {
+	matches := pattern.FindAllStringSubmatchIndex(text, -1)
+	for i := len(matches) - 1; i >= 0; i-- {
+		for group := len(matches[i])/2 - 1; group >= 1; group-- {
+			start, end := matches[i][2*group], matches[i][2*group+1]
+			if newRole, ok := roleMap[text[start:end]]; ok {
+				text = text[:start] + newRole + text[end:]
+			}
+		}
+	}
+	return text
+}
+
+// Objects are owned by the user performing the restore.
+func RemoveOwnersFromStatements(statements []StatementWithType) []StatementWithType {
+	return removeLinesFromStatements(statements, ownerPattern)
+}
+
+/*
+ * Only the privileges on objects are removed, so that the default privileges
+ * on each object apply.  Role memberships are restored.
+ */
+func RemovePrivilegesFromStatements(statements []StatementWithType) []StatementWithType {
+	return removeLinesFromStatements(statements, grantPattern, revokePattern)
+}
+
+// A statement that consisted only of the removed lines is removed as well.
+func removeLinesFromStatements(statements []StatementWithType, patterns ...*regexp.Regexp) []StatementWithType {
+	filteredStatements := make([]StatementWithType, 0, len(statements))
+	for _, statement := range statements {
+		if statement.ObjectType != "ROLE GRANT" {
+			for _, pattern := range patterns {
+				statement.Statement = pattern.ReplaceAllString(statement.Statement, "")
+			}
+			if strings.TrimSpace(statement.Statement) == "" {
+				continue
+			}
+		}
+		filteredStatements = append(filteredStatements, statement)
+	}
+	return filteredStatements
+}
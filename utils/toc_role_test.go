@@ -0,0 +1,84 @@
+package utils_test
+
+import (
+	"github.com/greenplum-db/gpbackup/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/toc_role tests", func() {
+	role := utils.StatementWithType{Name: "prod_owner", ObjectType: "ROLE", Statement: "\n\nCREATE ROLE prod_owner;\nALTER ROLE prod_owner WITH NOSUPERUSER LOGIN;"}
+	roleGrant := utils.StatementWithType{Name: "prod_owner", ObjectType: "ROLE GRANT", Statement: "\nGRANT prod_readers TO prod_owner WITH ADMIN OPTION GRANTED BY gpadmin;"}
+	table := utils.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: `
+
+CREATE TABLE public.foo (
+	i integer
+) DISTRIBUTED BY (i);
+
+
+ALTER TABLE public.foo OWNER TO prod_owner;
+
+
+REVOKE ALL ON TABLE public.foo FROM PUBLIC;
+REVOKE ALL ON TABLE public.foo FROM prod_owner;
+GRANT ALL ON TABLE public.foo TO prod_owner;
+GRANT SELECT ON TABLE public.foo TO "Prod Readers" WITH GRANT OPTION;
+
+
+REVOKE ALL (i) ON TABLE public.foo FROM PUBLIC;
+GRANT UPDATE (i) ON TABLE public.foo TO prod_owner;
+`}
+	schemaMetadata := utils.StatementWithType{Name: "public", ObjectType: "SCHEMA", Statement: "\n\nALTER SCHEMA public OWNER TO prod_owner;\n"}
+	Describe("SubstituteRolesInStatements", func() {
+		It("replaces roles in owner, privilege, and role membership statements and leaves out the old roles", func() {
+			roleMap := map[string]string{"prod_owner": "dev_owner", `"Prod Readers"`: "dev_readers", "prod_readers": `"Dev Readers"`}
+			statements := utils.SubstituteRolesInStatements([]utils.StatementWithType{role, roleGrant, table, schemaMetadata}, roleMap)
+			Expect(statements).To(Equal([]utils.StatementWithType{
+				{Name: "dev_owner", ObjectType: "ROLE GRANT", Statement: "\nGRANT \"Dev Readers\" TO dev_owner WITH ADMIN OPTION GRANTED BY gpadmin;"},
+				{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: `
+
+CREATE TABLE public.foo (
+	i integer
+) DISTRIBUTED BY (i);
+
+
+ALTER TABLE public.foo OWNER TO dev_owner;
+
+
+REVOKE ALL ON TABLE public.foo FROM PUBLIC;
+REVOKE ALL ON TABLE public.foo FROM dev_owner;
+GRANT ALL ON TABLE public.foo TO dev_owner;
+GRANT SELECT ON TABLE public.foo TO dev_readers WITH GRANT OPTION;
+
+
+REVOKE ALL (i) ON TABLE public.foo FROM PUBLIC;
+GRANT UPDATE (i) ON TABLE public.foo TO dev_owner;
+`},
+				{Name: "public", ObjectType: "SCHEMA", Statement: "\n\nALTER SCHEMA public OWNER TO dev_owner;\n"},
+			}))
+		})
+		It("does not replace a role that is part of a longer role name", func() {
+			statements := utils.SubstituteRolesInStatements([]utils.StatementWithType{schemaMetadata}, map[string]string{"prod": "dev"})
+			Expect(statements).To(Equal([]utils.StatementWithType{schemaMetadata}))
+		})
+	})
+	Describe("RemoveOwnersFromStatements", func() {
+		It("removes owner statements and any statement that consisted only of them", func() {
+			statements := utils.RemoveOwnersFromStatements([]utils.StatementWithType{role, roleGrant, table, schemaMetadata})
+			Expect(statements).To(HaveLen(3))
+			Expect(statements[0]).To(Equal(role))
+			Expect(statements[1]).To(Equal(roleGrant))
+			Expect(statements[2].Statement).ToNot(ContainSubstring("OWNER TO"))
+			Expect(statements[2].Statement).To(ContainSubstring("GRANT ALL ON TABLE public.foo TO prod_owner;"))
+		})
+	})
+	Describe("RemovePrivilegesFromStatements", func() {
+		It("removes the GRANT and REVOKE statements on objects, including column privileges", func() {
+			statements := utils.RemovePrivilegesFromStatements([]utils.StatementWithType{roleGrant, table})
+			Expect(statements[0]).To(Equal(roleGrant))
+			Expect(statements[1].Statement).ToNot(ContainSubstring("GRANT"))
+			Expect(statements[1].Statement).ToNot(ContainSubstring("REVOKE"))
+			Expect(statements[1].Statement).To(ContainSubstring("ALTER TABLE public.foo OWNER TO prod_owner;"))
+		})
+	})
+})
@@ -0,0 +1,105 @@
+package utils
+
+/*
+ * This file contains functions related to restoring objects into different
+ * tablespaces with gprestore --tablespace-map and --no-tablespaces.
+ */
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/pkg/errors"
+)
+
+var (
+	tablespaceClausePattern   = regexp.MustCompile(fmt.Sprintf(`( (?:USING INDEX )?TABLESPACE )(%s)`, IdentifierPattern))
+	alterIndexTablespaceRegex = regexp.MustCompile(`\nALTER INDEX [^\n]* SET TABLESPACE [^\n]*;`)
+	tablespaceLocationPattern = regexp.MustCompile(` (FILESPACE|LOCATION) (.*);\s*$`)
+)
+
+/*
+ * A tablespace with a location is created at that location: a filespace for
+ * a backup taken on GPDB 4.3 or 5, or a directory for a backup taken on GPDB
+ * 6 or later.  A tablespace without a location must already exist, so its
+ * CREATE TABLESPACE statement and metadata are not restored.
+ */
+type TablespaceMapping struct {
+	Tablespace string
+	Location   string
+}
+
+/*
+ * Tablespace names are rewritten wherever they follow the TABLESPACE keyword,
+ * which covers the TABLESPACE clauses of CREATE TABLE, CREATE DATABASE, and
+ * constraint statements, the ALTER INDEX statements that move indexes into
+ * their tablespaces, and the statements on the tablespaces themselves.  Names
+ * in string literals and function bodies are left as they are.
+ */
+func SubstituteTablespacesInStatements(statements []StatementWithType, tablespaceMap map[string]TablespaceMapping) []StatementWithType {
+	if len(tablespaceMap) == 0 {
+		return statements
+	}
+	newNames := make(map[string]string, len(tablespaceMap))
+	for oldTablespace, mapping := range tablespaceMap {
+		newNames[oldTablespace] = mapping.Tablespace
+	}
+	tablespacePattern := regexp.MustCompile(fmt.Sprintf(`(\bTABLESPACE )(%s)`, getAlternation(newNames)))
+	substitutedStatements := make([]StatementWithType, 0, len(statements))
+	for _, statement := range statements {
+		if statement.ObjectType == "TABLESPACE" || statement.ObjectType == "TABLESPACE METADATA" {
+			mapping, ok := tablespaceMap[statement.Name]
+			if ok && mapping.Location == "" {
+				continue
+			}
+			if ok && statement.ObjectType == "TABLESPACE" {
+				statement.Statement = substituteTablespaceLocation(statement.Statement, statement.Name, mapping.Location)
+			}
+			if ok {
+				statement.Name = mapping.Tablespace
+			}
+		}
+		statement.Statement = replaceInObjectNames(statement.Statement, func(code string) string {
+			return replaceIdentifiers(code, tablespacePattern, newNames)
+		})
+		substitutedStatements = append(substitutedStatements, statement)
+	}
+	return substitutedStatements
+}
+
+func substituteTablespaceLocation(statement string, tablespace string, location string) string {
+	match := tablespaceLocationPattern.FindStringSubmatchIndex(statement)
+	if match == nil {
+		gplog.Fatal(errors.Errorf("Unable to determine the location of tablespace %s", tablespace), "")
+	}
+	if statement[match[2]:match[3]] == "FILESPACE" {
+		if !IsValidIdentifier(location) {
+			gplog.Fatal(errors.Errorf("Tablespace %s must be mapped to a filespace, quoted as it would be in SQL, but %s was specified", tablespace, location), "")
+		}
+	} else {
+		location = fmt.Sprintf("'%s'", strings.Replace(location, "'", "''", -1))
+	}
+	return statement[:match[4]] + location + statement[match[5]:]
+}
+
+/*
+ * Objects are restored into the default tablespace of the restore database,
+ * and the tablespaces themselves are not restored.  As when substituting
+ * tablespaces, string literals and function bodies are left as they are.
+ */
+func RemoveTablespacesFromStatements(statements []StatementWithType) []StatementWithType {
+	filteredStatements := make([]StatementWithType, 0, len(statements))
+	for _, statement := range statements {
+		if statement.ObjectType == "TABLESPACE" || statement.ObjectType == "TABLESPACE METADATA" {
+			continue
+		}
+		statement.Statement = replaceInObjectNames(statement.Statement, func(code string) string {
+			code = alterIndexTablespaceRegex.ReplaceAllString(code, "")
+			return tablespaceClausePattern.ReplaceAllString(code, "")
+		})
+		filteredStatements = append(filteredStatements, statement)
+	}
+	return filteredStatements
+}
@@ -0,0 +1,74 @@
+package utils_test
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/toc_tablespace tests", func() {
+	database := utils.StatementWithType{Name: "testdb", ObjectType: "DATABASE", Statement: "\n\nCREATE DATABASE testdb TEMPLATE template0 TABLESPACE test_tablespace ENCODING 'UTF8';"}
+	tablespace := utils.StatementWithType{Name: "test_tablespace", ObjectType: "TABLESPACE", Statement: "\n\nCREATE TABLESPACE test_tablespace FILESPACE test_filespace;"}
+	tablespaceMetadata := utils.StatementWithType{Name: "test_tablespace", ObjectType: "TABLESPACE METADATA", Statement: "\n\nCOMMENT ON TABLESPACE test_tablespace IS 'fast storage';"}
+	table := utils.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.foo (\n\ti integer\n) WITH (appendonly=true) TABLESPACE test_tablespace DISTRIBUTED BY (i);\n"}
+	otherTable := utils.StatementWithType{Schema: "public", Name: "bar", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.bar (\n\ti integer\n) TABLESPACE test_tablespace_2 DISTRIBUTED BY (i);\n"}
+	index := utils.StatementWithType{Schema: "public", Name: "idx", ObjectType: "INDEX", ReferenceObject: "public.foo", Statement: "\n\nCREATE INDEX idx ON public.foo USING btree (i);\nALTER INDEX public.idx SET TABLESPACE test_tablespace;\nALTER TABLE public.foo CLUSTER ON idx;"}
+	constraint := utils.StatementWithType{Schema: "public", Name: "foo_pkey", ObjectType: "CONSTRAINT", ReferenceObject: "public.foo", Statement: "\n\nALTER TABLE ONLY public.foo ADD CONSTRAINT foo_pkey PRIMARY KEY (i) USING INDEX TABLESPACE test_tablespace;"}
+	comment := utils.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE METADATA", Statement: "\n\nCOMMENT ON TABLE public.foo IS 'Moved from TABLESPACE test_tablespace';"}
+	function := utils.StatementWithType{Schema: "public", Name: "move_foo", ObjectType: "FUNCTION", Statement: "\n\nCREATE FUNCTION public.move_foo() RETURNS void AS $$ALTER TABLE public.foo SET TABLESPACE test_tablespace$$ LANGUAGE sql;"}
+	Describe("SubstituteTablespacesInStatements", func() {
+		It("renames the tablespace in each statement and leaves out the statements on a tablespace without a location", func() {
+			tablespaceMap := map[string]utils.TablespaceMapping{"test_tablespace": {Tablespace: "dr_tablespace"}}
+			statements := utils.SubstituteTablespacesInStatements([]utils.StatementWithType{database, tablespace, tablespaceMetadata, table, otherTable, index, constraint}, tablespaceMap)
+			Expect(statements).To(Equal([]utils.StatementWithType{
+				{Name: "testdb", ObjectType: "DATABASE", Statement: "\n\nCREATE DATABASE testdb TEMPLATE template0 TABLESPACE dr_tablespace ENCODING 'UTF8';"},
+				{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.foo (\n\ti integer\n) WITH (appendonly=true) TABLESPACE dr_tablespace DISTRIBUTED BY (i);\n"},
+				otherTable,
+				{Schema: "public", Name: "idx", ObjectType: "INDEX", ReferenceObject: "public.foo", Statement: "\n\nCREATE INDEX idx ON public.foo USING btree (i);\nALTER INDEX public.idx SET TABLESPACE dr_tablespace;\nALTER TABLE public.foo CLUSTER ON idx;"},
+				{Schema: "public", Name: "foo_pkey", ObjectType: "CONSTRAINT", ReferenceObject: "public.foo", Statement: "\n\nALTER TABLE ONLY public.foo ADD CONSTRAINT foo_pkey PRIMARY KEY (i) USING INDEX TABLESPACE dr_tablespace;"},
+			}))
+		})
+		It("does not rename the tablespace in string literals or function bodies", func() {
+			tablespaceMap := map[string]utils.TablespaceMapping{"test_tablespace": {Tablespace: "dr_tablespace"}}
+			statements := utils.SubstituteTablespacesInStatements([]utils.StatementWithType{comment, function}, tablespaceMap)
+			Expect(statements).To(Equal([]utils.StatementWithType{comment, function}))
+		})
+		It("creates a tablespace with a location in a new filespace", func() {
+			tablespaceMap := map[string]utils.TablespaceMapping{"test_tablespace": {Tablespace: "dr_tablespace", Location: "dr_filespace"}}
+			statements := utils.SubstituteTablespacesInStatements([]utils.StatementWithType{tablespace, tablespaceMetadata}, tablespaceMap)
+			Expect(statements).To(Equal([]utils.StatementWithType{
+				{Name: "dr_tablespace", ObjectType: "TABLESPACE", Statement: "\n\nCREATE TABLESPACE dr_tablespace FILESPACE dr_filespace;"},
+				{Name: "dr_tablespace", ObjectType: "TABLESPACE METADATA", Statement: "\n\nCOMMENT ON TABLESPACE dr_tablespace IS 'fast storage';"},
+			}))
+		})
+		It("creates a tablespace with a location in a new directory", func() {
+			locationTablespace := utils.StatementWithType{Name: "test_tablespace", ObjectType: "TABLESPACE", Statement: "\n\nCREATE TABLESPACE test_tablespace LOCATION '/data/tablespace';"}
+			tablespaceMap := map[string]utils.TablespaceMapping{"test_tablespace": {Tablespace: "test_tablespace", Location: "/dr/data/it's"}}
+			statements := utils.SubstituteTablespacesInStatements([]utils.StatementWithType{locationTablespace}, tablespaceMap)
+			Expect(statements).To(Equal([]utils.StatementWithType{
+				{Name: "test_tablespace", ObjectType: "TABLESPACE", Statement: "\n\nCREATE TABLESPACE test_tablespace LOCATION '/dr/data/it''s';"},
+			}))
+		})
+		It("panics if a tablespace in a filespace is mapped to a location that is not a filespace name", func() {
+			tablespaceMap := map[string]utils.TablespaceMapping{"test_tablespace": {Tablespace: "dr_tablespace", Location: "/data/tablespace"}}
+			defer testhelper.ShouldPanicWithMessage("Tablespace test_tablespace must be mapped to a filespace, quoted as it would be in SQL, but /data/tablespace was specified")
+			utils.SubstituteTablespacesInStatements([]utils.StatementWithType{tablespace}, tablespaceMap)
+		})
+	})
+	Describe("RemoveTablespacesFromStatements", func() {
+		It("removes the TABLESPACE clauses and the statements on tablespaces", func() {
+			statements := utils.RemoveTablespacesFromStatements([]utils.StatementWithType{database, tablespace, tablespaceMetadata, table, index, constraint})
+			Expect(statements).To(Equal([]utils.StatementWithType{
+				{Name: "testdb", ObjectType: "DATABASE", Statement: "\n\nCREATE DATABASE testdb TEMPLATE template0 ENCODING 'UTF8';"},
+				{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.foo (\n\ti integer\n) WITH (appendonly=true) DISTRIBUTED BY (i);\n"},
+				{Schema: "public", Name: "idx", ObjectType: "INDEX", ReferenceObject: "public.foo", Statement: "\n\nCREATE INDEX idx ON public.foo USING btree (i);\nALTER TABLE public.foo CLUSTER ON idx;"},
+				{Schema: "public", Name: "foo_pkey", ObjectType: "CONSTRAINT", ReferenceObject: "public.foo", Statement: "\n\nALTER TABLE ONLY public.foo ADD CONSTRAINT foo_pkey PRIMARY KEY (i);"},
+			}))
+		})
+		It("does not remove TABLESPACE clauses from string literals or function bodies", func() {
+			statements := utils.RemoveTablespacesFromStatements([]utils.StatementWithType{comment, function})
+			Expect(statements).To(Equal([]utils.StatementWithType{comment, function}))
+		})
+	})
+})
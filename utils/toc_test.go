@@ -327,6 +327,56 @@ COMMENT ON DATABASE "db-special-chär$" IS 'this is a database comment';`}
 `))
 		})
 	})
+	Context("SubstituteRedirectSchemasInStatements", func() {
+		schemaMap := map[string]string{"oldschema": "newschema", `"Old Schema"`: "other"}
+		It("substitutes the schema in qualified names and reference objects", func() {
+			index := utils.StatementWithType{Schema: "oldschema", Name: "someindex", ObjectType: "INDEX", ReferenceObject: "oldschema.foo", Statement: "\n\nCREATE INDEX someindex ON oldschema.foo USING btree (i);\n"}
+			statements := utils.SubstituteRedirectSchemasInStatements([]utils.StatementWithType{index}, schemaMap)
+			Expect(statements).To(Equal([]utils.StatementWithType{{Schema: "newschema", Name: "someindex", ObjectType: "INDEX", ReferenceObject: "newschema.foo", Statement: "\n\nCREATE INDEX someindex ON newschema.foo USING btree (i);\n"}}))
+		})
+		It("substitutes the schema in sequence defaults and privileges", func() {
+			table := utils.StatementWithType{Schema: "oldschema", Name: "foo", ObjectType: "TABLE", Statement: "\n\nALTER TABLE ONLY oldschema.foo ALTER COLUMN i SET DEFAULT nextval('oldschema.foo_i_seq'::regclass);\n\nSELECT pg_catalog.setval('oldschema.foo_i_seq', 1, false);\n\nGRANT ALL ON oldschema.foo TO testrole;\n"}
+			statements := utils.SubstituteRedirectSchemasInStatements([]utils.StatementWithType{table}, schemaMap)
+			Expect(statements[0].Statement).To(Equal("\n\nALTER TABLE ONLY newschema.foo ALTER COLUMN i SET DEFAULT nextval('newschema.foo_i_seq'::regclass);\n\nSELECT pg_catalog.setval('newschema.foo_i_seq', 1, false);\n\nGRANT ALL ON newschema.foo TO testrole;\n"))
+		})
+		It("substitutes the schema in statements on the schema itself", func() {
+			schema := utils.StatementWithType{Name: "oldschema", ObjectType: "SCHEMA", Statement: "\n\nCREATE SCHEMA oldschema;\n\nALTER SCHEMA oldschema OWNER TO testrole;\n\nGRANT ALL ON SCHEMA oldschema TO testrole;"}
+			statements := utils.SubstituteRedirectSchemasInStatements([]utils.StatementWithType{schema}, schemaMap)
+			Expect(statements).To(Equal([]utils.StatementWithType{{Name: "newschema", ObjectType: "SCHEMA", Statement: "\n\nCREATE SCHEMA newschema;\n\nALTER SCHEMA newschema OWNER TO testrole;\n\nGRANT ALL ON SCHEMA newschema TO testrole;"}}))
+		})
+		It("substitutes a quoted schema", func() {
+			view := utils.StatementWithType{Schema: `"Old Schema"`, Name: "v", ObjectType: "VIEW", Statement: `CREATE VIEW "Old Schema".v AS SELECT * FROM "Old Schema".foo;`}
+			statements := utils.SubstituteRedirectSchemasInStatements([]utils.StatementWithType{view}, schemaMap)
+			Expect(statements[0].Schema).To(Equal("other"))
+			Expect(statements[0].Statement).To(Equal("CREATE VIEW other.v AS SELECT * FROM other.foo;"))
+		})
+		It("does not substitute a schema that is part of a longer identifier", func() {
+			view := utils.StatementWithType{Schema: "public", Name: "v", ObjectType: "VIEW", Statement: `CREATE VIEW public.v AS SELECT my_oldschema.foo.i, public.oldschema.j, "x oldschema".k FROM public.oldschema_view;`}
+			statements := utils.SubstituteRedirectSchemasInStatements([]utils.StatementWithType{view}, schemaMap)
+			Expect(statements[0]).To(Equal(view))
+		})
+		It("does not substitute the schema in string literals or function bodies", func() {
+			function := utils.StatementWithType{Schema: "oldschema", Name: "f", ObjectType: "FUNCTION", Statement: "CREATE FUNCTION oldschema.f() RETURNS text AS $_$SELECT 'oldschema.foo' FROM oldschema.foo$_$ LANGUAGE sql;\n\nCOMMENT ON FUNCTION oldschema.f() IS 'Reads oldschema.foo, which isn''t in SCHEMA oldschema';"}
+			statements := utils.SubstituteRedirectSchemasInStatements([]utils.StatementWithType{function}, schemaMap)
+			Expect(statements[0].Statement).To(Equal("CREATE FUNCTION newschema.f() RETURNS text AS $_$SELECT 'oldschema.foo' FROM oldschema.foo$_$ LANGUAGE sql;\n\nCOMMENT ON FUNCTION newschema.f() IS 'Reads oldschema.foo, which isn''t in SCHEMA oldschema';"))
+		})
+		It("substitutes the schema in statistics that name the relation in a literal", func() {
+			stats := utils.StatementWithType{Schema: "oldschema", Name: "foo", ObjectType: "STATISTICS", Statement: "UPDATE pg_class\nSET\n\trelpages = 1::int,\n\treltuples = 1.000000::real\nWHERE oid = 'oldschema.foo'::regclass::oid;"}
+			statements := utils.SubstituteRedirectSchemasInStatements([]utils.StatementWithType{stats}, schemaMap)
+			Expect(statements[0].Statement).To(Equal("UPDATE pg_class\nSET\n\trelpages = 1::int,\n\treltuples = 1.000000::real\nWHERE oid = 'newschema.foo'::regclass::oid;"))
+		})
+		It("returns the statements unchanged if no schemas are redirected", func() {
+			table := utils.StatementWithType{Schema: "oldschema", Name: "foo", ObjectType: "TABLE", Statement: "CREATE TABLE oldschema.foo (i int);"}
+			statements := utils.SubstituteRedirectSchemasInStatements([]utils.StatementWithType{table}, map[string]string{})
+			Expect(statements).To(Equal([]utils.StatementWithType{table}))
+		})
+	})
+	Context("SubstituteRedirectSchemasInFQNs", func() {
+		It("substitutes the schema of each redirected relation", func() {
+			fqns := utils.SubstituteRedirectSchemasInFQNs([]string{"oldschema.foo", "public.bar"}, map[string]string{"oldschema": "newschema"})
+			Expect(fqns).To(Equal([]string{"newschema.foo", "public.bar"}))
+		})
+	})
 	Describe("RemoveActiveRoles", func() {
 		user1 := utils.StatementWithType{Name: "user1", ObjectType: "ROLE", Statement: "CREATE ROLE user1 SUPERUSER;\n"}
 		user2 := utils.StatementWithType{Name: "user2", ObjectType: "ROLE", Statement: "CREATE ROLE user2;\n"}
@@ -341,4 +391,75 @@ COMMENT ON DATABASE "db-special-chär$" IS 'this is a database comment';`}
 			Expect(resultStatements).To(Equal([]utils.StatementWithType{user1, user2}))
 		})
 	})
+	Describe("AddIncrementalDataEntry", func() {
+		It("sets the timestamp of an entry from the previous backup", func() {
+			toc := &utils.TOC{}
+			toc.AddIncrementalDataEntry(utils.MasterDataEntry{Schema: "public", Name: "foo", Oid: 1, AttributeString: "(i)", RowsCopied: 5}, "20170101010101")
+			Expect(toc.DataEntries).To(Equal([]utils.MasterDataEntry{{Schema: "public", Name: "foo", Oid: 1, AttributeString: "(i)", RowsCopied: 5, Timestamp: "20170101010101"}}))
+		})
+		It("keeps the timestamp of an entry that refers to an earlier backup", func() {
+			toc := &utils.TOC{}
+			toc.AddIncrementalDataEntry(utils.MasterDataEntry{Schema: "public", Name: "foo", Oid: 1, Timestamp: "20160101010101"}, "20170101010101")
+			Expect(toc.DataEntries).To(Equal([]utils.MasterDataEntry{{Schema: "public", Name: "foo", Oid: 1, Timestamp: "20160101010101"}}))
+		})
+	})
+	Describe("GetDataEntriesForTimestamp", func() {
+		current := utils.MasterDataEntry{Schema: "public", Name: "foo", Oid: 1}
+		previous := utils.MasterDataEntry{Schema: "public", Name: "bar", Oid: 2, Timestamp: "20170101010101"}
+		It("returns the entries for the current backup", func() {
+			Expect(utils.GetDataEntriesForTimestamp([]utils.MasterDataEntry{current, previous}, "")).To(Equal([]utils.MasterDataEntry{current}))
+		})
+		It("returns the entries for a previous backup", func() {
+			Expect(utils.GetDataEntriesForTimestamp([]utils.MasterDataEntry{current, previous}, "20170101010101")).To(Equal([]utils.MasterDataEntry{previous}))
+		})
+		It("returns an empty list if no entries match", func() {
+			Expect(utils.GetDataEntriesForTimestamp([]utils.MasterDataEntry{current}, "20170101010101")).To(BeEmpty())
+		})
+	})
+	Describe("GetIncrementalTimestamps", func() {
+		It("returns the distinct timestamps of previous backups in ascending order", func() {
+			dataEntries := []utils.MasterDataEntry{
+				{Name: "foo"},
+				{Name: "bar", Timestamp: "20170102010101"},
+				{Name: "baz", Timestamp: "20170101010101"},
+				{Name: "qux", Timestamp: "20170102010101"},
+			}
+			Expect(utils.GetIncrementalTimestamps(dataEntries)).To(Equal([]string{"20170101010101", "20170102010101"}))
+		})
+		It("returns an empty list for a backup that is not incremental", func() {
+			Expect(utils.GetIncrementalTimestamps([]utils.MasterDataEntry{{Name: "foo"}})).To(BeEmpty())
+		})
+	})
+	Describe("AssignDataStreams", func() {
+		It("assigns tables to streams round-robin in oid order", func() {
+			streams := utils.AssignDataStreams([]uint32{30, 10, 50, 20, 40}, 2)
+			Expect(streams).To(Equal(map[uint32]int{10: 0, 20: 1, 30: 0, 40: 1, 50: 0}))
+		})
+		It("assigns all tables to the first stream if there is only one stream", func() {
+			streams := utils.AssignDataStreams([]uint32{2, 1}, 1)
+			Expect(streams).To(Equal(map[uint32]int{1: 0, 2: 0}))
+		})
+		It("leaves streams empty if there are more streams than tables", func() {
+			streams := utils.AssignDataStreams([]uint32{2, 1}, 4)
+			Expect(streams).To(Equal(map[uint32]int{1: 0, 2: 1}))
+		})
+	})
+	Describe("GetDataEntriesByStream", func() {
+		It("groups entries by stream in oid order", func() {
+			dataEntries := []utils.MasterDataEntry{
+				{Name: "foo", Oid: 3, Stream: 0},
+				{Name: "bar", Oid: 4, Stream: 2},
+				{Name: "baz", Oid: 1, Stream: 0},
+			}
+			Expect(utils.GetDataEntriesByStream(dataEntries)).To(Equal([][]utils.MasterDataEntry{
+				{{Name: "baz", Oid: 1, Stream: 0}, {Name: "foo", Oid: 3, Stream: 0}},
+				{},
+				{{Name: "bar", Oid: 4, Stream: 2}},
+			}))
+		})
+		It("puts entries from a backup without streams in the first stream", func() {
+			dataEntries := []utils.MasterDataEntry{{Name: "foo", Oid: 1}, {Name: "bar", Oid: 2}}
+			Expect(utils.GetDataEntriesByStream(dataEntries)).To(Equal([][]utils.MasterDataEntry{dataEntries}))
+		})
+	})
 })
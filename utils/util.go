@@ -44,11 +44,31 @@ func DollarQuoteString(literal string) string {
 	return quoteStr + literal + quoteStr
 }
 
+/*
+ * Wraps a string in single quotes for use as a single word in a shell
+ * command, escaping any single quotes it contains.
+ */
+func ShellQuote(str string) string {
+	return fmt.Sprintf("'%s'", strings.Replace(str, "'", `'\''`, -1))
+}
+
 // This function assumes that all identifiers are already appropriately quoted
 func MakeFQN(schema string, object string) string {
 	return fmt.Sprintf("%s.%s", schema, object)
 }
 
+/*
+ * Matches an identifier quoted as it would be in SQL, either an identifier that
+ * needs no quoting or one in double quotes, for use in larger patterns.
+ */
+const IdentifierPattern = `(?:"(?:[^"]|"")+"|[a-z_][a-z0-9_$]*)`
+
+var validIdentifier = regexp.MustCompile(fmt.Sprintf(`^%s$`, IdentifierPattern))
+
+func IsValidIdentifier(identifier string) bool {
+	return validIdentifier.MatchString(identifier)
+}
+
 func ValidateFQNs(fqns []string) {
 	unquotedIdentString := "[a-z_][a-z0-9_]*"
 	validIdentString := fmt.Sprintf("(?:\"(.*)\"|(%s))", unquotedIdentString)
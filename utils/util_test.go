@@ -47,6 +47,26 @@ var _ = Describe("utils/util tests", func() {
 			Expect(actual).To(Equal(expected))
 		})
 	})
+	Context("ShellQuote", func() {
+		It("wraps a string in single quotes", func() {
+			Expect(utils.ShellQuote("/data/backups/my dir")).To(Equal(`'/data/backups/my dir'`))
+		})
+		It("escapes single quotes in the string", func() {
+			Expect(utils.ShellQuote("/data/it's; rm -rf /")).To(Equal(`'/data/it'\''s; rm -rf /'`))
+		})
+	})
+	Context("IsValidIdentifier", func() {
+		It("accepts unquoted and quoted identifiers", func() {
+			Expect(utils.IsValidIdentifier("my_schema$1")).To(BeTrue())
+			Expect(utils.IsValidIdentifier(`"My ""Schema"""`)).To(BeTrue())
+		})
+		It("rejects identifiers that are not quoted as they would be in SQL", func() {
+			Expect(utils.IsValidIdentifier("MySchema")).To(BeFalse())
+			Expect(utils.IsValidIdentifier("my schema")).To(BeFalse())
+			Expect(utils.IsValidIdentifier(`"my"schema"`)).To(BeFalse())
+			Expect(utils.IsValidIdentifier("")).To(BeFalse())
+		})
+	})
 	Describe("ValidateFQNs", func() {
 		It("validates an unquoted string", func() {
 			testStrings := []string{`schemaname.tablename`}
@@ -0,0 +1,109 @@
+package utils
+
+/*
+ * This file contains structs and functions shared by gprestore --verify-only
+ * and the gpbackup_helper verification agent.
+ */
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * The verification agent reports one DataFileVerification per table on
+ * stdout.  Size and Checksum describe the data file itself when each table
+ * has its own data file, and the table's byte range of the uncompressed data
+ * when all tables are in a single data file.
+ */
+type DataFileVerification struct {
+	Oid      uint32
+	Size     int64
+	Checksum string
+	Rows     int64
+	Error    string
+}
+
+func (verification DataFileVerification) String() string {
+	if verification.Error != "" {
+		return fmt.Sprintf("%d error %s", verification.Oid, verification.Error)
+	}
+	return fmt.Sprintf("%d %d %s %d", verification.Oid, verification.Size, verification.Checksum, verification.Rows)
+}
+
+// Lines that are not in the format written by DataFileVerification.String() are ignored.
+func ParseDataFileVerifications(output string) map[uint32]DataFileVerification {
+	verifications := make(map[uint32]DataFileVerification, 0)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 4)
+		if len(fields) < 3 {
+			continue
+		}
+		oid, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			continue
+		}
+		verification := DataFileVerification{Oid: uint32(oid)}
+		if fields[1] == "error" {
+			verification.Error = strings.Join(fields[2:], " ")
+			verifications[verification.Oid] = verification
+			continue
+		}
+		if len(fields) != 4 {
+			continue
+		}
+		verification.Size, err = strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		verification.Checksum = fields[2]
+		verification.Rows, err = strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			continue
+		}
+		verifications[verification.Oid] = verification
+	}
+	return verifications
+}
+
+/*
+ * Counts the rows in data written by COPY ... WITH CSV.  Quoted fields may
+ * contain newlines, so a newline only ends a row if it is outside of quotes;
+ * an escaped quote is written as two quotes, which leaves the quoting state
+ * unchanged.
+ */
+func CountCSVRows(reader io.Reader) (int64, error) {
+	bufReader := bufio.NewReader(reader)
+	var numRows int64
+	inQuotes := false
+	endsWithNewline := true
+	for {
+		char, err := bufReader.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return numRows, err
+		}
+		switch char {
+		case '"':
+			inQuotes = !inQuotes
+		case '\n':
+			if !inQuotes {
+				numRows++
+			}
+		}
+		endsWithNewline = char == '\n'
+	}
+	if inQuotes {
+		return numRows, errors.New("Data ends within a quoted field")
+	}
+	if !endsWithNewline {
+		numRows++
+	}
+	return numRows, nil
+}
@@ -0,0 +1,55 @@
+package utils_test
+
+import (
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/verify tests", func() {
+	Describe("CountCSVRows", func() {
+		It("counts one row per line", func() {
+			rows, err := utils.CountCSVRows(strings.NewReader("1,a\n2,b\n3,c\n"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rows).To(Equal(int64(3)))
+		})
+		It("counts a final row without a trailing newline", func() {
+			rows, err := utils.CountCSVRows(strings.NewReader("1,a\n2,b"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rows).To(Equal(int64(2)))
+		})
+		It("does not count newlines within quoted fields", func() {
+			rows, err := utils.CountCSVRows(strings.NewReader("1,\"a\nb\"\n2,\"c \"\"quoted\"\"\nd\"\n"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rows).To(Equal(int64(2)))
+		})
+		It("counts no rows in empty data", func() {
+			rows, err := utils.CountCSVRows(strings.NewReader(""))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rows).To(Equal(int64(0)))
+		})
+		It("returns an error if the data ends within a quoted field", func() {
+			_, err := utils.CountCSVRows(strings.NewReader("1,\"a\n2,b\n"))
+			Expect(err).To(MatchError("Data ends within a quoted field"))
+		})
+	})
+	Describe("DataFileVerification", func() {
+		It("formats and parses a successful verification", func() {
+			verification := utils.DataFileVerification{Oid: 3456, Size: 100, Checksum: "aaaa", Rows: 10}
+			Expect(verification.String()).To(Equal("3456 100 aaaa 10"))
+			Expect(utils.ParseDataFileVerifications(verification.String())).To(Equal(map[uint32]utils.DataFileVerification{3456: verification}))
+		})
+		It("formats and parses a failed verification", func() {
+			verification := utils.DataFileVerification{Oid: 3456, Error: "Cannot access data file /tmp/foo"}
+			Expect(verification.String()).To(Equal("3456 error Cannot access data file /tmp/foo"))
+			Expect(utils.ParseDataFileVerifications(verification.String())).To(Equal(map[uint32]utils.DataFileVerification{3456: verification}))
+		})
+		It("ignores lines that are not verification results", func() {
+			output := "3456 100 aaaa 10\n20170101:01:01:01 gpbackup_helper:gpadmin:host:000000-[CRITICAL]:-Segment 0: error\n"
+			Expect(utils.ParseDataFileVerifications(output)).To(HaveLen(1))
+		})
+	})
+})